@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+
+	appconfig "github.com/user/s3cpbp/internal/config"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/s3copy"
+	"github.com/user/s3cpbp/internal/transfer"
+	"github.com/user/s3cpbp/internal/upload"
+)
+
+// runCopy copies the sources to the S3 target of the configuration, server-side unless streaming is required,
+// with the same listing, worker pool, retry policy and adaptive concurrency as downloads
+func runCopy(ctx context.Context, cfg *appconfig.Config) {
+	target := *cfg.Target
+	targetClient := newClientCache(ctx, cfg.TargetClient).get(target.Bucket)
+	clients := newClientCache(ctx, cfg.Client)
+	r := newRun(cfg, "Copied", "objects")
+
+	// Unchanged objects are found by comparing them with a listing of the target, taken before copying
+	remote, ok := r.remote(ctx, cfg, targetClient, target)
+	if !ok {
+		return
+	}
+
+	// Streamed copies pass through this machine, server-side copies only need the target's client
+	var uploader upload.Uploader
+	if cfg.StreamCopy {
+		uploader = upload.CreateUploader(targetClient, cfg.PartSize)
+		log.Printf("Copying through this machine, the destination cannot read the sources server-side")
+	}
+
+	// All sources copy within one concurrency budget
+	concurrency := transfer.NewConcurrency(cfg.Concurrency, cfg.MinConcurrency, cfg.MaxConcurrency)
+
+	listErrChans := make([]<-chan error, len(cfg.Sources))
+	for i, location := range cfg.Sources {
+		client := clients.get(location.Bucket)
+		objects := objectSource(cfg, location, clients, r.retry)
+
+		// Channel to communicate objects to be copied, the listing's result is checked once all workers are done
+		foundFilesChan := make(chan s3ops.ObjectInfo, 1000)
+		listErrChans[i] = r.list(ctx, objects, cfg.Filter.Match, foundFilesChan)
+
+		// Start enough workers for the highest concurrency, the controller decides how many copy at once
+		for j := 0; j < cfg.MaxConcurrency; j++ {
+			r.wg.Add(1)
+			worker := s3copy.Worker{
+				ID:            i*cfg.MaxConcurrency + j,
+				Source:        client,
+				Bucket:        location.Bucket,
+				Destination:   targetClient,
+				Uploader:      uploader,
+				Stream:        cfg.StreamCopy,
+				TargetBucket:  target.Bucket,
+				TargetPrefix:  upload.Key(target.Prefix, filepath.ToSlash(location.Subdir)),
+				PartSize:      cfg.PartSize,
+				FilesChan:     foundFilesChan,
+				WaitGroup:     &r.wg,
+				TotalFiles:    &r.total,
+				FinishedFiles: &r.finished,
+				SkippedFiles:  &r.skipped,
+				Sync:          cfg.Sync,
+				Remote:        remote,
+				Verify:        cfg.Verify,
+				Options:       cfg.Write,
+				Retry:         r.retry,
+				Concurrency:   concurrency,
+				Results:       &r.results,
+			}
+			go worker.Start(ctx)
+		}
+	}
+
+	// Wait for all workers to finish
+	listErrs := r.wait(listErrChans)
+	if r.interrupted(ctx) {
+		return
+	}
+
+	// Report failed objects, and listings that did not complete as some objects were never seen
+	where := "from " + describeSources(cfg.Sources) + " to " + target.String()
+	failed := r.failed(where)
+	for i, listErr := range listErrs {
+		failed = r.incomplete("Listing", cfg.Sources[i], listErr) || failed
+	}
+	if failed {
+		exitFunc(1)
+		return
+	}
+
+	r.done(where, "")
+}
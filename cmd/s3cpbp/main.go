@@ -2,100 +2,243 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"sync"
-	"sync/atomic"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	appconfig "github.com/user/s3cpbp/internal/config"
 	"github.com/user/s3cpbp/internal/download"
+	"github.com/user/s3cpbp/internal/mirror"
+	"github.com/user/s3cpbp/internal/retry"
 	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/source"
+	"github.com/user/s3cpbp/internal/transfer"
 )
 
 // Set during build by -ldflags
 var version = "dev"
 
+// exitFunc allows tests to intercept the process exit status
+var exitFunc = os.Exit
+
 // parseConfigFunc allows for easier testing by mocking config parsing
 var parseConfigFunc = appconfig.Parse
 
 // initializeS3Client allows for easier testing by mocking the client initialization
-var initializeS3Client = func(bucket string) (*s3.Client, error) {
-	// Setup initial AWS client with default configuration
-	defaultAwsCfg, err := config.LoadDefaultConfig(context.Background())
-	if err != nil {
-		return nil, err
-	}
+var initializeS3Client = s3ops.NewClient
+
+// handleSignals cancels the run on the first SIGINT/SIGTERM and forces an exit on the second one
+func handleSignals(cancel context.CancelFunc) (stop func()) {
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case sig := <-sigChan:
+			log.Printf("Received %v, stopping transfers (send again to force exit)", sig)
+			cancel()
+		}
 
-	// Create a temporary S3 client to get the bucket location
-	tempClient := s3.NewFromConfig(defaultAwsCfg)
+		select {
+		case <-done:
+		case sig := <-sigChan:
+			log.Printf("Received %v again, forcing exit", sig)
+			exitFunc(130)
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+	}
+}
 
-	// Get the bucket's region
-	region, err := s3ops.GetBucketRegion(tempClient, bucket)
+func main() {
+	// Parse configuration
+	cfg, showVersion, err := parseConfigFunc(os.Args[1:], version)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		return nil, err
+		log.Printf("Invalid configuration: %v", err)
+		exitFunc(2)
+		return
+	}
+	if showVersion {
+		return
 	}
 
-	log.Printf("Bucket '%s' is in region '%s'", bucket, region)
+	// Root context, cancelled on SIGINT/SIGTERM
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopSignals := handleSignals(cancel)
+	defer stopSignals()
 
-	// Create a new AWS config with the correct region
-	awsCfg, err := config.LoadDefaultConfig(context.Background(),
-		config.WithRegion(region),
-	)
-	if err != nil {
-		return nil, err
+	// Uploads walk a local directory instead of listing buckets
+	if cfg.Upload != "" {
+		runUpload(ctx, cfg)
+		return
 	}
 
-	// Create and return S3 client with the correct region
-	return s3.NewFromConfig(awsCfg), nil
-}
+	// Copies write to another bucket instead of the local disk
+	if cfg.Target != nil {
+		runCopy(ctx, cfg)
+		return
+	}
 
-func main() {
-	// Parse configuration
-	cfg, showVersion := parseConfigFunc(version)
-	if showVersion {
+	// Dry runs write the plan of the download instead of touching the destination
+	if cfg.DryRun {
+		runPlan(ctx, cfg)
 		return
 	}
 
-	// Initialize S3 client with region detection
-	client, err := initializeS3Client(cfg.Bucket)
+	// Remove temporary files left behind by an earlier run that crashed or was killed
+	removed, err := download.CleanPartialFiles(cfg.Destination)
 	if err != nil {
-		log.Fatalf("Failed to initialize S3 client: %v", err)
-	}
-
-	// Create downloader from client
-	downloader := download.CreateDownloader(client)
-
-	// Setup counters
-	var (
-		totalFiles    atomic.Int64
-		finishedFiles atomic.Int64
-		wg            sync.WaitGroup
-	)
-
-	// Channel to communicate files to be downloaded
-	foundFilesChan := make(chan string, 1000)
-
-	// Start listing files
-	go s3ops.ListFiles(client, cfg.Bucket, cfg.Prefix, foundFilesChan, &totalFiles)
-
-	// Start worker pool for downloading
-	for i := 0; i < cfg.Concurrency; i++ {
-		wg.Add(1)
-		worker := download.Worker{
-			ID:            i,
-			Downloader:    downloader,
-			Bucket:        cfg.Bucket,
-			Destination:   cfg.Destination,
-			FilesChan:     foundFilesChan,
-			WaitGroup:     &wg,
-			TotalFiles:    &totalFiles,
-			FinishedFiles: &finishedFiles,
+		log.Fatalf("Failed to clean up partial files in %s: %v", cfg.Destination, err)
+	}
+	if removed > 0 {
+		log.Printf("Removed %d stale partial files from %s", removed, cfg.Destination)
+	}
+
+	clients := newClientCache(ctx, cfg.Client)
+	r := newRun(cfg, "Downloaded", "files")
+
+	// Mirroring records every listed object, to tell which files no longer have one
+	var listed *mirror.Listed
+	if cfg.Delete {
+		listed = &mirror.Listed{}
+	}
+
+	// All sources download within one concurrency budget
+	concurrency := transfer.NewConcurrency(cfg.Concurrency, cfg.MinConcurrency, cfg.MaxConcurrency)
+
+	listErrChans := make([]<-chan error, len(cfg.Sources))
+	for i, location := range cfg.Sources {
+		client := clients.get(location.Bucket)
+		downloader := download.CreateDownloader(client)
+		objects := objectSource(cfg, location, clients, r.retry)
+
+		// Channel to communicate files to be downloaded
+		foundFilesChan := make(chan s3ops.ObjectInfo, 1000)
+
+		// Start listing files, the result is checked once all workers are done
+		include := cfg.Filter.Match
+		if listed != nil {
+			include = listed.Track(location.Subdir, include)
+		}
+		listErrChans[i] = r.list(ctx, objects, include, foundFilesChan)
+
+		// Start enough workers for the highest concurrency, the controller decides how many download at once
+		for j := 0; j < cfg.MaxConcurrency; j++ {
+			r.wg.Add(1)
+			worker := download.Worker{
+				ID:              i*cfg.MaxConcurrency + j,
+				Downloader:      downloader,
+				Bucket:          location.Bucket,
+				Destination:     filepath.Join(cfg.Destination, location.Subdir),
+				FilesChan:       foundFilesChan,
+				WaitGroup:       &r.wg,
+				TotalFiles:      &r.total,
+				FinishedFiles:   &r.finished,
+				SkippedFiles:    &r.skipped,
+				Sync:            cfg.Sync,
+				Verify:          cfg.Verify,
+				HeadClient:      client,
+				ResumeThreshold: cfg.ResumeThreshold,
+				Retry:           r.retry,
+				Concurrency:     concurrency,
+				Results:         &r.results,
+			}
+			go worker.Start(ctx)
 		}
-		go worker.Start()
 	}
 
 	// Wait for all workers to finish
-	wg.Wait()
-	log.Printf("All done! Downloaded %d files from S3 bucket '%s'", finishedFiles.Load(), cfg.Bucket)
+	listErrs := r.wait(listErrChans)
+	if r.interrupted(ctx) {
+		return
+	}
+
+	// Report failed objects, and listings that did not complete as some objects were never seen
+	where := "from " + describeSources(cfg.Sources)
+	failed := r.failed(where)
+	listFailed := false
+	for i, listErr := range listErrs {
+		listFailed = r.incomplete("Listing", cfg.Sources[i], listErr) || listFailed
+	}
+	failed = failed || listFailed
+
+	// Files are only deleted when the listings are complete, an object missing from them may still exist
+	deleted := 0
+	if cfg.Delete && listFailed {
+		log.Printf("Not deleting any files from %s, the listings are incomplete", cfg.Destination)
+	} else if cfg.Delete {
+		if deleted, err = deleteExtraneous(ctx, cfg, listed); err != nil {
+			log.Printf("Mirroring %s did not complete, %d files deleted: %v", cfg.Destination, deleted, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		exitFunc(1)
+		return
+	}
+
+	if cfg.Delete && !cfg.DeleteDryRun {
+		r.done(where, fmt.Sprintf(", deleted %d", deleted))
+		return
+	}
+	r.done(where, "")
+}
+
+// objectSource returns where the objects of a location come from: a manifest or an inventory report
+// when one is given, otherwise listing the bucket
+func objectSource(cfg *appconfig.Config, location appconfig.Location, clients *clientCache, retryPolicy retry.Policy) source.Source {
+	client := clients.get(location.Bucket)
+	if cfg.FromFile != "" {
+		return &source.Manifest{
+			Path:   cfg.FromFile,
+			Format: cfg.FromFileFormat,
+			Bucket: location.Bucket,
+			Prefix: location.Prefix,
+			Input:  os.Stdin,
+		}
+	}
+	if cfg.Inventory != "" {
+		// Reports are usually delivered to another bucket, which may be in another region
+		inventoryClient := client
+		if bucket := source.InventoryBucket(cfg.Inventory); bucket != "" {
+			inventoryClient = clients.get(bucket)
+		}
+		return &source.Inventory{
+			Manifest: cfg.Inventory,
+			Client:   inventoryClient,
+			Bucket:   location.Bucket,
+			Prefix:   location.Prefix,
+		}
+	}
+	return &source.Listing{
+		Client:      client,
+		Bucket:      location.Bucket,
+		Prefix:      location.Prefix,
+		Retry:       retryPolicy,
+		Concurrency: cfg.ListConcurrency,
+	}
+}
+
+// describeSources names the sources of a run for the summary
+func describeSources(sources []appconfig.Location) string {
+	if len(sources) == 1 {
+		return fmt.Sprintf("S3 bucket '%s'", sources[0].Bucket)
+	}
+	return fmt.Sprintf("%d S3 sources", len(sources))
 }
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	appconfig "github.com/user/s3cpbp/internal/config"
+	s3ops "github.com/user/s3cpbp/internal/s3"
 )
 
 // TestVersionFlag tests that the version flag is handled correctly
@@ -27,12 +32,12 @@ func TestVersionFlag(t *testing.T) {
 	var parseCalled bool
 
 	// Override the Parse function to avoid actual flag parsing
-	parseConfigFunc = func(v string) (*appconfig.Config, bool) {
+	parseConfigFunc = func(args []string, v string) (*appconfig.Config, bool, error) {
 		parseCalled = true
 		if v != version {
 			t.Errorf("Parse() version = %v, want %v", v, version)
 		}
-		return nil, true // Signal version flag was used
+		return nil, true, nil // Signal version flag was used
 	}
 
 	// Call main which should exit after showing version
@@ -44,6 +49,41 @@ func TestVersionFlag(t *testing.T) {
 	}
 }
 
+// TestInvalidConfig tests that configuration errors exit with status 2 and help exits cleanly
+func TestInvalidConfig(t *testing.T) {
+	origParseConfigFunc := parseConfigFunc
+	origExitFunc := exitFunc
+	defer func() {
+		parseConfigFunc = origParseConfigFunc
+		exitFunc = origExitFunc
+	}()
+
+	tests := []struct {
+		name         string
+		err          error
+		expectedCode int
+	}{
+		{name: "invalid configuration", err: errors.New("destination directory is required"), expectedCode: 2},
+		{name: "help", err: flag.ErrHelp, expectedCode: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := -1
+			exitFunc = func(c int) { code = c }
+			parseConfigFunc = func(args []string, v string) (*appconfig.Config, bool, error) {
+				return nil, false, tt.err
+			}
+
+			main()
+
+			if code != tt.expectedCode {
+				t.Errorf("exit code = %d, want %d", code, tt.expectedCode)
+			}
+		})
+	}
+}
+
 // TestInitializeS3Client tests that the S3 client initialization function works correctly
 func TestInitializeS3Client(t *testing.T) {
 	// Save original function
@@ -58,7 +98,7 @@ func TestInitializeS3Client(t *testing.T) {
 	testBucket := "test-bucket"
 
 	// Create a function that will verify the input bucket
-	initializeS3Client = func(bucket string) (*s3.Client, error) {
+	initializeS3Client = func(ctx context.Context, opts s3ops.ClientOptions, bucket string) (*s3.Client, error) {
 		if bucket != testBucket {
 			t.Errorf("initializeS3Client() called with bucket = %v, want %v", bucket, testBucket)
 		}
@@ -71,7 +111,7 @@ func TestInitializeS3Client(t *testing.T) {
 	}
 
 	// Call the function
-	client, err := initializeS3Client(testBucket)
+	client, err := initializeS3Client(context.Background(), s3ops.ClientOptions{}, testBucket)
 
 	// Verify results
 	if err != nil {
@@ -115,18 +155,19 @@ func TestNormalConfig(t *testing.T) {
 		os.Args = []string{"cmd", "-b", "test-bucket", "-p", "prefix", "-d", tempDir}
 
 		// Mock the config parsing
-		parseConfigFunc = func(v string) (*appconfig.Config, bool) {
+		parseConfigFunc = func(args []string, v string) (*appconfig.Config, bool, error) {
 			return &appconfig.Config{
-				Bucket:      "test-bucket",
-				Prefix:      "test-prefix",
-				Destination: tempDir,
-				Concurrency: 1, // Use a small number for testing
-				Version:     v,
-			}, false
+				Sources:        []appconfig.Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:    tempDir,
+				Concurrency:    1, // Use a small number for testing
+				MinConcurrency: 1,
+				MaxConcurrency: 1,
+				Version:        v,
+			}, false, nil
 		}
 
 		// Mock the S3 client initialization
-		initializeS3Client = func(bucket string) (*s3.Client, error) {
+		initializeS3Client = func(ctx context.Context, opts s3ops.ClientOptions, bucket string) (*s3.Client, error) {
 			// Create a mock S3 client with a real region
 			// Skip the rest of main() - this is a test success
 			t.SkipNow()
@@ -144,3 +185,45 @@ func TestNormalConfig(t *testing.T) {
 	// This test passes automatically - the subtest is skipped but that's expected
 	t.Log("TestNormalConfig completed")
 }
+
+// TestHandleSignals tests that the first interrupt cancels the run and the second one forces an exit
+func TestHandleSignals(t *testing.T) {
+	origExitFunc := exitFunc
+	defer func() { exitFunc = origExitFunc }()
+
+	exitCodes := make(chan int, 1)
+	exitFunc = func(code int) { exitCodes <- code }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stop := handleSignals(cancel)
+	defer stop()
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to find own process: %v", err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Skipf("Sending interrupts is not supported on this platform: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Context was not cancelled after the first interrupt")
+	}
+
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Fatalf("Failed to send second interrupt: %v", err)
+	}
+
+	select {
+	case code := <-exitCodes:
+		if code != 130 {
+			t.Errorf("exit code = %d, want 130", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Second interrupt did not force an exit")
+	}
+}
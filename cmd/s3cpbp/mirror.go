@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	appconfig "github.com/user/s3cpbp/internal/config"
+	"github.com/user/s3cpbp/internal/mirror"
+)
+
+// deleteExtraneous deletes the files under the destination whose objects the sources no longer list,
+// or only logs them for a dry run. It returns the number of files deleted.
+func deleteExtraneous(ctx context.Context, cfg *appconfig.Config, listed *mirror.Listed) (int, error) {
+	m := newMirror(cfg, listed)
+	files, err := m.Extraneous(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("walking the destination: %w", err)
+	}
+
+	if cfg.DeleteDryRun {
+		for _, file := range files {
+			log.Printf("Would delete %s", filepath.Join(cfg.Destination, filepath.FromSlash(file.Key)))
+		}
+		log.Printf("Would delete %d files from %s whose objects no longer exist", len(files), cfg.Destination)
+		if cfg.MaxDelete > 0 && len(files) > cfg.MaxDelete {
+			log.Printf("That is more than --max-delete %d, --delete would not delete any of them", cfg.MaxDelete)
+		}
+		return 0, nil
+	}
+	return m.Delete(files)
+}
+
+// newMirror compares the destination with the objects the sources listed
+func newMirror(cfg *appconfig.Config, listed *mirror.Listed) *mirror.Mirror {
+	scopes := make([]mirror.Scope, len(cfg.Sources))
+	for i, location := range cfg.Sources {
+		scopes[i] = mirror.Scope{Subdir: location.Subdir, Prefix: location.Prefix, Match: cfg.Filter.MatchKey}
+	}
+	return &mirror.Mirror{
+		Destination: cfg.Destination,
+		Scopes:      scopes,
+		Listed:      listed,
+		Protect:     cfg.Protect,
+		MaxDelete:   cfg.MaxDelete,
+		Concurrency: cfg.ListConcurrency,
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appconfig "github.com/user/s3cpbp/internal/config"
+	"github.com/user/s3cpbp/internal/mirror"
+)
+
+func TestDeleteExtraneous(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name        string
+		dryRun      bool
+		maxDelete   int
+		wantDeleted int
+		wantErr     bool
+		wantGone    []string
+	}{
+		{"dry run deletes nothing", true, 0, 0, false, nil},
+		{"above the limit deletes nothing", false, 1, 0, true, nil},
+		{"extraneous files are deleted", false, 0, 2, false, []string{"logs/gone.json", "logs/old/stale.json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination := t.TempDir()
+			writeFiles(t, destination, "logs/a.json", "logs/gone.json", "logs/old/stale.json", "logs/notes/keep.txt", "other/b.json")
+
+			cfg := &appconfig.Config{
+				Sources:      []appconfig.Location{{Bucket: "bucket", Prefix: "logs/"}},
+				Destination:  destination,
+				DeleteDryRun: tt.dryRun,
+				MaxDelete:    tt.maxDelete,
+			}
+			if err := cfg.Protect.Add("notes/"); err != nil {
+				t.Fatalf("Add() returned unexpected error: %v", err)
+			}
+			var listed mirror.Listed
+			listed.Add("logs/a.json")
+
+			deleted, err := deleteExtraneous(context.Background(), cfg, &listed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deleteExtraneous() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "exceed the limit") {
+				t.Errorf("deleteExtraneous() error = %v, want the limit exceeded", err)
+			}
+			if deleted != tt.wantDeleted {
+				t.Errorf("deleteExtraneous() = %d files deleted, want %d", deleted, tt.wantDeleted)
+			}
+
+			gone := map[string]bool{}
+			for _, path := range tt.wantGone {
+				gone[path] = true
+			}
+			for _, path := range []string{"logs/a.json", "logs/gone.json", "logs/old/stale.json", "logs/notes/keep.txt", "other/b.json"} {
+				_, err := os.Stat(filepath.Join(destination, filepath.FromSlash(path)))
+				if exists := err == nil; exists == gone[path] {
+					t.Errorf("%s exists = %v, want %v", path, exists, !gone[path])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	appconfig "github.com/user/s3cpbp/internal/config"
+	"github.com/user/s3cpbp/internal/download"
+	"github.com/user/s3cpbp/internal/mirror"
+	"github.com/user/s3cpbp/internal/plan"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// runPlan lists, filters and compares the objects as a download would, then writes the plan of the run
+// instead of downloading. Nothing is created under the destination, which need not exist yet.
+func runPlan(ctx context.Context, cfg *appconfig.Config) {
+	clients := newClientCache(ctx, cfg.Client)
+	retryPolicy := cfg.Retry
+	var retries atomic.Int64
+	retryPolicy.Retries = &retries
+
+	// Mirroring records every listed object, to tell which files no longer have one
+	var listed *mirror.Listed
+	if cfg.Delete {
+		listed = &mirror.Listed{}
+	}
+
+	p := &plan.Plan{Destination: cfg.Destination}
+	var wg sync.WaitGroup
+	listErrs := make([]error, len(cfg.Sources))
+	for i, location := range cfg.Sources {
+		p.Sources = append(p.Sources, location.String())
+		objects := objectSource(cfg, location, clients, retryPolicy)
+		destination := filepath.Join(cfg.Destination, location.Subdir)
+
+		// Every listed object counts towards the LIST requests, also those the filters drop
+		var found, total atomic.Int64
+		include := func(obj s3ops.ObjectInfo) bool {
+			found.Add(1)
+			return cfg.Filter.Match(obj)
+		}
+		if listed != nil {
+			include = listed.Track(location.Subdir, include)
+		}
+
+		foundFilesChan := make(chan s3ops.ObjectInfo, 1000)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			listErrs[i] = objects.Objects(ctx, include, foundFilesChan, &total)
+			// Listings return up to 1,000 objects per page, parallel listing takes a few more requests
+			var pages int64
+			if cfg.FromFile == "" && cfg.Inventory == "" {
+				pages = max(1, (found.Load()+999)/1000)
+			}
+			p.AddListing(found.Load(), pages)
+		}()
+
+		// Compare the objects with their local files as the workers would
+		for j := 0; j < cfg.Concurrency; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for obj := range foundFilesChan {
+					item := plan.Item{
+						Source: s3ops.URIScheme + location.Bucket + "/" + obj.Key,
+						Path:   filepath.Join(destination, obj.Key),
+						Size:   obj.Size,
+					}
+					unchanged, err := cfg.Sync.Unchanged(item.Path, obj)
+					if err != nil {
+						log.Printf("Failed to compare %s with the local file, planning to download it: %v", obj.Key, err)
+					}
+					if unchanged {
+						p.AddSkip(item)
+						continue
+					}
+					gets, heads := download.Requests(obj, cfg.ResumeThreshold, cfg.Verify)
+					p.AddDownload(item, gets, heads)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		log.Printf("Interrupted, no plan was written")
+		exitFunc(130)
+		return
+	}
+
+	// A plan missing objects would understate the run, and list files for deletion that still have objects
+	failed := false
+	for i, listErr := range listErrs {
+		if listErr != nil {
+			log.Printf("Listing %s did not complete, no plan was written: %v", cfg.Sources[i], listErr)
+			failed = true
+		}
+	}
+	if failed {
+		exitFunc(1)
+		return
+	}
+
+	// A destination that doesn't exist yet has nothing to delete
+	if _, err := os.Stat(cfg.Destination); cfg.Delete && err == nil {
+		files, err := newMirror(cfg, listed).Extraneous(ctx)
+		if err != nil {
+			log.Printf("Walking %s did not complete, no plan was written: %v", cfg.Destination, err)
+			exitFunc(1)
+			return
+		}
+		for _, file := range files {
+			p.AddDelete(plan.Item{Path: filepath.Join(cfg.Destination, filepath.FromSlash(file.Key)), Size: file.Size})
+		}
+		if cfg.MaxDelete > 0 && len(files) > cfg.MaxDelete {
+			log.Printf("%d files to delete are more than --max-delete %d, --delete would not delete any of them", len(files), cfg.MaxDelete)
+		}
+	}
+	p.Finish(cfg.Pricing)
+
+	if err := writePlan(p, cfg.PlanFile, cfg.PlanFormat); err != nil {
+		log.Printf("Failed to write the plan: %v", err)
+		exitFunc(1)
+		return
+	}
+
+	s := p.Summary
+	log.Printf("Dry run done! Would download %d files (%s), skip %d unchanged, delete %d, estimated cost $%.4f, %d retries",
+		s.DownloadFiles, plan.FormatSize(s.DownloadBytes), s.SkipFiles, s.DeleteFiles, s.Cost.Total, retries.Load())
+}
+
+// writePlan writes the plan to a file, or to standard output when path is empty
+func writePlan(p *plan.Plan, path string, format plan.Format) error {
+	if path == "" {
+		return p.Write(os.Stdout, format)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := p.Write(file, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
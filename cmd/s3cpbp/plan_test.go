@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	appconfig "github.com/user/s3cpbp/internal/config"
+	"github.com/user/s3cpbp/internal/plan"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// TestRunPlan tests a dry run end to end, from the listing to the JSON plan file
+func TestRunPlan(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// same.json is unchanged, extra.json no longer has an object
+	destination := t.TempDir()
+	writeFiles(t, destination, "data/same.json", "data/extra.json")
+
+	fake := &fakeS3{objects: map[string][]byte{
+		"bucket/data/new.json":  []byte("new object"),
+		"bucket/data/same.json": []byte("data/same.json"),
+		"bucket/other/a.json":   []byte("outside the prefix"),
+	}}
+	serveFakeS3(t, fake)
+	status := interceptExit(t)
+
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+	cfg := &appconfig.Config{
+		Sources:     []appconfig.Location{{Bucket: "bucket", Prefix: "data/"}},
+		Destination: destination,
+		Concurrency: 2,
+		Sync:        transfer.SyncSizeOnly,
+		DryRun:      true,
+		Delete:      true,
+		PlanFile:    planFile,
+		PlanFormat:  plan.FormatJSON,
+		Pricing:     plan.DefaultPricing,
+	}
+	runPlan(context.Background(), cfg)
+
+	if *status != -1 {
+		t.Fatalf("runPlan() exited with %d, want success", *status)
+	}
+	if puts := fake.puts; len(puts) != 0 {
+		t.Errorf("runPlan() wrote objects %q", puts)
+	}
+	if _, err := os.Stat(filepath.Join(destination, "data", "extra.json")); err != nil {
+		t.Errorf("runPlan() deleted a file: %v", err)
+	}
+
+	data, err := os.ReadFile(planFile)
+	if err != nil {
+		t.Fatalf("Failed to read the plan: %v", err)
+	}
+	var p plan.Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatalf("Failed to decode the plan: %v", err)
+	}
+
+	expected := map[string][]plan.Item{
+		"download": {{Source: "s3://bucket/data/new.json", Path: filepath.Join(destination, "data", "new.json"), Size: 10}},
+		"skip":     {{Source: "s3://bucket/data/same.json", Path: filepath.Join(destination, "data", "same.json"), Size: 14}},
+		"delete":   {{Path: filepath.Join(destination, "data", "extra.json"), Size: 15}},
+	}
+	for name, items := range map[string][]plan.Item{"download": p.Download, "skip": p.Skip, "delete": p.Delete} {
+		if len(items) != len(expected[name]) || (len(items) > 0 && items[0] != expected[name][0]) {
+			t.Errorf("plan %s = %+v, want %+v", name, items, expected[name])
+		}
+	}
+	s := p.Summary
+	if s.Listed != 2 || s.DownloadBytes != 10 || s.DeleteFiles != 1 || s.Requests.List != 1 || s.Requests.Get != 1 {
+		t.Errorf("plan summary = %+v, want 2 listed, 10 bytes to download, 1 deletion, 1 LIST and 1 GET", s)
+	}
+}
+
+// TestRunPlan_ListingFailure tests that no plan is written when a listing fails
+func TestRunPlan_ListingFailure(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	serveFakeS3(t, &fakeS3{missing: "missing"})
+	status := interceptExit(t)
+
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+	runPlan(context.Background(), &appconfig.Config{
+		Sources:     []appconfig.Location{{Bucket: "missing", Prefix: "data/"}},
+		Destination: t.TempDir(),
+		Concurrency: 1,
+		DryRun:      true,
+		PlanFile:    planFile,
+		PlanFormat:  plan.FormatJSON,
+	})
+
+	if *status != 1 {
+		t.Errorf("runPlan() exited with %d, want 1", *status)
+	}
+	if _, err := os.Stat(planFile); !os.IsNotExist(err) {
+		t.Errorf("plan written despite the failed listing: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	appconfig "github.com/user/s3cpbp/internal/config"
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/source"
+	"github.com/user/s3cpbp/internal/transfer"
+	"github.com/user/s3cpbp/internal/upload"
+)
+
+// clientCache creates the clients of a run once per bucket, each for the bucket's region
+type clientCache struct {
+	ctx     context.Context
+	options s3ops.ClientOptions
+	mu      sync.Mutex
+	clients map[string]*s3.Client
+}
+
+func newClientCache(ctx context.Context, options s3ops.ClientOptions) *clientCache {
+	return &clientCache{ctx: ctx, options: options, clients: make(map[string]*s3.Client)}
+}
+
+// get returns the client of a bucket, a client that cannot be created ends the run
+func (c *clientCache) get(bucket string) *s3.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[bucket]; ok {
+		return client
+	}
+	client, err := initializeS3Client(c.ctx, c.options, bucket)
+	if err != nil {
+		log.Fatalf("Failed to initialize S3 client for bucket '%s': %v", bucket, err)
+	}
+	c.clients[bucket] = client
+	return client
+}
+
+// run holds the counters a download, upload or copy shares across its sources and workers,
+// and writes the summary at the end
+type run struct {
+	verb string // Past tense of the transfer for the summary, e.g. "Downloaded"
+	noun string // What is transferred, "files" or "objects"
+
+	total    atomic.Int64
+	finished atomic.Int64
+	skipped  atomic.Int64
+	retries  atomic.Int64
+	wg       sync.WaitGroup
+	results  transfer.Results
+
+	// Listing and transfers share the retry policy, and count their retries together
+	retry retry.Policy
+}
+
+func newRun(cfg *appconfig.Config, verb, noun string) *run {
+	r := &run{verb: verb, noun: noun, retry: cfg.Retry}
+	r.retry.Retries = &r.retries
+	return r
+}
+
+// list starts listing the objects of a source, the returned channel holds the result once the listing is done
+func (r *run) list(ctx context.Context, objects source.Source, include func(s3ops.ObjectInfo) bool, found chan<- s3ops.ObjectInfo) <-chan error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- objects.Objects(ctx, include, found, &r.total)
+	}()
+	return errChan
+}
+
+// remote lists the objects under the prefix of target to compare with, nil when not syncing.
+// It returns false when the listing did not complete and the run has ended.
+func (r *run) remote(ctx context.Context, cfg *appconfig.Config, client *s3.Client, target appconfig.Location) (map[string]s3ops.ObjectInfo, bool) {
+	if cfg.Sync == transfer.SyncNone {
+		return nil, true
+	}
+	listing := &source.Listing{
+		Client:      client,
+		Bucket:      target.Bucket,
+		Prefix:      upload.Key(target.Prefix, ""),
+		Retry:       r.retry,
+		Concurrency: cfg.ListConcurrency,
+	}
+	remote, err := upload.RemoteObjects(ctx, listing)
+	if err != nil {
+		log.Printf("Listing %s did not complete, cannot tell which %s are unchanged: %v", target, r.noun, err)
+		if ctx.Err() != nil {
+			exitFunc(130)
+			return nil, false
+		}
+		exitFunc(1)
+		return nil, false
+	}
+	log.Printf("Found %d objects in %s to compare the %s with", len(remote), target, r.noun)
+	return remote, true
+}
+
+// wait waits for the workers, then for the listings to return
+func (r *run) wait(errChans []<-chan error) []error {
+	r.wg.Wait()
+	errs := make([]error, len(errChans))
+	for i, errChan := range errChans {
+		errs[i] = <-errChan
+	}
+	return errs
+}
+
+// interrupted summarizes a cancelled run and exits with 130, listing errors are expected here.
+// It returns false when the run was not cancelled.
+func (r *run) interrupted(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	failures := len(r.results.Failures())
+	interrupted := r.results.Interrupted()
+	pending := r.total.Load() - r.finished.Load() - r.skipped.Load() - int64(failures) - int64(len(interrupted))
+	log.Printf("Interrupted: %d %s, %d skipped, %d failed, %d interrupted, %d pending of %d %s found so far, %d retries",
+		r.finished.Load(), strings.ToLower(r.verb), r.skipped.Load(), failures, len(interrupted), pending, r.total.Load(), r.noun, r.retries.Load())
+	for _, key := range interrupted {
+		log.Printf("  interrupted: %s", key)
+	}
+	exitFunc(130)
+	return true
+}
+
+// failed logs the failed transfers, where describes the sources and target of the run.
+// It returns whether any transfer failed.
+func (r *run) failed(where string) bool {
+	failures := r.results.Failures()
+	if len(failures) == 0 {
+		return false
+	}
+	log.Printf("%s %d of %d %s %s, %d skipped, %d failed, %d retries:",
+		r.verb, r.finished.Load(), r.total.Load(), r.noun, where, r.skipped.Load(), len(failures), r.retries.Load())
+	for _, failure := range failures {
+		log.Printf("  %v", failure)
+	}
+	return true
+}
+
+// incomplete logs a listing or walk that did not complete, which means some objects were never seen.
+// It returns whether err is set.
+func (r *run) incomplete(action string, location any, err error) bool {
+	if err == nil {
+		return false
+	}
+	log.Printf("%s %v did not complete, only %d %s were found: %v", action, location, r.total.Load(), r.noun, err)
+	return true
+}
+
+// done logs the summary of a successful run, details are added after the skipped count
+func (r *run) done(where, details string) {
+	log.Printf("All done! %s %d %s %s, skipped %d unchanged%s, %d retries",
+		r.verb, r.finished.Load(), r.noun, where, r.skipped.Load(), details, r.retries.Load())
+}
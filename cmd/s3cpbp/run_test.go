@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// fakeS3 serves the path-style requests of a run from objects held in memory
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte // Contents by bucket/key
+	modified time.Time
+	denied   string   // Keys ending in this are refused with AccessDenied
+	missing  string   // Bucket that doesn't exist
+	puts     []string // Keys written, in order
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case bucket == f.missing:
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `<Error><Code>NoSuchBucket</Code><Message>The specified bucket does not exist</Message></Error>`)
+	case f.denied != "" && strings.HasSuffix(key, f.denied):
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Get("list-type") == "2":
+		f.list(w, bucket, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut && key != "":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.objects[bucket+"/"+key] = body
+		f.puts = append(f.puts, key)
+		w.Header().Set("ETag", `"etag"`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// list writes a single page listing the objects of a bucket under a prefix
+func (f *fakeS3) list(w http.ResponseWriter, bucket, prefix string) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	result := struct {
+		XMLName  xml.Name `xml:"ListBucketResult"`
+		Name     string
+		Prefix   string
+		KeyCount int
+		Contents []content
+	}{Name: bucket, Prefix: prefix}
+
+	var keys []string
+	for name := range f.objects {
+		if key, ok := strings.CutPrefix(name, bucket+"/"); ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: f.modified.UTC().Format(time.RFC3339),
+			ETag:         `"etag"`,
+			Size:         len(f.objects[bucket+"/"+key]),
+		})
+	}
+	result.KeyCount = len(keys)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// keys returns the keys stored in a bucket, sorted
+func (f *fakeS3) keys(bucket string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for name := range f.objects {
+		if key, ok := strings.CutPrefix(name, bucket+"/"); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serveFakeS3 starts the fake and points the clients of the run at it, counting the clients created
+func serveFakeS3(t *testing.T, fake *fakeS3) *int {
+	t.Helper()
+	if fake.objects == nil {
+		fake.objects = make(map[string][]byte)
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	created := 0
+	origInitializeS3Client := initializeS3Client
+	t.Cleanup(func() { initializeS3Client = origInitializeS3Client })
+	initializeS3Client = func(ctx context.Context, opts s3ops.ClientOptions, bucket string) (*s3.Client, error) {
+		created++
+		return s3.New(s3.Options{
+			Region:                     "us-east-1",
+			BaseEndpoint:               aws.String(server.URL),
+			UsePathStyle:               true,
+			Credentials:                credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+			RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+			RetryMaxAttempts:           1,
+		}), nil
+	}
+	return &created
+}
+
+// writeFiles creates the files under dir, given by slash-separated relative paths
+func writeFiles(t *testing.T, dir string, paths ...string) {
+	t.Helper()
+	for _, name := range paths {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+}
+
+// interceptExit records the exit status of a run instead of exiting, -1 when it did not exit
+func interceptExit(t *testing.T) *int {
+	t.Helper()
+	status := -1
+	origExitFunc := exitFunc
+	t.Cleanup(func() { exitFunc = origExitFunc })
+	exitFunc = func(code int) { status = code }
+	return &status
+}
+
+func TestClientCache(t *testing.T) {
+	created := serveFakeS3(t, &fakeS3{})
+	clients := newClientCache(context.Background(), s3ops.ClientOptions{})
+
+	first := clients.get("bucket-a")
+	if clients.get("bucket-a") != first {
+		t.Error("get() created a second client for the same bucket")
+	}
+	if clients.get("bucket-b") == first {
+		t.Error("get() returned the client of another bucket")
+	}
+	if *created != 2 {
+		t.Errorf("created %d clients, want 2", *created)
+	}
+}
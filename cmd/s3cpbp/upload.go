@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+
+	appconfig "github.com/user/s3cpbp/internal/config"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/source"
+	"github.com/user/s3cpbp/internal/transfer"
+	"github.com/user/s3cpbp/internal/upload"
+)
+
+// runUpload uploads the local directory to the single location of the configuration,
+// with the same worker pool, retry policy and adaptive concurrency as downloads
+func runUpload(ctx context.Context, cfg *appconfig.Config) {
+	target := cfg.Sources[0]
+	client := newClientCache(ctx, cfg.Client).get(target.Bucket)
+	r := newRun(cfg, "Uploaded", "files")
+
+	// Unchanged files are found by comparing them with a listing of the prefix, taken before uploading
+	remote, ok := r.remote(ctx, cfg, client, target)
+	if !ok {
+		return
+	}
+
+	// Channel to communicate files to be uploaded
+	foundFilesChan := make(chan s3ops.ObjectInfo, 1000)
+
+	// Start walking the directory, the result is checked once all workers are done
+	files := &source.Directory{Path: cfg.Upload, Concurrency: cfg.ListConcurrency}
+	walkErrChan := r.list(ctx, files, cfg.Filter.Match, foundFilesChan)
+
+	// Start enough workers for the highest concurrency, the controller decides how many upload at once
+	uploader := upload.CreateUploader(client, cfg.PartSize)
+	concurrency := transfer.NewConcurrency(cfg.Concurrency, cfg.MinConcurrency, cfg.MaxConcurrency)
+	for i := 0; i < cfg.MaxConcurrency; i++ {
+		r.wg.Add(1)
+		worker := upload.Worker{
+			ID:            i,
+			Uploader:      uploader,
+			Bucket:        target.Bucket,
+			Prefix:        target.Prefix,
+			Root:          cfg.Upload,
+			FilesChan:     foundFilesChan,
+			WaitGroup:     &r.wg,
+			TotalFiles:    &r.total,
+			FinishedFiles: &r.finished,
+			SkippedFiles:  &r.skipped,
+			Sync:          cfg.Sync,
+			Remote:        remote,
+			Verify:        cfg.Verify,
+			Options:       cfg.Write,
+			Retry:         r.retry,
+			Concurrency:   concurrency,
+			Results:       &r.results,
+		}
+		go worker.Start(ctx)
+	}
+
+	// Wait for all workers to finish
+	walkErr := r.wait([]<-chan error{walkErrChan})[0]
+	if r.interrupted(ctx) {
+		return
+	}
+
+	// Report failed files, and a walk that did not complete as some files were never seen
+	where := "to " + target.String()
+	failed := r.failed(where)
+	failed = r.incomplete("Walking", cfg.Upload, walkErr) || failed
+	if failed {
+		exitFunc(1)
+		return
+	}
+
+	r.done(where, "")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	appconfig "github.com/user/s3cpbp/internal/config"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// uploadConfig returns the configuration of an upload of dir to s3://bucket/backup/
+func uploadConfig(dir string) *appconfig.Config {
+	return &appconfig.Config{
+		Sources:        []appconfig.Location{{Bucket: "bucket", Prefix: "backup"}},
+		Upload:         dir,
+		Concurrency:    2,
+		MinConcurrency: 1,
+		MaxConcurrency: 2,
+		PartSize:       5 * 1024 * 1024,
+	}
+}
+
+func TestRunUpload(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.json", "logs/b.json", "logs/2024/c.json")
+
+	fake := &fakeS3{}
+	serveFakeS3(t, fake)
+	status := interceptExit(t)
+
+	runUpload(context.Background(), uploadConfig(dir))
+
+	if *status != -1 {
+		t.Fatalf("runUpload() exited with %d, want success", *status)
+	}
+	expected := []string{"backup/a.json", "backup/logs/2024/c.json", "backup/logs/b.json"}
+	if keys := fake.keys("bucket"); !slices.Equal(keys, expected) {
+		t.Errorf("uploaded %q, want %q", keys, expected)
+	}
+	if body := string(fake.objects["bucket/backup/logs/b.json"]); body != "logs/b.json" {
+		t.Errorf("backup/logs/b.json holds %q, want the file's contents", body)
+	}
+}
+
+func TestRunUpload_Sync(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, "same.json", "changed.json", "new.json")
+
+	// The object of same.json has the file's size and is newer, changed.json's has another size
+	fake := &fakeS3{
+		objects: map[string][]byte{
+			"bucket/backup/same.json":    []byte("same.json"),
+			"bucket/backup/changed.json": []byte("old"),
+		},
+		modified: time.Now().Add(time.Hour),
+	}
+	serveFakeS3(t, fake)
+	status := interceptExit(t)
+
+	cfg := uploadConfig(dir)
+	cfg.Sync = transfer.SyncSizeOnly
+	runUpload(context.Background(), cfg)
+
+	if *status != -1 {
+		t.Fatalf("runUpload() exited with %d, want success", *status)
+	}
+	slices.Sort(fake.puts)
+	if expected := []string{"backup/changed.json", "backup/new.json"}; !slices.Equal(fake.puts, expected) {
+		t.Errorf("uploaded %q, want %q", fake.puts, expected)
+	}
+	if body := string(fake.objects["bucket/backup/changed.json"]); body != "changed.json" {
+		t.Errorf("changed.json was not uploaded again, the object holds %q", body)
+	}
+}
+
+func TestRunUpload_Failure(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.json", "secret.json")
+
+	fake := &fakeS3{denied: "secret.json"}
+	serveFakeS3(t, fake)
+	status := interceptExit(t)
+
+	runUpload(context.Background(), uploadConfig(dir))
+
+	if *status != 1 {
+		t.Errorf("runUpload() exited with %d, want 1 after a failed upload", *status)
+	}
+	if keys := fake.keys("bucket"); !slices.Equal(keys, []string{"backup/a.json"}) {
+		t.Errorf("uploaded %q, want only backup/a.json", keys)
+	}
+}
+
+func TestRunUpload_Interrupted(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.json")
+
+	serveFakeS3(t, &fakeS3{})
+	status := interceptExit(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runUpload(ctx, uploadConfig(dir))
+
+	if *status != 130 {
+		t.Errorf("runUpload() exited with %d, want 130 when cancelled", *status)
+	}
+}
@@ -1,78 +1,693 @@
 package config
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/user/s3cpbp/internal/filter"
+	"github.com/user/s3cpbp/internal/plan"
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/source"
+	"github.com/user/s3cpbp/internal/transfer"
+	"github.com/user/s3cpbp/internal/upload"
 )
 
+// Location is a bucket and prefix to copy from, into a subdirectory of the destination
+type Location struct {
+	Bucket string
+	Prefix string
+	Subdir string // Relative to the destination, empty for the destination itself
+}
+
+// ParseLocation parses a source given as s3://bucket/prefix, optionally followed by #subdirectory
+func ParseLocation(value string) (Location, error) {
+	uri, subdir, _ := strings.Cut(value, "#")
+	bucket, prefix, err := s3ops.ParseURI(uri)
+	if err != nil {
+		return Location{}, err
+	}
+	if subdir != "" {
+		if !filepath.IsLocal(subdir) {
+			return Location{}, fmt.Errorf("subdirectory %q must be a relative path within the destination", subdir)
+		}
+		if subdir = filepath.Clean(subdir); subdir == "." {
+			subdir = ""
+		}
+	}
+	return Location{Bucket: bucket, Prefix: prefix, Subdir: subdir}, nil
+}
+
+// String formats the location as an s3:// URI
+func (l Location) String() string {
+	return s3ops.URIScheme + l.Bucket + "/" + l.Prefix
+}
+
+// overlaps reports whether two locations would download the same objects to the same files
+func (l Location) overlaps(other Location) bool {
+	return l.Bucket == other.Bucket && l.Subdir == other.Subdir &&
+		(strings.HasPrefix(l.Prefix, other.Prefix) || strings.HasPrefix(other.Prefix, l.Prefix))
+}
+
 // Config holds the application configuration
 type Config struct {
-	Bucket      string
-	Prefix      string
-	Destination string
-	Concurrency int
-	Version     string
+	Sources         []Location // Copied with one concurrency budget, in one run, or the single target of an upload
+	Upload          string     // Local directory to upload to the source instead of downloading, empty for downloads
+	PartSize        int64      // In bytes, uploads of larger files are sent in parts of this size
+	Write           s3ops.WriteOptions
+	Target          *Location // S3 location to copy the sources to instead of downloading, nil otherwise
+	TargetClient    s3ops.ClientOptions
+	StreamCopy      bool   // Copy by downloading and uploading instead of server-side, for other accounts or partitions
+	FromFile        string // Manifest to read the objects from instead of listing, source.Stdin for standard input
+	FromFileFormat  source.ManifestFormat
+	Inventory       string // Local path or s3:// URI of an S3 Inventory manifest.json to read the objects from
+	Destination     string
+	Delete          bool            // Delete files under the destination whose objects the sources no longer list
+	DeleteDryRun    bool            // Only report the files Delete would remove
+	MaxDelete       int             // Delete nothing when more files are to be deleted, 0 for no limit
+	Protect         filter.Patterns // Files never deleted, matched against their path relative to the destination
+	DryRun          bool            // Only write the plan of the run, without creating or deleting files
+	PlanFormat      plan.Format
+	PlanFile        string // Where the plan is written, empty for standard output
+	Pricing         plan.Pricing
+	Concurrency     int // Initial number of concurrent downloads
+	MinConcurrency  int
+	MaxConcurrency  int
+	ListConcurrency int // ListObjectsV2 requests in flight while listing
+	Sync            transfer.SyncStrategy
+	Verify          bool
+	ResumeThreshold int64 // In bytes, 0 disables resuming
+	Retry           retry.Policy
+	Filter          *filter.Filter
+	Client          s3ops.ClientOptions
+	Version         string
+}
+
+// parseArgs parses the flags, which may also follow the arguments as with the AWS CLI, and returns the arguments
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		// Everything after -- is an argument, even if it looks like a flag
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// usage prints the command line forms and flags
+func usage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintf(out, "Usage:\n")
+	fmt.Fprintf(out, "  %s [flags] s3://BUCKET/PREFIX [s3://BUCKET/PREFIX ...] LOCAL_DIR\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(out, "  %s [flags] -b BUCKET -p PREFIX -d LOCAL_DIR\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(out, "  %s [flags] LOCAL_DIR s3://BUCKET/PREFIX\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(out, "  %s [flags] s3://BUCKET/PREFIX [s3://BUCKET/PREFIX ...] s3://BUCKET/PREFIX\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(out, "BUCKET may also be an access point or Multi-Region Access Point ARN.\n\nFlags:\n")
+	flags.PrintDefaults()
 }
 
-// Parse parses command line flags and returns application configuration
-func Parse(version string) (*Config, bool) {
+// Parse parses the command line arguments and returns the application configuration, or reports whether only the
+// version was shown. Flags take precedence over S3CPBP_* environment variables, which take precedence over the
+// config file given with --config or S3CPBP_CONFIG, where a job profile selected with --job overrides the file's
+// top-level settings.
+func Parse(args []string, version string) (*Config, bool, error) {
 	var (
 		bucket      string
 		prefix      string
+		fromFile    string
+		fileFormat  string
+		inventory   string
 		destination string
 		concurrency int
+		minConc     int
+		maxConc     int
+		listConc    int
+		syncMode    string
+		verify      bool
+		resumeMiB   int64
+		maxAttempts int
+		baseDelay   time.Duration
+		maxDelay    time.Duration
+		jitter      float64
 		showVersion bool
+		filters     filter.Filter
+		client      s3ops.ClientOptions
+		sources     []Location
+		configPath  string
+		job         string
+		uploadDir   string
+		partSize    int64 = 8 * 1024 * 1024
+		write       s3ops.WriteOptions
+		target      s3ops.ClientOptions
+		streamCopy  bool
+		deleteFiles bool
+		deleteDry   bool
+		maxDelete   int
+		protect     filter.Patterns
+		dryRun      bool
+		planFormat  string
+		planFile    string
+		pricing     = plan.DefaultPricing
 	)
 
+	flags := flag.NewFlagSet("s3cpbp", flag.ContinueOnError)
+
 	// Parse command line flags
-	flag.StringVar(&bucket, "bucket", "", "AWS S3 bucket name")
-	flag.StringVar(&bucket, "b", "", "AWS S3 bucket name (shorthand)")
+	flags.StringVar(&bucket, "bucket", "", "AWS S3 bucket name")
+	flags.StringVar(&bucket, "b", "", "AWS S3 bucket name (shorthand)")
+
+	flags.StringVar(&prefix, "prefix", "", "Prefix for S3 objects")
+	flags.StringVar(&prefix, "p", "", "Prefix for S3 objects (shorthand)")
+
+	flags.Func("source", "Copy from this s3://bucket/prefix, optionally followed by #subdirectory of the destination (repeatable)", func(value string) error {
+		location, err := ParseLocation(value)
+		sources = append(sources, location)
+		return err
+	})
+
+	flags.StringVar(&fromFile, "from-file", "", "Read the keys to copy from this file, or - for stdin, instead of listing the bucket")
+	flags.StringVar(&fileFormat, "from-file-format", "", "Format of --from-file: keys (one per line) or csv (bucket,key[,size[,etag]]), defaults to csv for .csv files")
+
+	flags.StringVar(&inventory, "inventory", "", "Read the objects to copy from an S3 Inventory report, given as the local path or s3:// URI of its manifest.json")
+
+	flags.StringVar(&uploadDir, "upload", "", "Upload this local directory to the bucket and prefix instead of downloading")
+
+	flags.StringVar(&destination, "destination", "", "Destination directory on local machine, or s3://bucket/prefix to copy to")
+	flags.StringVar(&destination, "d", "", "Destination directory on local machine, or s3://bucket/prefix to copy to (shorthand)")
+
+	flags.IntVar(&concurrency, "concurrency", 50, "Number of concurrent downloads")
+	flags.IntVar(&concurrency, "c", 50, "Number of concurrent downloads (shorthand)")
+
+	flags.IntVar(&minConc, "min-concurrency", 1, "Lowest number of concurrent downloads when backing off from throttling")
+	flags.IntVar(&maxConc, "max-concurrency", 0, "Highest number of concurrent downloads to grow to, defaults to twice --concurrency")
+
+	flags.IntVar(&listConc, "list-concurrency", 8, "Number of concurrent listing requests, sub-prefixes are listed in parallel")
+
+	// Filter rules keep the order in which they are given, across all three flags
+	flags.Func("include", "Include keys matching a glob, or a regular expression prefixed with \"re:\" (repeatable)", filters.Include)
+	flags.Func("exclude", "Exclude keys matching a glob, or a regular expression prefixed with \"re:\" (repeatable)", filters.Exclude)
+	flags.Func("filter-file", "Read include and exclude rules from a file, one \"+ pattern\" or \"- pattern\" per line", filters.LoadFile)
+
+	// Attribute filters use what ListObjectsV2 already returns, so they don't cost extra requests
+	now := time.Now()
+	flags.Func("min-size", "Only copy objects of at least this size, e.g. 100K or 1.5G", func(value string) (err error) {
+		filters.MinSize, err = filter.ParseSize(value)
+		return err
+	})
+	flags.Func("max-size", "Only copy objects of at most this size, e.g. 2G", func(value string) (err error) {
+		filters.MaxSize, err = filter.ParseSize(value)
+		return err
+	})
+	flags.Func("modified-after", "Only copy objects modified at or after this RFC3339 time, date or age like 24h or 7d", func(value string) (err error) {
+		filters.ModifiedAfter, err = filter.ParseTime(value, now)
+		return err
+	})
+	flags.Func("modified-before", "Only copy objects modified before this RFC3339 time, date or age like 24h or 7d", func(value string) (err error) {
+		filters.ModifiedBefore, err = filter.ParseTime(value, now)
+		return err
+	})
+	flags.Func("storage-class", "Only copy objects in these comma-separated storage classes, e.g. STANDARD,INTELLIGENT_TIERING (repeatable)", filters.AddStorageClasses)
+
+	flags.StringVar(&syncMode, "sync", "", "Skip unchanged files: size-only, size-mtime or checksum")
+
+	// Mirroring, files of objects that no longer exist are deleted after the downloads
+	flags.BoolVar(&deleteFiles, "delete", false, "Delete files under the destination whose objects the sources no longer contain")
+	flags.BoolVar(&deleteDry, "delete-dry-run", false, "List the files --delete would remove, without removing them")
+	flags.IntVar(&maxDelete, "max-delete", 0, "Don't delete anything when more than this many files would be deleted, 0 for no limit")
+	flags.Func("delete-exclude", "Never delete files whose path relative to the destination matches a glob, or a regular expression prefixed with \"re:\" (repeatable)", protect.Add)
 
-	flag.StringVar(&prefix, "prefix", "", "Prefix for S3 objects")
-	flag.StringVar(&prefix, "p", "", "Prefix for S3 objects (shorthand)")
+	// Plans list what a run would do, for review before running it
+	flags.BoolVar(&dryRun, "dry-run", false, "List, filter and compare the objects, then write the plan of the run instead of downloading")
+	flags.StringVar(&planFormat, "plan-format", "", "Format of the --dry-run plan: text or json (default text)")
+	flags.StringVar(&planFile, "plan-file", "", "Write the --dry-run plan to this file instead of standard output")
+	flags.Float64Var(&pricing.TransferPerGB, "transfer-price", pricing.TransferPerGB, "Price per GB of data transfer in the plan's cost estimate, 0 within the bucket's region")
 
-	flag.StringVar(&destination, "destination", "", "Destination directory on local machine")
-	flag.StringVar(&destination, "d", "", "Destination directory on local machine (shorthand)")
+	flags.BoolVar(&verify, "verify", false, "Verify downloaded files and copies against the object's ETag and checksums, or have S3 check a CRC32 checksum of uploads")
 
-	flag.IntVar(&concurrency, "concurrency", 50, "Number of concurrent downloads")
-	flag.IntVar(&concurrency, "c", 50, "Number of concurrent downloads (shorthand)")
+	flags.Int64Var(&resumeMiB, "resume-threshold", 64, "Download objects of at least this many MiB in resumable chunks, 0 disables resuming")
 
-	flag.BoolVar(&showVersion, "version", false, "Show version information")
-	flag.BoolVar(&showVersion, "v", false, "Show version information (shorthand)")
+	// Attributes of uploaded and copied objects
+	flags.Func("part-size", "Upload files larger than this, and copy objects over 5G, in parts of this size, between 5M and 5G (default 8M)", func(value string) (err error) {
+		partSize, err = filter.ParseSize(value)
+		return err
+	})
+	flags.Func("set-storage-class", "Upload or copy objects in this storage class, e.g. STANDARD_IA, defaults to the bucket's or the copied object's", func(value string) (err error) {
+		write.StorageClass, err = s3ops.ParseStorageClass(value)
+		return err
+	})
+	flags.Func("sse", "Encrypt uploaded and copied objects with AES256, aws:kms or aws:kms:dsse, defaults to the bucket's encryption", func(value string) (err error) {
+		write.SSE, err = s3ops.ParseServerSideEncryption(value)
+		return err
+	})
+	flags.StringVar(&write.SSEKMSKeyID, "sse-kms-key-id", "", "KMS key ID, ARN or alias to encrypt uploads and copies with, defaults to the AWS managed key")
+	flags.Func("tag", "Tag uploaded objects with key=value, replacing the tags of copied objects (repeatable)", write.AddTag)
+	flags.Func("metadata", "Set user metadata key=value on uploaded objects, replacing the metadata of copied objects (repeatable)", write.AddMetadata)
 
-	flag.Parse()
+	// Copies to an S3 destination, which may be in another account, partition or store
+	flags.StringVar(&target.Profile, "destination-profile", "", "Copy with the credentials of this profile, instead of those used for the sources")
+	flags.StringVar(&target.RoleARN, "destination-role-arn", "", "Copy with this IAM role, e.g. to copy into another account")
+	flags.StringVar(&target.Region, "destination-region", "", "Region of the destination bucket, skips detecting it")
+	flags.StringVar(&target.EndpointURL, "destination-endpoint-url", "", "Copy to this S3-compatible endpoint, defaults to --endpoint-url")
+	flags.BoolVar(&streamCopy, "stream-copy", false, "Copy through this machine with GET and PUT instead of server-side, implied by the other --destination-* flags")
+
+	flags.IntVar(&maxAttempts, "max-attempts", 5, "Attempts per download and listing page before giving up")
+	flags.DurationVar(&baseDelay, "retry-base-delay", 500*time.Millisecond, "Delay before the first retry, doubled on every attempt")
+	flags.DurationVar(&maxDelay, "retry-max-delay", 20*time.Second, "Upper bound for the delay between attempts")
+	flags.Float64Var(&jitter, "retry-jitter", 0.5, "Fraction of the retry delay that is randomized, between 0 and 1")
+
+	// Connection options, for S3-compatible stores such as MinIO, Ceph or R2
+	flags.StringVar(&client.EndpointURL, "endpoint-url", "", "Use this S3-compatible endpoint instead of AWS, e.g. https://minio.example.com:9000")
+	flags.BoolVar(&client.PathStyle, "path-style", false, "Address buckets in the URL path instead of the host name, as most S3-compatible stores expect")
+	flags.StringVar(&client.Region, "region", "", "Region of the bucket, skips detecting it")
+	flags.BoolVar(&client.NoVerifySSL, "no-verify-ssl", false, "Don't verify TLS certificates")
+	flags.StringVar(&client.CABundle, "ca-bundle", "", "PEM file with certificate authorities to trust in addition to the system's")
+
+	// Credentials, used for region detection as well
+	flags.StringVar(&client.Profile, "profile", "", "Use this profile from the AWS config and credentials files")
+	flags.StringVar(&client.RoleARN, "role-arn", "", "Assume this IAM role, e.g. to copy from another account")
+	flags.StringVar(&client.ExternalID, "external-id", "", "External ID the role's trust policy requires")
+	flags.StringVar(&client.SessionName, "session-name", "", "Name of the role session, defaults to s3cpbp-<unix time>")
+	flags.StringVar(&client.MFASerial, "mfa-serial", "", "ARN or serial number of the MFA device the role requires, the code is asked for on stdin")
+	flags.StringVar(&client.WebIdentityTokenFile, "web-identity-token-file", "", "Assume the role with the OIDC token in this file instead of AWS credentials")
+	flags.BoolVar(&client.NoSignRequest, "no-sign-request", false, "Don't sign requests, for public buckets")
+
+	flags.StringVar(&configPath, "config", "", "Read settings from this YAML, TOML or JSON file, see also S3CPBP_* environment variables")
+	flags.StringVar(&job, "job", "", "Use the settings of this job profile from the config file")
+
+	flags.BoolVar(&showVersion, "version", false, "Show version information")
+	flags.BoolVar(&showVersion, "v", false, "Show version information (shorthand)")
+
+	flags.Usage = func() { usage(flags) }
+	args, err := parseArgs(flags, args)
+	if err != nil {
+		return nil, false, err
+	}
 
 	// Show version and exit if requested
 	if showVersion {
 		fmt.Printf("s3cpbp version %s\n", version)
-		return nil, true
+		return nil, true, nil
+	}
+
+	// As with the AWS CLI, arguments are s3:// sources followed by the local or s3:// destination,
+	// or a local directory followed by the s3:// location to upload it to
+	given := givenFlags(flags)
+	for i, arg := range args {
+		if s3ops.IsURI(arg) && i == len(args)-1 && i > 0 && destination == "" && uploadDir == "" {
+			destination = arg
+			given.add("destination")
+			continue
+		}
+		if !s3ops.IsURI(arg) {
+			switch {
+			case i == 0 && len(args) > 1:
+				if uploadDir != "" {
+					return nil, false, fmt.Errorf("upload directory given twice, as --upload %q and as argument %q", uploadDir, arg)
+				}
+				uploadDir = arg
+				given.add("upload")
+			case i == len(args)-1:
+				if destination != "" {
+					return nil, false, fmt.Errorf("destination given twice, as --destination %q and as argument %q", destination, arg)
+				}
+				destination = arg
+				given.add("destination")
+			default:
+				return nil, false, fmt.Errorf("argument %q is not an s3:// URI, only the first argument may be a directory to upload and the last the destination", arg)
+			}
+			continue
+		}
+		location, err := ParseLocation(arg)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid source: %w", err)
+		}
+		sources = append(sources, location)
+		given.add("source")
+	}
+
+	// Fill in what the command line leaves out from the environment and the config file
+	if configPath == "" {
+		configPath = os.Getenv(envPrefix + "CONFIG")
+	}
+	if job == "" {
+		job = os.Getenv(envPrefix + "JOB")
+	}
+	layers := []settings{environment(flags, os.LookupEnv)}
+	if configPath != "" {
+		base, profile, err := loadFile(flags, configPath, job)
+		if err != nil {
+			return nil, false, err
+		}
+		layers = append(layers, profile, base)
+	} else if job != "" {
+		return nil, false, fmt.Errorf("job profile %q requires a config file", job)
+	}
+	if err := given.apply(flags, layers...); err != nil {
+		return nil, false, err
+	}
+
+	// An s3:// destination copies the sources instead of downloading them
+	var copyTarget *Location
+	if s3ops.IsURI(destination) {
+		location, err := ParseLocation(destination)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid destination: %w", err)
+		}
+		if location.Subdir != "" {
+			return nil, false, errors.New("an s3:// destination cannot have a #subdirectory")
+		}
+		copyTarget = &location
+		destination = ""
+	} else if target != (s3ops.ClientOptions{}) || streamCopy {
+		return nil, false, errors.New("--destination-profile, --destination-role-arn, --destination-region, --destination-endpoint-url and --stream-copy require an s3:// destination")
 	}
 
 	// Validate required parameters
-	if bucket == "" {
-		log.Fatal("Bucket name is required")
+	if bucket == "" && len(sources) == 0 {
+		return nil, false, errors.New("bucket name or an s3:// source is required")
+	}
+
+	if bucket != "" {
+		if err := s3ops.ValidateBucket(bucket); err != nil {
+			return nil, false, fmt.Errorf("invalid bucket: %w", err)
+		}
+		// A manifest names the objects itself, the prefix then only narrows it down, and uploads may go to the bucket's root
+		if prefix == "" && fromFile == "" && inventory == "" && uploadDir == "" {
+			return nil, false, errors.New("prefix is required")
+		}
+		sources = append([]Location{{Bucket: bucket, Prefix: prefix}}, sources...)
+	} else if prefix != "" {
+		return nil, false, errors.New("prefix requires --bucket, include it in the s3:// URI of a source instead")
+	}
+
+	for i, location := range sources {
+		for _, other := range sources[:i] {
+			if location.overlaps(other) {
+				return nil, false, fmt.Errorf("sources %s and %s overlap, give them different subdirectories", other, location)
+			}
+		}
+	}
+
+	for _, location := range sources {
+		if s3ops.IsAccessPoint(location.Bucket) && (client.EndpointURL != "" || client.PathStyle) {
+			return nil, false, fmt.Errorf("access point %s cannot be used with --endpoint-url or --path-style", location.Bucket)
+		}
+	}
+
+	if fromFile != "" && inventory != "" {
+		return nil, false, errors.New("only one of --from-file and --inventory can be given")
+	}
+
+	if (fromFile != "" || inventory != "") && len(sources) > 1 {
+		return nil, false, errors.New("--from-file and --inventory take a single source")
+	}
+
+	manifestFormat, err := source.ParseManifestFormat(fileFormat)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid manifest format: %w", err)
+	}
+
+	// Uploads go from a local directory to a single location
+	if uploadDir != "" {
+		if destination != "" || copyTarget != nil {
+			return nil, false, errors.New("a run either uploads or downloads, --upload and --destination cannot both be given")
+		}
+		if len(sources) != 1 || sources[0].Subdir != "" {
+			return nil, false, errors.New("uploads take a single s3:// location without a #subdirectory")
+		}
+		if fromFile != "" || inventory != "" {
+			return nil, false, errors.New("--from-file and --inventory only apply to downloads")
+		}
+		if len(filters.StorageClasses) > 0 {
+			return nil, false, errors.New("--storage-class only applies to downloads, use --set-storage-class to upload in a storage class")
+		}
+		info, err := os.Stat(uploadDir)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid upload directory: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, false, fmt.Errorf("upload source %s must be a directory", uploadDir)
+		}
+	} else if copyTarget != nil {
+		if err := validateCopy(*copyTarget, sources, client, target); err != nil {
+			return nil, false, err
+		}
+	} else if destination == "" {
+		return nil, false, errors.New("destination directory is required")
+	} else if write.StorageClass != "" || write.SSE != "" || write.SSEKMSKeyID != "" || len(write.Tags) > 0 || len(write.Metadata) > 0 {
+		return nil, false, errors.New("--set-storage-class, --sse, --sse-kms-key-id, --tag and --metadata only apply to uploads and copies")
+	}
+
+	if write.SSEKMSKeyID != "" && write.SSE != types.ServerSideEncryptionAwsKms && write.SSE != types.ServerSideEncryptionAwsKmsDsse {
+		return nil, false, errors.New("--sse-kms-key-id requires --sse aws:kms or aws:kms:dsse")
+	}
+
+	if partSize < upload.MinPartSize || partSize > upload.MaxPartSize {
+		return nil, false, errors.New("part size must be between 5M and 5G")
+	}
+
+	// Leave the adaptive controller room to grow
+	if maxConc == 0 {
+		maxConc = 2 * concurrency
+	}
+
+	if concurrency < 1 || minConc < 1 || minConc > concurrency || maxConc < concurrency {
+		return nil, false, fmt.Errorf("concurrency must satisfy 1 <= min-concurrency (%d) <= concurrency (%d) <= max-concurrency (%d)", minConc, concurrency, maxConc)
+	}
+
+	if listConc < 1 {
+		return nil, false, errors.New("list concurrency must be at least 1")
+	}
+
+	if resumeMiB < 0 {
+		return nil, false, errors.New("resume threshold must not be negative")
+	}
+
+	if maxAttempts < 1 {
+		return nil, false, errors.New("max attempts must be at least 1")
 	}
 
-	if prefix == "" {
-		log.Fatal("Prefix is required")
+	if baseDelay < 0 || maxDelay < 0 {
+		return nil, false, errors.New("retry delays must not be negative")
 	}
 
-	if destination == "" {
-		log.Fatal("Destination directory is required")
+	if jitter < 0 || jitter > 1 {
+		return nil, false, errors.New("retry jitter must be between 0 and 1")
 	}
 
-	// Create destination directory if it doesn't exist
-	if err := os.MkdirAll(destination, os.ModePerm); err != nil {
-		log.Fatalf("Failed to create destination directory: %v", err)
+	if filters.MaxSize > 0 && filters.MinSize > filters.MaxSize {
+		return nil, false, errors.New("min size must not exceed max size")
+	}
+
+	if !filters.ModifiedAfter.IsZero() && !filters.ModifiedBefore.IsZero() && !filters.ModifiedAfter.Before(filters.ModifiedBefore) {
+		return nil, false, errors.New("modified-after must be earlier than modified-before")
+	}
+
+	if client.EndpointURL != "" {
+		endpoint, err := url.Parse(client.EndpointURL)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return nil, false, fmt.Errorf("endpoint URL must be an http:// or https:// URL, got %q", client.EndpointURL)
+		}
+	}
+
+	if client.RoleARN == "" && (client.ExternalID != "" || client.SessionName != "" || client.MFASerial != "" || client.WebIdentityTokenFile != "") {
+		return nil, false, errors.New("--external-id, --session-name, --mfa-serial and --web-identity-token-file require --role-arn")
+	}
+
+	if client.NoSignRequest && (client.Profile != "" || client.RoleARN != "") {
+		return nil, false, errors.New("--no-sign-request cannot be combined with --profile or --role-arn")
+	}
+
+	if client.MFASerial != "" && client.WebIdentityTokenFile != "" {
+		return nil, false, errors.New("--mfa-serial cannot be combined with --web-identity-token-file")
+	}
+
+	if client.MFASerial != "" && fromFile == source.Stdin {
+		return nil, false, errors.New("--mfa-serial asks for the code on standard input, which --from-file - already reads")
+	}
+
+	if client.WebIdentityTokenFile != "" {
+		if _, err := os.Stat(client.WebIdentityTokenFile); err != nil {
+			return nil, false, fmt.Errorf("invalid web identity token file: %w", err)
+		}
+	}
+
+	if client.CABundle != "" {
+		if _, err := os.Stat(client.CABundle); err != nil {
+			return nil, false, fmt.Errorf("invalid CA bundle: %w", err)
+		}
+	}
+
+	// Mirroring compares the destination with complete listings of the sources
+	if deleteDry {
+		deleteFiles = true
+	}
+	if deleteFiles {
+		if uploadDir != "" || copyTarget != nil {
+			return nil, false, errors.New("--delete only applies to downloads")
+		}
+		if fromFile != "" || inventory != "" {
+			return nil, false, errors.New("--delete compares the destination with a listing of the sources, it cannot be combined with --from-file or --inventory")
+		}
+	} else if maxDelete != 0 || len(protect) > 0 {
+		return nil, false, errors.New("--max-delete and --delete-exclude require --delete or --delete-dry-run")
+	}
+	if maxDelete < 0 {
+		return nil, false, errors.New("max delete must not be negative")
+	}
+
+	format, err := plan.ParseFormat(planFormat)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid plan format: %w", err)
+	}
+	if dryRun && (uploadDir != "" || copyTarget != nil) {
+		return nil, false, errors.New("--dry-run only applies to downloads")
+	}
+	if !dryRun && (planFormat != "" || planFile != "") {
+		return nil, false, errors.New("--plan-format and --plan-file require --dry-run")
+	}
+	if pricing.TransferPerGB < 0 {
+		return nil, false, errors.New("transfer price must not be negative")
+	}
+
+	syncStrategy, err := transfer.ParseSyncStrategy(syncMode)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid sync mode: %w", err)
+	}
+
+	// Create destination directory if it doesn't exist, a dry run leaves the disk untouched
+	if destination != "" && !dryRun {
+		if err := os.MkdirAll(destination, os.ModePerm); err != nil {
+			return nil, false, fmt.Errorf("failed to create destination directory: %w", err)
+		}
+	}
+
+	// The destination is reached with the sources' connection settings and credentials, unless others are given
+	targetClient := client
+	targetClient.Region = target.Region
+	targetClient.NoSignRequest = false
+	if target.EndpointURL != "" {
+		targetClient.EndpointURL = target.EndpointURL
+	}
+	if target.Profile != "" || target.RoleARN != "" {
+		targetClient.Profile = target.Profile
+		targetClient.RoleARN = target.RoleARN
+		targetClient.ExternalID = ""
+		targetClient.SessionName = ""
+		targetClient.MFASerial = ""
+		targetClient.WebIdentityTokenFile = ""
+	}
+
+	// Server-side copies read the sources with the destination's credentials, within one store and partition
+	if copyTarget != nil && (target.Profile != "" || target.RoleARN != "" || target.EndpointURL != "") {
+		streamCopy = true
+	}
+	for _, location := range sources {
+		if copyTarget != nil && crossPartition(location.Bucket, client.Region, copyTarget.Bucket, target.Region) {
+			streamCopy = true
+		}
 	}
 
 	return &Config{
-		Bucket:      bucket,
-		Prefix:      prefix,
-		Destination: destination,
-		Concurrency: concurrency,
-		Version:     version,
-	}, false
+		Sources:         sources,
+		Target:          copyTarget,
+		TargetClient:    targetClient,
+		StreamCopy:      streamCopy,
+		Upload:          uploadDir,
+		PartSize:        partSize,
+		Write:           write,
+		FromFile:        fromFile,
+		FromFileFormat:  manifestFormat,
+		Inventory:       inventory,
+		Destination:     destination,
+		Delete:          deleteFiles,
+		DeleteDryRun:    deleteDry,
+		MaxDelete:       maxDelete,
+		Protect:         protect,
+		DryRun:          dryRun,
+		PlanFormat:      format,
+		PlanFile:        planFile,
+		Pricing:         pricing,
+		Concurrency:     concurrency,
+		MinConcurrency:  minConc,
+		MaxConcurrency:  maxConc,
+		ListConcurrency: listConc,
+		Sync:            syncStrategy,
+		Verify:          verify,
+		ResumeThreshold: resumeMiB * 1024 * 1024,
+		Retry: retry.Policy{
+			MaxAttempts: maxAttempts,
+			BaseDelay:   baseDelay,
+			MaxDelay:    maxDelay,
+			Jitter:      jitter,
+		},
+		Filter:  &filters,
+		Client:  client,
+		Version: version,
+	}, false, nil
+}
+
+// validateCopy checks the sources and options of a copy to an S3 destination
+func validateCopy(target Location, sources []Location, client, overrides s3ops.ClientOptions) error {
+	if err := s3ops.ValidateBucket(target.Bucket); err != nil {
+		return fmt.Errorf("invalid destination bucket: %w", err)
+	}
+	if s3ops.IsAccessPoint(target.Bucket) && (overrides.EndpointURL != "" || client.EndpointURL != "" || client.PathStyle) {
+		return fmt.Errorf("access point %s cannot be used with an endpoint URL or --path-style", target.Bucket)
+	}
+	if overrides.EndpointURL != "" {
+		endpoint, err := url.Parse(overrides.EndpointURL)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return fmt.Errorf("destination endpoint URL must be an http:// or https:// URL, got %q", overrides.EndpointURL)
+		}
+	}
+	// Keys are copied whole under the destination prefix, so a destination within the listed prefix
+	// of the same bucket would list and copy its own copies
+	if overrides.EndpointURL == "" {
+		for _, location := range sources {
+			prefix := upload.Key(upload.Key(target.Prefix, filepath.ToSlash(location.Subdir)), "")
+			if location.Bucket == target.Bucket && strings.HasPrefix(prefix+location.Prefix, location.Prefix) {
+				return fmt.Errorf("copying %s to %s would copy objects onto themselves or into the copied prefix", location, target)
+			}
+		}
+	}
+	return nil
+}
+
+// crossPartition reports whether two buckets are known to be in different AWS partitions, such as aws and aws-cn,
+// judging by their access point ARNs or given regions. Server-side copies cannot cross partitions.
+func crossPartition(bucket, region, otherBucket, otherRegion string) bool {
+	partition := func(bucket, region string) string {
+		if accessPoint, err := s3ops.ParseAccessPoint(bucket); err == nil {
+			return accessPoint.Partition
+		}
+		switch {
+		case region == "":
+			return ""
+		case strings.HasPrefix(region, "cn-"):
+			return "aws-cn"
+		case strings.HasPrefix(region, "us-gov-"):
+			return "aws-us-gov"
+		default:
+			return "aws"
+		}
+	}
+	a, b := partition(bucket, region), partition(otherBucket, otherRegion)
+	return a != "" && b != "" && a != b
 }
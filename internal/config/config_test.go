@@ -3,22 +3,30 @@ package config
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
-)
+	"time"
 
-func TestParse(t *testing.T) {
-	// Save original flag values and restore them after test
-	oldFlagCommandLine := flag.CommandLine
-	defer func() { flag.CommandLine = oldFlagCommandLine }()
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/user/s3cpbp/internal/plan"
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
 
-	// Reset flags for each test case
-	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+// defaultRetry is the retry policy used when no retry flags are given
+var defaultRetry = retry.Policy{MaxAttempts: 5, BaseDelay: 500 * time.Millisecond, MaxDelay: 20 * time.Second, Jitter: 0.5}
 
+func TestParse(t *testing.T) {
 	tests := []struct {
 		name          string
 		args          []string
 		version       string
 		expectedCfg   *Config
+		included      []s3ops.ObjectInfo // Objects the filter must include
+		excluded      []s3ops.ObjectInfo // Objects the filter must exclude
 		expectVersion bool
 		wantErr       bool
 		tempDir       bool
@@ -28,11 +36,15 @@ func TestParse(t *testing.T) {
 			args:    []string{"-bucket", "test-bucket", "-prefix", "test-prefix", "-destination", "test-dest", "-concurrency", "5"},
 			version: "1.0.0",
 			expectedCfg: &Config{
-				Bucket:      "test-bucket",
-				Prefix:      "test-prefix",
-				Destination: "test-dest",
-				Concurrency: 5,
-				Version:     "1.0.0",
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Concurrency:     5,
+				MinConcurrency:  1,
+				MaxConcurrency:  10,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
 			},
 			expectVersion: false,
 			wantErr:       false,
@@ -42,15 +54,432 @@ func TestParse(t *testing.T) {
 			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-c", "5"},
 			version: "1.0.0",
 			expectedCfg: &Config{
-				Bucket:      "test-bucket",
-				Prefix:      "test-prefix",
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Concurrency:     5,
+				MinConcurrency:  1,
+				MaxConcurrency:  10,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "sync mode",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-sync", "size-mtime"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				Sync:            transfer.SyncSizeMtime,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "verify downloads",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-verify"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				Verify:          true,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "resuming disabled",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-resume-threshold", "0"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "retry policy",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-max-attempts", "8", "-retry-base-delay", "1s", "-retry-max-delay", "1m", "-retry-jitter", "0"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           retry.Policy{MaxAttempts: 8, BaseDelay: time.Second, MaxDelay: time.Minute},
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "adaptive concurrency",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-c", "20", "-min-concurrency", "5", "-max-concurrency", "200", "-list-concurrency", "32"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Concurrency:     20,
+				MinConcurrency:  5,
+				MaxConcurrency:  200,
+				ListConcurrency: 32,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "filters",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-exclude", "*", "-include", "*.parquet", "-exclude", "_temporary/"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			included:      []s3ops.ObjectInfo{{Key: "test-prefix/a.parquet"}},
+			excluded:      []s3ops.ObjectInfo{{Key: "test-prefix/a.json"}, {Key: "test-prefix/_temporary/a.parquet"}},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name: "attribute filters",
+			args: []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest",
+				"-max-size", "2G", "-modified-after", "2024-10-01T00:00:00Z", "-storage-class", "standard,glacier_ir"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			included: []s3ops.ObjectInfo{
+				{Key: "a", Size: 1 << 30, LastModified: time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC), StorageClass: "STANDARD"},
+				{Key: "b", Size: 2 << 30, LastModified: time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), StorageClass: "GLACIER_IR"},
+			},
+			excluded: []s3ops.ObjectInfo{
+				{Key: "c", Size: 2<<30 + 1, LastModified: time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC), StorageClass: "STANDARD"},
+				{Key: "d", Size: 1, LastModified: time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC), StorageClass: "STANDARD"},
+				{Key: "e", Size: 1, LastModified: time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC), StorageClass: "GLACIER"},
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "manifest from stdin",
+			args:    []string{"-b", "test-bucket", "-d", "test-dest", "-from-file", "-", "-from-file-format", "csv"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket"}},
+				FromFile:        "-",
+				FromFileFormat:  "csv",
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "inventory report without prefix",
+			args:    []string{"-b", "test-bucket", "-d", "test-dest", "-inventory", "s3://inventory-bucket/test-bucket/daily/manifest.json"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket"}},
+				Inventory:       "s3://inventory-bucket/test-bucket/daily/manifest.json",
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "aws-cli style arguments",
+			args:    []string{"s3://test-bucket/test-prefix", "test-dest", "-sync", "size-only"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Sync:            transfer.SyncSizeOnly,
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "access point arn",
+			args:    []string{"s3://arn:aws:s3:us-west-2:123456789012:accesspoint/my-ap/logs/", "test-dest"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "arn:aws:s3:us-west-2:123456789012:accesspoint/my-ap", Prefix: "logs/"}},
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "multi-region access point arn flag",
+			args:    []string{"-b", "arn:aws:s3::123456789012:accesspoint/mfzwi23gnjvgw.mrap", "-p", "logs/", "-d", "test-dest"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "arn:aws:s3::123456789012:accesspoint/mfzwi23gnjvgw.mrap", Prefix: "logs/"}},
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "s3-compatible endpoint",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-endpoint-url", "http://localhost:9000", "-path-style", "-region", "us-east-1", "-no-verify-ssl"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Client: s3ops.ClientOptions{
+					EndpointURL: "http://localhost:9000",
+					PathStyle:   true,
+					Region:      "us-east-1",
+					NoVerifySSL: true,
+				},
+				Version: "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "multiple sources",
+			args:    []string{"-b", "bucket-a", "-p", "logs/2024-10-01/", "-d", "test-dest", "-source", "s3://bucket-a/logs/2024-10-02/", "s3://bucket-b/exports/#b"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources: []Location{
+					{Bucket: "bucket-a", Prefix: "logs/2024-10-01/"},
+					{Bucket: "bucket-a", Prefix: "logs/2024-10-02/"},
+					{Bucket: "bucket-b", Prefix: "exports/", Subdir: "b"},
+				},
+				Destination:     "test-dest",
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "assume role",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-profile", "base", "-role-arn", "arn:aws:iam::123456789012:role/reader", "-external-id", "ext-1", "-session-name", "nightly", "-mfa-serial", "arn:aws:iam::111111111111:mfa/me"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:     []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
 				Destination: "test-dest",
-				Concurrency: 5,
-				Version:     "1.0.0",
+				Client: s3ops.ClientOptions{
+					Profile:     "base",
+					RoleARN:     "arn:aws:iam::123456789012:role/reader",
+					ExternalID:  "ext-1",
+					SessionName: "nightly",
+					MFASerial:   "arn:aws:iam::111111111111:mfa/me",
+				},
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
 			},
 			expectVersion: false,
 			wantErr:       false,
 		},
+		{
+			name:    "public dataset",
+			args:    []string{"s3://test-bucket/test-prefix", "test-dest", "-no-sign-request"},
+			version: "1.0.0",
+			expectedCfg: &Config{
+				Sources:         []Location{{Bucket: "test-bucket", Prefix: "test-prefix"}},
+				Destination:     "test-dest",
+				Client:          s3ops.ClientOptions{NoSignRequest: true},
+				Concurrency:     50,
+				MinConcurrency:  1,
+				MaxConcurrency:  100,
+				ListConcurrency: 8,
+				ResumeThreshold: 64 * 1024 * 1024,
+				Retry:           defaultRetry,
+				Version:         "1.0.0",
+			},
+			expectVersion: false,
+			wantErr:       false,
+		},
+		{
+			name:    "external id without role",
+			args:    []string{"s3://test-bucket/test-prefix", "test-dest", "-external-id", "ext-1"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "anonymous with profile",
+			args:    []string{"s3://test-bucket/test-prefix", "test-dest", "-no-sign-request", "-profile", "base"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "mfa with manifest on stdin",
+			args:    []string{"-b", "test-bucket", "-d", "test-dest", "-from-file", "-", "-role-arn", "arn:aws:iam::123456789012:role/reader", "-mfa-serial", "arn:aws:iam::111111111111:mfa/me"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "missing web identity token file",
+			args:    []string{"s3://test-bucket/test-prefix", "test-dest", "-role-arn", "arn:aws:iam::123456789012:role/reader", "-web-identity-token-file", "missing-token"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "missing bucket",
+			args:    []string{"-d", "test-dest"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "missing destination",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "invalid bucket",
+			args:    []string{"-b", "s3://test-bucket", "-p", "test-prefix", "-d", "test-dest"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "prefix without bucket",
+			args:    []string{"-p", "test-prefix", "s3://test-bucket/logs/", "test-dest"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "overlapping sources",
+			args:    []string{"s3://test-bucket/logs/", "s3://test-bucket/logs/2024/", "test-dest"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "argument between sources",
+			args:    []string{"s3://test-bucket/logs/", "test-dest", "s3://test-bucket/other/"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "destination given twice",
+			args:    []string{"-d", "test-dest", "s3://test-bucket/logs/", "other-dest"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "access point with endpoint",
+			args:    []string{"s3://arn:aws:s3:us-west-2:123456789012:accesspoint/my-ap/logs/", "test-dest", "-endpoint-url", "http://localhost:9000"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-unknown"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "invalid concurrency bounds",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-c", "10", "-max-concurrency", "5"},
+			version: "1.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "job without config file",
+			args:    []string{"-b", "test-bucket", "-p", "test-prefix", "-d", "test-dest", "-job", "nightly"},
+			version: "1.0.0",
+			wantErr: true,
+		},
 		{
 			name:          "version flag",
 			args:          []string{"-version"},
@@ -71,9 +500,6 @@ func TestParse(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Reset flags
-			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-
 			// Create temp dir if needed
 			var tempDir string
 			if tt.tempDir {
@@ -94,29 +520,11 @@ func TestParse(t *testing.T) {
 				}
 			}
 
-			// Set up test
-			os.Args = append([]string{"cmd"}, tt.args...)
-
-			// Call function under test with custom exit function to prevent os.Exit
-			var originalOsExit = osExit
-			defer func() { osExit = originalOsExit }()
-
-			// Use a panic to simulate os.Exit without actually exiting
-			osExit = func(code int) {
-				panic("os.Exit called")
+			cfg, showVersion, err := Parse(tt.args, tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
-			// Setup recovery to catch the panic
-			defer func() {
-				if r := recover(); r != nil {
-					if r != "os.Exit called" {
-						t.Errorf("unexpected panic: %v", r)
-					}
-				}
-			}()
-
-			cfg, showVersion := Parse(tt.version)
-
 			// Check results
 			if tt.expectVersion != showVersion {
 				t.Errorf("Parse() showVersion = %v, want %v", showVersion, tt.expectVersion)
@@ -126,11 +534,17 @@ func TestParse(t *testing.T) {
 				if cfg == nil {
 					t.Fatalf("Parse() returned nil Config, expected non-nil")
 				}
-				if cfg.Bucket != tt.expectedCfg.Bucket {
-					t.Errorf("Parse() Bucket = %v, want %v", cfg.Bucket, tt.expectedCfg.Bucket)
+				if !slices.Equal(cfg.Sources, tt.expectedCfg.Sources) {
+					t.Errorf("Parse() Sources = %v, want %v", cfg.Sources, tt.expectedCfg.Sources)
 				}
-				if cfg.Prefix != tt.expectedCfg.Prefix {
-					t.Errorf("Parse() Prefix = %v, want %v", cfg.Prefix, tt.expectedCfg.Prefix)
+				if cfg.Client != tt.expectedCfg.Client {
+					t.Errorf("Parse() Client = %+v, want %+v", cfg.Client, tt.expectedCfg.Client)
+				}
+				if cfg.Inventory != tt.expectedCfg.Inventory {
+					t.Errorf("Parse() Inventory = %q, want %q", cfg.Inventory, tt.expectedCfg.Inventory)
+				}
+				if cfg.FromFile != tt.expectedCfg.FromFile || cfg.FromFileFormat != tt.expectedCfg.FromFileFormat {
+					t.Errorf("Parse() FromFile = %q (%q), want %q (%q)", cfg.FromFile, cfg.FromFileFormat, tt.expectedCfg.FromFile, tt.expectedCfg.FromFileFormat)
 				}
 				if cfg.Destination != tt.expectedCfg.Destination {
 					t.Errorf("Parse() Destination = %v, want %v", cfg.Destination, tt.expectedCfg.Destination)
@@ -138,6 +552,35 @@ func TestParse(t *testing.T) {
 				if cfg.Concurrency != tt.expectedCfg.Concurrency {
 					t.Errorf("Parse() Concurrency = %v, want %v", cfg.Concurrency, tt.expectedCfg.Concurrency)
 				}
+				if cfg.MinConcurrency != tt.expectedCfg.MinConcurrency || cfg.MaxConcurrency != tt.expectedCfg.MaxConcurrency {
+					t.Errorf("Parse() concurrency bounds = %d-%d, want %d-%d",
+						cfg.MinConcurrency, cfg.MaxConcurrency, tt.expectedCfg.MinConcurrency, tt.expectedCfg.MaxConcurrency)
+				}
+				if cfg.ListConcurrency != tt.expectedCfg.ListConcurrency {
+					t.Errorf("Parse() ListConcurrency = %v, want %v", cfg.ListConcurrency, tt.expectedCfg.ListConcurrency)
+				}
+				if cfg.Sync != tt.expectedCfg.Sync {
+					t.Errorf("Parse() Sync = %v, want %v", cfg.Sync, tt.expectedCfg.Sync)
+				}
+				if cfg.Verify != tt.expectedCfg.Verify {
+					t.Errorf("Parse() Verify = %v, want %v", cfg.Verify, tt.expectedCfg.Verify)
+				}
+				if cfg.ResumeThreshold != tt.expectedCfg.ResumeThreshold {
+					t.Errorf("Parse() ResumeThreshold = %v, want %v", cfg.ResumeThreshold, tt.expectedCfg.ResumeThreshold)
+				}
+				if cfg.Retry != tt.expectedCfg.Retry {
+					t.Errorf("Parse() Retry = %+v, want %+v", cfg.Retry, tt.expectedCfg.Retry)
+				}
+				for _, obj := range tt.included {
+					if !cfg.Filter.Match(obj) {
+						t.Errorf("Parse() Filter excludes %q", obj.Key)
+					}
+				}
+				for _, obj := range tt.excluded {
+					if cfg.Filter.Match(obj) {
+						t.Errorf("Parse() Filter includes %q", obj.Key)
+					}
+				}
 				if cfg.Version != tt.expectedCfg.Version {
 					t.Errorf("Parse() Version = %v, want %v", cfg.Version, tt.expectedCfg.Version)
 				}
@@ -146,5 +589,293 @@ func TestParse(t *testing.T) {
 	}
 }
 
-// Redefine the osExit variable to allow testing fatal errors
-var osExit = os.Exit
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected Location
+		wantErr  bool
+	}{
+		{value: "s3://bucket", expected: Location{Bucket: "bucket"}},
+		{value: "s3://bucket/", expected: Location{Bucket: "bucket"}},
+		{value: "s3://bucket/logs/date=2024-10-01/", expected: Location{Bucket: "bucket", Prefix: "logs/date=2024-10-01/"}},
+		{value: "s3://bucket/logs/#day1/", expected: Location{Bucket: "bucket", Prefix: "logs/", Subdir: "day1"}},
+		{value: "s3://bucket/logs/#.", expected: Location{Bucket: "bucket", Prefix: "logs/"}},
+		{value: "s3://bucket/logs/#../up", wantErr: true},
+		{value: "s3://bucket/logs/#/abs", wantErr: true},
+		{value: "bucket/logs/", wantErr: true},
+		{value: "s3:///logs/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			location, err := ParseLocation(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLocation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && location != tt.expected {
+				t.Errorf("ParseLocation() = %+v, want %+v", location, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLocationOverlaps(t *testing.T) {
+	logs := Location{Bucket: "a", Prefix: "logs/"}
+	tests := []struct {
+		name     string
+		other    Location
+		expected bool
+	}{
+		{name: "same prefix", other: Location{Bucket: "a", Prefix: "logs/"}, expected: true},
+		{name: "nested prefix", other: Location{Bucket: "a", Prefix: "logs/2024/"}, expected: true},
+		{name: "whole bucket", other: Location{Bucket: "a"}, expected: true},
+		{name: "sibling prefix", other: Location{Bucket: "a", Prefix: "exports/"}, expected: false},
+		{name: "other bucket", other: Location{Bucket: "b", Prefix: "logs/"}, expected: false},
+		{name: "other subdirectory", other: Location{Bucket: "a", Prefix: "logs/", Subdir: "copy"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logs.overlaps(tt.other); got != tt.expected {
+				t.Errorf("overlaps() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+		verify   bool
+	}{
+		{name: "flags first", args: []string{"-verify", "s3://bucket/logs/", "dest"}, expected: []string{"s3://bucket/logs/", "dest"}, verify: true},
+		{name: "flags last", args: []string{"s3://bucket/logs/", "dest", "-verify"}, expected: []string{"s3://bucket/logs/", "dest"}, verify: true},
+		{name: "flags between", args: []string{"s3://bucket/logs/", "-verify", "dest"}, expected: []string{"s3://bucket/logs/", "dest"}, verify: true},
+		{name: "terminator", args: []string{"s3://bucket/logs/", "--", "-verify"}, expected: []string{"s3://bucket/logs/", "-verify"}},
+		{name: "no arguments", args: []string{"-verify"}, expected: nil, verify: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			verify := flags.Bool("verify", false, "")
+			got, err := parseArgs(flags, tt.args)
+			if err != nil {
+				t.Fatalf("parseArgs() returned unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("parseArgs() = %q, want %q", got, tt.expected)
+			}
+			if *verify != tt.verify {
+				t.Errorf("parseArgs() parsed -verify = %v, want %v", *verify, tt.verify)
+			}
+		})
+	}
+}
+
+func TestParse_Upload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	t.Run("positional", func(t *testing.T) {
+		cfg, _, err := Parse([]string{dir, "s3://test-bucket/uploads", "-part-size", "64M", "-set-storage-class", "standard_ia",
+			"-sse", "aws:kms", "-sse-kms-key-id", "alias/uploads", "-tag", "team=data", "-metadata", "origin=etl"}, "1.0.0")
+		if err != nil {
+			t.Fatalf("Parse() returned unexpected error: %v", err)
+		}
+		expectedSources := []Location{{Bucket: "test-bucket", Prefix: "uploads"}}
+		if cfg.Upload != dir || cfg.Destination != "" || !slices.Equal(cfg.Sources, expectedSources) {
+			t.Errorf("Parse() Upload = %q, Destination = %q, Sources = %v, want %q to %v", cfg.Upload, cfg.Destination, cfg.Sources, dir, expectedSources)
+		}
+		if cfg.PartSize != 64*1024*1024 {
+			t.Errorf("Parse() PartSize = %d, want 64 MiB", cfg.PartSize)
+		}
+		write := cfg.Write
+		if write.StorageClass != types.StorageClassStandardIa || write.SSE != types.ServerSideEncryptionAwsKms || write.SSEKMSKeyID != "alias/uploads" {
+			t.Errorf("Parse() Write = %+v", write)
+		}
+		if write.Tags["team"] != "data" || write.Metadata["origin"] != "etl" {
+			t.Errorf("Parse() Tags = %v, Metadata = %v", write.Tags, write.Metadata)
+		}
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		cfg, _, err := Parse([]string{"-upload", dir, "-b", "test-bucket"}, "1.0.0")
+		if err != nil {
+			t.Fatalf("Parse() returned unexpected error: %v", err)
+		}
+		// Uploads may go to the root of the bucket, in parts of 8 MiB by default
+		if cfg.Upload != dir || !slices.Equal(cfg.Sources, []Location{{Bucket: "test-bucket"}}) || cfg.PartSize != 8*1024*1024 {
+			t.Errorf("Parse() Upload = %q, Sources = %v, PartSize = %d", cfg.Upload, cfg.Sources, cfg.PartSize)
+		}
+	})
+
+	errorTests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"upload and destination", []string{dir, "s3://test-bucket/uploads/", "test-dest"}, "either uploads or downloads"},
+		{"upload given twice", []string{"-upload", dir, dir, "s3://test-bucket/uploads/"}, "upload directory given twice"},
+		{"several targets", []string{dir, "s3://test-bucket/a/", "s3://test-bucket/b/"}, "single s3:// location"},
+		{"target subdirectory", []string{dir, "s3://test-bucket/a/#sub"}, "single s3:// location"},
+		{"missing directory", []string{filepath.Join(dir, "missing"), "s3://test-bucket/a/"}, "invalid upload directory"},
+		{"file instead of directory", []string{file, "s3://test-bucket/a/"}, "must be a directory"},
+		{"manifest", []string{dir, "s3://test-bucket/a/", "-from-file", file}, "only apply to downloads"},
+		{"storage class filter", []string{dir, "s3://test-bucket/a/", "-storage-class", "glacier"}, "use --set-storage-class"},
+		{"write options for downloads", []string{"s3://test-bucket/a/", "test-dest", "-tag", "team=data"}, "only apply to uploads"},
+		{"KMS key without KMS", []string{dir, "s3://test-bucket/a/", "-sse", "AES256", "-sse-kms-key-id", "alias/uploads"}, "requires --sse aws:kms"},
+		{"part size too small", []string{dir, "s3://test-bucket/a/", "-part-size", "1M"}, "part size must be between"},
+		{"unknown storage class", []string{dir, "s3://test-bucket/a/", "-set-storage-class", "cold"}, "unknown storage class"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Parse(tt.args, "1.0.0")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParse_Copy(t *testing.T) {
+	t.Run("positional", func(t *testing.T) {
+		cfg, _, err := Parse([]string{"s3://src-bucket/logs/", "s3://other-bucket/data/#sub", "s3://dst-bucket/backup", "-tag", "team=data",
+			"-region", "eu-west-1", "-profile", "prod"}, "1.0.0")
+		if err != nil {
+			t.Fatalf("Parse() returned unexpected error: %v", err)
+		}
+		expectedSources := []Location{{Bucket: "src-bucket", Prefix: "logs/"}, {Bucket: "other-bucket", Prefix: "data/", Subdir: "sub"}}
+		if cfg.Target == nil || *cfg.Target != (Location{Bucket: "dst-bucket", Prefix: "backup"}) || cfg.Destination != "" || !slices.Equal(cfg.Sources, expectedSources) {
+			t.Fatalf("Parse() Target = %v, Destination = %q, Sources = %v", cfg.Target, cfg.Destination, cfg.Sources)
+		}
+		// The destination uses the same credentials, its region is detected on its own
+		if cfg.TargetClient.Profile != "prod" || cfg.TargetClient.Region != "" || cfg.StreamCopy || cfg.Write.Tags["team"] != "data" {
+			t.Errorf("Parse() TargetClient = %+v, StreamCopy = %v, Write = %+v", cfg.TargetClient, cfg.StreamCopy, cfg.Write)
+		}
+	})
+
+	t.Run("other account", func(t *testing.T) {
+		cfg, _, err := Parse([]string{"-d", "s3://dst-bucket/", "s3://src-bucket/logs/", "-role-arn", "arn:aws:iam::123456789012:role/read",
+			"-external-id", "ext", "-destination-role-arn", "arn:aws:iam::210987654321:role/write", "-destination-region", "us-east-2"}, "1.0.0")
+		if err != nil {
+			t.Fatalf("Parse() returned unexpected error: %v", err)
+		}
+		target := cfg.TargetClient
+		if target.RoleARN != "arn:aws:iam::210987654321:role/write" || target.ExternalID != "" || target.Region != "us-east-2" || !cfg.StreamCopy {
+			t.Errorf("Parse() TargetClient = %+v, StreamCopy = %v, want the destination role streamed", target, cfg.StreamCopy)
+		}
+		if cfg.Client.RoleARN != "arn:aws:iam::123456789012:role/read" || cfg.Client.ExternalID != "ext" {
+			t.Errorf("Parse() Client = %+v, want the source role", cfg.Client)
+		}
+	})
+
+	t.Run("other partition", func(t *testing.T) {
+		cfg, _, err := Parse([]string{"s3://src-bucket/logs/", "s3://dst-bucket/", "-region", "us-east-1", "-destination-region", "cn-north-1"}, "1.0.0")
+		if err != nil {
+			t.Fatalf("Parse() returned unexpected error: %v", err)
+		}
+		if !cfg.StreamCopy {
+			t.Error("Parse() StreamCopy = false, want copies from aws to aws-cn streamed")
+		}
+	})
+
+	errorTests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"destination subdirectory", []string{"s3://src-bucket/logs/", "s3://dst-bucket/a/#sub"}, "cannot have a #subdirectory"},
+		{"same prefix", []string{"s3://src-bucket/logs/", "s3://src-bucket/logs/"}, "onto themselves"},
+		{"bucket root", []string{"s3://src-bucket/logs/", "s3://src-bucket"}, "onto themselves"},
+		{"within the source", []string{"s3://src-bucket/logs/", "s3://src-bucket/logs/copy/"}, "onto themselves"},
+		{"destination flags for downloads", []string{"s3://src-bucket/logs/", "test-dest", "-destination-profile", "prod"}, "require an s3:// destination"},
+		{"invalid destination endpoint", []string{"s3://src-bucket/logs/", "s3://dst-bucket/", "-destination-endpoint-url", "minio:9000"}, "destination endpoint URL"},
+		{"upload to a copy target", []string{"-upload", t.TempDir(), "-b", "test-bucket", "-d", "s3://dst-bucket/"}, "either uploads or downloads"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Parse(tt.args, "1.0.0")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A destination under another prefix of the same bucket is fine
+	if _, _, err := Parse([]string{"s3://src-bucket/logs/", "s3://src-bucket/backup/"}, "1.0.0"); err != nil {
+		t.Errorf("Parse() returned unexpected error: %v", err)
+	}
+}
+
+func TestParse_Delete(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "mirror")
+	cfg, _, err := Parse([]string{"s3://test-bucket/logs/", dest, "-delete-dry-run", "-max-delete", "100", "-delete-exclude", "local/"}, "1.0.0")
+	if err != nil {
+		t.Fatalf("Parse() returned unexpected error: %v", err)
+	}
+	if !cfg.Delete || !cfg.DeleteDryRun || cfg.MaxDelete != 100 || !cfg.Protect.Match("local/notes.txt") {
+		t.Errorf("Parse() Delete = %v, DeleteDryRun = %v, MaxDelete = %d, Protect = %v", cfg.Delete, cfg.DeleteDryRun, cfg.MaxDelete, cfg.Protect)
+	}
+
+	errorTests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"uploads", []string{"-delete", t.TempDir(), "s3://test-bucket/logs/"}, "only applies to downloads"},
+		{"copies", []string{"-delete", "s3://test-bucket/logs/", "s3://other-bucket/"}, "only applies to downloads"},
+		{"manifest", []string{"-delete", "s3://test-bucket/logs/", dest, "-from-file", "keys.txt"}, "cannot be combined with --from-file"},
+		{"limit without delete", []string{"s3://test-bucket/logs/", dest, "-max-delete", "10"}, "require --delete"},
+		{"protection without delete", []string{"s3://test-bucket/logs/", dest, "-delete-exclude", "*.txt"}, "require --delete"},
+		{"negative limit", []string{"s3://test-bucket/logs/", dest, "-delete", "-max-delete", "-1"}, "must not be negative"},
+		{"invalid pattern", []string{"s3://test-bucket/logs/", dest, "-delete", "-delete-exclude", "re:("}, "invalid pattern"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Parse(tt.args, "1.0.0")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParse_DryRun(t *testing.T) {
+	// A dry run doesn't create the destination
+	dest := filepath.Join(t.TempDir(), "new")
+	cfg, _, err := Parse([]string{"s3://test-bucket/logs/", dest, "-dry-run", "-plan-format", "json", "-plan-file", "plan.json", "-transfer-price", "0"}, "1.0.0")
+	if err != nil {
+		t.Fatalf("Parse() returned unexpected error: %v", err)
+	}
+	if !cfg.DryRun || cfg.PlanFormat != plan.FormatJSON || cfg.PlanFile != "plan.json" || cfg.Pricing.TransferPerGB != 0 || cfg.Pricing.GetPer1000 != plan.DefaultPricing.GetPer1000 {
+		t.Errorf("Parse() DryRun = %v, PlanFormat = %q, PlanFile = %q, Pricing = %+v", cfg.DryRun, cfg.PlanFormat, cfg.PlanFile, cfg.Pricing)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("Parse() created the destination of a dry run: %v", err)
+	}
+
+	errorTests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"uploads", []string{"-dry-run", t.TempDir(), "s3://test-bucket/logs/"}, "only applies to downloads"},
+		{"plan file without dry run", []string{"s3://test-bucket/logs/", dest, "-plan-file", "plan.json"}, "require --dry-run"},
+		{"unknown format", []string{"s3://test-bucket/logs/", dest, "-dry-run", "-plan-format", "yaml"}, "invalid plan format"},
+		{"negative price", []string{"s3://test-bucket/logs/", dest, "-dry-run", "-transfer-price", "-1"}, "must not be negative"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Parse(tt.args, "1.0.0")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// envPrefix starts the environment variables that set flags, e.g. S3CPBP_MAX_CONCURRENCY for --max-concurrency
+const envPrefix = "S3CPBP_"
+
+// profilesKey holds the job profiles of a config file, by name
+const profilesKey = "profiles"
+
+// shorthands maps the one-letter flags to the long names used in the environment and config files
+var shorthands = map[string]string{"b": "bucket", "p": "prefix", "d": "destination", "c": "concurrency", "v": "version"}
+
+// unlayered flags are only read from the command line, as they select the other layers or skip them
+var unlayered = map[string]bool{"config": true, "job": true, "version": true}
+
+// repeatable flags add a value every time they are given. Environment variables list them one per line,
+// as patterns, tags and keys may contain commas.
+var repeatable = map[string]bool{"source": true, "include": true, "exclude": true, "filter-file": true, "storage-class": true, "tag": true, "metadata": true, "delete-exclude": true}
+
+// groups are flags that replace each other: a layer setting any of them overrides all of them from the layers
+// below, so that the sources, filter rules or direction of the command line are never mixed with those of a config file
+var groups = [][]string{{"bucket", "prefix", "source"}, {"filter-file", "include", "exclude"}, {"destination", "upload"}}
+
+// setting is a flag's values from the environment or a config file
+type setting struct {
+	name   string
+	values []string
+	origin string // Where the setting comes from, for errors
+}
+
+// settings are the flag values of one layer, in the order they are applied
+type settings []setting
+
+// given tracks the flags set by the command line or a layer of higher precedence, by long name
+type given map[string]bool
+
+// givenFlags returns the flags set on the command line
+func givenFlags(flags *flag.FlagSet) given {
+	g := given{}
+	flags.Visit(func(f *flag.Flag) { g.add(f.Name) })
+	return g
+}
+
+// add marks a flag and the other flags of its group as given
+func (g given) add(name string) {
+	if long, ok := shorthands[name]; ok {
+		name = long
+	}
+	g[name] = true
+	for _, group := range groups {
+		if slices.Contains(group, name) {
+			for _, member := range group {
+				g[member] = true
+			}
+		}
+	}
+}
+
+// apply sets the flags that aren't given yet from the layers, highest precedence first
+func (g given) apply(flags *flag.FlagSet, layers ...settings) error {
+	for _, layer := range layers {
+		var set []string
+		for _, s := range layer {
+			if g[s.name] {
+				continue
+			}
+			for _, value := range s.values {
+				if err := flags.Set(s.name, value); err != nil {
+					return fmt.Errorf("invalid value %q for %s: %w", value, s.origin, err)
+				}
+			}
+			set = append(set, s.name)
+		}
+		// Only after the whole layer, as the flags of one group complement each other within it
+		for _, name := range set {
+			g.add(name)
+		}
+	}
+	return nil
+}
+
+// environment reads the flags set through S3CPBP_* variables, empty variables count as unset.
+// Filter rules apply as filter files first, then includes, then excludes.
+func environment(flags *flag.FlagSet, lookup func(string) (string, bool)) settings {
+	var layer settings
+	flags.VisitAll(func(f *flag.Flag) {
+		if _, short := shorthands[f.Name]; short || unlayered[f.Name] {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			return
+		}
+		values := []string{value}
+		if repeatable[f.Name] {
+			values = strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == '\r' })
+		}
+		layer = append(layer, setting{name: f.Name, values: values, origin: name})
+	})
+
+	ruleOrder := map[string]int{"filter-file": 1, "include": 2, "exclude": 3}
+	slices.SortStableFunc(layer, func(a, b setting) int { return ruleOrder[a.name] - ruleOrder[b.name] })
+	return layer
+}
+
+// loadFile reads the top-level settings of a config file, and those of the job profile if one is selected
+func loadFile(flags *flag.FlagSet, path, job string) (base, profile settings, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var doc *table
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		doc, err = parseYAML(data)
+	case ".toml":
+		doc, err = parseTOML(data)
+	case ".json":
+		doc, err = parseJSON(data)
+	default:
+		return nil, nil, fmt.Errorf("config file %s must end in .yaml, .yml, .toml or .json", path)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	profiles := newTable()
+	if value, ok := doc.values[profilesKey]; ok {
+		if profiles, ok = value.(*table); !ok {
+			return nil, nil, fmt.Errorf("config file %s: %s must map job names to settings", path, profilesKey)
+		}
+	}
+
+	if base, err = fileSettings(flags, doc, path, true); err != nil {
+		return nil, nil, err
+	}
+	if job == "" {
+		return base, nil, nil
+	}
+
+	value, ok := profiles.values[job]
+	if !ok {
+		return nil, nil, fmt.Errorf("job profile %q not found in %s, it has %q", job, path, profiles.keys)
+	}
+	settings, ok := value.(*table)
+	if !ok {
+		return nil, nil, fmt.Errorf("job profile %q in %s must map settings to values", job, path)
+	}
+	if profile, err = fileSettings(flags, settings, fmt.Sprintf("%s job %q", path, job), false); err != nil {
+		return nil, nil, err
+	}
+	return base, profile, nil
+}
+
+// fileSettings checks the settings of a config file or job profile against the flags, in the order they are written
+func fileSettings(flags *flag.FlagSet, t *table, origin string, top bool) (settings, error) {
+	var layer settings
+	for _, key := range t.keys {
+		if key == profilesKey && top {
+			continue
+		}
+		if _, short := shorthands[key]; short || unlayered[key] || flags.Lookup(key) == nil {
+			return nil, fmt.Errorf("unknown setting %q in %s", key, origin)
+		}
+
+		var values []string
+		switch value := t.values[key].(type) {
+		case nil:
+			continue
+		case string:
+			values = []string{value}
+		case []string:
+			values = value
+		default:
+			return nil, fmt.Errorf("setting %q in %s must be a value or a list of values", key, origin)
+		}
+		if len(values) > 1 && !repeatable[key] {
+			return nil, fmt.Errorf("setting %q in %s takes a single value", key, origin)
+		}
+		layer = append(layer, setting{name: key, values: values, origin: fmt.Sprintf("%s in %s", key, origin)})
+	}
+	return layer, nil
+}
+
+// table is a mapping read from a config file, keeping the order of its keys.
+// Values are strings, string slices for lists, nested tables, or nil for null.
+type table struct {
+	keys   []string
+	values map[string]any
+}
+
+func newTable() *table {
+	return &table{values: map[string]any{}}
+}
+
+// set adds a key, each key can only be set once
+func (t *table) set(key string, value any) error {
+	if _, ok := t.values[key]; ok {
+		return fmt.Errorf("duplicate key %q", key)
+	}
+	t.keys = append(t.keys, key)
+	t.values[key] = value
+	return nil
+}
+
+// subtable returns the table nested under key, adding an empty one if the key is new
+func (t *table) subtable(key string) (*table, error) {
+	value, ok := t.values[key]
+	if !ok {
+		sub := newTable()
+		return sub, t.set(key, sub)
+	}
+	sub, ok := value.(*table)
+	if !ok {
+		return nil, fmt.Errorf("key %q is not a table", key)
+	}
+	return sub, nil
+}
+
+// parseJSON reads a JSON object, keeping the order of its keys
+func parseJSON(data []byte) (*table, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := decodeJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := value.(*table)
+	if !ok {
+		return nil, errors.New("expected an object")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the object")
+	}
+	return doc, nil
+}
+
+// decodeJSON reads the next value, lists may only hold strings, numbers and booleans
+func decodeJSON(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '{' {
+			t := newTable()
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				if err := t.set(key.(string), value); err != nil {
+					return nil, err
+				}
+			}
+			_, err := dec.Token()
+			return t, err
+		}
+
+		list := []string{}
+		for dec.More() {
+			value, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			item, ok := value.(string)
+			if !ok {
+				return nil, errors.New("lists may only contain strings, numbers and booleans")
+			}
+			list = append(list, item)
+		}
+		_, err := dec.Token()
+		return list, err
+	case string:
+		return token, nil
+	case json.Number:
+		return token.String(), nil
+	case bool:
+		return strconv.FormatBool(token), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// configFiles are the same settings in every supported format
+var configFiles = map[string]string{
+	"jobs.yaml": `# Shared by all jobs
+concurrency: 20
+retry-base-delay: 1s
+include: ["*.json", '*.parquet']
+exclude:
+  - _temporary/
+profiles:
+  nightly:
+    source:
+      - s3://logs-bucket/daily/
+      - "s3://exports-bucket/out/#exports"
+    destination: test-dest
+    sync: size-mtime # Skip what the last run copied
+    verify: true
+`,
+	"jobs.toml": `# Shared by all jobs
+concurrency = 20
+retry-base-delay = "1s"
+include = ["*.json", '*.parquet']
+exclude = [
+  "_temporary/",
+]
+
+[profiles.nightly]
+source = ["s3://logs-bucket/daily/", "s3://exports-bucket/out/#exports"]
+destination = "test-dest"
+sync = "size-mtime" # Skip what the last run copied
+verify = true
+`,
+	"jobs.json": `{
+	"concurrency": 20,
+	"retry-base-delay": "1s",
+	"include": ["*.json", "*.parquet"],
+	"exclude": ["_temporary/"],
+	"profiles": {
+		"nightly": {
+			"source": ["s3://logs-bucket/daily/", "s3://exports-bucket/out/#exports"],
+			"destination": "test-dest",
+			"sync": "size-mtime",
+			"verify": true
+		}
+	}
+}`,
+}
+
+// writeConfig writes a config file to a temporary directory and returns its path
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestParse_ConfigFile(t *testing.T) {
+	expectedSources := []Location{
+		{Bucket: "logs-bucket", Prefix: "daily/"},
+		{Bucket: "exports-bucket", Prefix: "out/", Subdir: "exports"},
+	}
+
+	for name, content := range configFiles {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfig(t, name, content)
+			cfg, _, err := Parse([]string{"-config", path, "-job", "nightly"}, "1.0.0")
+			if err != nil {
+				t.Fatalf("Parse() returned unexpected error: %v", err)
+			}
+
+			if !slices.Equal(cfg.Sources, expectedSources) {
+				t.Errorf("Parse() Sources = %v, want %v", cfg.Sources, expectedSources)
+			}
+			if cfg.Destination != "test-dest" || cfg.Concurrency != 20 || cfg.MaxConcurrency != 40 {
+				t.Errorf("Parse() Destination = %q, Concurrency = %d-%d, want test-dest, 20-40", cfg.Destination, cfg.Concurrency, cfg.MaxConcurrency)
+			}
+			if cfg.Sync != transfer.SyncSizeMtime || !cfg.Verify {
+				t.Errorf("Parse() Sync = %v, Verify = %v, want size-mtime and verified", cfg.Sync, cfg.Verify)
+			}
+			if cfg.Retry.BaseDelay != time.Second {
+				t.Errorf("Parse() Retry.BaseDelay = %v, want 1s", cfg.Retry.BaseDelay)
+			}
+			for key, expected := range map[string]bool{"a.json": true, "b.parquet": true, "c.csv": false, "_temporary/d.json": false} {
+				if got := cfg.Filter.Match(s3ops.ObjectInfo{Key: key}); got != expected {
+					t.Errorf("Parse() Filter.Match(%q) = %v, want %v", key, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestParse_Precedence(t *testing.T) {
+	path := writeConfig(t, "jobs.yaml", `
+concurrency: 20
+list-concurrency: 4
+max-attempts: 3
+destination: test-dest
+profiles:
+  nightly:
+    concurrency: 30
+    bucket: file-bucket
+    prefix: file-prefix/
+    include: "*.json"
+`)
+	t.Setenv("S3CPBP_CONFIG", path)
+	t.Setenv("S3CPBP_JOB", "nightly")
+	t.Setenv("S3CPBP_LIST_CONCURRENCY", "16")
+	t.Setenv("S3CPBP_MAX_ATTEMPTS", "")
+	t.Setenv("S3CPBP_EXCLUDE", "*.tmp\nre:\\.c{1,2}rc$\n")
+
+	cfg, _, err := Parse([]string{"s3://flag-bucket/logs/", "-max-concurrency", "100"}, "1.0.0")
+	if err != nil {
+		t.Fatalf("Parse() returned unexpected error: %v", err)
+	}
+
+	// Sources on the command line replace the bucket and prefix of the file
+	expectedSources := []Location{{Bucket: "flag-bucket", Prefix: "logs/"}}
+	if !slices.Equal(cfg.Sources, expectedSources) {
+		t.Errorf("Parse() Sources = %v, want %v", cfg.Sources, expectedSources)
+	}
+	checks := []struct {
+		name          string
+		got, expected any
+	}{
+		{"Destination from the file", cfg.Destination, "test-dest"},
+		{"Concurrency from the job profile", cfg.Concurrency, 30},
+		{"MaxConcurrency from the command line", cfg.MaxConcurrency, 100},
+		{"ListConcurrency from the environment", cfg.ListConcurrency, 16},
+		{"MaxAttempts from the file, empty variables are unset", cfg.Retry.MaxAttempts, 3},
+	}
+	for _, check := range checks {
+		if check.got != check.expected {
+			t.Errorf("%s = %v, want %v", check.name, check.got, check.expected)
+		}
+	}
+
+	// Excludes from the environment replace the profile's filter rules
+	for key, expected := range map[string]bool{"a.json": true, "a.csv": true, "a.tmp": false, "a.crc": false, "a.ccrc": false, "a.cccrc": true} {
+		if got := cfg.Filter.Match(s3ops.ObjectInfo{Key: key}); got != expected {
+			t.Errorf("Parse() Filter.Match(%q) = %v, want %v", key, got, expected)
+		}
+	}
+}
+
+func TestParse_ConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "unknown setting",
+			file:    "jobs.yaml",
+			content: "destination: test-dest\nconcurency: 5\n",
+			wantErr: `unknown setting "concurency"`,
+		},
+		{
+			name:    "shorthand setting",
+			file:    "jobs.toml",
+			content: "d = \"test-dest\"\n",
+			wantErr: `unknown setting "d"`,
+		},
+		{
+			name:    "list for a single value",
+			file:    "jobs.json",
+			content: `{"destination": ["a", "b"]}`,
+			wantErr: "takes a single value",
+		},
+		{
+			name:    "invalid value",
+			file:    "jobs.yaml",
+			content: "destination: test-dest\nconcurrency: many\n",
+			wantErr: `invalid value "many" for concurrency in`,
+		},
+		{
+			name:    "missing job profile",
+			file:    "jobs.yaml",
+			content: "profiles:\n  nightly:\n    destination: test-dest\n",
+			args:    []string{"-job", "weekly"},
+			wantErr: `job profile "weekly" not found`,
+		},
+		{
+			name:    "unsupported format",
+			file:    "jobs.ini",
+			content: "destination = test-dest\n",
+			wantErr: "must end in .yaml, .yml, .toml or .json",
+		},
+		{
+			name:    "syntax error",
+			file:    "jobs.yaml",
+			content: "destination: test-dest\n  concurrency: 5\n",
+			wantErr: "line 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.file, tt.content)
+			args := append([]string{"-config", path, "-b", "test-bucket", "-p", "test-prefix"}, tt.args...)
+			_, _, err := Parse(args, "1.0.0")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	doc, err := parseJSON([]byte(`{"b": 1.5, "a": [true, "x"], "c": null, "d": {"e": "f"}}`))
+	if err != nil {
+		t.Fatalf("parseJSON() returned unexpected error: %v", err)
+	}
+	if !slices.Equal(doc.keys, []string{"b", "a", "c", "d"}) {
+		t.Errorf("parseJSON() keys = %q, want them in file order", doc.keys)
+	}
+	if doc.values["b"] != "1.5" || !slices.Equal(doc.values["a"].([]string), []string{"true", "x"}) || doc.values["c"] != nil {
+		t.Errorf("parseJSON() values = %v", doc.values)
+	}
+	if nested, ok := doc.values["d"].(*table); !ok || nested.values["e"] != "f" {
+		t.Errorf("parseJSON() nested = %v, want a table with e: f", doc.values["d"])
+	}
+
+	for _, invalid := range []string{`[]`, `{"a": [[1]]}`, `{"a": 1, "a": 2}`, `{"a": 1} {}`, `{"a": `} {
+		if _, err := parseJSON([]byte(invalid)); err == nil {
+			t.Errorf("parseJSON(%s) did not fail", invalid)
+		}
+	}
+}
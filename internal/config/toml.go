@@ -0,0 +1,111 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML reads a TOML document, keeping the order of its keys. Tables become nested tables
+// and arrays may only hold values, not tables.
+func parseTOML(data []byte) (*table, error) {
+	var values map[string]any
+	meta, err := toml.Decode(string(data), &values)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := newTable()
+	for _, key := range meta.Keys() {
+		parent, err := walk(doc, key[:len(key)-1])
+		if err != nil {
+			return nil, err
+		}
+		name := key[len(key)-1]
+
+		value := lookup(values, key)
+		if _, ok := value.(map[string]any); ok {
+			if _, err := parent.subtable(name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		converted, err := tomlValue(value)
+		if err == nil {
+			err = parent.set(name, converted)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key, err)
+		}
+	}
+	return doc, nil
+}
+
+// walk returns the table at a path of keys, adding the tables that don't exist yet
+func walk(t *table, path []string) (*table, error) {
+	for _, key := range path {
+		var err error
+		if t, err = t.subtable(key); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// lookup returns the decoded value at a path of keys
+func lookup(values map[string]any, path toml.Key) any {
+	var value any = values
+	for _, key := range path {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// tomlValue converts a decoded value to a string, or an array of values to a list of strings
+func tomlValue(value any) (any, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case time.Time:
+		// Local dates and times come in zones named after their TOML type, they are written back without an offset
+		switch value.Location().String() {
+		case "date-local":
+			return value.Format(time.DateOnly), nil
+		case "datetime-local":
+			return value.Format("2006-01-02T15:04:05.999999999"), nil
+		case "time-local":
+			return value.Format("15:04:05.999999999"), nil
+		}
+		return value.Format(time.RFC3339Nano), nil
+	case []any:
+		list := []string{}
+		for _, item := range value {
+			converted, err := tomlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := converted.(string)
+			if !ok {
+				return nil, errors.New("arrays may only contain strings, numbers, booleans and dates")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	case []map[string]any:
+		return nil, errors.New("arrays of tables are not supported")
+	}
+	return nil, fmt.Errorf("unsupported value %v", value)
+}
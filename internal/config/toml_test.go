@@ -0,0 +1,90 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	doc, err := parseTOML([]byte(`# Comment
+prefix = "logs/#2024/" # trailing comment
+destination = "it's/logs/" # it's a comment
+ca-bundle = 'C:\certs\ca.pem'
+concurrency = 1_000
+modified-after = 2024-10-01
+storage-class = [
+  "STANDARD", # comment inside an array
+  "INTELLIGENT_TIERING",
+]
+
+[profiles.nightly]
+include = ["a", "b, c"]
+retry.max = "x"
+
+[profiles."week ly"]
+verify = true
+`))
+	if err != nil {
+		t.Fatalf("parseTOML() returned unexpected error: %v", err)
+	}
+
+	expectedKeys := []string{"prefix", "destination", "ca-bundle", "concurrency", "modified-after", "storage-class", "profiles"}
+	if !slices.Equal(doc.keys, expectedKeys) {
+		t.Errorf("parseTOML() keys = %q, want %q", doc.keys, expectedKeys)
+	}
+	expectedValues := map[string]any{
+		"prefix":         "logs/#2024/",
+		"destination":    "it's/logs/",
+		"ca-bundle":      `C:\certs\ca.pem`,
+		"concurrency":    "1000",
+		"modified-after": "2024-10-01",
+	}
+	for key, expected := range expectedValues {
+		if doc.values[key] != expected {
+			t.Errorf("parseTOML() %s = %#v, want %#v", key, doc.values[key], expected)
+		}
+	}
+	if got := doc.values["storage-class"].([]string); !slices.Equal(got, []string{"STANDARD", "INTELLIGENT_TIERING"}) {
+		t.Errorf("parseTOML() storage-class = %q", got)
+	}
+
+	profiles := doc.values["profiles"].(*table)
+	if !slices.Equal(profiles.keys, []string{"nightly", "week ly"}) {
+		t.Fatalf("parseTOML() profiles = %q, want nightly and week ly", profiles.keys)
+	}
+	nightly := profiles.values["nightly"].(*table)
+	if got := nightly.values["include"].([]string); !slices.Equal(got, []string{"a", "b, c"}) {
+		t.Errorf("parseTOML() nightly include = %q", got)
+	}
+	if got := nightly.values["retry"].(*table).values["max"]; got != "x" {
+		t.Errorf("parseTOML() dotted key = %#v, want a nested table", got)
+	}
+	if got := profiles.values["week ly"].(*table).values["verify"]; got != "true" {
+		t.Errorf("parseTOML() week ly verify = %#v", got)
+	}
+}
+
+func TestParseTOML_Errors(t *testing.T) {
+	tests := []struct {
+		toml    string
+		wantErr string
+	}{
+		{toml: "a = 1\na = 2\n", wantErr: "line 2"},
+		{toml: "a = nightly\n", wantErr: "line 1"},
+		{toml: "a\n", wantErr: "line 1"},
+		{toml: "a = \n", wantErr: "line 1"},
+		{toml: "[[jobs]]\nb = 1\n", wantErr: "arrays of tables are not supported"},
+		{toml: "a = [[1]]\n", wantErr: "arrays may only contain"},
+		{toml: "a = [\n1,\n", wantErr: "line 2"},
+		{toml: "a = 1\n[a]\n", wantErr: "line 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.toml, func(t *testing.T) {
+			if _, err := parseTOML([]byte(tt.toml)); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseTOML() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
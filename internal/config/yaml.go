@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML reads a YAML mapping. Nested mappings become tables and lists may only hold values.
+func parseYAML(data []byte) (*table, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		return newTable(), nil
+	}
+
+	value, err := yamlValue(doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+	t, ok := value.(*table)
+	if !ok {
+		return nil, errors.New("expected a mapping")
+	}
+	return t, nil
+}
+
+// yamlValue converts a node to a table, a list of strings, a string, or nil for null
+func yamlValue(node *yaml.Node) (any, error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		t := newTable()
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: keys must be values", key.Line)
+			}
+			converted, err := yamlValue(value)
+			if err == nil {
+				err = t.set(key.Value, converted)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", key.Line, err)
+			}
+		}
+		return t, nil
+	case yaml.SequenceNode:
+		list := []string{}
+		for _, item := range node.Content {
+			value, err := yamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("line %d: list items must be values", item.Line)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!null" {
+			return nil, nil
+		}
+		return node.Value, nil
+	}
+	return nil, fmt.Errorf("line %d: unsupported YAML node", node.Line)
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	doc, err := parseYAML([]byte(`---
+# Comment
+prefix: logs/date=2024-10-01/   # trailing comment
+destination: it's/logs/ # an apostrophe in a plain value
+endpoint-url: http://localhost:9000
+include: "#*.json"
+exclude:
+- '*.tmp'
+- "it's \u00e9"
+storage-class: []
+modified-after: ~
+"quoted key": value
+profiles:
+  nightly:
+    include: [a, "b, c", ]
+  weekly:
+    verify: true
+`))
+	if err != nil {
+		t.Fatalf("parseYAML() returned unexpected error: %v", err)
+	}
+
+	expectedKeys := []string{"prefix", "destination", "endpoint-url", "include", "exclude", "storage-class", "modified-after", "quoted key", "profiles"}
+	if !slices.Equal(doc.keys, expectedKeys) {
+		t.Errorf("parseYAML() keys = %q, want %q", doc.keys, expectedKeys)
+	}
+	expectedValues := map[string]any{
+		"prefix":         "logs/date=2024-10-01/",
+		"destination":    "it's/logs/",
+		"endpoint-url":   "http://localhost:9000",
+		"include":        "#*.json",
+		"modified-after": nil,
+		"quoted key":     "value",
+	}
+	for key, expected := range expectedValues {
+		if doc.values[key] != expected {
+			t.Errorf("parseYAML() %s = %#v, want %#v", key, doc.values[key], expected)
+		}
+	}
+	if got := doc.values["exclude"].([]string); !slices.Equal(got, []string{"*.tmp", "it's é"}) {
+		t.Errorf("parseYAML() exclude = %q", got)
+	}
+	if got := doc.values["storage-class"].([]string); len(got) != 0 {
+		t.Errorf("parseYAML() storage-class = %q, want an empty list", got)
+	}
+
+	profiles := doc.values["profiles"].(*table)
+	if !slices.Equal(profiles.keys, []string{"nightly", "weekly"}) {
+		t.Fatalf("parseYAML() profiles = %q, want nightly and weekly", profiles.keys)
+	}
+	if got := profiles.values["nightly"].(*table).values["include"].([]string); !slices.Equal(got, []string{"a", "b, c"}) {
+		t.Errorf("parseYAML() nightly include = %q", got)
+	}
+	if got := profiles.values["weekly"].(*table).values["verify"]; got != "true" {
+		t.Errorf("parseYAML() weekly verify = %#v", got)
+	}
+}
+
+func TestParseYAML_Errors(t *testing.T) {
+	tests := []struct {
+		yaml    string
+		wantErr string
+	}{
+		{yaml: "a: 1\na: 2\n", wantErr: `line 2`},
+		{yaml: "a: 1\n  b: 2\n", wantErr: "line 2"},
+		{yaml: "a:\n\t- b\n", wantErr: "line 2"},
+		{yaml: "- a\n", wantErr: "expected a mapping"},
+		{yaml: "a\n", wantErr: "expected a mapping"},
+		{yaml: "a:\n  - b: c\n", wantErr: "line 2: list items must be values"},
+		{yaml: "a: [b, [c]]\n", wantErr: "list items must be values"},
+		{yaml: "a: \"b\n", wantErr: "line 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.yaml, func(t *testing.T) {
+			if _, err := parseYAML([]byte(tt.yaml)); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseYAML() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package download
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PartialSuffix marks temporary files that hold an object while it is being downloaded
+const PartialSuffix = ".s3cpbp-partial"
+
+// StateSuffix marks the files recording the progress of resumable downloads
+const StateSuffix = ".s3cpbp-state"
+
+// partialPath returns the hidden temporary sibling used while downloading to localPath,
+// e.g. "dir/.name.s3cpbp-partial" for "dir/name"
+func partialPath(localPath string) string {
+	dir, name := filepath.Split(localPath)
+	return filepath.Join(dir, "."+name+PartialSuffix)
+}
+
+// statePath returns the hidden file recording the progress of a resumable download to localPath,
+// e.g. "dir/.name.s3cpbp-state" for "dir/name"
+func statePath(localPath string) string {
+	dir, name := filepath.Split(localPath)
+	return filepath.Join(dir, "."+name+StateSuffix)
+}
+
+// isPartialFile reports whether a file name looks like a temporary download file
+func isPartialFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, PartialSuffix)
+}
+
+// isStateFile reports whether a file name looks like the progress record of a resumable download
+func isStateFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, StateSuffix)
+}
+
+// CleanPartialFiles removes stale temporary files left under the destination by an earlier run
+// that crashed or was killed. Partial files of resumable downloads, which have a state file next
+// to them, are kept so the next download of the object can resume. It returns the number of files removed.
+func CleanPartialFiles(destination string) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(destination, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		// The counterpart that has to exist for the file to be useful
+		var counterpart string
+		switch {
+		case isPartialFile(d.Name()):
+			counterpart = strings.TrimSuffix(path, PartialSuffix) + StateSuffix
+		case isStateFile(d.Name()):
+			counterpart = strings.TrimSuffix(path, StateSuffix) + PartialSuffix
+		default:
+			return nil
+		}
+		if _, err := os.Stat(counterpart); err == nil {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,73 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartialPath(t *testing.T) {
+	tests := []struct {
+		localPath string
+		expected  string
+	}{
+		{filepath.Join("dest", "file.txt"), filepath.Join("dest", ".file.txt"+PartialSuffix)},
+		{filepath.Join("dest", "a", "b", "c.bin"), filepath.Join("dest", "a", "b", ".c.bin"+PartialSuffix)},
+		{"file.txt", ".file.txt" + PartialSuffix},
+	}
+
+	for _, tt := range tests {
+		if got := partialPath(tt.localPath); got != tt.expected {
+			t.Errorf("partialPath(%q) = %q, want %q", tt.localPath, got, tt.expected)
+		}
+		if !isPartialFile(filepath.Base(partialPath(tt.localPath))) {
+			t.Errorf("isPartialFile() = false for partial path of %q", tt.localPath)
+		}
+	}
+}
+
+func TestCleanPartialFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "clean_partial")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	files := map[string]bool{ // path -> should be kept
+		"complete.txt":                             true,
+		"nested/dir/complete.bin":                  true,
+		"not-hidden" + PartialSuffix:               true,
+		".complete.txt" + PartialSuffix:            false,
+		"nested/dir/.complete.bin" + PartialSuffix: false,
+		".resumable.bin" + PartialSuffix:           true,
+		".resumable.bin" + StateSuffix:             true,
+		".orphan.bin" + StateSuffix:                false,
+	}
+	for name := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	removed, err := CleanPartialFiles(tempDir)
+	if err != nil {
+		t.Fatalf("CleanPartialFiles() returned unexpected error: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("CleanPartialFiles() removed %d files, want 3", removed)
+	}
+
+	for name, keep := range files {
+		_, err := os.Stat(filepath.Join(tempDir, name))
+		if keep && err != nil {
+			t.Errorf("%s should have been kept: %v", name, err)
+		}
+		if !keep && !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed", name)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// resumeChunkSize is the size of the ranges a resumable download is split into.
+// It is a variable so tests can use small objects.
+var resumeChunkSize int64 = 32 * mib
+
+// resumeConcurrency is the number of ranges of a single object fetched at the same time
+const resumeConcurrency = 3
+
+// resumeState records which chunks of a resumable download are already on disk.
+// It is stored as JSON next to the partial file, so a retry or a later run only fetches the missing chunks.
+type resumeState struct {
+	ETag      string `json:"etag"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunk_size"`
+	Done      []bool `json:"done"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// newResumeState returns an empty state for obj, stored at path
+func newResumeState(path string, obj s3ops.ObjectInfo) *resumeState {
+	chunks := (obj.Size + resumeChunkSize - 1) / resumeChunkSize
+	return &resumeState{
+		ETag:      obj.ETag,
+		Size:      obj.Size,
+		ChunkSize: resumeChunkSize,
+		Done:      make([]bool, chunks),
+		path:      path,
+	}
+}
+
+// loadResumeState reads the state stored at path.
+// It returns an empty state when there is none or it belongs to a different version of the object.
+func loadResumeState(path string, obj s3ops.ObjectInfo) *resumeState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return newResumeState(path, obj)
+	}
+
+	state := &resumeState{path: path}
+	if err := json.Unmarshal(data, state); err != nil || state.ETag != obj.ETag || state.Size != obj.Size ||
+		state.ChunkSize <= 0 || int64(len(state.Done)) != (obj.Size+state.ChunkSize-1)/state.ChunkSize {
+		return newResumeState(path, obj)
+	}
+	return state
+}
+
+// missing returns the indexes of the chunks that haven't been downloaded yet
+func (s *resumeState) missing() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var chunks []int
+	for i, done := range s.Done {
+		if !done {
+			chunks = append(chunks, i)
+		}
+	}
+	return chunks
+}
+
+// completed returns the number of bytes already downloaded
+func (s *resumeState) completed() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for i, done := range s.Done {
+		if done {
+			start, end := s.chunkRange(i)
+			n += end - start + 1
+		}
+	}
+	return n
+}
+
+// chunkRange returns the first and last byte of a chunk, as used in a Range header
+func (s *resumeState) chunkRange(index int) (int64, int64) {
+	start := int64(index) * s.ChunkSize
+	return start, min(start+s.ChunkSize, s.Size) - 1
+}
+
+// complete marks a chunk as downloaded and saves the state
+func (s *resumeState) complete(index int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Done[index] = true
+	return s.save()
+}
+
+// reset forgets all downloaded chunks, e.g. after the assembled file failed verification
+func (s *resumeState) reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.Done)
+	return s.save()
+}
+
+// save writes the state to disk, the caller must hold the lock
+func (s *resumeState) save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
+
+// remove deletes the stored state
+func (s *resumeState) remove() {
+	os.Remove(s.path)
+}
+
+// resumable reports whether obj is downloaded in chunks that survive failures.
+// The ETag is required to make sure chunks from different versions of the object are never mixed.
+func (w *Worker) resumable(obj s3ops.ObjectInfo) bool {
+	return w.ResumeThreshold > 0 && obj.Size >= w.ResumeThreshold && obj.ETag != ""
+}
+
+// downloadChunks fetches the missing chunks of a resumable download with ranged GETs.
+// Each chunk is flushed to disk and recorded in the state as soon as it is complete,
+// so an interrupted download picks up where it stopped.
+func (w *Worker) downloadChunks(ctx context.Context, file *os.File, obj s3ops.ObjectInfo, state *resumeState) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan int)
+	errs := make(chan error, resumeConcurrency)
+	var wg sync.WaitGroup
+
+	for i := 0; i < resumeConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range chunks {
+				start, end := state.chunkRange(index)
+				_, err := w.Downloader.Download(ctx, io.NewOffsetWriter(file, start), &s3.GetObjectInput{
+					Bucket: aws.String(w.Bucket),
+					Key:    aws.String(obj.Key),
+					Range:  aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+					// Fail instead of mixing in data from a newer version of the object
+					IfMatch: aws.String(`"` + obj.ETag + `"`),
+				})
+				if err == nil {
+					err = file.Sync()
+				}
+				if err == nil {
+					err = state.complete(index)
+				}
+				if err != nil {
+					// Every goroutine reports at most one error, so this never blocks
+					errs <- fmt.Errorf("bytes %d-%d: %w", start, end, err)
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, index := range state.missing() {
+		select {
+		case <-ctx.Done():
+			break feed
+		case chunks <- index:
+		}
+	}
+	close(chunks)
+	wg.Wait()
+	close(errs)
+
+	if err, ok := <-errs; ok {
+		return err
+	}
+	return ctx.Err()
+}
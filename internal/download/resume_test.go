@@ -0,0 +1,175 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// rangeDownloader returns a mock downloader serving ranges of content.
+// Requested ranges are recorded, and ranges listed in failing return an error.
+func rangeDownloader(t *testing.T, content []byte, failing map[string]bool, requested *[]string, mu *sync.Mutex) *mockDownloader {
+	return &mockDownloader{
+		downloadFunc: func(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
+			rng := aws.ToString(input.Range)
+			if aws.ToString(input.IfMatch) != `"etag"` {
+				t.Errorf("Download() IfMatch = %q, want %q", aws.ToString(input.IfMatch), `"etag"`)
+			}
+
+			mu.Lock()
+			*requested = append(*requested, rng)
+			mu.Unlock()
+
+			if failing[rng] {
+				return 0, errors.New("connection reset by peer")
+			}
+
+			var start, end int
+			if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil {
+				t.Errorf("Download() with unexpected range %q", rng)
+				return 0, err
+			}
+			nWritten, err := w.WriteAt(content[start:end+1], 0)
+			return int64(nWritten), err
+		},
+	}
+}
+
+// TestDownloadFile_Resume tests that a failed chunked download is kept and only the missing chunks are fetched later
+func TestDownloadFile_Resume(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "resume_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	origChunkSize := resumeChunkSize
+	resumeChunkSize = 4
+	defer func() { resumeChunkSize = origChunkSize }()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	content := []byte("0123456789")
+	obj := s3ops.ObjectInfo{Key: "big/file.bin", Size: int64(len(content)), ETag: "etag"}
+	localPath := filepath.Join(tempDir, obj.Key)
+
+	var (
+		mu            sync.Mutex
+		requested     []string
+		finishedFiles atomic.Int64
+		totalFiles    atomic.Int64
+	)
+
+	worker := Worker{
+		ID:              10,
+		Downloader:      rangeDownloader(t, content, map[string]bool{"bytes=4-7": true}, &requested, &mu),
+		Bucket:          "test-bucket",
+		Destination:     tempDir,
+		TotalFiles:      &totalFiles,
+		FinishedFiles:   &finishedFiles,
+		ResumeThreshold: 1,
+	}
+
+	// The second chunk always fails, the others are kept for the next run
+	err = worker.downloadFile(context.Background(), obj)
+	var fileErr *transfer.FileError
+	if !errors.As(err, &fileErr) || fileErr.Op != "download" {
+		t.Fatalf("downloadFile() error = %v, want *transfer.FileError with Op %q", err, "download")
+	}
+	if _, err := os.Stat(partialPath(localPath)); err != nil {
+		t.Fatalf("Partial file was not kept for resuming: %v", err)
+	}
+	state := loadResumeState(statePath(localPath), obj)
+	if state.Done[1] {
+		t.Error("Failed chunk is recorded as done")
+	}
+	missing := state.missing()
+
+	// A later run only asks for the chunks that are still missing
+	requested = nil
+	worker.Downloader = rangeDownloader(t, content, nil, &requested, &mu)
+	if err := worker.downloadFile(context.Background(), obj); err != nil {
+		t.Fatalf("downloadFile() returned unexpected error: %v", err)
+	}
+
+	if len(requested) != len(missing) {
+		t.Errorf("Resumed download requested %v, want only the %d missing chunks", requested, len(missing))
+	}
+	for _, rng := range requested {
+		if rng == "bytes=0-3" && state.Done[0] {
+			t.Errorf("Resumed download requested completed chunk %s", rng)
+		}
+	}
+
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", localPath, err)
+	}
+	if string(data) != string(content) {
+		t.Errorf("File content = %q, want %q", data, content)
+	}
+	if _, err := os.Stat(statePath(localPath)); !os.IsNotExist(err) {
+		t.Error("State file was not removed after a successful download")
+	}
+	if finishedFiles.Load() != 1 {
+		t.Errorf("FinishedFiles = %d, want 1", finishedFiles.Load())
+	}
+}
+
+func TestLoadResumeState(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "resume_state")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	origChunkSize := resumeChunkSize
+	resumeChunkSize = 4
+	defer func() { resumeChunkSize = origChunkSize }()
+
+	path := filepath.Join(tempDir, ".file.bin"+StateSuffix)
+	obj := s3ops.ObjectInfo{Key: "file.bin", Size: 10, ETag: "etag"}
+
+	state := newResumeState(path, obj)
+	if len(state.Done) != 3 {
+		t.Fatalf("newResumeState() has %d chunks, want 3", len(state.Done))
+	}
+	if start, end := state.chunkRange(2); start != 8 || end != 9 {
+		t.Errorf("chunkRange(2) = %d-%d, want 8-9", start, end)
+	}
+	if err := state.complete(2); err != nil {
+		t.Fatalf("complete() returned unexpected error: %v", err)
+	}
+
+	if loaded := loadResumeState(path, obj); !loaded.Done[2] || loaded.completed() != 2 {
+		t.Errorf("loadResumeState() = %+v, want the last chunk done", loaded.Done)
+	}
+
+	// A changed object must not reuse chunks of the previous version
+	changed := obj
+	changed.ETag = "other"
+	if loaded := loadResumeState(path, changed); len(loaded.missing()) != 3 {
+		t.Errorf("loadResumeState() for a changed ETag kept chunks %v", loaded.Done)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatalf("Failed to write state: %v", err)
+	}
+	if loaded := loadResumeState(path, obj); len(loaded.missing()) != 3 {
+		t.Errorf("loadResumeState() for a corrupt state kept chunks %v", loaded.Done)
+	}
+}
@@ -0,0 +1,93 @@
+package download
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// TestWorkerStart_SkipsUnchanged tests that unchanged objects are counted as skipped and not downloaded
+func TestWorkerStart_SkipsUnchanged(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "worker_test_sync")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	modified := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.WriteFile(filepath.Join(tempDir, "existing.txt"), []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(tempDir, "existing.txt"), modified, modified); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+
+	filesChan := make(chan s3ops.ObjectInfo, 2)
+	filesChan <- s3ops.ObjectInfo{Key: "existing.txt", Size: 3, LastModified: modified}
+	filesChan <- s3ops.ObjectInfo{Key: "new.txt", Size: 3, LastModified: modified}
+	close(filesChan)
+
+	var (
+		wg            sync.WaitGroup
+		totalFiles    atomic.Int64
+		finishedFiles atomic.Int64
+		skippedFiles  atomic.Int64
+		downloaded    []string
+	)
+	totalFiles.Store(2)
+	wg.Add(1)
+
+	mockDownload := &mockDownloader{
+		downloadFunc: func(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
+			downloaded = append(downloaded, *input.Key)
+			nWritten, err := w.WriteAt([]byte("new"), 0)
+			return int64(nWritten), err
+		},
+	}
+
+	worker := Worker{
+		ID:            9,
+		Downloader:    mockDownload,
+		Bucket:        "test-bucket",
+		Destination:   tempDir,
+		FilesChan:     filesChan,
+		WaitGroup:     &wg,
+		TotalFiles:    &totalFiles,
+		FinishedFiles: &finishedFiles,
+		SkippedFiles:  &skippedFiles,
+		Sync:          transfer.SyncSizeMtime,
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	worker.Start(context.Background())
+	wg.Wait()
+
+	if len(downloaded) != 1 || downloaded[0] != "new.txt" {
+		t.Errorf("downloaded %v, want [new.txt]", downloaded)
+	}
+	if skippedFiles.Load() != 1 || finishedFiles.Load() != 1 {
+		t.Errorf("skipped %d, finished %d, want 1 and 1", skippedFiles.Load(), finishedFiles.Load())
+	}
+
+	// Downloaded files carry the object's LastModified, so the next run skips them
+	info, err := os.Stat(filepath.Join(tempDir, "new.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat new.txt: %v", err)
+	}
+	if !info.ModTime().Equal(modified) {
+		t.Errorf("new.txt mtime = %v, want %v", info.ModTime(), modified)
+	}
+}
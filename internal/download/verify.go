@@ -0,0 +1,215 @@
+package download
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// HeadObjectAPI defines the interface for the HeadObject operation used to verify downloads
+type HeadObjectAPI interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+const mib = 1024 * 1024
+
+// commonPartSizes are part sizes used by popular S3 clients,
+// tried when inferring how a multipart object was uploaded
+var commonPartSizes = []int64{5 * mib, 8 * mib, 15 * mib, 16 * mib, 32 * mib, 64 * mib, 100 * mib, 128 * mib, 256 * mib, 512 * mib}
+
+// crc64NVMETable is the CRC-64/NVME polynomial in the reversed form expected by hash/crc64
+var crc64NVMETable = crc64.MakeTable(0x9a6c9329ac4bc9b5)
+
+// verifyFile checks the downloaded file at path against the object's ETag and additional checksums.
+// It returns an error wrapping transfer.ErrIntegrity on a mismatch. Objects without any usable checksum,
+// such as SSE-KMS encrypted objects uploaded without additional checksums, are logged and accepted.
+func (w *Worker) verifyFile(ctx context.Context, path string, obj s3ops.ObjectInfo) error {
+	head, err := w.HeadClient.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(w.Bucket),
+		Key:          aws.String(obj.Key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("head object: %w", err)
+	}
+
+	verified := false
+
+	// ETags of SSE-KMS and SSE-C encrypted objects are not an MD5 of the data
+	if obj.ETag != "" && head.ServerSideEncryption != types.ServerSideEncryptionAwsKms &&
+		head.ServerSideEncryption != types.ServerSideEncryptionAwsKmsDsse && head.SSECustomerAlgorithm == nil {
+		ok, err := w.verifyETag(ctx, path, obj)
+		if err != nil {
+			return err
+		}
+		verified = verified || ok
+	}
+
+	expected := map[types.ChecksumAlgorithm]*string{
+		types.ChecksumAlgorithmCrc32:     head.ChecksumCRC32,
+		types.ChecksumAlgorithmCrc32c:    head.ChecksumCRC32C,
+		types.ChecksumAlgorithmSha1:      head.ChecksumSHA1,
+		types.ChecksumAlgorithmSha256:    head.ChecksumSHA256,
+		types.ChecksumAlgorithmCrc64nvme: head.ChecksumCRC64NVME,
+	}
+	for algorithm, value := range expected {
+		// Composite checksums of multipart uploads ("<checksum>-<parts>") can't be checked against the whole file
+		if value == nil || strings.Contains(*value, "-") {
+			continue
+		}
+		actual, err := fileChecksum(path, algorithm)
+		if err != nil {
+			return err
+		}
+		if actual != *value {
+			return fmt.Errorf("%w: %s is %s, expected %s", transfer.ErrIntegrity, algorithm, actual, *value)
+		}
+		verified = true
+	}
+
+	if !verified {
+		log.Printf("Worker %d: No checksum available to verify %s", w.ID, obj.Key)
+	}
+	return nil
+}
+
+// verifyETag compares the file with a single-part MD5 ETag or a multipart "md5-of-md5s-N" ETag.
+// It returns false without an error when the multipart part size can't be determined
+// or the parts don't all have the size of the first one.
+func (w *Worker) verifyETag(ctx context.Context, path string, obj s3ops.ObjectInfo) (bool, error) {
+	if !obj.IsMultipart() {
+		sum, err := transfer.FileMD5(path)
+		if err != nil {
+			return false, err
+		}
+		if sum != obj.ETag {
+			return false, fmt.Errorf("%w: MD5 is %s, expected ETag %s", transfer.ErrIntegrity, sum, obj.ETag)
+		}
+		return true, nil
+	}
+
+	separator := strings.LastIndex(obj.ETag, "-")
+	parts, err := strconv.ParseInt(obj.ETag[separator+1:], 10, 64)
+	if err != nil || parts < 1 {
+		return false, nil
+	}
+
+	for _, partSize := range candidatePartSizes(obj.Size, parts) {
+		etag, err := multipartETag(path, partSize, parts)
+		if err != nil {
+			return false, err
+		}
+		if etag == obj.ETag {
+			return true, nil
+		}
+	}
+
+	// None of the usual part sizes match, ask S3 for the size of the first part
+	head, err := w.HeadClient.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:     aws.String(w.Bucket),
+		Key:        aws.String(obj.Key),
+		PartNumber: aws.Int32(1),
+	})
+	if err != nil {
+		return false, fmt.Errorf("head object part 1: %w", err)
+	}
+	// Parts of different sizes, e.g. of objects assembled with UploadPartCopy, can't be reproduced from the file
+	partSize := aws.ToInt64(head.ContentLength)
+	if partSize <= 0 || (obj.Size+partSize-1)/partSize != parts {
+		log.Printf("Worker %d: Parts of %s differ in size, its multipart ETag can't be verified", w.ID, obj.Key)
+		return false, nil
+	}
+	etag, err := multipartETag(path, partSize, parts)
+	if err != nil {
+		return false, err
+	}
+	if etag != obj.ETag {
+		return false, fmt.Errorf("%w: multipart ETag is %s, expected %s", transfer.ErrIntegrity, etag, obj.ETag)
+	}
+	return true, nil
+}
+
+// candidatePartSizes returns the part sizes that split an object of the given size into exactly parts parts
+func candidatePartSizes(size, parts int64) []int64 {
+	// Clients that size parts to the object round up to whole MiBs
+	inferred := (size + parts - 1) / parts
+	inferred = (inferred + mib - 1) / mib * mib
+
+	var candidates []int64
+	seen := map[int64]bool{}
+	for _, partSize := range append([]int64{inferred}, commonPartSizes...) {
+		if partSize <= 0 || seen[partSize] || (size+partSize-1)/partSize != parts {
+			continue
+		}
+		seen[partSize] = true
+		candidates = append(candidates, partSize)
+	}
+	return candidates
+}
+
+// multipartETag computes the ETag S3 assigns to a multipart upload: the MD5 of the concatenated part MD5s
+func multipartETag(path string, partSize, parts int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	digests := md5.New()
+	for i := int64(0); i < parts; i++ {
+		part := md5.New()
+		if _, err := io.Copy(part, io.NewSectionReader(file, i*partSize, partSize)); err != nil {
+			return "", err
+		}
+		digests.Write(part.Sum(nil))
+	}
+	return hex.EncodeToString(digests.Sum(nil)) + "-" + strconv.FormatInt(parts, 10), nil
+}
+
+// fileChecksum returns the base64 encoded checksum of a file, the way S3 reports it
+func fileChecksum(path string, algorithm types.ChecksumAlgorithm) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		h = crc32.NewIEEE()
+	case types.ChecksumAlgorithmCrc32c:
+		h = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case types.ChecksumAlgorithmSha1:
+		h = sha1.New()
+	case types.ChecksumAlgorithmSha256:
+		h = sha256.New()
+	case types.ChecksumAlgorithmCrc64nvme:
+		h = crc64.New(crc64NVMETable)
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm %s", algorithm)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
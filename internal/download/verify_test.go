@@ -0,0 +1,286 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// mockHeadClient implements the HeadObjectAPI interface for testing
+type mockHeadClient struct {
+	headFunc func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+func (m *mockHeadClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return m.headFunc(ctx, params, optFns...)
+}
+
+// headReturning returns a mock HEAD client that always responds with output
+func headReturning(output *s3.HeadObjectOutput) *mockHeadClient {
+	return &mockHeadClient{
+		headFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			return output, nil
+		},
+	}
+}
+
+func TestFileChecksum(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "verify_checksum")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "check.txt")
+	if err := os.WriteFile(path, []byte("123456789"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// Standard check values of each algorithm for "123456789", base64 encoded
+	tests := []struct {
+		algorithm types.ChecksumAlgorithm
+		expected  string
+	}{
+		{types.ChecksumAlgorithmCrc32, "y/Q5Jg=="},
+		{types.ChecksumAlgorithmCrc32c, "4waSgw=="},
+		{types.ChecksumAlgorithmCrc64nvme, "rosUhgp5mIg="},
+		{types.ChecksumAlgorithmSha1, "98O8HYCOBHMq32eZZczDTKeuNEE="},
+		{types.ChecksumAlgorithmSha256, "FeKw08M4keuw8e9gnsQZQgwg4yDOlMZfvIwzEkSOsiU="},
+	}
+
+	for _, tt := range tests {
+		sum, err := fileChecksum(path, tt.algorithm)
+		if err != nil {
+			t.Errorf("fileChecksum(%s) returned unexpected error: %v", tt.algorithm, err)
+			continue
+		}
+		if sum != tt.expected {
+			t.Errorf("fileChecksum(%s) = %q, want %q", tt.algorithm, sum, tt.expected)
+		}
+	}
+
+	if _, err := fileChecksum(path, "MD4"); err == nil {
+		t.Error("fileChecksum() with an unknown algorithm did not fail")
+	}
+}
+
+func TestCandidatePartSizes(t *testing.T) {
+	// 20 MiB uploaded in 8 MiB parts is 3 parts, 5 MiB parts would be 4
+	candidates := candidatePartSizes(20*mib, 3)
+	found := false
+	for _, partSize := range candidates {
+		if (20*mib+partSize-1)/partSize != 3 {
+			t.Errorf("candidatePartSizes() returned %d, which doesn't split the object into 3 parts", partSize)
+		}
+		if partSize == 8*mib {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("candidatePartSizes() = %v, want it to include 8 MiB", candidates)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "verify_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	content := []byte("hello world")
+	contentMD5 := "5eb63bbbe01eeed093cb22bb8f5acdc3"
+	path := filepath.Join(tempDir, "file.txt")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	sha256Sum, err := fileChecksum(path, types.ChecksumAlgorithmSha256)
+	if err != nil {
+		t.Fatalf("fileChecksum() returned unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		etag      string
+		head      *s3.HeadObjectOutput
+		wantError bool
+	}{
+		{
+			name: "matching MD5 ETag",
+			etag: contentMD5,
+			head: &s3.HeadObjectOutput{},
+		},
+		{
+			name:      "mismatching MD5 ETag",
+			etag:      "00000000000000000000000000000000",
+			head:      &s3.HeadObjectOutput{},
+			wantError: true,
+		},
+		{
+			name: "ETag of a KMS encrypted object is ignored",
+			etag: "00000000000000000000000000000000",
+			head: &s3.HeadObjectOutput{ServerSideEncryption: types.ServerSideEncryptionAwsKms},
+		},
+		{
+			name: "matching SHA256 checksum",
+			head: &s3.HeadObjectOutput{ChecksumSHA256: aws.String(sha256Sum)},
+		},
+		{
+			name:      "mismatching SHA256 checksum",
+			etag:      contentMD5,
+			head:      &s3.HeadObjectOutput{ChecksumSHA256: aws.String("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")},
+			wantError: true,
+		},
+		{
+			name: "composite checksum is ignored",
+			head: &s3.HeadObjectOutput{ChecksumCRC32: aws.String("AAAAAA==-2")},
+		},
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker := Worker{ID: 1, Bucket: "test-bucket", HeadClient: headReturning(tt.head)}
+			err := worker.verifyFile(context.Background(), path, s3ops.ObjectInfo{Key: "file.txt", Size: int64(len(content)), ETag: tt.etag})
+			if (err != nil) != tt.wantError {
+				t.Fatalf("verifyFile() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantError && !errors.Is(err, transfer.ErrIntegrity) {
+				t.Errorf("verifyFile() error = %v, want wrapped %v", err, transfer.ErrIntegrity)
+			}
+		})
+	}
+}
+
+func TestVerifyFile_Multipart(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "verify_multipart")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// An object uploaded in 5 MiB parts, with an uneven last part
+	content := bytes.Repeat([]byte("0123456789abcdef"), (11*mib)/16)
+	path := filepath.Join(tempDir, "multipart.bin")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	digests := md5.New()
+	for offset := 0; offset < len(content); offset += 5 * mib {
+		part := md5.Sum(content[offset:min(offset+5*mib, len(content))])
+		digests.Write(part[:])
+	}
+	etag := hex.EncodeToString(digests.Sum(nil)) + "-3"
+
+	worker := Worker{ID: 1, Bucket: "test-bucket", HeadClient: headReturning(&s3.HeadObjectOutput{})}
+	obj := s3ops.ObjectInfo{Key: "multipart.bin", Size: int64(len(content)), ETag: etag}
+	if err := worker.verifyFile(context.Background(), path, obj); err != nil {
+		t.Errorf("verifyFile() returned unexpected error: %v", err)
+	}
+
+	// A different part count means a different upload, S3 reports the actual part size
+	obj.ETag = "00000000000000000000000000000000-2"
+	worker.HeadClient = &mockHeadClient{
+		headFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			if params.PartNumber != nil {
+				return &s3.HeadObjectOutput{ContentLength: aws.Int64(6 * mib)}, nil
+			}
+			return &s3.HeadObjectOutput{}, nil
+		},
+	}
+	if err := worker.verifyFile(context.Background(), path, obj); !errors.Is(err, transfer.ErrIntegrity) {
+		t.Errorf("verifyFile() error = %v, want wrapped %v", err, transfer.ErrIntegrity)
+	}
+
+	// Parts of different sizes, e.g. a concatenation made with UploadPartCopy, can't be verified
+	obj.ETag = "00000000000000000000000000000000-3"
+	worker.HeadClient = &mockHeadClient{
+		headFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			if params.PartNumber != nil {
+				return &s3.HeadObjectOutput{ContentLength: aws.Int64(2 * mib)}, nil
+			}
+			return &s3.HeadObjectOutput{}, nil
+		},
+	}
+	if err := worker.verifyFile(context.Background(), path, obj); err != nil {
+		t.Errorf("verifyFile() returned unexpected error for parts of different sizes: %v", err)
+	}
+}
+
+// TestDownloadFile_VerifyFailure tests that a corrupted download is retried and then reported as a failure
+func TestDownloadFile_VerifyFailure(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "verify_download")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var (
+		downloadAttempts atomic.Int32
+		finishedFiles    atomic.Int64
+	)
+
+	mockDownload := &mockDownloader{
+		downloadFunc: func(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
+			if input.ChecksumMode != types.ChecksumModeEnabled {
+				t.Errorf("Download() ChecksumMode = %q, want %q", input.ChecksumMode, types.ChecksumModeEnabled)
+			}
+			if aws.ToString(input.IfMatch) != `"5eb63bbbe01eeed093cb22bb8f5acdc3"` {
+				t.Errorf("Download() IfMatch = %q, want the listed ETag", aws.ToString(input.IfMatch))
+			}
+			downloadAttempts.Add(1)
+			nWritten, err := w.WriteAt([]byte("corrupted"), 0)
+			return int64(nWritten), err
+		},
+	}
+
+	worker := Worker{
+		ID:            9,
+		Downloader:    mockDownload,
+		Bucket:        "test-bucket",
+		Destination:   tempDir,
+		FinishedFiles: &finishedFiles,
+		Verify:        true,
+		HeadClient:    headReturning(&s3.HeadObjectOutput{}),
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	err = worker.downloadFile(context.Background(), s3ops.ObjectInfo{Key: "file.txt", ETag: "5eb63bbbe01eeed093cb22bb8f5acdc3"})
+
+	var fileErr *transfer.FileError
+	if !errors.As(err, &fileErr) || fileErr.Op != "verify" {
+		t.Fatalf("downloadFile() error = %v, want *transfer.FileError with Op %q", err, "verify")
+	}
+	if !errors.Is(err, transfer.ErrIntegrity) {
+		t.Errorf("downloadFile() error = %v, want wrapped %v", err, transfer.ErrIntegrity)
+	}
+	if downloadAttempts.Load() != 3 {
+		t.Errorf("Download attempts = %d, want 3", downloadAttempts.Load())
+	}
+	if finishedFiles.Load() != 0 {
+		t.Errorf("FinishedFiles = %d, want 0", finishedFiles.Load())
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "file.txt")); !os.IsNotExist(err) {
+		t.Error("file.txt should not exist after failed verification")
+	}
+}
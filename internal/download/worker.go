@@ -2,6 +2,7 @@ package download
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log"
 	"os"
@@ -12,6 +13,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
 )
 
 // Downloader defines an interface for the S3 download functionality
@@ -21,99 +26,230 @@ type Downloader interface {
 
 // Worker represents a download worker
 type Worker struct {
-	ID            int
-	Downloader    Downloader
-	Bucket        string
-	Destination   string
-	FilesChan     <-chan string
-	WaitGroup     *sync.WaitGroup
-	TotalFiles    *atomic.Int64
-	FinishedFiles *atomic.Int64
+	ID              int
+	Downloader      Downloader
+	Bucket          string
+	Destination     string
+	FilesChan       <-chan s3ops.ObjectInfo
+	WaitGroup       *sync.WaitGroup
+	TotalFiles      *atomic.Int64
+	FinishedFiles   *atomic.Int64
+	SkippedFiles    *atomic.Int64 // Required when Sync is set
+	Sync            transfer.SyncStrategy
+	Verify          bool          // Verify downloads against the object's ETag and checksums
+	HeadClient      HeadObjectAPI // Required when Verify is set
+	ResumeThreshold int64         // Objects of at least this size are downloaded in resumable chunks, 0 disables resuming
+	Retry           retry.Policy
+	Concurrency     *transfer.Concurrency // Limits the downloads in flight across workers, optional
+	Results         *transfer.Results
 }
 
-// Start starts the download worker
-func (w *Worker) Start() {
+// Start starts the download worker.
+// It stops taking new files as soon as the context is cancelled.
+func (w *Worker) Start(ctx context.Context) {
 	defer w.WaitGroup.Done()
 
-	for key := range w.FilesChan {
-		w.downloadFile(key)
+	loop := transfer.Loop{
+		ID:          w.ID,
+		Files:       w.FilesChan,
+		Skip:        w.skip,
+		Transfer:    w.downloadFile,
+		Concurrency: w.Concurrency,
+		Results:     w.Results,
 	}
+	loop.Run(ctx)
 }
 
-// downloadFile downloads a single file from S3
-func (w *Worker) downloadFile(key string) {
+// skip reports whether the local copy of an object is already up to date, counting and logging it as skipped
+func (w *Worker) skip(obj s3ops.ObjectInfo) bool {
+	unchanged, err := w.Sync.Unchanged(filepath.Join(w.Destination, obj.Key), obj)
+	if err != nil {
+		log.Printf("Worker %d: Failed to compare %s with the local file, downloading it: %v", w.ID, obj.Key, err)
+	}
+	if unchanged {
+		w.SkippedFiles.Add(1)
+		log.Printf("Worker %d %s, skipped unchanged %s", w.ID, w.progress(), obj.Key)
+	}
+	return unchanged
+}
+
+// downloadFile downloads a single file from S3.
+// The object is written to a temporary sibling file which is fsynced and renamed into place
+// only once the download succeeded, so the final path never holds a truncated file.
+// Any failure is returned as a *transfer.FileError so the run can carry on with other objects.
+func (w *Worker) downloadFile(ctx context.Context, obj s3ops.ObjectInfo) error {
+	key := obj.Key
 	localPath := filepath.Join(w.Destination, key)
+	tempPath := partialPath(localPath)
 	var err error
 
 	// Create directories if they don't exist (only attempt once)
 	dir := filepath.Dir(localPath)
 	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
-		log.Fatalf("Worker %d: Failed to create directory %s: %v", w.ID, dir, err)
+		return &transfer.FileError{Key: key, Op: "mkdir", Path: dir, Err: err}
 	}
 
-	// Create the file (only attempt once)
-	file, err := os.Create(localPath)
+	// Large objects are downloaded in chunks that survive failed attempts and runs
+	var state *resumeState
+	if w.resumable(obj) {
+		state = loadResumeState(statePath(localPath), obj)
+		if done := state.completed(); done > 0 {
+			log.Printf("Worker %d: Resuming %s at %d of %d bytes", w.ID, key, done, obj.Size)
+		}
+	}
+
+	// Create the temporary file (only attempt once), keeping the chunks of a resumed download
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if state != nil {
+		flags = os.O_RDWR | os.O_CREATE
+	}
+	file, err := os.OpenFile(tempPath, flags, 0666)
 	if err != nil {
-		log.Fatalf("Worker %d: Failed to create file %s: %v", w.ID, localPath, err)
+		return &transfer.FileError{Key: key, Op: "create", Path: tempPath, Err: err}
 	}
 	defer file.Close()
 
-	// Retry logic for download only
-	for attempt := 1; attempt <= 3; attempt++ {
-		// Download the file using S3 Manager
-		_, err = w.Downloader.Download(context.TODO(), file, &s3.GetObjectInput{
-			Bucket: aws.String(w.Bucket),
-			Key:    aws.String(key),
-		})
-
-		if err == nil {
-			// Success!
-			break // Exit retry loop
+	// fail closes and removes the temporary file before reporting the failure.
+	// Resumable downloads keep the file and their state, unless the data turned out to be corrupt.
+	fail := func(op string, err error) error {
+		file.Close()
+		if state == nil || errors.Is(err, transfer.ErrIntegrity) {
+			os.Remove(tempPath)
+			if state != nil {
+				state.remove()
+			}
 		}
+		return &transfer.FileError{Key: key, Op: op, Path: tempPath, Err: err}
+	}
 
-		// Log failure and prepare for next attempt (if any)
-		log.Printf("Worker %d: Attempt %d: Failed to download %s: %v", w.ID, attempt, key, err)
-		if attempt == 3 {
-			// Clean up the potentially partially downloaded file on final failure
-			// We need to close the file first before removing it
-			file.Close()
-			os.Remove(localPath)
-			log.Fatalf("Worker %d: Failed to download %s after 3 attempts: %v", w.ID, key, err)
+	// A chunk left over from a different version of the object must not extend the file
+	if state != nil {
+		if err := file.Truncate(obj.Size); err != nil {
+			return fail("truncate", err)
 		}
-		// Optional: Add a small delay before retrying
-		// time.Sleep(1 * time.Second)
-
-		// Reset file pointer to the beginning for the next download attempt
-		_, seekErr := file.Seek(0, io.SeekStart)
-		if seekErr != nil {
-			log.Printf("Worker %d: Failed to seek file %s before retry: %v", w.ID, localPath, seekErr)
-			file.Close() // Close before removing
-			os.Remove(localPath)
-			log.Fatalf("Worker %d: Unrecoverable error seeking file %s: %v", w.ID, localPath, seekErr)
+	}
+
+	var lastErr error
+	err = transfer.Attempt(ctx, w.Retry, w.Concurrency, func(attempt int) (int64, error) {
+		if attempt > 1 {
+			if err := w.restart(file, state, lastErr); err != nil {
+				return 0, retry.Permanent(err)
+			}
 		}
-		err = file.Truncate(0) // Truncate the file to overwrite potentially partial download
-		if err != nil {
-			log.Printf("Worker %d: Failed to truncate file %s before retry: %v", w.ID, localPath, err)
-			file.Close() // Close before removing
-			os.Remove(localPath)
-			log.Fatalf("Worker %d: Unrecoverable error truncating file %s: %v", w.ID, localPath, err)
+
+		var n int64
+		if state != nil {
+			// Only fetch the chunks that are still missing
+			before := state.completed()
+			lastErr = w.downloadChunks(ctx, file, obj, state)
+			n = state.completed() - before
+		} else {
+			// Download the file using S3 Manager
+			input := &s3.GetObjectInput{
+				Bucket: aws.String(w.Bucket),
+				Key:    aws.String(key),
+			}
+			if w.Verify {
+				input.ChecksumMode = types.ChecksumModeEnabled
+				// The file is verified against the listed ETag, a newer version would fail every attempt
+				if obj.ETag != "" {
+					input.IfMatch = aws.String(`"` + obj.ETag + `"`)
+				}
+			}
+			n, lastErr = w.Downloader.Download(ctx, file, input)
+		}
+
+		// Check the bytes on disk before the file is moved into place
+		if lastErr == nil && w.Verify {
+			lastErr = w.verifyFile(ctx, tempPath, obj)
 		}
+		return n, lastErr
+	}, func(attempt int, err error) {
+		log.Printf("Worker %d: Attempt %d: Failed to download %s: %v", w.ID, attempt, key, err)
+	})
+	if errors.Is(err, transfer.ErrIntegrity) {
+		return fail("verify", err)
+	}
+	if err != nil {
+		// Only resumable downloads keep their partial file
+		return fail("download", err)
 	}
 
-	// If we reach here, the download was successful within the retry loop.
-	// The redundant check for err != nil after the loop is removed as log.Fatalf would have exited.
+	// Make sure the data is on disk before the file becomes visible under its final name
+	if err := file.Sync(); err != nil {
+		return fail("sync", err)
+	}
+	if err := file.Close(); err != nil {
+		return fail("close", err)
+	}
+	if err := os.Rename(tempPath, localPath); err != nil {
+		os.Remove(tempPath)
+		if state != nil {
+			state.remove()
+		}
+		return &transfer.FileError{Key: key, Op: "rename", Path: localPath, Err: err}
+	}
+	if state != nil {
+		state.remove()
+	}
+
+	// Use the object's LastModified as mtime, so later sync runs can tell whether it changed
+	if !obj.LastModified.IsZero() {
+		if err := os.Chtimes(localPath, obj.LastModified, obj.LastModified); err != nil {
+			log.Printf("Worker %d: Failed to set modification time of %s: %v", w.ID, localPath, err)
+		}
+	}
 
 	// Increment counter and log progress only on success
-	finished := w.FinishedFiles.Add(1)
-	total := w.TotalFiles.Load()
+	w.FinishedFiles.Add(1)
+
+	log.Printf("Worker %d %s, downloaded %s", w.ID, w.progress(), key)
+	return nil
+}
+
+// restart prepares the temporary file for another attempt after a failed one
+func (w *Worker) restart(file *os.File, state *resumeState, failure error) error {
+	if state != nil {
+		// Completed chunks are kept, unless the assembled file is corrupt
+		if errors.Is(failure, transfer.ErrIntegrity) {
+			return state.reset()
+		}
+		return nil
+	}
+
+	// Overwrite the partial download from the beginning
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return file.Truncate(0)
+}
 
-	log.Printf("Worker %d (%d/%d), downloaded %s", w.ID, finished, total, key)
+// progress formats the progress of the run for the worker's log lines
+func (w *Worker) progress() string {
+	return transfer.Progress(w.TotalFiles, w.FinishedFiles, w.SkippedFiles, w.Concurrency)
 }
 
+// PartSize is the size of the ranged GETs the downloader splits objects into
+const PartSize = 5 * 1024 * 1024
+
 // CreateDownloader creates a new S3 downloader
 func CreateDownloader(client *s3.Client) *manager.Downloader {
 	return manager.NewDownloader(client, func(d *manager.Downloader) {
-		d.PartSize = 5 * 1024 * 1024 // 5MB per part
-		d.Concurrency = 3            // 3 go routines per file download
+		d.PartSize = PartSize
+		d.Concurrency = 3 // 3 go routines per file download
 	})
 }
+
+// Requests estimates the GET and HEAD requests a download of the object takes, in parts of PartSize,
+// or in resumable chunks from resumeThreshold on, and with a HEAD request to verify it
+func Requests(obj s3ops.ObjectInfo, resumeThreshold int64, verify bool) (gets, heads int64) {
+	partSize := int64(PartSize)
+	if resumeThreshold > 0 && obj.Size >= resumeThreshold && obj.ETag != "" {
+		partSize = resumeChunkSize
+	}
+	gets = max(1, (obj.Size+partSize-1)/partSize)
+	if verify {
+		heads = 1
+	}
+	return gets, heads
+}
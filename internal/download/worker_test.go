@@ -7,7 +7,6 @@ import (
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -18,6 +17,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
 )
 
 // mockDownloader implements the Downloader interface for testing
@@ -42,6 +45,28 @@ func TestCreateDownloader(t *testing.T) {
 	}
 }
 
+func TestRequests(t *testing.T) {
+	const mib = 1024 * 1024
+	tests := []struct {
+		name            string
+		obj             s3ops.ObjectInfo
+		resumeThreshold int64
+		verify          bool
+		gets, heads     int64
+	}{
+		{"empty object", s3ops.ObjectInfo{Size: 0}, 0, false, 1, 0},
+		{"parts of the downloader", s3ops.ObjectInfo{Size: 12 * mib}, 0, true, 3, 1},
+		{"resumable chunks", s3ops.ObjectInfo{Size: 100 * mib, ETag: "abc"}, 64 * mib, false, 4, 0},
+		{"not resumable without an ETag", s3ops.ObjectInfo{Size: 100 * mib}, 64 * mib, false, 20, 0},
+	}
+	for _, tt := range tests {
+		gets, heads := Requests(tt.obj, tt.resumeThreshold, tt.verify)
+		if gets != tt.gets || heads != tt.heads {
+			t.Errorf("%s: Requests() = %d, %d, want %d, %d", tt.name, gets, heads, tt.gets, tt.heads)
+		}
+	}
+}
+
 // TestWorkerStart tests the Start method of Worker
 func TestWorkerStart(t *testing.T) {
 	// Create a temporary directory for test files
@@ -59,9 +84,9 @@ func TestWorkerStart(t *testing.T) {
 	}
 
 	// Setup the file channel
-	filesChan := make(chan string, len(testFiles))
+	filesChan := make(chan s3ops.ObjectInfo, len(testFiles))
 	for _, file := range testFiles {
-		filesChan <- file
+		filesChan <- s3ops.ObjectInfo{Key: file}
 	}
 	close(filesChan)
 
@@ -107,7 +132,7 @@ func TestWorkerStart(t *testing.T) {
 	}
 
 	// Start the worker
-	worker.Start()
+	worker.Start(context.Background())
 
 	// Wait for the worker to finish
 	wg.Wait()
@@ -178,7 +203,9 @@ func TestDownloadFile(t *testing.T) {
 	}
 
 	// Call the method directly
-	worker.downloadFile(testFile)
+	if err := worker.downloadFile(context.Background(), s3ops.ObjectInfo{Key: testFile}); err != nil {
+		t.Fatalf("downloadFile() returned unexpected error: %v", err)
+	}
 
 	// Verify the file was created
 	filePath := filepath.Join(tempDir, testFile)
@@ -200,83 +227,135 @@ func TestDownloadFile(t *testing.T) {
 	}
 }
 
-// Helper function to run tests expecting log.Fatalf
-func runTestExpectingFatal(t *testing.T, testName string, testFunc func(t *testing.T)) {
-	if os.Getenv("BE_WORKER_FATAL_TEST") == "1" {
-		testFunc(t)
-		return
+func TestDownloadFile_MkdirAllFailure(t *testing.T) {
+	// Create a read-only directory to cause MkdirAll to fail
+	readOnlyDir, err := os.MkdirTemp("", "readonly")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
 	}
-	cmd := exec.Command(os.Args[0], "-test.run="+testName)
-	cmd.Env = append(os.Environ(), "BE_WORKER_FATAL_TEST=1")
-	err := cmd.Run()
-	if e, ok := err.(*exec.ExitError); ok && !e.Success() {
-		// Test exited with non-zero status, as expected from log.Fatalf
-		return
+	defer os.RemoveAll(readOnlyDir)
+
+	// On Windows, this is trickier and might not reliably cause failure without ACL manipulation.
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping read-only directory test on Windows")
+	}
+	if err := os.Chmod(readOnlyDir, 0400); err != nil {
+		t.Fatalf("Failed to chmod temp dir: %v", err)
+	}
+	defer os.Chmod(readOnlyDir, 0700) // Clean up chmod
+	if os.Geteuid() == 0 {
+		t.Skip("Skipping read-only directory test when running as root")
 	}
-	t.Fatalf("Test %s process ran with err %v, want exit status 1", testName, err)
-}
 
-func TestDownloadFile_MkdirAllFailure(t *testing.T) {
-	// This test expects log.Fatalf, so we use the helper
-	runTestExpectingFatal(t, "^"+t.Name()+"$", func(t *testing.T) {
-		// Create a read-only directory to cause MkdirAll to fail
-		readOnlyDir, err := os.MkdirTemp("", "readonly")
-		if err != nil {
-			t.Fatalf("Failed to create temp dir: %v", err)
-		}
-		// On non-Windows, chmod; on Windows, this is trickier and might not reliably cause failure.
-		// This test might be less effective on Windows without more complex ACL manipulation.
-		if runtime.GOOS != "windows" {
-			if err := os.Chmod(readOnlyDir, 0400); err != nil {
-				t.Fatalf("Failed to chmod temp dir: %v", err)
-			}
-			defer os.Chmod(readOnlyDir, 0700) // Clean up chmod
-		}
-		defer os.RemoveAll(readOnlyDir)
-
-		destination := filepath.Join(readOnlyDir, "subdir") // Try to create subdir inside readOnlyDir
-
-		var finishedFiles atomic.Int64
-		worker := Worker{
-			ID:          3,
-			Downloader:  nil, // Downloader won't be reached
-			Bucket:      "test-bucket",
-			Destination: destination,
-			// Other fields like WaitGroup, FilesChan, TotalFiles not needed for this specific test
-			FinishedFiles: &finishedFiles,
-		}
+	destination := filepath.Join(readOnlyDir, "subdir") // Try to create subdir inside readOnlyDir
+
+	var finishedFiles atomic.Int64
+	worker := Worker{
+		ID:            3,
+		Downloader:    nil, // Downloader won't be reached
+		Bucket:        "test-bucket",
+		Destination:   destination,
+		FinishedFiles: &finishedFiles,
+	}
+
+	err = worker.downloadFile(context.Background(), s3ops.ObjectInfo{Key: "some/key.txt"})
 
-		// This call should trigger log.Fatalf inside downloadFile
-		worker.downloadFile("some/key.txt")
-	})
+	var fileErr *transfer.FileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("downloadFile() error = %v, want *transfer.FileError", err)
+	}
+	if fileErr.Op != "mkdir" {
+		t.Errorf("FileError.Op = %q, want %q", fileErr.Op, "mkdir")
+	}
+	if fileErr.Key != "some/key.txt" {
+		t.Errorf("FileError.Key = %q, want %q", fileErr.Key, "some/key.txt")
+	}
+	if finishedFiles.Load() != 0 {
+		t.Errorf("FinishedFiles = %d, want 0", finishedFiles.Load())
+	}
 }
 
 func TestDownloadFile_CreateFailure(t *testing.T) {
-	runTestExpectingFatal(t, "^"+t.Name()+"$", func(t *testing.T) {
-		tempDir, err := os.MkdirTemp("", "create_fail")
-		if err != nil {
-			t.Fatalf("Failed to create temp dir: %v", err)
-		}
-		defer os.RemoveAll(tempDir)
+	tempDir, err := os.MkdirTemp("", "create_fail")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
 
-		// Pre-create a directory where the file should be, to cause os.Create to fail
-		conflictingPath := filepath.Join(tempDir, "path/to/file.txt")
-		if err := os.MkdirAll(conflictingPath, 0755); err != nil {
-			t.Fatalf("Failed to create conflicting dir: %v", err)
-		}
+	// Pre-create a directory where the temporary file should be, to cause os.Create to fail
+	conflictingPath := partialPath(filepath.Join(tempDir, "path/to/file.txt"))
+	if err := os.MkdirAll(conflictingPath, 0755); err != nil {
+		t.Fatalf("Failed to create conflicting dir: %v", err)
+	}
 
-		var finishedFiles atomic.Int64
-		worker := Worker{
-			ID:            4,
-			Downloader:    nil, // Downloader won't be reached
-			Bucket:        "test-bucket",
-			Destination:   tempDir,
-			FinishedFiles: &finishedFiles,
-		}
+	var finishedFiles atomic.Int64
+	worker := Worker{
+		ID:            4,
+		Downloader:    nil, // Downloader won't be reached
+		Bucket:        "test-bucket",
+		Destination:   tempDir,
+		FinishedFiles: &finishedFiles,
+	}
 
-		// This call should trigger log.Fatalf
-		worker.downloadFile("path/to/file.txt")
-	})
+	err = worker.downloadFile(context.Background(), s3ops.ObjectInfo{Key: "path/to/file.txt"})
+
+	var fileErr *transfer.FileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("downloadFile() error = %v, want *transfer.FileError", err)
+	}
+	if fileErr.Op != "create" {
+		t.Errorf("FileError.Op = %q, want %q", fileErr.Op, "create")
+	}
+}
+
+func TestDownloadFile_RenameFailure(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "rename_fail")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Pre-create a non-empty directory at the final path, so the temporary file can't be renamed over it
+	conflictingPath := filepath.Join(tempDir, "path/to/file.txt")
+	if err := os.MkdirAll(filepath.Join(conflictingPath, "child"), 0755); err != nil {
+		t.Fatalf("Failed to create conflicting dir: %v", err)
+	}
+
+	var (
+		totalFiles    atomic.Int64
+		finishedFiles atomic.Int64
+	)
+	mockDownload := &mockDownloader{
+		downloadFunc: func(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
+			nWritten, err := w.WriteAt([]byte("content"), 0)
+			return int64(nWritten), err
+		},
+	}
+
+	worker := Worker{
+		ID:            4,
+		Downloader:    mockDownload,
+		Bucket:        "test-bucket",
+		Destination:   tempDir,
+		TotalFiles:    &totalFiles,
+		FinishedFiles: &finishedFiles,
+	}
+
+	err = worker.downloadFile(context.Background(), s3ops.ObjectInfo{Key: "path/to/file.txt"})
+
+	var fileErr *transfer.FileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("downloadFile() error = %v, want *transfer.FileError", err)
+	}
+	if fileErr.Op != "rename" {
+		t.Errorf("FileError.Op = %q, want %q", fileErr.Op, "rename")
+	}
+	if _, err := os.Stat(partialPath(conflictingPath)); !os.IsNotExist(err) {
+		t.Error("Temporary file was not removed after rename failure")
+	}
+	if finishedFiles.Load() != 0 {
+		t.Errorf("FinishedFiles = %d, want 0", finishedFiles.Load())
+	}
 }
 
 func TestDownloadFile_RetrySuccess(t *testing.T) {
@@ -336,7 +415,9 @@ func TestDownloadFile_RetrySuccess(t *testing.T) {
 			defer log.SetOutput(os.Stderr) // Restore log output
 
 			testFile := "retry/success/file.txt"
-			worker.downloadFile(testFile)
+			if err := worker.downloadFile(context.Background(), s3ops.ObjectInfo{Key: testFile}); err != nil {
+				t.Fatalf("downloadFile() returned unexpected error: %v", err)
+			}
 
 			// Verify file content is the final successful one
 			filePath := filepath.Join(tempDir, testFile)
@@ -372,64 +453,194 @@ func TestDownloadFile_RetrySuccess(t *testing.T) {
 }
 
 func TestDownloadFile_RetryFailure(t *testing.T) {
-	runTestExpectingFatal(t, "^"+t.Name()+"$", func(t *testing.T) {
-		tempDir, err := os.MkdirTemp("", "retry_fail")
-		if err != nil {
-			t.Fatalf("Failed to create temp dir: %v", err)
-		}
-		defer os.RemoveAll(tempDir)
+	tempDir, err := os.MkdirTemp("", "retry_fail")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
 
-		var (
-			downloadAttempts atomic.Int32
-			finishedFiles    atomic.Int64 // Should remain 0
-		)
+	var (
+		downloadAttempts atomic.Int32
+		finishedFiles    atomic.Int64 // Should remain 0
+	)
 
-		mockErr := errors.New("persistent download error")
+	mockErr := errors.New("persistent download error")
 
-		mockDownload := &mockDownloader{
-			downloadFunc: func(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
-				downloadAttempts.Add(1)
-				// Always fail
-				return 0, mockErr
-			},
-		}
+	mockDownload := &mockDownloader{
+		downloadFunc: func(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
+			downloadAttempts.Add(1)
+			// Always fail
+			return 0, mockErr
+		},
+	}
 
-		worker := Worker{
-			ID:            6,
-			Downloader:    mockDownload,
-			Bucket:        "test-bucket",
-			Destination:   tempDir,
-			FinishedFiles: &finishedFiles,
-		}
+	worker := Worker{
+		ID:            6,
+		Downloader:    mockDownload,
+		Bucket:        "test-bucket",
+		Destination:   tempDir,
+		FinishedFiles: &finishedFiles,
+	}
 
-		testFile := "retry/failure/file.txt"
+	testFile := "retry/failure/file.txt"
 
-		// Capture log output to verify attempts were logged before fatal
-		var logBuf bytes.Buffer
-		log.SetOutput(&logBuf)
-		// Note: Cannot restore stderr here as log.Fatalf will exit
+	// Capture log output to verify attempts were logged
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
 
-		// This call should eventually trigger log.Fatalf after 3 attempts
-		worker.downloadFile(testFile)
+	err = worker.downloadFile(context.Background(), s3ops.ObjectInfo{Key: testFile})
 
-		// Code here will not be reached if log.Fatalf works correctly
-		// We rely on runTestExpectingFatal to verify the exit
+	if !errors.Is(err, mockErr) {
+		t.Errorf("downloadFile() error = %v, want wrapped %v", err, mockErr)
+	}
+	var fileErr *transfer.FileError
+	if !errors.As(err, &fileErr) || fileErr.Op != "download" {
+		t.Errorf("downloadFile() error = %v, want *transfer.FileError with Op %q", err, "download")
+	}
 
-		// We can still check the log *if* it didn't exit (which would be a test failure)
-		logOutput := logBuf.String()
-		if !strings.Contains(logOutput, "Attempt 1: Failed to download") {
-			t.Errorf("Log missing attempt 1 failure")
-		}
-		if !strings.Contains(logOutput, "Attempt 2: Failed to download") {
-			t.Errorf("Log missing attempt 2 failure")
-		}
-		if !strings.Contains(logOutput, "Attempt 3: Failed to download") {
-			t.Errorf("Log missing attempt 3 failure")
+	logOutput := logBuf.String()
+	for _, part := range []string{"Attempt 1: Failed to download", "Attempt 2: Failed to download", "Attempt 3: Failed to download"} {
+		if !strings.Contains(logOutput, part) {
+			t.Errorf("Log missing %q", part)
 		}
-		if downloadAttempts.Load() != 3 {
-			t.Errorf("Expected 3 download attempts, got %d", downloadAttempts.Load())
-		}
-	})
+	}
+	if downloadAttempts.Load() != 3 {
+		t.Errorf("Expected 3 download attempts, got %d", downloadAttempts.Load())
+	}
+	if finishedFiles.Load() != 0 {
+		t.Errorf("FinishedFiles = %d, want 0", finishedFiles.Load())
+	}
+
+	// Neither the final nor the partially downloaded file must be left behind
+	if _, err := os.Stat(filepath.Join(tempDir, testFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected %s not to exist after final failure", testFile)
+	}
+	if _, err := os.Stat(partialPath(filepath.Join(tempDir, testFile))); !os.IsNotExist(err) {
+		t.Errorf("Expected temporary file for %s to be removed after final failure", testFile)
+	}
+}
+
+// TestDownloadFile_RetryPolicy tests that retries back off and permanent errors fail fast
+func TestDownloadFile_RetryPolicy(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name             string
+		err              error
+		expectedAttempts int32
+		expectedRetries  int64
+	}{
+		{"transient error is retried", errors.New("connection reset by peer"), 4, 3},
+		{"missing object fails fast", &types.NoSuchKey{}, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "retry_policy")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			var (
+				downloadAttempts atomic.Int32
+				finishedFiles    atomic.Int64
+				retries          atomic.Int64
+			)
+			worker := Worker{
+				ID: 11,
+				Downloader: &mockDownloader{
+					downloadFunc: func(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
+						downloadAttempts.Add(1)
+						return 0, tt.err
+					},
+				},
+				Bucket:        "test-bucket",
+				Destination:   tempDir,
+				FinishedFiles: &finishedFiles,
+				Retry:         retry.Policy{MaxAttempts: 4, Retries: &retries},
+			}
+
+			err = worker.downloadFile(context.Background(), s3ops.ObjectInfo{Key: "file.txt"})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("downloadFile() error = %v, want wrapped %v", err, tt.err)
+			}
+			if downloadAttempts.Load() != tt.expectedAttempts {
+				t.Errorf("Download attempts = %d, want %d", downloadAttempts.Load(), tt.expectedAttempts)
+			}
+			if retries.Load() != tt.expectedRetries {
+				t.Errorf("Retries = %d, want %d", retries.Load(), tt.expectedRetries)
+			}
+		})
+	}
+}
+
+// TestWorkerStart_CollectsFailures tests that failed objects are reported and do not stop the worker
+func TestWorkerStart_CollectsFailures(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "worker_test_failures")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	testFiles := []string{"good1.txt", "bad.txt", "good2.txt"}
+	filesChan := make(chan s3ops.ObjectInfo, len(testFiles))
+	for _, file := range testFiles {
+		filesChan <- s3ops.ObjectInfo{Key: file}
+	}
+	close(filesChan)
+
+	var (
+		wg            sync.WaitGroup
+		totalFiles    atomic.Int64
+		finishedFiles atomic.Int64
+		results       transfer.Results
+	)
+	totalFiles.Store(int64(len(testFiles)))
+	wg.Add(1)
+
+	mockDownload := &mockDownloader{
+		downloadFunc: func(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
+			if *input.Key == "bad.txt" {
+				return 0, errors.New("access denied")
+			}
+			nWritten, err := w.WriteAt([]byte("ok"), 0)
+			return int64(nWritten), err
+		},
+	}
+
+	worker := Worker{
+		ID:            7,
+		Downloader:    mockDownload,
+		Bucket:        "test-bucket",
+		Destination:   tempDir,
+		FilesChan:     filesChan,
+		WaitGroup:     &wg,
+		TotalFiles:    &totalFiles,
+		FinishedFiles: &finishedFiles,
+		Results:       &results,
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	worker.Start(context.Background())
+	wg.Wait()
+
+	if finishedFiles.Load() != 2 {
+		t.Errorf("FinishedFiles = %d, want 2", finishedFiles.Load())
+	}
+
+	failures := results.Failures()
+	if len(failures) != 1 {
+		t.Fatalf("Failures() returned %d errors, want 1", len(failures))
+	}
+	var fileErr *transfer.FileError
+	if !errors.As(failures[0], &fileErr) || fileErr.Key != "bad.txt" {
+		t.Errorf("Failures()[0] = %v, want *transfer.FileError for bad.txt", failures[0])
+	}
 }
 
 // TestWorkerFileProcessing tests basic file handling
@@ -449,9 +660,9 @@ func TestWorkerFileProcessing(t *testing.T) {
 	}
 
 	// Setup the file channel
-	filesChan := make(chan string, len(testFiles))
+	filesChan := make(chan s3ops.ObjectInfo, len(testFiles))
 	for _, file := range testFiles {
-		filesChan <- file
+		filesChan <- s3ops.ObjectInfo{Key: file}
 	}
 	close(filesChan)
 
@@ -480,12 +691,13 @@ func TestWorkerFileProcessing(t *testing.T) {
 	// Set total files
 	totalFiles.Store(int64(len(testFiles)))
 
-	// Instead of calling worker.Start(), we'll manually process the files
+	// Instead of calling worker.Start(context.Background()), we'll manually process the files
 	// to avoid needing a real S3 downloader
 	go func() {
 		defer wg.Done()
 
-		for key := range worker.FilesChan {
+		for obj := range worker.FilesChan {
+			key := obj.Key
 			// Create the directory structure
 			localPath := filepath.Join(worker.Destination, key)
 			dir := filepath.Dir(localPath)
@@ -538,3 +750,73 @@ func TestWorkerFileProcessing(t *testing.T) {
 		}
 	}
 }
+
+// TestWorkerStart_Cancelled tests that a cancelled download is recorded as interrupted and cleaned up
+func TestWorkerStart_Cancelled(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "worker_test_cancel")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	filesChan := make(chan s3ops.ObjectInfo, 2)
+	filesChan <- s3ops.ObjectInfo{Key: "slow.txt"}
+	filesChan <- s3ops.ObjectInfo{Key: "never.txt"}
+	close(filesChan)
+
+	var (
+		wg            sync.WaitGroup
+		totalFiles    atomic.Int64
+		finishedFiles atomic.Int64
+		results       transfer.Results
+	)
+	totalFiles.Store(2)
+	wg.Add(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockDownload := &mockDownloader{
+		downloadFunc: func(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
+			// Write some data, then get interrupted
+			w.WriteAt([]byte("partial"), 0)
+			cancel()
+			<-ctx.Done()
+			return 0, ctx.Err()
+		},
+	}
+
+	worker := Worker{
+		ID:            8,
+		Downloader:    mockDownload,
+		Bucket:        "test-bucket",
+		Destination:   tempDir,
+		FilesChan:     filesChan,
+		WaitGroup:     &wg,
+		TotalFiles:    &totalFiles,
+		FinishedFiles: &finishedFiles,
+		Results:       &results,
+	}
+
+	worker.Start(ctx)
+	wg.Wait()
+
+	if interrupted := results.Interrupted(); len(interrupted) != 1 || interrupted[0] != "slow.txt" {
+		t.Errorf("Interrupted() = %v, want [slow.txt]", interrupted)
+	}
+	if failures := results.Failures(); len(failures) != 0 {
+		t.Errorf("Failures() = %v, want none", failures)
+	}
+	if finishedFiles.Load() != 0 {
+		t.Errorf("FinishedFiles = %d, want 0", finishedFiles.Load())
+	}
+	if _, err := os.Stat(partialPath(filepath.Join(tempDir, "slow.txt"))); !os.IsNotExist(err) {
+		t.Error("Partial file for slow.txt was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "slow.txt")); !os.IsNotExist(err) {
+		t.Error("slow.txt should not exist after an interrupted download")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "never.txt")); !os.IsNotExist(err) {
+		t.Error("never.txt should not have been started after cancellation")
+	}
+}
@@ -0,0 +1,139 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// sizeUnits are the multipliers of the size suffixes, in powers of 1024 like aws s3 and rclone
+var sizeUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+// ParseSize parses a size in bytes with an optional K, M, G or T suffix, e.g. "512", "100K", "1.5GiB" or "2GB".
+// Suffixes are powers of 1024 whether written as "G", "GB" or "GiB".
+func ParseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	end := strings.IndexFunc(value, func(r rune) bool { return unicode.IsLetter(r) })
+	if end < 0 {
+		end = len(value)
+	}
+
+	number, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	unit := strings.ToLower(value[end:])
+	if len(unit) > 1 {
+		unit = strings.TrimSuffix(strings.TrimSuffix(unit, "b"), "i")
+	}
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q, expected B, K, M, G or T", value)
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+// ParseTime parses an absolute time in RFC3339 or YYYY-MM-DD format (UTC),
+// or a duration relative to now like "24h", "7d" or "2w", meaning that long ago.
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+
+	if d, err := parseAge(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339, YYYY-MM-DD or a relative age like 24h or 7d", value)
+}
+
+// parseAge parses a duration, additionally accepting days ("d") and weeks ("w") as the only unit
+func parseAge(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q", value)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return d, nil
+}
+
+// AddStorageClasses restricts the filter to objects in the given comma-separated storage classes.
+// Names are case-insensitive, e.g. "standard,intelligent_tiering".
+func (f *Filter) AddStorageClasses(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		class := types.ObjectStorageClass(name)
+		known := false
+		for _, v := range class.Values() {
+			if v == class {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown storage class %q", name)
+		}
+		f.StorageClasses = append(f.StorageClasses, class)
+	}
+	return nil
+}
+
+// matchAttributes reports whether the object's size, last-modified time and storage class pass the filter.
+// Conditions on attributes the object source doesn't provide, like sizes missing from a manifest, are not applied.
+func (f *Filter) matchAttributes(obj s3ops.ObjectInfo) bool {
+	if obj.Size != s3ops.UnknownSize && (obj.Size < f.MinSize || (f.MaxSize > 0 && obj.Size > f.MaxSize)) {
+		return false
+	}
+	if !obj.LastModified.IsZero() {
+		if !f.ModifiedAfter.IsZero() && obj.LastModified.Before(f.ModifiedAfter) {
+			return false
+		}
+		if !f.ModifiedBefore.IsZero() && !obj.LastModified.Before(f.ModifiedBefore) {
+			return false
+		}
+	}
+	if len(f.StorageClasses) == 0 {
+		return true
+	}
+
+	// Listings leave the storage class empty for some S3-compatible stores, which means STANDARD
+	class := obj.StorageClass
+	if class == "" {
+		class = types.ObjectStorageClassStandard
+	}
+	for _, c := range f.StorageClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
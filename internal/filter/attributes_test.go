@@ -0,0 +1,120 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+		wantErr  bool
+	}{
+		{"512", 512, false},
+		{"512B", 512, false},
+		{"100K", 100 << 10, false},
+		{"100kb", 100 << 10, false},
+		{"1.5GiB", 3 << 29, false},
+		{"2GB", 2 << 30, false},
+		{"1T", 1 << 40, false},
+		{"", 0, true},
+		{"-1", 0, true},
+		{"10X", 0, true},
+		{"GB", 0, true},
+	}
+
+	for _, tt := range tests {
+		size, err := ParseSize(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if size != tt.expected {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.value, size, tt.expected)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 10, 8, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{"2024-10-01T08:30:00Z", time.Date(2024, 10, 1, 8, 30, 0, 0, time.UTC), false},
+		{"2024-10-01", time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), false},
+		{"24h", time.Date(2024, 10, 7, 12, 0, 0, 0, time.UTC), false},
+		{"90m", time.Date(2024, 10, 8, 10, 30, 0, 0, time.UTC), false},
+		{"7d", time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC), false},
+		{"1w", time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+		{"-7d", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTime(tt.value, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTime(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.expected) {
+			t.Errorf("ParseTime(%q) = %v, want %v", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestAddStorageClasses(t *testing.T) {
+	var f Filter
+	if err := f.AddStorageClasses("standard, intelligent_tiering"); err != nil {
+		t.Fatalf("AddStorageClasses() returned unexpected error: %v", err)
+	}
+	if len(f.StorageClasses) != 2 || f.StorageClasses[1] != "INTELLIGENT_TIERING" {
+		t.Errorf("AddStorageClasses() = %v, want [STANDARD INTELLIGENT_TIERING]", f.StorageClasses)
+	}
+
+	if err := f.AddStorageClasses("FROZEN"); err == nil {
+		t.Error("AddStorageClasses() with an unknown class did not fail")
+	}
+}
+
+func TestFilterMatchAttributes(t *testing.T) {
+	day := time.Date(2024, 10, 8, 0, 0, 0, 0, time.UTC)
+	f := Filter{
+		MinSize:        10,
+		MaxSize:        100,
+		ModifiedAfter:  day,
+		ModifiedBefore: day.Add(24 * time.Hour),
+		StorageClasses: []types.ObjectStorageClass{types.ObjectStorageClassStandard},
+	}
+	if err := f.Exclude("*.crc"); err != nil {
+		t.Fatalf("Exclude() returned unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		obj      s3ops.ObjectInfo
+		expected bool
+	}{
+		{"within all bounds", s3ops.ObjectInfo{Key: "a", Size: 50, LastModified: day.Add(time.Hour), StorageClass: "STANDARD"}, true},
+		{"bounds are inclusive", s3ops.ObjectInfo{Key: "a", Size: 100, LastModified: day, StorageClass: "STANDARD"}, true},
+		{"empty storage class is standard", s3ops.ObjectInfo{Key: "a", Size: 10, LastModified: day}, true},
+		{"too small", s3ops.ObjectInfo{Key: "a", Size: 9, LastModified: day, StorageClass: "STANDARD"}, false},
+		{"too large", s3ops.ObjectInfo{Key: "a", Size: 101, LastModified: day, StorageClass: "STANDARD"}, false},
+		{"too old", s3ops.ObjectInfo{Key: "a", Size: 50, LastModified: day.Add(-time.Second), StorageClass: "STANDARD"}, false},
+		{"too new", s3ops.ObjectInfo{Key: "a", Size: 50, LastModified: day.Add(24 * time.Hour), StorageClass: "STANDARD"}, false},
+		{"other storage class", s3ops.ObjectInfo{Key: "a", Size: 50, LastModified: day, StorageClass: "GLACIER"}, false},
+		{"excluded key", s3ops.ObjectInfo{Key: "a.crc", Size: 50, LastModified: day, StorageClass: "STANDARD"}, false},
+	}
+
+	for _, tt := range tests {
+		if matches := f.Match(tt.obj); matches != tt.expected {
+			t.Errorf("Match(%s) = %v, want %v", tt.name, matches, tt.expected)
+		}
+	}
+}
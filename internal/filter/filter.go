@@ -0,0 +1,209 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// RegexPrefix marks a pattern as a regular expression instead of a glob
+const RegexPrefix = "re:"
+
+// rule includes or excludes the keys matching a pattern
+type rule struct {
+	include bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// Filter decides which objects are copied, using include and exclude rules on their keys
+// and conditions on the attributes ListObjectsV2 returns.
+// Rules are evaluated in order and the last matching one wins, like aws s3 cp filters.
+// Keys matching no rule are included, unless the first rule is an include,
+// so that a lone --include '*.parquet' means "only parquet files".
+// Objects must additionally satisfy every attribute condition that is set.
+// The zero value and a nil Filter include everything.
+type Filter struct {
+	rules []rule
+
+	MinSize        int64     // In bytes
+	MaxSize        int64     // In bytes, 0 means no limit
+	ModifiedAfter  time.Time // Inclusive, zero means no limit
+	ModifiedBefore time.Time // Exclusive, zero means no limit
+	StorageClasses []types.ObjectStorageClass
+}
+
+// Include adds a rule including the keys that match pattern
+func (f *Filter) Include(pattern string) error {
+	return f.add(true, pattern)
+}
+
+// Exclude adds a rule excluding the keys that match pattern
+func (f *Filter) Exclude(pattern string) error {
+	return f.add(false, pattern)
+}
+
+func (f *Filter) add(include bool, pattern string) error {
+	re, err := compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	f.rules = append(f.rules, rule{include: include, pattern: pattern, re: re})
+	return nil
+}
+
+// LoadFile adds the rules from a filter file, one per line in the form "+ pattern" or "include pattern"
+// to include and "- pattern" or "exclude pattern" to exclude. Empty lines and lines starting with # are ignored.
+func (f *Filter) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		action, pattern, ok := strings.Cut(text, " ")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return fmt.Errorf("%s:%d: expected an action and a pattern", path, line)
+		}
+
+		switch action {
+		case "+", "include":
+			err = f.Include(pattern)
+		case "-", "exclude":
+			err = f.Exclude(pattern)
+		default:
+			return fmt.Errorf("%s:%d: unknown action %q, expected +, -, include or exclude", path, line, action)
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Empty reports whether the filter has no rules or conditions
+func (f *Filter) Empty() bool {
+	return f == nil || (len(f.rules) == 0 && f.MinSize == 0 && f.MaxSize == 0 &&
+		f.ModifiedAfter.IsZero() && f.ModifiedBefore.IsZero() && len(f.StorageClasses) == 0)
+}
+
+// Match reports whether the object is to be copied
+func (f *Filter) Match(obj s3ops.ObjectInfo) bool {
+	if f.Empty() {
+		return true
+	}
+	return f.matchAttributes(obj) && f.MatchKey(obj.Key)
+}
+
+// MatchKey reports whether the include and exclude rules select the key, regardless of the attribute conditions
+func (f *Filter) MatchKey(key string) bool {
+	if f == nil || len(f.rules) == 0 {
+		return true
+	}
+
+	included := !f.rules[0].include
+	for _, r := range f.rules {
+		if r.re.MatchString(key) {
+			included = r.include
+		}
+	}
+	return included
+}
+
+// Patterns is a list of globs or regular expressions with the syntax of include and exclude rules
+type Patterns []*regexp.Regexp
+
+// Add adds a pattern to the list
+func (p *Patterns) Add(pattern string) error {
+	re, err := compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	*p = append(*p, re)
+	return nil
+}
+
+// Match reports whether any pattern matches the key
+func (p Patterns) Match(key string) bool {
+	for _, re := range p {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// compile turns a pattern into a regular expression.
+// Patterns prefixed with RegexPrefix are regular expressions matched anywhere in the key,
+// everything else is a glob matched against the whole key.
+func compile(pattern string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(pattern, RegexPrefix); ok {
+		return regexp.Compile(expr)
+	}
+	return regexp.Compile(globToRegexp(pattern))
+}
+
+// globToRegexp translates a glob into an anchored regular expression.
+// "*" and "?" don't cross "/", "**" does, and "[...]" is a character class.
+// Like in .gitignore, a glob without a "/" matches the last path segment at any depth,
+// and a glob ending in "/" matches everything below a directory of that name.
+func globToRegexp(glob string) string {
+	if dir, ok := strings.CutSuffix(glob, "/"); ok {
+		glob = dir + "/**"
+		if !strings.Contains(dir, "/") {
+			glob = "**/" + glob
+		}
+	} else if !strings.Contains(glob, "/") {
+		glob = "**/" + glob
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				// Zero or more whole directories
+				expr.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return expr.String()
+}
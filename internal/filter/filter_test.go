@@ -0,0 +1,207 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob    string
+		key     string
+		matches bool
+	}{
+		{"*.parquet", "data/part-0.parquet", true},
+		{"*.parquet", "part-0.parquet", true},
+		{"*.parquet", "data/part-0.parquet.crc", false},
+		{"data/*.parquet", "data/part-0.parquet", true},
+		{"data/*.parquet", "data/2024/part-0.parquet", false},
+		{"data/**/*.parquet", "data/2024/10/part-0.parquet", true},
+		{"data/**/*.parquet", "data/part-0.parquet", true},
+		{"data/**", "data/2024/part-0.parquet", true},
+		{"_temporary/", "data/_temporary/0/part-0", true},
+		{"_temporary/", "data/not_temporary/part-0", false},
+		{"data/_temporary/", "data/_temporary/part-0", true},
+		{"data/_temporary/", "other/data/_temporary/part-0", false},
+		{"part-?.csv", "logs/part-1.csv", true},
+		{"part-?.csv", "logs/part-10.csv", false},
+		{"part-[0-4].csv", "part-3.csv", true},
+		{"part-[!0-4].csv", "part-3.csv", false},
+		{"file(1).txt", "file(1).txt", true},
+	}
+
+	for _, tt := range tests {
+		re, err := compile(tt.glob)
+		if err != nil {
+			t.Errorf("compile(%q) returned unexpected error: %v", tt.glob, err)
+			continue
+		}
+		if matches := re.MatchString(tt.key); matches != tt.matches {
+			t.Errorf("glob %q (%s) matching %q = %v, want %v", tt.glob, re, tt.key, matches, tt.matches)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	type rule struct {
+		include bool
+		pattern string
+	}
+
+	tests := []struct {
+		name     string
+		rules    []rule
+		included []string
+		excluded []string
+	}{
+		{
+			name:     "no rules",
+			included: []string{"a.parquet", "b/c.crc"},
+		},
+		{
+			name:     "only parquet files",
+			rules:    []rule{{true, "*.parquet"}},
+			included: []string{"a.parquet", "b/c.parquet"},
+			excluded: []string{"b/c.crc", "d.json"},
+		},
+		{
+			name:     "everything except temporary and crc files",
+			rules:    []rule{{false, "_temporary/"}, {false, "*.crc"}},
+			included: []string{"a.parquet", "b/c.json"},
+			excluded: []string{"b/_temporary/0/c.parquet", "b/c.parquet.crc"},
+		},
+		{
+			name:     "later rules win",
+			rules:    []rule{{false, "*"}, {true, "*.parquet"}, {false, "_temporary/"}},
+			included: []string{"a.parquet", "b/c.parquet"},
+			excluded: []string{"b/c.json", "_temporary/c.parquet"},
+		},
+		{
+			name:     "regular expressions",
+			rules:    []rule{{false, `re:\.(crc|tmp)$`}, {true, `re:^logs/2024-10-0[1-3]/`}},
+			included: []string{"logs/2024-10-02/a.tmp", "logs/2024-11-01/a.json"},
+			excluded: []string{"logs/2024-11-01/a.crc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f Filter
+			for _, r := range tt.rules {
+				var err error
+				if r.include {
+					err = f.Include(r.pattern)
+				} else {
+					err = f.Exclude(r.pattern)
+				}
+				if err != nil {
+					t.Fatalf("Adding rule %q returned unexpected error: %v", r.pattern, err)
+				}
+			}
+
+			for _, key := range tt.included {
+				if !f.Match(s3ops.ObjectInfo{Key: key}) {
+					t.Errorf("Match(%q) = false, want true", key)
+				}
+			}
+			for _, key := range tt.excluded {
+				if f.Match(s3ops.ObjectInfo{Key: key}) {
+					t.Errorf("Match(%q) = true, want false", key)
+				}
+			}
+		})
+	}
+
+	// A nil filter includes everything
+	var f *Filter
+	if !f.Match(s3ops.ObjectInfo{Key: "a"}) {
+		t.Error("Match() of a nil Filter = false, want true")
+	}
+}
+
+func TestFilterInvalidPattern(t *testing.T) {
+	var f Filter
+	if err := f.Include("re:("); err == nil {
+		t.Error("Include() with an invalid regular expression did not fail")
+	}
+	if !f.Empty() {
+		t.Error("An invalid pattern was added to the filter")
+	}
+}
+
+func TestFilterMatchKey(t *testing.T) {
+	f := Filter{MinSize: 100}
+	if err := f.Exclude("*.tmp"); err != nil {
+		t.Fatalf("Exclude() returned unexpected error: %v", err)
+	}
+	// Attribute conditions don't apply to keys alone
+	if !f.MatchKey("logs/a.json") || f.MatchKey("logs/a.tmp") {
+		t.Errorf("MatchKey() = %v, %v, want true for a.json and false for a.tmp", f.MatchKey("logs/a.json"), f.MatchKey("logs/a.tmp"))
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	var p Patterns
+	for _, pattern := range []string{"local/", "re:\\.keep$"} {
+		if err := p.Add(pattern); err != nil {
+			t.Fatalf("Add(%q) returned unexpected error: %v", pattern, err)
+		}
+	}
+	tests := map[string]bool{
+		"local/notes.txt":     true,
+		"data/local/x.json":   true,
+		"data/.keep":          true,
+		"data/a.json":         false,
+		"localized/file.json": false,
+	}
+	for key, expected := range tests {
+		if got := p.Match(key); got != expected {
+			t.Errorf("Match(%q) = %v, want %v", key, got, expected)
+		}
+	}
+	if err := p.Add("re:("); err == nil || len(p) != 2 {
+		t.Errorf("Add() with an invalid regular expression = %v, %d patterns", err, len(p))
+	}
+}
+
+func TestFilterLoadFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "filter_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "filters.txt")
+	content := "# Skip Spark leftovers\n- _temporary/\n\nexclude *.crc\n+ _temporary/keep.parquet\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write filter file: %v", err)
+	}
+
+	var f Filter
+	if err := f.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile() returned unexpected error: %v", err)
+	}
+	if len(f.rules) != 3 {
+		t.Fatalf("LoadFile() added %d rules, want 3", len(f.rules))
+	}
+	if f.Match(s3ops.ObjectInfo{Key: "data/_temporary/x"}) || f.Match(s3ops.ObjectInfo{Key: "data/a.crc"}) {
+		t.Error("LoadFile() rules don't exclude temporary and crc files")
+	}
+	if !f.Match(s3ops.ObjectInfo{Key: "_temporary/keep.parquet"}) || !f.Match(s3ops.ObjectInfo{Key: "data/a.parquet"}) {
+		t.Error("LoadFile() rules exclude files they shouldn't")
+	}
+
+	if err := os.WriteFile(path, []byte("keep *.parquet\n"), 0644); err != nil {
+		t.Fatalf("Failed to write filter file: %v", err)
+	}
+	if err := f.LoadFile(path); err == nil {
+		t.Error("LoadFile() with an unknown action did not fail")
+	}
+
+	if err := f.LoadFile(filepath.Join(tempDir, "missing.txt")); err == nil {
+		t.Error("LoadFile() with a missing file did not fail")
+	}
+}
@@ -0,0 +1,65 @@
+package inventory
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// codec is a compression algorithm used for the pages of Parquet files and the streams of ORC files
+type codec int
+
+const (
+	codecNone codec = iota
+	codecSnappy
+	codecGzip
+	codecZlib // Raw deflate, as ORC calls it
+	codecZstd
+)
+
+// zstdDecoder is shared by all readers, DecodeAll is safe for concurrent use
+var zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+	return zstd.NewReader(nil)
+})
+
+// decompress decompresses a block, sizeHint is the expected decompressed size when known
+func decompress(c codec, src []byte, sizeHint int) ([]byte, error) {
+	switch c {
+	case codecNone:
+		return src, nil
+	case codecSnappy:
+		return snappy.Decode(make([]byte, 0, sizeHint), src)
+	case codecGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(src))
+		if err != nil {
+			return nil, err
+		}
+		return readAll(gz, sizeHint)
+	case codecZlib:
+		return readAll(flate.NewReader(bytes.NewReader(src)), sizeHint)
+	case codecZstd:
+		decoder, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.DecodeAll(src, make([]byte, 0, sizeHint))
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %d", c)
+	}
+}
+
+// readAll reads a decompressing reader to the end
+func readAll(r io.ReadCloser, sizeHint int) ([]byte, error) {
+	defer r.Close()
+	buf := bytes.NewBuffer(make([]byte, 0, sizeHint))
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
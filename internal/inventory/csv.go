@@ -0,0 +1,65 @@
+package inventory
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ReadCSV reads a CSV data file, gzipped or not, calling fn for every record.
+// The columns are named by the manifest's fileSchema, e.g. "Bucket, Key, Size, LastModifiedDate, ETag".
+func ReadCSV(r io.Reader, schema string, fn func(*Record) error) error {
+	var columns []field
+	for _, name := range strings.Split(schema, ",") {
+		columns = append(columns, fieldOf(name))
+	}
+
+	// Data files are gzipped, but accept files that were decompressed after downloading them
+	buffered := bufio.NewReader(r)
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buffered
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(columns)
+	reader.ReuseRecord = true
+
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+		record := newRecord()
+		for i, value := range values {
+			f := columns[i]
+			// Keys are URL-encoded in CSV reports
+			if f == fieldKey {
+				if value, err = url.QueryUnescape(value); err != nil {
+					return fmt.Errorf("line %d: invalid key: %w", line, err)
+				}
+			}
+			if err := record.setString(f, value); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		if err := fn(&record); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package inventory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+func TestReadCSV(t *testing.T) {
+	data := `"source-bucket","logs/a.json","","true","false","12","2024-10-01T08:00:00.000Z","""abc""","STANDARD","CRC32"
+"source-bucket","logs/b+c%2Fd.json","3HL4kqtJvjVBH40Nrjfkd","false","","","","","",""
+`
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte(data))
+	gz.Close()
+
+	schema := "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, LastModifiedDate, ETag, StorageClass, ChecksumAlgorithm"
+	for name, input := range map[string][]byte{"gzipped": gzipped.Bytes(), "plain": []byte(data)} {
+		t.Run(name, func(t *testing.T) {
+			var records []Record
+			err := ReadCSV(bytes.NewReader(input), schema, func(record *Record) error {
+				records = append(records, *record)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ReadCSV() returned unexpected error: %v", err)
+			}
+			if len(records) != 2 {
+				t.Fatalf("ReadCSV() read %d records, want 2", len(records))
+			}
+
+			first := records[0]
+			if first.Bucket != "source-bucket" || first.Key != "logs/a.json" || first.Size != 12 ||
+				first.ETag != "abc" || first.StorageClass != types.ObjectStorageClassStandard ||
+				!first.LastModified.Equal(time.Date(2024, 10, 1, 8, 0, 0, 0, time.UTC)) ||
+				len(first.ChecksumAlgorithms) != 1 || !first.Current() {
+				t.Errorf("first record = %+v", first)
+			}
+
+			second := records[1]
+			if second.Key != "logs/b c/d.json" || second.VersionID != "3HL4kqtJvjVBH40Nrjfkd" ||
+				second.Size != s3ops.UnknownSize || second.Current() {
+				t.Errorf("second record = %+v", second)
+			}
+		})
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "wrong column count", input: "source-bucket,a.json\n"},
+		{name: "invalid size", input: "source-bucket,a.json,big\n"},
+		{name: "invalid key", input: "source-bucket,a%zz.json,1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ReadCSV(strings.NewReader(tt.input), "Bucket, Key, Size", func(*Record) error { return nil })
+			if err == nil {
+				t.Error("ReadCSV() did not return an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// Format is the file format of an inventory report's data files
+type Format string
+
+const (
+	// FormatCSV data files are gzipped CSV without a header, the columns are listed in the manifest's fileSchema
+	FormatCSV Format = "CSV"
+	// FormatORC data files are Apache ORC
+	FormatORC Format = "ORC"
+	// FormatParquet data files are Apache Parquet
+	FormatParquet Format = "Parquet"
+)
+
+// File is a data file of an inventory report
+type File struct {
+	Key         string `json:"key"` // Key in the destination bucket
+	Size        int64  `json:"size"`
+	MD5Checksum string `json:"MD5checksum"`
+}
+
+// Manifest is the manifest.json written with every S3 Inventory report
+type Manifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	DestinationBucket string `json:"destinationBucket"` // ARN of the bucket holding the report
+	Version           string `json:"version"`
+	CreationTimestamp string `json:"creationTimestamp"` // Milliseconds since the epoch
+	FileFormat        Format `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []File `json:"files"`
+}
+
+// ParseManifest reads and validates a manifest.json
+func ParseManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decoding inventory manifest: %w", err)
+	}
+
+	switch m.FileFormat {
+	case FormatCSV:
+	case FormatORC, FormatParquet:
+		// The readers of this package are only tested with files they encode themselves, see testdata/README.md
+		return nil, fmt.Errorf("inventory reports in %s format are not supported yet, configure a report in %s format", m.FileFormat, FormatCSV)
+	default:
+		return nil, fmt.Errorf("unsupported inventory format %q, expected %s, %s or %s", m.FileFormat, FormatCSV, FormatORC, FormatParquet)
+	}
+	if m.SourceBucket == "" {
+		return nil, fmt.Errorf("inventory manifest has no sourceBucket")
+	}
+	return &m, nil
+}
+
+// Bucket returns the name of the bucket holding the report's data files
+func (m *Manifest) Bucket() string {
+	// The destination is an ARN like arn:aws:s3:::bucket
+	return m.DestinationBucket[strings.LastIndex(m.DestinationBucket, ":")+1:]
+}
+
+// Record is an object listed in an inventory report
+type Record struct {
+	s3ops.ObjectInfo
+	Bucket         string
+	VersionID      string
+	IsLatest       bool // Always true for reports of current versions only
+	IsDeleteMarker bool
+}
+
+// Current reports whether the record is the current version of an object that can be copied
+func (r *Record) Current() bool {
+	return r.IsLatest && !r.IsDeleteMarker
+}
+
+// field identifies the inventory columns the reader knows about
+type field int
+
+const (
+	fieldUnknown field = iota
+	fieldBucket
+	fieldKey
+	fieldVersionID
+	fieldIsLatest
+	fieldIsDeleteMarker
+	fieldSize
+	fieldLastModified
+	fieldETag
+	fieldStorageClass
+	fieldChecksumAlgorithm
+)
+
+// fields maps normalized column names to fields. CSV schemas name the columns like "LastModifiedDate",
+// ORC and Parquet schemas like "last_modified_date".
+var fields = map[string]field{
+	"bucket":            fieldBucket,
+	"key":               fieldKey,
+	"versionid":         fieldVersionID,
+	"islatest":          fieldIsLatest,
+	"isdeletemarker":    fieldIsDeleteMarker,
+	"size":              fieldSize,
+	"lastmodifieddate":  fieldLastModified,
+	"etag":              fieldETag,
+	"storageclass":      fieldStorageClass,
+	"checksumalgorithm": fieldChecksumAlgorithm,
+}
+
+// fieldOf returns the field of a column name, or fieldUnknown for columns that are not needed
+func fieldOf(name string) field {
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "_", ""))
+	return fields[name]
+}
+
+// newRecord returns a record with the defaults for columns missing from a report
+func newRecord() Record {
+	return Record{ObjectInfo: s3ops.ObjectInfo{Size: s3ops.UnknownSize}, IsLatest: true}
+}
+
+// setString sets a field from a string value, as found in CSV reports and string columns
+func (r *Record) setString(f field, value string) error {
+	switch f {
+	case fieldBucket:
+		r.Bucket = value
+	case fieldKey:
+		r.Key = value
+	case fieldVersionID:
+		r.VersionID = value
+	case fieldIsLatest, fieldIsDeleteMarker:
+		if value == "" {
+			return nil
+		}
+		b, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		r.setBool(f, b)
+	case fieldSize:
+		if value == "" {
+			return nil
+		}
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 {
+			return fmt.Errorf("invalid size %q", value)
+		}
+		r.Size = size
+	case fieldLastModified:
+		if value == "" {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return fmt.Errorf("invalid last modified date %q", value)
+		}
+		r.LastModified = t
+	case fieldETag:
+		r.ETag = strings.Trim(value, `"`)
+	case fieldStorageClass:
+		r.StorageClass = types.ObjectStorageClass(value)
+	case fieldChecksumAlgorithm:
+		if value != "" {
+			r.ChecksumAlgorithms = []types.ChecksumAlgorithm{types.ChecksumAlgorithm(value)}
+		}
+	}
+	return nil
+}
+
+// setValue sets a field from a decoded ORC or Parquet value: a string, int64, bool or time.Time.
+// Nil values are left at their default.
+func (r *Record) setValue(f field, value any) error {
+	switch v := value.(type) {
+	case nil:
+	case string:
+		return r.setString(f, v)
+	case int64:
+		switch f {
+		case fieldSize:
+			r.Size = v
+		case fieldLastModified:
+			// Timestamps without a unit are in milliseconds
+			r.LastModified = time.UnixMilli(v).UTC()
+		}
+	case bool:
+		r.setBool(f, v)
+	case time.Time:
+		if f == fieldLastModified {
+			r.LastModified = v
+		}
+	default:
+		return fmt.Errorf("unexpected %T value", value)
+	}
+	return nil
+}
+
+// setBool sets a field from a boolean column
+func (r *Record) setBool(f field, value bool) {
+	switch f {
+	case fieldIsLatest:
+		r.IsLatest = value
+	case fieldIsDeleteMarker:
+		r.IsDeleteMarker = value
+	}
+}
+
+// parseBool parses the true and false values of CSV reports
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q", value)
+	}
+}
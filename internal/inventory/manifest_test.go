@@ -0,0 +1,107 @@
+package inventory
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expectError bool
+	}{
+		{
+			name: "csv report",
+			input: `{
+				"sourceBucket": "source-bucket",
+				"destinationBucket": "arn:aws:s3:::inventory-bucket",
+				"version": "2016-11-30",
+				"creationTimestamp": "1514944800000",
+				"fileFormat": "CSV",
+				"fileSchema": "Bucket, Key, Size, LastModifiedDate, ETag, StorageClass",
+				"files": [{"key": "source-bucket/daily/data/a.csv.gz", "size": 2147, "MD5checksum": "f11166069f1990abeb9c97ace9cdfabc"}]
+			}`,
+		},
+		{
+			name:        "unsupported format",
+			input:       `{"sourceBucket": "source-bucket", "fileFormat": "JSON"}`,
+			expectError: true,
+		},
+		{
+			name:        "orc report",
+			input:       `{"sourceBucket": "source-bucket", "fileFormat": "ORC"}`,
+			expectError: true,
+		},
+		{
+			name:        "parquet report",
+			input:       `{"sourceBucket": "source-bucket", "fileFormat": "Parquet"}`,
+			expectError: true,
+		},
+		{
+			name:        "missing source bucket",
+			input:       `{"fileFormat": "CSV"}`,
+			expectError: true,
+		},
+		{
+			name:        "invalid json",
+			input:       `{"sourceBucket":`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := ParseManifest(strings.NewReader(tt.input))
+			if tt.expectError {
+				if err == nil {
+					t.Error("ParseManifest() did not return an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifest() returned unexpected error: %v", err)
+			}
+
+			if manifest.SourceBucket != "source-bucket" || manifest.FileFormat != FormatCSV {
+				t.Errorf("ParseManifest() = %+v", manifest)
+			}
+			if got := manifest.Bucket(); got != "inventory-bucket" {
+				t.Errorf("Bucket() = %q, want %q", got, "inventory-bucket")
+			}
+			if len(manifest.Files) != 1 || manifest.Files[0].Key != "source-bucket/daily/data/a.csv.gz" ||
+				manifest.Files[0].MD5Checksum != "f11166069f1990abeb9c97ace9cdfabc" {
+				t.Errorf("Files = %+v", manifest.Files)
+			}
+		})
+	}
+}
+
+func TestRecordCurrent(t *testing.T) {
+	record := newRecord()
+	if !record.Current() {
+		t.Error("Current() = false for a record without version columns")
+	}
+	record.IsDeleteMarker = true
+	if record.Current() {
+		t.Error("Current() = true for a delete marker")
+	}
+	record.IsDeleteMarker, record.IsLatest = false, false
+	if record.Current() {
+		t.Error("Current() = true for a noncurrent version")
+	}
+}
+
+func TestFieldOf(t *testing.T) {
+	for name, expected := range map[string]field{
+		"LastModifiedDate":    fieldLastModified,
+		" last_modified_date": fieldLastModified,
+		"IsDeleteMarker":      fieldIsDeleteMarker,
+		"e_tag":               fieldETag,
+		"ObjectLockMode":      fieldUnknown,
+	} {
+		if got := fieldOf(name); got != expected {
+			t.Errorf("fieldOf(%q) = %v, want %v", name, got, expected)
+		}
+	}
+}
@@ -0,0 +1,590 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// orcMagic ends the postscript of every ORC file
+const orcMagic = "ORC"
+
+// ORC type kinds
+const (
+	orcBoolean          = 0
+	orcShort            = 2
+	orcInt              = 3
+	orcLong             = 4
+	orcString           = 7
+	orcBinary           = 8
+	orcTimestamp        = 9
+	orcStruct           = 12
+	orcVarchar          = 16
+	orcChar             = 17
+	orcTimestampInstant = 18
+)
+
+// ORC stream kinds
+const (
+	streamPresent        = 0
+	streamData           = 1
+	streamLength         = 2
+	streamDictionaryData = 3
+	streamSecondary      = 5
+)
+
+// ORC column encodings
+const (
+	encodingDirect       = 0
+	encodingDictionary   = 1
+	encodingDirectV2     = 2
+	encodingDictionaryV2 = 3
+)
+
+// orcCodecs maps ORC compression kinds to codecs, LZO and LZ4 are not supported
+var orcCodecs = map[uint64]codec{
+	0: codecNone,
+	1: codecZlib,
+	2: codecSnappy,
+	5: codecZstd,
+}
+
+// orcFile holds the metadata of an ORC file the reader needs
+type orcFile struct {
+	r       io.ReaderAt
+	codec   codec
+	types   []orcType
+	stripes []orcStripe
+}
+
+// orcType is a node of the ORC type tree, numbered by column id
+type orcType struct {
+	kind       uint64
+	subtypes   []uint64
+	fieldNames []string
+}
+
+// orcStripe locates a stripe, its streams are followed by the stripe footer
+type orcStripe struct {
+	offset       uint64
+	indexLength  uint64
+	dataLength   uint64
+	footerLength uint64
+	rows         uint64
+}
+
+// orcStream locates a stream within the file
+type orcStream struct {
+	kind   uint64
+	offset uint64
+	length uint64
+}
+
+// orcStripeFooter lists the streams and column encodings of a stripe
+type orcStripeFooter struct {
+	streams   map[[2]uint64]orcStream // By column id and stream kind
+	encodings []orcEncoding
+	location  *time.Location
+}
+
+// orcEncoding is the encoding of a column within a stripe
+type orcEncoding struct {
+	kind           uint64
+	dictionarySize uint64
+}
+
+// ReadORC reads an ORC data file, calling fn for every record.
+// Inventory reports have a flat struct of columns, nested columns are ignored.
+func ReadORC(r io.ReaderAt, size int64, fn func(*Record) error) error {
+	file, err := readORCTail(r, size)
+	if err != nil {
+		return err
+	}
+	if len(file.types) == 0 || file.types[0].kind != orcStruct {
+		return fmt.Errorf("ORC file has no struct of columns")
+	}
+
+	// The top-level struct's fields are the columns of the report
+	root := file.types[0]
+	var (
+		names        []string
+		columns      []uint64
+		columnFields []field
+	)
+	for i, id := range root.subtypes {
+		if i >= len(root.fieldNames) || id >= uint64(len(file.types)) {
+			return fmt.Errorf("ORC file has an invalid type tree")
+		}
+		if f := fieldOf(root.fieldNames[i]); f != fieldUnknown {
+			names = append(names, root.fieldNames[i])
+			columns = append(columns, id)
+			columnFields = append(columnFields, f)
+		}
+	}
+
+	for _, stripe := range file.stripes {
+		footer, err := file.readStripeFooter(stripe)
+		if err != nil {
+			return err
+		}
+
+		values := make([][]any, len(columns))
+		for i, id := range columns {
+			if values[i], err = file.readColumn(footer, id, int(stripe.rows)); err != nil {
+				return fmt.Errorf("column %s: %w", names[i], err)
+			}
+		}
+
+		for row := 0; row < int(stripe.rows); row++ {
+			record := newRecord()
+			for i, f := range columnFields {
+				if err := record.setValue(f, values[i][row]); err != nil {
+					return fmt.Errorf("column %s: %w", names[i], err)
+				}
+			}
+			if err := fn(&record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readORCTail reads the postscript and footer at the end of the file
+func readORCTail(r io.ReaderAt, size int64) (*orcFile, error) {
+	if size < 4 {
+		return nil, fmt.Errorf("not an ORC file: too short")
+	}
+
+	// The last byte holds the length of the uncompressed postscript before it
+	last := make([]byte, 1)
+	if _, err := r.ReadAt(last, size-1); err != nil {
+		return nil, err
+	}
+	psLength := int64(last[0])
+	if psLength+1 > size {
+		return nil, fmt.Errorf("not an ORC file: invalid postscript length")
+	}
+	ps := make([]byte, psLength)
+	if _, err := r.ReadAt(ps, size-1-psLength); err != nil {
+		return nil, err
+	}
+
+	var (
+		footerLength uint64
+		compression  uint64
+		magic        []byte
+	)
+	p := &protoReader{buf: ps}
+	err := p.readMessage(func(num, wire int) (err error) {
+		switch num {
+		case 1:
+			footerLength, err = p.uvarint()
+		case 2:
+			compression, err = p.uvarint()
+		case 8000:
+			magic, err = p.bytes()
+		default:
+			err = p.skip(wire)
+		}
+		return err
+	})
+	if err != nil || string(magic) != orcMagic {
+		return nil, fmt.Errorf("not an ORC file: invalid postscript")
+	}
+
+	c, ok := orcCodecs[compression]
+	if !ok {
+		return nil, fmt.Errorf("unsupported ORC compression kind %d", compression)
+	}
+	file := &orcFile{r: r, codec: c}
+
+	if footerLength > uint64(size-1-psLength) {
+		return nil, fmt.Errorf("invalid ORC footer length %d", footerLength)
+	}
+	footer, err := file.readStream(uint64(size-1-psLength)-footerLength, footerLength)
+	if err != nil {
+		return nil, fmt.Errorf("reading ORC footer: %w", err)
+	}
+
+	p = &protoReader{buf: footer}
+	err = p.readMessage(func(num, wire int) error {
+		switch num {
+		case 3:
+			stripe, err := readORCStripeInformation(p)
+			file.stripes = append(file.stripes, stripe)
+			return err
+		case 4:
+			t, err := readORCType(p)
+			file.types = append(file.types, t)
+			return err
+		default:
+			return p.skip(wire)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading ORC footer: %w", err)
+	}
+	return file, nil
+}
+
+func readORCStripeInformation(p *protoReader) (orcStripe, error) {
+	var s orcStripe
+	m, err := p.message()
+	if err != nil {
+		return s, err
+	}
+	err = m.readMessage(func(num, wire int) (err error) {
+		switch num {
+		case 1:
+			s.offset, err = m.uvarint()
+		case 2:
+			s.indexLength, err = m.uvarint()
+		case 3:
+			s.dataLength, err = m.uvarint()
+		case 4:
+			s.footerLength, err = m.uvarint()
+		case 5:
+			s.rows, err = m.uvarint()
+		default:
+			err = m.skip(wire)
+		}
+		return err
+	})
+	return s, err
+}
+
+func readORCType(p *protoReader) (orcType, error) {
+	var t orcType
+	m, err := p.message()
+	if err != nil {
+		return t, err
+	}
+	err = m.readMessage(func(num, wire int) (err error) {
+		switch num {
+		case 1:
+			t.kind, err = m.uvarint()
+		case 2:
+			t.subtypes, err = m.uvarints(wire, t.subtypes)
+		case 3:
+			var name []byte
+			name, err = m.bytes()
+			t.fieldNames = append(t.fieldNames, string(name))
+		default:
+			err = m.skip(wire)
+		}
+		return err
+	})
+	return t, err
+}
+
+// readStripeFooter reads the footer following a stripe's streams and locates the streams
+func (f *orcFile) readStripeFooter(stripe orcStripe) (*orcStripeFooter, error) {
+	data, err := f.readStream(stripe.offset+stripe.indexLength+stripe.dataLength, stripe.footerLength)
+	if err != nil {
+		return nil, fmt.Errorf("reading ORC stripe footer: %w", err)
+	}
+
+	footer := &orcStripeFooter{streams: make(map[[2]uint64]orcStream), location: time.UTC}
+	offset := stripe.offset
+	p := &protoReader{buf: data}
+	err = p.readMessage(func(num, wire int) error {
+		switch num {
+		case 1:
+			// Streams are stored one after the other in the order they are listed
+			m, err := p.message()
+			if err != nil {
+				return err
+			}
+			var column uint64
+			stream := orcStream{offset: offset}
+			err = m.readMessage(func(num, wire int) (err error) {
+				switch num {
+				case 1:
+					stream.kind, err = m.uvarint()
+				case 2:
+					column, err = m.uvarint()
+				case 3:
+					stream.length, err = m.uvarint()
+				default:
+					err = m.skip(wire)
+				}
+				return err
+			})
+			offset += stream.length
+			footer.streams[[2]uint64{column, stream.kind}] = stream
+			return err
+		case 2:
+			m, err := p.message()
+			if err != nil {
+				return err
+			}
+			var encoding orcEncoding
+			err = m.readMessage(func(num, wire int) (err error) {
+				switch num {
+				case 1:
+					encoding.kind, err = m.uvarint()
+				case 2:
+					encoding.dictionarySize, err = m.uvarint()
+				default:
+					err = m.skip(wire)
+				}
+				return err
+			})
+			footer.encodings = append(footer.encodings, encoding)
+			return err
+		case 3:
+			name, err := p.bytes()
+			if err != nil {
+				return err
+			}
+			// Without time zone data, timestamps are read as UTC like S3 writes them
+			if location, err := time.LoadLocation(string(name)); err == nil {
+				footer.location = location
+			}
+			return nil
+		default:
+			return p.skip(wire)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading ORC stripe footer: %w", err)
+	}
+	return footer, nil
+}
+
+// readColumn decodes the values of a column in a stripe, with nil for null values
+func (f *orcFile) readColumn(footer *orcStripeFooter, id uint64, rows int) ([]any, error) {
+	if id >= uint64(len(footer.encodings)) {
+		return nil, fmt.Errorf("no encoding in stripe")
+	}
+	encoding := footer.encodings[id]
+	v2 := encoding.kind == encodingDirectV2 || encoding.kind == encodingDictionaryV2
+
+	stream := func(kind uint64) ([]byte, error) {
+		s, ok := footer.streams[[2]uint64{id, kind}]
+		if !ok {
+			return nil, fmt.Errorf("missing stream of kind %d", kind)
+		}
+		return f.readStream(s.offset, s.length)
+	}
+
+	// Only the rows marked as present have values in the other streams
+	var present []bool
+	count := rows
+	if _, ok := footer.streams[[2]uint64{id, streamPresent}]; ok {
+		data, err := stream(streamPresent)
+		if err != nil {
+			return nil, err
+		}
+		if present, err = decodeBooleanRLE(data, rows); err != nil {
+			return nil, err
+		}
+		count = 0
+		for _, p := range present {
+			if p {
+				count++
+			}
+		}
+	}
+
+	var decoded []any
+	switch kind := f.types[id].kind; kind {
+	case orcBoolean:
+		data, err := stream(streamData)
+		if err != nil {
+			return nil, err
+		}
+		values, err := decodeBooleanRLE(data, count)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			decoded = append(decoded, v)
+		}
+	case orcShort, orcInt, orcLong:
+		data, err := stream(streamData)
+		if err != nil {
+			return nil, err
+		}
+		values, err := decodeIntRLE(data, v2, true, count)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			decoded = append(decoded, v)
+		}
+	case orcString, orcBinary, orcVarchar, orcChar:
+		strings, err := f.readStrings(stream, encoding, v2, count)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range strings {
+			decoded = append(decoded, s)
+		}
+	case orcTimestamp, orcTimestampInstant:
+		location := footer.location
+		if kind == orcTimestampInstant {
+			location = time.UTC
+		}
+		times, err := f.readTimestamps(stream, v2, count, location)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range times {
+			decoded = append(decoded, t)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ORC type %d", kind)
+	}
+
+	if present == nil {
+		return decoded, nil
+	}
+	values := make([]any, rows)
+	for i, next := 0, 0; i < rows; i++ {
+		if present[i] {
+			values[i] = decoded[next]
+			next++
+		}
+	}
+	return values, nil
+}
+
+// readStrings decodes a string column, stored directly or as indexes into a dictionary
+func (f *orcFile) readStrings(stream func(uint64) ([]byte, error), encoding orcEncoding, v2 bool, count int) ([]string, error) {
+	data, err := stream(streamData)
+	if err != nil {
+		return nil, err
+	}
+	lengthData, err := stream(streamLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if encoding.kind == encodingDirect || encoding.kind == encodingDirectV2 {
+		lengths, err := decodeIntRLE(lengthData, v2, false, count)
+		if err != nil {
+			return nil, err
+		}
+		return splitStrings(data, lengths)
+	}
+
+	// The data stream holds indexes into the dictionary
+	dictionaryData, err := stream(streamDictionaryData)
+	if err != nil {
+		return nil, err
+	}
+	lengths, err := decodeIntRLE(lengthData, v2, false, int(encoding.dictionarySize))
+	if err != nil {
+		return nil, err
+	}
+	dictionary, err := splitStrings(dictionaryData, lengths)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := decodeIntRLE(data, v2, false, count)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, count)
+	for i, index := range indexes {
+		if index < 0 || index >= int64(len(dictionary)) {
+			return nil, fmt.Errorf("dictionary index %d out of range", index)
+		}
+		values[i] = dictionary[index]
+	}
+	return values, nil
+}
+
+// readTimestamps decodes a timestamp column: signed seconds since 2015-01-01 in the data stream,
+// and nanoseconds in the secondary stream. Nanoseconds with trailing zeros have them removed,
+// with the number of zeros minus one in the lowest three bits.
+func (f *orcFile) readTimestamps(stream func(uint64) ([]byte, error), v2 bool, count int, location *time.Location) ([]time.Time, error) {
+	data, err := stream(streamData)
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := stream(streamSecondary)
+	if err != nil {
+		return nil, err
+	}
+	seconds, err := decodeIntRLE(data, v2, true, count)
+	if err != nil {
+		return nil, err
+	}
+	nanos, err := decodeIntRLE(secondary, v2, false, count)
+	if err != nil {
+		return nil, err
+	}
+
+	epoch := time.Date(2015, time.January, 1, 0, 0, 0, 0, location)
+	times := make([]time.Time, count)
+	for i := range times {
+		n := nanos[i] >> 3
+		if zeros := nanos[i] & 7; zeros != 0 {
+			for z := int64(0); z <= zeros; z++ {
+				n *= 10
+			}
+		}
+		times[i] = epoch.Add(time.Duration(seconds[i])*time.Second + time.Duration(n)).UTC()
+	}
+	return times, nil
+}
+
+// splitStrings splits concatenated strings by their lengths
+func splitStrings(data []byte, lengths []int64) ([]string, error) {
+	values := make([]string, len(lengths))
+	pos := int64(0)
+	for i, length := range lengths {
+		if length < 0 || length > int64(len(data))-pos {
+			return nil, errTruncated
+		}
+		values[i] = string(data[pos : pos+length])
+		pos += length
+	}
+	return values, nil
+}
+
+// readStream reads and decompresses a stream. Compressed streams are a sequence of chunks,
+// each with a 3-byte little-endian header holding the chunk length shifted left by one,
+// and the lowest bit set for chunks stored uncompressed.
+func (f *orcFile) readStream(offset, length uint64) ([]byte, error) {
+	if length > 1<<31 {
+		return nil, fmt.Errorf("stream of %d bytes is too large", length)
+	}
+	data := make([]byte, length)
+	if _, err := f.r.ReadAt(data, int64(offset)); err != nil {
+		return nil, err
+	}
+	if f.codec == codecNone {
+		return data, nil
+	}
+
+	var out []byte
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 3 {
+			return nil, errTruncated
+		}
+		header := int(data[pos]) | int(data[pos+1])<<8 | int(data[pos+2])<<16
+		pos += 3
+		chunkLength := header >> 1
+		if chunkLength > len(data)-pos {
+			return nil, errTruncated
+		}
+		chunk := data[pos : pos+chunkLength]
+		pos += chunkLength
+
+		if header&1 == 1 {
+			out = append(out, chunk...)
+			continue
+		}
+		decompressed, err := decompress(f.codec, chunk, 0)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, decompressed...)
+	}
+	return out, nil
+}
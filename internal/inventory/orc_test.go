@@ -0,0 +1,452 @@
+package inventory
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"math/bits"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// protoWriter writes protocol buffer messages, to build ORC files for tests
+type protoWriter struct {
+	bytes.Buffer
+}
+
+func (w *protoWriter) tag(num, wire int) {
+	w.Write(binary.AppendUvarint(nil, uint64(num<<3|wire)))
+}
+
+func (w *protoWriter) uvarint(num int, v uint64) {
+	w.tag(num, protoVarint)
+	w.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *protoWriter) field(num int, b []byte) {
+	w.tag(num, protoBytes)
+	w.Write(binary.AppendUvarint(nil, uint64(len(b))))
+	w.Write(b)
+}
+
+func (w *protoWriter) packed(num int, values ...uint64) {
+	var packed []byte
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, v)
+	}
+	w.field(num, packed)
+}
+
+// encodeByteRLE encodes bytes as literals of ORC's byte run-length encoding
+func encodeByteRLE(values []byte) []byte {
+	var data []byte
+	for len(values) > 0 {
+		n := min(len(values), 128)
+		data = append(data, byte(0x100-n))
+		data = append(data, values[:n]...)
+		values = values[n:]
+	}
+	return data
+}
+
+func encodeBooleanRLE(values []bool) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			packed[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return encodeByteRLE(packed)
+}
+
+// encodeIntRLEv1 encodes integers as literals of integer run-length encoding version 1
+func encodeIntRLEv1(values []int64, signed bool) []byte {
+	var data []byte
+	for len(values) > 0 {
+		n := min(len(values), 128)
+		data = append(data, byte(0x100-n))
+		for _, v := range values[:n] {
+			data = binary.AppendUvarint(data, encodeORCInt(v, signed))
+		}
+		values = values[n:]
+	}
+	return data
+}
+
+// encodeIntRLEv2 encodes integers as direct runs of integer run-length encoding version 2
+func encodeIntRLEv2(values []int64, signed bool) []byte {
+	var data []byte
+	for len(values) > 0 {
+		n := min(len(values), 512)
+		var largest uint64
+		for _, v := range values[:n] {
+			largest = max(largest, encodeORCInt(v, signed))
+		}
+		width := closestFixedBits(bits.Len64(largest))
+		code := width - 1
+		if width > 24 {
+			code = 24 + slices.Index([]int{26, 28, 30, 32, 40, 48, 56, 64}, width)
+		}
+		data = append(data, byte(rleDirect<<6|code<<1|(n-1)>>8), byte(n-1))
+
+		var acc uint64
+		used := 0
+		for _, v := range values[:n] {
+			u := encodeORCInt(v, signed)
+			for i := width - 1; i >= 0; i-- {
+				acc = acc<<1 | u>>i&1
+				if used++; used == 8 {
+					data = append(data, byte(acc))
+					acc, used = 0, 0
+				}
+			}
+		}
+		if used > 0 {
+			data = append(data, byte(acc<<(8-used)))
+		}
+		values = values[n:]
+	}
+	return data
+}
+
+func encodeORCInt(v int64, signed bool) uint64 {
+	if signed {
+		return uint64(v<<1 ^ v>>63)
+	}
+	return uint64(v)
+}
+
+// compressORC splits a stream into compressed chunks, keeping chunks that do not shrink uncompressed
+func compressORC(t *testing.T, compression uint64, data []byte) []byte {
+	t.Helper()
+	if compression == 0 {
+		return data
+	}
+
+	var out []byte
+	for len(data) > 0 {
+		chunk := data[:min(len(data), 32)]
+		data = data[len(chunk):]
+
+		var compressed []byte
+		switch compression {
+		case 1:
+			var buf bytes.Buffer
+			w, _ := flate.NewWriter(&buf, flate.BestCompression)
+			w.Write(chunk)
+			w.Close()
+			compressed = buf.Bytes()
+		case 2:
+			compressed = snappy.Encode(nil, chunk)
+		case 5:
+			encoder, err := zstd.NewWriter(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compressed = encoder.EncodeAll(chunk, nil)
+			encoder.Close()
+		default:
+			compressed = chunk
+		}
+
+		header := len(compressed) << 1
+		if len(compressed) >= len(chunk) {
+			compressed, header = chunk, len(chunk)<<1|1
+		}
+		out = append(out, byte(header), byte(header>>8), byte(header>>16))
+		out = append(out, compressed...)
+	}
+	return out
+}
+
+// orcTestColumn is a column of an ORC file built for tests
+type orcTestColumn struct {
+	name     string
+	kind     uint64
+	encoding uint64
+	values   []any // nil for null values, timestamps as milliseconds
+}
+
+// buildORC builds an ORC file with a single stripe and a nested column the reader ignores
+func buildORC(t *testing.T, compression uint64, columns []orcTestColumn) []byte {
+	t.Helper()
+
+	var (
+		file         bytes.Buffer
+		stripeFooter protoWriter
+		rows         = len(columns[0].values)
+	)
+	file.WriteString(orcMagic)
+
+	addStream := func(id int, kind uint64, data []byte) {
+		data = compressORC(t, compression, data)
+		file.Write(data)
+		var stream protoWriter
+		stream.uvarint(1, kind)
+		stream.uvarint(2, uint64(id))
+		stream.uvarint(3, uint64(len(data)))
+		stripeFooter.field(1, stream.Bytes())
+	}
+	encodings := []protoWriter{{}}
+	encodings[0].uvarint(1, encodingDirect)
+
+	for i, column := range columns {
+		id := i + 1
+		v2 := column.encoding == encodingDirectV2 || column.encoding == encodingDictionaryV2
+		intRLE := func(values []int64, signed bool) []byte {
+			if v2 {
+				return encodeIntRLEv2(values, signed)
+			}
+			return encodeIntRLEv1(values, signed)
+		}
+
+		var present []any
+		flags := make([]bool, rows)
+		for row, v := range column.values {
+			if flags[row] = v != nil; flags[row] {
+				present = append(present, v)
+			}
+		}
+		if len(present) < rows {
+			addStream(id, streamPresent, encodeBooleanRLE(flags))
+		}
+
+		var encoding protoWriter
+		encoding.uvarint(1, column.encoding)
+		switch column.kind {
+		case orcBoolean:
+			var values []bool
+			for _, v := range present {
+				values = append(values, v.(bool))
+			}
+			addStream(id, streamData, encodeBooleanRLE(values))
+		case orcLong:
+			var values []int64
+			for _, v := range present {
+				values = append(values, v.(int64))
+			}
+			addStream(id, streamData, intRLE(values, true))
+		case orcString:
+			var strings []string
+			for _, v := range present {
+				strings = append(strings, v.(string))
+			}
+			if column.encoding == encodingDictionaryV2 {
+				// Dictionaries are sorted, so indexes differ from the order of first appearance
+				dictionary := slices.Clone(strings)
+				slices.Sort(dictionary)
+				dictionary = slices.Compact(dictionary)
+				var indexes, lengths []int64
+				for _, s := range strings {
+					indexes = append(indexes, int64(slices.Index(dictionary, s)))
+				}
+				for _, s := range dictionary {
+					lengths = append(lengths, int64(len(s)))
+				}
+				addStream(id, streamData, intRLE(indexes, false))
+				addStream(id, streamDictionaryData, []byte(joinStrings(dictionary)))
+				addStream(id, streamLength, intRLE(lengths, false))
+				encoding.uvarint(2, uint64(len(dictionary)))
+			} else {
+				var lengths []int64
+				for _, s := range strings {
+					lengths = append(lengths, int64(len(s)))
+				}
+				addStream(id, streamData, []byte(joinStrings(strings)))
+				addStream(id, streamLength, intRLE(lengths, false))
+			}
+		case orcTimestamp:
+			epoch := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+			var seconds, nanos []int64
+			for _, v := range present {
+				ts := time.UnixMilli(v.(int64))
+				seconds = append(seconds, ts.Unix()-epoch)
+				nanos = append(nanos, encodeORCNanos(int64(ts.Nanosecond())))
+			}
+			addStream(id, streamData, intRLE(seconds, true))
+			addStream(id, streamSecondary, intRLE(nanos, false))
+		}
+		encodings = append(encodings, encoding)
+	}
+
+	// The nested column and its child have no streams
+	for range 2 {
+		var encoding protoWriter
+		encoding.uvarint(1, encodingDirect)
+		encodings = append(encodings, encoding)
+	}
+
+	dataLength := file.Len() - len(orcMagic)
+	for _, encoding := range encodings {
+		stripeFooter.field(2, encoding.Bytes())
+	}
+	stripeFooter.field(3, []byte("UTC"))
+	stripeFooterData := compressORC(t, compression, stripeFooter.Bytes())
+	file.Write(stripeFooterData)
+
+	var footer protoWriter
+	footer.uvarint(1, uint64(len(orcMagic)))
+	footer.uvarint(2, uint64(file.Len()-len(orcMagic)))
+	var stripe protoWriter
+	stripe.uvarint(1, uint64(len(orcMagic)))
+	stripe.uvarint(2, 0)
+	stripe.uvarint(3, uint64(dataLength))
+	stripe.uvarint(4, uint64(len(stripeFooterData)))
+	stripe.uvarint(5, uint64(rows))
+	footer.field(3, stripe.Bytes())
+
+	var root protoWriter
+	root.uvarint(1, orcStruct)
+	var subtypes []uint64
+	for i := range len(columns) + 1 {
+		subtypes = append(subtypes, uint64(i+1))
+	}
+	root.packed(2, subtypes...)
+	for _, column := range columns {
+		root.field(3, []byte(column.name))
+	}
+	root.field(3, []byte("tags"))
+	footer.field(4, root.Bytes())
+	for _, column := range columns {
+		var typ protoWriter
+		typ.uvarint(1, column.kind)
+		footer.field(4, typ.Bytes())
+	}
+	var tags, tag protoWriter
+	tags.uvarint(1, orcStruct)
+	tags.uvarint(2, uint64(len(columns)+2))
+	tags.field(3, []byte("key"))
+	footer.field(4, tags.Bytes())
+	tag.uvarint(1, orcString)
+	footer.field(4, tag.Bytes())
+	footer.uvarint(6, uint64(rows))
+	footerData := compressORC(t, compression, footer.Bytes())
+	file.Write(footerData)
+
+	var postscript protoWriter
+	postscript.uvarint(1, uint64(len(footerData)))
+	postscript.uvarint(2, compression)
+	postscript.uvarint(3, 32)
+	postscript.packed(4, 0, 12)
+	postscript.field(8000, []byte(orcMagic))
+	file.Write(postscript.Bytes())
+	file.WriteByte(byte(postscript.Len()))
+	return file.Bytes()
+}
+
+// encodeORCNanos removes trailing zeros from nanoseconds, keeping their number minus one in the lowest bits
+func encodeORCNanos(nanos int64) int64 {
+	zeros := int64(0)
+	for nanos != 0 && nanos%10 == 0 && zeros < 8 {
+		nanos /= 10
+		zeros++
+	}
+	if zeros < 2 {
+		for ; zeros > 0; zeros-- {
+			nanos *= 10
+		}
+		return nanos << 3
+	}
+	return nanos<<3 | (zeros - 1)
+}
+
+func joinStrings(values []string) string {
+	var b bytes.Buffer
+	for _, s := range values {
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// orcTestColumns are the columns of parquetTestColumns, with a mix of ORC encodings
+func orcTestColumns() []orcTestColumn {
+	var columns []orcTestColumn
+	for _, c := range parquetTestColumns() {
+		column := orcTestColumn{name: c.name, encoding: encodingDirectV2, values: c.values}
+		switch c.typ {
+		case parquetBoolean:
+			column.kind = orcBoolean
+		case parquetInt64:
+			column.kind = orcLong
+			if c.converted == convertedTimestampMillis {
+				column.kind, column.encoding = orcTimestamp, encodingDirect
+			}
+		default:
+			column.kind = orcString
+			if c.dictionary {
+				column.encoding = encodingDictionaryV2
+			}
+			if c.name == "e_tag" {
+				column.encoding = encodingDirect
+			}
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+func TestReadORC(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression uint64
+	}{
+		{name: "uncompressed", compression: 0},
+		{name: "zlib", compression: 1},
+		{name: "snappy", compression: 2},
+		{name: "zstd", compression: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildORC(t, tt.compression, orcTestColumns())
+
+			var records []Record
+			err := ReadORC(bytes.NewReader(data), int64(len(data)), func(record *Record) error {
+				records = append(records, *record)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ReadORC() returned unexpected error: %v", err)
+			}
+			checkTestRecords(t, records)
+		})
+	}
+}
+
+func TestReadORCErrors(t *testing.T) {
+	valid := buildORC(t, 1, orcTestColumns())
+
+	tests := map[string][]byte{
+		"not orc":           []byte("Bucket,Key\nsource-bucket,a.json\n"),
+		"truncated":         valid[:len(valid)/2],
+		"unsupported codec": buildORC(t, 3, orcTestColumns()),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ReadORC(bytes.NewReader(data), int64(len(data)), func(*Record) error { return nil })
+			if err == nil {
+				t.Error("ReadORC() did not return an error")
+			}
+		})
+	}
+}
+
+func TestDecodeORCNanos(t *testing.T) {
+	for _, nanos := range []int64{0, 1, 10, 100, 123000000, 999999999, 120000} {
+		data := encodeIntRLEv2([]int64{encodeORCNanos(nanos)}, false)
+		seconds := encodeIntRLEv2([]int64{0}, true)
+		streams := map[uint64][]byte{streamData: seconds, streamSecondary: data}
+		f := &orcFile{}
+		times, err := f.readTimestamps(func(kind uint64) ([]byte, error) { return streams[kind], nil }, true, 1, time.UTC)
+		if err != nil {
+			t.Fatalf("readTimestamps() returned unexpected error: %v", err)
+		}
+		if got := times[0].Nanosecond(); int64(got) != nanos {
+			t.Errorf("nanoseconds %d decoded as %d", nanos, got)
+		}
+	}
+}
@@ -0,0 +1,694 @@
+package inventory
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// parquetMagic starts and ends every Parquet file
+const parquetMagic = "PAR1"
+
+// Parquet physical types
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetInt96     = 3
+	parquetByteArray = 6
+)
+
+// Parquet value encodings
+const (
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingRLEDictionary   = 8
+)
+
+// Parquet page types
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// Parquet converted types of timestamps
+const (
+	convertedTimestampMillis = 9
+	convertedTimestampMicros = 10
+)
+
+// julianUnixEpoch is the Julian day of 1970-01-01, INT96 timestamps count days from the Julian epoch
+const julianUnixEpoch = 2440588
+
+// parquetCodecs maps Parquet compression codecs to codecs, LZO, Brotli and LZ4 are not supported
+var parquetCodecs = map[int32]codec{
+	0: codecNone,
+	1: codecSnappy,
+	2: codecGzip,
+	6: codecZstd,
+}
+
+// parquetColumn is a top-level primitive column of a Parquet schema
+type parquetColumn struct {
+	name     string
+	typ      int32
+	optional bool
+	unit     time.Duration // Unit of INT64 timestamps, zero for other columns
+}
+
+// parquetChunk is the part of a column stored in a row group
+type parquetChunk struct {
+	path                 []string
+	codec                int32
+	numValues            int64
+	dataPageOffset       int64
+	dictionaryPageOffset int64
+	compressedSize       int64
+}
+
+// parquetRowGroup is a horizontal slice of a Parquet file
+type parquetRowGroup struct {
+	numRows int64
+	chunks  []parquetChunk
+}
+
+// parquetSchemaElement is a node of the flattened Parquet schema tree
+type parquetSchemaElement struct {
+	parquetColumn
+	numChildren int32
+}
+
+// parquetPageHeader holds the fields of data, data v2 and dictionary page headers the reader needs
+type parquetPageHeader struct {
+	typ              int32
+	uncompressedSize int32
+	compressedSize   int32
+	numValues        int32
+	encoding         int32
+	defLevelEncoding int32
+	defLevelsLength  int32 // Data page v2 only
+	repLevelsLength  int32 // Data page v2 only
+	uncompressed     bool  // Data page v2 values that are stored uncompressed
+}
+
+// ReadParquet reads a Parquet data file, calling fn for every record.
+// Inventory reports have a flat schema, nested columns are ignored.
+func ReadParquet(r io.ReaderAt, size int64, fn func(*Record) error) error {
+	columns, rowGroups, err := readParquetFooter(r, size)
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]parquetColumn)
+	for _, c := range columns {
+		byName[c.name] = c
+	}
+
+	for _, rowGroup := range rowGroups {
+		// Decode the columns of the row group that make up a record
+		var (
+			names    []string
+			fieldsOf []field
+			values   [][]any
+		)
+		for _, chunk := range rowGroup.chunks {
+			if len(chunk.path) != 1 {
+				continue
+			}
+			column, ok := byName[chunk.path[0]]
+			f := fieldOf(chunk.path[0])
+			if !ok || f == fieldUnknown {
+				continue
+			}
+
+			v, err := readParquetChunk(r, chunk, column)
+			if err != nil {
+				return fmt.Errorf("column %s: %w", column.name, err)
+			}
+			if int64(len(v)) != rowGroup.numRows {
+				return fmt.Errorf("column %s: found %d values in a row group of %d rows", column.name, len(v), rowGroup.numRows)
+			}
+			names = append(names, column.name)
+			fieldsOf = append(fieldsOf, f)
+			values = append(values, v)
+		}
+
+		for row := int64(0); row < rowGroup.numRows; row++ {
+			record := newRecord()
+			for i, f := range fieldsOf {
+				if err := record.setValue(f, values[i][row]); err != nil {
+					return fmt.Errorf("column %s: %w", names[i], err)
+				}
+			}
+			if err := fn(&record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readParquetFooter reads the schema and row groups from the file metadata at the end of the file
+func readParquetFooter(r io.ReaderAt, size int64) ([]parquetColumn, []parquetRowGroup, error) {
+	if size < 12 {
+		return nil, nil, fmt.Errorf("not a Parquet file: too short")
+	}
+	tail := make([]byte, 8)
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return nil, nil, err
+	}
+	if string(tail[4:]) != parquetMagic {
+		return nil, nil, fmt.Errorf("not a Parquet file: missing magic")
+	}
+
+	length := int64(binary.LittleEndian.Uint32(tail))
+	if length > size-12 {
+		return nil, nil, fmt.Errorf("invalid Parquet footer length %d", length)
+	}
+	footer := make([]byte, length)
+	if _, err := r.ReadAt(footer, size-8-length); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		schema    []parquetSchemaElement
+		rowGroups []parquetRowGroup
+	)
+	t := &thriftReader{buf: footer}
+	err := t.readStruct(func(id int16, typ byte) error {
+		switch id {
+		case 2:
+			return t.readList(func(byte) error {
+				element, err := readParquetSchemaElement(t)
+				schema = append(schema, element)
+				return err
+			})
+		case 4:
+			return t.readList(func(byte) error {
+				rowGroup, err := readParquetRowGroup(t)
+				rowGroups = append(rowGroups, rowGroup)
+				return err
+			})
+		default:
+			return t.skip(typ)
+		}
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading Parquet metadata: %w", err)
+	}
+	if len(schema) == 0 {
+		return nil, nil, fmt.Errorf("reading Parquet metadata: no schema")
+	}
+
+	// The first element is the root, keep its primitive children and skip nested groups
+	var columns []parquetColumn
+	for i := 1; i < len(schema); {
+		if schema[i].numChildren == 0 {
+			columns = append(columns, schema[i].parquetColumn)
+		}
+		i = skipParquetSubtree(schema, i)
+	}
+	return columns, rowGroups, nil
+}
+
+// skipParquetSubtree returns the index of the element following the subtree starting at i
+func skipParquetSubtree(schema []parquetSchemaElement, i int) int {
+	children := schema[i].numChildren
+	i++
+	for ; children > 0 && i < len(schema); children-- {
+		i = skipParquetSubtree(schema, i)
+	}
+	return i
+}
+
+func readParquetSchemaElement(t *thriftReader) (parquetSchemaElement, error) {
+	var e parquetSchemaElement
+	err := t.readStruct(func(id int16, typ byte) (err error) {
+		switch id {
+		case 1:
+			e.typ, err = t.i32()
+		case 3:
+			var repetition int32
+			repetition, err = t.i32()
+			e.optional = repetition == 1
+		case 4:
+			var name []byte
+			name, err = t.binary()
+			e.name = string(name)
+		case 5:
+			e.numChildren, err = t.i32()
+		case 6:
+			var converted int32
+			if converted, err = t.i32(); converted == convertedTimestampMillis {
+				e.unit = time.Millisecond
+			} else if converted == convertedTimestampMicros {
+				e.unit = time.Microsecond
+			}
+		case 10:
+			err = readParquetLogicalType(t, &e.unit)
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+	return e, err
+}
+
+// readParquetLogicalType reads the unit of TIMESTAMP logical types and skips the others
+func readParquetLogicalType(t *thriftReader, unit *time.Duration) error {
+	return t.readStruct(func(id int16, typ byte) error {
+		if id != 8 {
+			return t.skip(typ)
+		}
+		return t.readStruct(func(id int16, typ byte) error {
+			if id != 2 {
+				return t.skip(typ)
+			}
+			return t.readStruct(func(id int16, typ byte) error {
+				switch id {
+				case 1:
+					*unit = time.Millisecond
+				case 2:
+					*unit = time.Microsecond
+				case 3:
+					*unit = time.Nanosecond
+				}
+				return t.skip(typ)
+			})
+		})
+	})
+}
+
+func readParquetRowGroup(t *thriftReader) (parquetRowGroup, error) {
+	var g parquetRowGroup
+	err := t.readStruct(func(id int16, typ byte) (err error) {
+		switch id {
+		case 1:
+			return t.readList(func(byte) error {
+				chunk, err := readParquetColumnChunk(t)
+				g.chunks = append(g.chunks, chunk)
+				return err
+			})
+		case 3:
+			g.numRows, err = t.i64()
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+	return g, err
+}
+
+func readParquetColumnChunk(t *thriftReader) (parquetChunk, error) {
+	var c parquetChunk
+	err := t.readStruct(func(id int16, typ byte) error {
+		if id == 1 {
+			return fmt.Errorf("columns in external files are not supported")
+		}
+		if id != 3 {
+			return t.skip(typ)
+		}
+
+		// ColumnMetaData
+		return t.readStruct(func(id int16, typ byte) (err error) {
+			switch id {
+			case 3:
+				err = t.readList(func(byte) error {
+					name, err := t.binary()
+					c.path = append(c.path, string(name))
+					return err
+				})
+			case 4:
+				c.codec, err = t.i32()
+			case 5:
+				c.numValues, err = t.i64()
+			case 7:
+				c.compressedSize, err = t.i64()
+			case 9:
+				c.dataPageOffset, err = t.i64()
+			case 11:
+				c.dictionaryPageOffset, err = t.i64()
+			default:
+				err = t.skip(typ)
+			}
+			return err
+		})
+	})
+	return c, err
+}
+
+func readParquetPageHeader(t *thriftReader) (parquetPageHeader, error) {
+	var h parquetPageHeader
+	err := t.readStruct(func(id int16, typ byte) (err error) {
+		switch id {
+		case 1:
+			h.typ, err = t.i32()
+		case 2:
+			h.uncompressedSize, err = t.i32()
+		case 3:
+			h.compressedSize, err = t.i32()
+		case 5, 7, 8:
+			// Data page, dictionary page and data page v2 headers, numbered alike where they overlap
+			page := id
+			err = t.readStruct(func(id int16, typ byte) (err error) {
+				switch {
+				case id == 1:
+					h.numValues, err = t.i32()
+				case id == 2 && page != 8:
+					h.encoding, err = t.i32()
+				case id == 3 && page == 5:
+					h.defLevelEncoding, err = t.i32()
+				case id == 4 && page == 8:
+					h.encoding, err = t.i32()
+				case id == 5 && page == 8:
+					h.defLevelsLength, err = t.i32()
+				case id == 6 && page == 8:
+					h.repLevelsLength, err = t.i32()
+				case id == 7 && page == 8:
+					h.uncompressed = !t.bool(typ)
+				default:
+					err = t.skip(typ)
+				}
+				return err
+			})
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+	return h, err
+}
+
+// readParquetChunk decodes the values of a column chunk, with nil for null values
+func readParquetChunk(r io.ReaderAt, chunk parquetChunk, column parquetColumn) ([]any, error) {
+	c, ok := parquetCodecs[chunk.codec]
+	if !ok {
+		return nil, fmt.Errorf("unsupported Parquet compression codec %d", chunk.codec)
+	}
+
+	// The dictionary page, if any, comes first
+	start := chunk.dataPageOffset
+	if chunk.dictionaryPageOffset > 0 && chunk.dictionaryPageOffset < start {
+		start = chunk.dictionaryPageOffset
+	}
+	if chunk.compressedSize < 0 || chunk.compressedSize > 1<<31 {
+		return nil, fmt.Errorf("invalid column chunk size %d", chunk.compressedSize)
+	}
+	buf := make([]byte, chunk.compressedSize)
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return nil, err
+	}
+
+	var (
+		values     = make([]any, 0, chunk.numValues)
+		dictionary []any
+	)
+	for pos := 0; int64(len(values)) < chunk.numValues; {
+		t := &thriftReader{buf: buf[pos:]}
+		header, err := readParquetPageHeader(t)
+		if err != nil {
+			return nil, fmt.Errorf("reading page header: %w", err)
+		}
+		pos += t.pos
+		if header.compressedSize < 0 || int(header.compressedSize) > len(buf)-pos {
+			return nil, fmt.Errorf("page of %d bytes exceeds the column chunk", header.compressedSize)
+		}
+		page := buf[pos : pos+int(header.compressedSize)]
+		pos += int(header.compressedSize)
+
+		switch header.typ {
+		case pageDictionary:
+			data, err := decompress(c, page, int(header.uncompressedSize))
+			if err != nil {
+				return nil, err
+			}
+			if dictionary, err = decodeParquetPlain(data, column, int(header.numValues)); err != nil {
+				return nil, fmt.Errorf("dictionary page: %w", err)
+			}
+		case pageData, pageDataV2:
+			pageValues, err := decodeParquetDataPage(page, header, c, column, dictionary)
+			if err != nil {
+				return nil, fmt.Errorf("data page: %w", err)
+			}
+			values = append(values, pageValues...)
+		default:
+			// Index pages carry nothing the reader needs
+		}
+	}
+	return values, nil
+}
+
+// decodeParquetDataPage decodes the values of a data page, with nil for null values
+func decodeParquetDataPage(page []byte, header parquetPageHeader, c codec, column parquetColumn, dictionary []any) ([]any, error) {
+	count := int(header.numValues)
+
+	// Flat columns have no repetition levels and a definition level of 1 for values that are present
+	var (
+		defLevels []int
+		data      []byte
+		err       error
+	)
+	if header.typ == pageDataV2 {
+		levelsLength := int(header.repLevelsLength) + int(header.defLevelsLength)
+		if header.repLevelsLength < 0 || header.defLevelsLength < 0 || levelsLength > len(page) {
+			return nil, errTruncated
+		}
+		if column.optional {
+			if defLevels, err = decodeHybrid(page[header.repLevelsLength:levelsLength], 1, count); err != nil {
+				return nil, err
+			}
+		}
+		data = page[levelsLength:]
+		if !header.uncompressed {
+			if data, err = decompress(c, data, int(header.uncompressedSize)-levelsLength); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if data, err = decompress(c, page, int(header.uncompressedSize)); err != nil {
+			return nil, err
+		}
+		if column.optional {
+			if header.defLevelEncoding != encodingRLE {
+				return nil, fmt.Errorf("unsupported definition level encoding %d", header.defLevelEncoding)
+			}
+			var levels []byte
+			if levels, data, err = lengthPrefixed(data); err != nil {
+				return nil, err
+			}
+			if defLevels, err = decodeHybrid(levels, 1, count); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	present := count
+	if defLevels != nil {
+		present = 0
+		for _, level := range defLevels {
+			present += level
+		}
+	}
+
+	var decoded []any
+	switch header.encoding {
+	case encodingPlain:
+		decoded, err = decodeParquetPlain(data, column, present)
+	case encodingPlainDictionary, encodingRLEDictionary:
+		decoded, err = decodeParquetDictionary(data, dictionary, present)
+	case encodingRLE:
+		if column.typ != parquetBoolean {
+			return nil, fmt.Errorf("unsupported RLE encoding of type %d", column.typ)
+		}
+		decoded, err = decodeParquetRLEBooleans(data, present)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %d", header.encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if defLevels == nil {
+		return decoded, nil
+	}
+
+	// Spread the present values over the rows
+	values := make([]any, count)
+	for i, next := 0, 0; i < count; i++ {
+		if defLevels[i] == 1 {
+			values[i] = decoded[next]
+			next++
+		}
+	}
+	return values, nil
+}
+
+// decodeParquetPlain decodes count plainly encoded values
+func decodeParquetPlain(data []byte, column parquetColumn, count int) ([]any, error) {
+	values := make([]any, count)
+	pos := 0
+	for i := range values {
+		switch column.typ {
+		case parquetBoolean:
+			if i/8 >= len(data) {
+				return nil, errTruncated
+			}
+			values[i] = data[i/8]>>(i%8)&1 == 1
+		case parquetInt32:
+			if len(data)-pos < 4 {
+				return nil, errTruncated
+			}
+			values[i] = int64(int32(binary.LittleEndian.Uint32(data[pos:])))
+			pos += 4
+		case parquetInt64:
+			if len(data)-pos < 8 {
+				return nil, errTruncated
+			}
+			v := int64(binary.LittleEndian.Uint64(data[pos:]))
+			pos += 8
+			switch column.unit {
+			case time.Millisecond:
+				values[i] = time.UnixMilli(v).UTC()
+			case time.Microsecond:
+				values[i] = time.UnixMicro(v).UTC()
+			case time.Nanosecond:
+				values[i] = time.Unix(0, v).UTC()
+			default:
+				values[i] = v
+			}
+		case parquetInt96:
+			// Nanoseconds of the day followed by the Julian day
+			if len(data)-pos < 12 {
+				return nil, errTruncated
+			}
+			nanos := int64(binary.LittleEndian.Uint64(data[pos:]))
+			day := int64(binary.LittleEndian.Uint32(data[pos+8:]))
+			values[i] = time.Unix((day-julianUnixEpoch)*86400, nanos).UTC()
+			pos += 12
+		case parquetByteArray:
+			value, rest, err := lengthPrefixed(data[pos:])
+			if err != nil {
+				return nil, err
+			}
+			values[i] = string(value)
+			pos = len(data) - len(rest)
+		default:
+			return nil, fmt.Errorf("unsupported Parquet type %d", column.typ)
+		}
+	}
+	return values, nil
+}
+
+// decodeParquetDictionary decodes count dictionary indexes, prefixed by their bit width
+func decodeParquetDictionary(data []byte, dictionary []any, count int) ([]any, error) {
+	if count == 0 {
+		return nil, nil
+	}
+	if len(data) == 0 {
+		return nil, errTruncated
+	}
+	indexes, err := decodeHybrid(data[1:], int(data[0]), count)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, count)
+	for i, index := range indexes {
+		if index >= len(dictionary) {
+			return nil, fmt.Errorf("dictionary index %d out of range", index)
+		}
+		values[i] = dictionary[index]
+	}
+	return values, nil
+}
+
+// decodeParquetRLEBooleans decodes length-prefixed RLE encoded booleans
+func decodeParquetRLEBooleans(data []byte, count int) ([]any, error) {
+	encoded, _, err := lengthPrefixed(data)
+	if err != nil {
+		return nil, err
+	}
+	bits, err := decodeHybrid(encoded, 1, count)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, count)
+	for i, bit := range bits {
+		values[i] = bit == 1
+	}
+	return values, nil
+}
+
+// decodeHybrid decodes count values of the RLE/bit-packing hybrid encoding.
+// Runs are a varint header with the run length shifted left by one, followed by the repeated value
+// in as many bytes as the bit width needs. Bit-packed groups have the lowest header bit set
+// and hold multiples of 8 values packed least significant bit first.
+func decodeHybrid(data []byte, bitWidth, count int) ([]int, error) {
+	if bitWidth < 0 || bitWidth > 32 {
+		return nil, fmt.Errorf("invalid bit width %d", bitWidth)
+	}
+	values := make([]int, 0, count)
+	for pos := 0; len(values) < count; {
+		header, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		pos += n
+
+		if header&1 == 0 {
+			// Run of a repeated value
+			width := (bitWidth + 7) / 8
+			if len(data)-pos < width {
+				return nil, errTruncated
+			}
+			value := 0
+			for i := 0; i < width; i++ {
+				value |= int(data[pos+i]) << (8 * i)
+			}
+			pos += width
+			for run := header >> 1; run > 0 && len(values) < count; run-- {
+				values = append(values, value)
+			}
+			continue
+		}
+
+		// Bit-packed groups of 8 values
+		groups := header >> 1
+		if bitWidth > 0 && groups > uint64(len(data)-pos) {
+			return nil, errTruncated
+		}
+		end := pos + int(groups)*bitWidth
+		if end > len(data) {
+			return nil, errTruncated
+		}
+		for bit := pos * 8; bit < end*8 && len(values) < count; bit += bitWidth {
+			value := 0
+			for i := 0; i < bitWidth; i++ {
+				b := bit + i
+				value |= int(data[b/8]>>(b%8)&1) << i
+			}
+			values = append(values, value)
+		}
+		if bitWidth == 0 {
+			for i := uint64(0); i < groups*8 && len(values) < count; i++ {
+				values = append(values, 0)
+			}
+		}
+		pos = end
+	}
+	return values, nil
+}
+
+// lengthPrefixed splits off a value prefixed with its length as a 4-byte little-endian integer
+func lengthPrefixed(data []byte) (value, rest []byte, err error) {
+	if len(data) < 4 {
+		return nil, nil, errTruncated
+	}
+	n := binary.LittleEndian.Uint32(data)
+	if uint64(n) > uint64(len(data)-4) {
+		return nil, nil, errTruncated
+	}
+	return data[4 : 4+n], data[4+n:], nil
+}
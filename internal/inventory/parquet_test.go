@@ -0,0 +1,475 @@
+package inventory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"math/bits"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// thriftWriter writes the Thrift compact protocol, to build Parquet files for tests
+type thriftWriter struct {
+	bytes.Buffer
+	last []int16 // Last field id of every open struct
+}
+
+func (w *thriftWriter) begin() { w.last = append(w.last, 0) }
+
+func (w *thriftWriter) end() {
+	w.WriteByte(thriftStop)
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.WriteByte(typ)
+		w.varint(int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) varint(v int64) {
+	w.Write(binary.AppendUvarint(nil, uint64(v<<1^v>>63)))
+}
+
+func (w *thriftWriter) str(s string) {
+	w.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	w.WriteString(s)
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.varint(int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.varint(v)
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.str(s)
+}
+
+func (w *thriftWriter) bool(id int16, v bool) {
+	if v {
+		w.field(id, thriftTrue)
+	} else {
+		w.field(id, thriftFalse)
+	}
+}
+
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+func (w *thriftWriter) list(id int16, typ byte, n int) {
+	w.field(id, thriftList)
+	if n < thriftLongList {
+		w.WriteByte(byte(n)<<4 | typ)
+	} else {
+		w.WriteByte(thriftLongList<<4 | typ)
+		w.Write(binary.AppendUvarint(nil, uint64(n)))
+	}
+}
+
+// parquetTestColumn is a column of a Parquet file built for tests
+type parquetTestColumn struct {
+	name       string
+	typ        int32
+	optional   bool
+	converted  int32
+	dictionary bool
+	values     []any // nil for null values
+}
+
+// buildParquet builds a Parquet file with a single row group, using data pages v1 or v2
+func buildParquet(t *testing.T, codec int32, v2 bool, columns []parquetTestColumn) []byte {
+	t.Helper()
+
+	type chunk struct {
+		column           parquetTestColumn
+		offset, size     int64
+		dataOffset       int64
+		dictionaryOffset int64
+		encoding         int32
+	}
+	var (
+		file   bytes.Buffer
+		chunks []chunk
+		rows   = len(columns[0].values)
+	)
+	file.WriteString(parquetMagic)
+
+	for _, column := range columns {
+		c := chunk{column: column, offset: int64(file.Len()), encoding: encodingPlain}
+
+		var present []any
+		for _, v := range column.values {
+			if v != nil {
+				present = append(present, v)
+			}
+		}
+
+		var values []byte
+		if column.dictionary {
+			var dictionary []any
+			indexes := make(map[any]int)
+			var encoded []int
+			for _, v := range present {
+				if _, ok := indexes[v]; !ok {
+					indexes[v] = len(dictionary)
+					dictionary = append(dictionary, v)
+				}
+				encoded = append(encoded, indexes[v])
+			}
+
+			plain := encodeParquetPlain(column.typ, dictionary)
+			compressed := compressParquet(t, codec, plain)
+			var header thriftWriter
+			header.begin()
+			header.i32(1, pageDictionary)
+			header.i32(2, int32(len(plain)))
+			header.i32(3, int32(len(compressed)))
+			header.structField(7)
+			header.i32(1, int32(len(dictionary)))
+			header.i32(2, encodingPlain)
+			header.end()
+			header.end()
+			c.dictionaryOffset = int64(file.Len())
+			file.Write(header.Bytes())
+			file.Write(compressed)
+
+			// The indexes, as one run each
+			width := max(bits.Len(uint(len(dictionary)-1)), 1)
+			values = []byte{byte(width)}
+			for _, index := range encoded {
+				values = append(values, 2)
+				for i := 0; i < (width+7)/8; i++ {
+					values = append(values, byte(index>>(8*i)))
+				}
+			}
+			c.encoding = encodingPlainDictionary
+			if v2 {
+				c.encoding = encodingRLEDictionary
+			}
+		} else {
+			values = encodeParquetPlain(column.typ, present)
+		}
+
+		// Definition levels, bit-packed
+		var levels []byte
+		if column.optional {
+			groups := (rows + 7) / 8
+			levels = binary.AppendUvarint(nil, uint64(groups<<1|1))
+			packed := make([]byte, groups)
+			for i, v := range column.values {
+				if v != nil {
+					packed[i/8] |= 1 << (i % 8)
+				}
+			}
+			levels = append(levels, packed...)
+		}
+
+		var header thriftWriter
+		header.begin()
+		var body []byte
+		if v2 {
+			compressed := compressParquet(t, codec, values)
+			header.i32(1, pageDataV2)
+			header.i32(2, int32(len(levels)+len(values)))
+			header.i32(3, int32(len(levels)+len(compressed)))
+			header.structField(8)
+			header.i32(1, int32(rows))
+			header.i32(2, int32(rows-len(present)))
+			header.i32(3, int32(rows))
+			header.i32(4, c.encoding)
+			header.i32(5, int32(len(levels)))
+			header.i32(6, 0)
+			header.bool(7, true)
+			header.end()
+			body = append(levels, compressed...)
+		} else {
+			var page []byte
+			if column.optional {
+				page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+				page = append(page, levels...)
+			}
+			page = append(page, values...)
+			body = compressParquet(t, codec, page)
+			header.i32(1, pageData)
+			header.i32(2, int32(len(page)))
+			header.i32(3, int32(len(body)))
+			header.structField(5)
+			header.i32(1, int32(rows))
+			header.i32(2, c.encoding)
+			header.i32(3, encodingRLE)
+			header.i32(4, encodingRLE)
+			header.end()
+		}
+		header.end()
+		c.dataOffset = int64(file.Len())
+		file.Write(header.Bytes())
+		file.Write(body)
+		c.size = int64(file.Len()) - c.offset
+		chunks = append(chunks, c)
+	}
+
+	// The file metadata, with a nested group and metadata the reader skips
+	var footer thriftWriter
+	footer.begin()
+	footer.i32(1, 1)
+	footer.list(2, thriftStruct, len(columns)+3)
+	footer.begin()
+	footer.binary(4, "schema")
+	footer.i32(5, int32(len(columns)+1))
+	footer.end()
+	for _, column := range columns {
+		footer.begin()
+		footer.i32(1, column.typ)
+		if column.optional {
+			footer.i32(3, 1)
+		} else {
+			footer.i32(3, 0)
+		}
+		footer.binary(4, column.name)
+		if column.converted != 0 {
+			footer.i32(6, column.converted)
+		}
+		footer.end()
+	}
+	footer.begin()
+	footer.i32(3, 1)
+	footer.binary(4, "tags")
+	footer.i32(5, 1)
+	footer.end()
+	footer.begin()
+	footer.i32(1, parquetByteArray)
+	footer.i32(3, 1)
+	footer.binary(4, "key")
+	footer.end()
+	footer.i64(3, int64(rows))
+
+	footer.list(4, thriftStruct, 1)
+	footer.begin()
+	footer.list(1, thriftStruct, len(chunks)+1)
+	for _, c := range chunks {
+		footer.begin()
+		footer.i64(2, c.offset)
+		footer.structField(3)
+		footer.i32(1, c.column.typ)
+		footer.list(2, thriftI32, 1)
+		footer.varint(int64(c.encoding))
+		footer.list(3, thriftBinary, 1)
+		footer.str(c.column.name)
+		footer.i32(4, codec)
+		footer.i64(5, int64(rows))
+		footer.i64(6, c.size)
+		footer.i64(7, c.size)
+		footer.list(8, thriftStruct, 1)
+		footer.begin()
+		footer.binary(1, "origin")
+		footer.binary(2, "test")
+		footer.end()
+		footer.i64(9, c.dataOffset)
+		if c.dictionaryOffset != 0 {
+			footer.i64(11, c.dictionaryOffset)
+		}
+		footer.end()
+		footer.end()
+	}
+	footer.begin()
+	footer.structField(3)
+	footer.i32(1, parquetByteArray)
+	footer.list(3, thriftBinary, 2)
+	footer.str("tags")
+	footer.str("key")
+	footer.end()
+	footer.end()
+	footer.i64(2, int64(file.Len()))
+	footer.i64(3, int64(rows))
+	footer.end()
+
+	footer.binary(6, "s3cpbp test")
+	footer.end()
+
+	file.Write(footer.Bytes())
+	file.Write(binary.LittleEndian.AppendUint32(nil, uint32(footer.Len())))
+	file.WriteString(parquetMagic)
+	return file.Bytes()
+}
+
+// encodeParquetPlain encodes values with the PLAIN encoding
+func encodeParquetPlain(typ int32, values []any) []byte {
+	var data []byte
+	if typ == parquetBoolean {
+		data = make([]byte, (len(values)+7)/8)
+	}
+	for i, v := range values {
+		switch typ {
+		case parquetBoolean:
+			if v.(bool) {
+				data[i/8] |= 1 << (i % 8)
+			}
+		case parquetInt64:
+			data = binary.LittleEndian.AppendUint64(data, uint64(v.(int64)))
+		case parquetByteArray:
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(v.(string))))
+			data = append(data, v.(string)...)
+		}
+	}
+	return data
+}
+
+func compressParquet(t *testing.T, codec int32, data []byte) []byte {
+	switch codec {
+	case 1:
+		return snappy.Encode(nil, data)
+	case 2:
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+		return buf.Bytes()
+	case 6:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(data, nil)
+	default:
+		return data
+	}
+}
+
+// testColumns are the columns of the test reports, with four objects:
+// a.json, a noncurrent version of b.json without size and date, an empty a.json and a large c.json
+func parquetTestColumns() []parquetTestColumn {
+	return []parquetTestColumn{
+		{
+			name:   "bucket",
+			typ:    parquetByteArray,
+			values: []any{"source-bucket", "source-bucket", "source-bucket", "source-bucket"},
+		},
+		{
+			name:       "key",
+			typ:        parquetByteArray,
+			dictionary: true,
+			values:     []any{"logs/a.json", "logs/b.json", "logs/a.json", "other/c.json"},
+		},
+		{
+			name:     "size",
+			typ:      parquetInt64,
+			optional: true,
+			values:   []any{int64(12), nil, int64(0), int64(1 << 40)},
+		},
+		{
+			name:      "last_modified_date",
+			typ:       parquetInt64,
+			optional:  true,
+			converted: convertedTimestampMillis,
+			values:    []any{int64(1727769600123), nil, int64(1727769600123), int64(0)},
+		},
+		{
+			name:   "is_latest",
+			typ:    parquetBoolean,
+			values: []any{true, false, true, true},
+		},
+		{
+			name:     "e_tag",
+			typ:      parquetByteArray,
+			optional: true,
+			values:   []any{"abc", nil, "def", nil},
+		},
+		{
+			name:   "intelligent_tiering_access_tier",
+			typ:    parquetByteArray,
+			values: []any{"", "", "", ""},
+		},
+	}
+}
+
+// checkTestRecords checks the records read from a report of the test columns
+func checkTestRecords(t *testing.T, records []Record) {
+	t.Helper()
+
+	modified := time.Date(2024, 10, 1, 8, 0, 0, 123000000, time.UTC)
+	expected := []Record{
+		{ObjectInfo: s3ops.ObjectInfo{Key: "logs/a.json", Size: 12, ETag: "abc", LastModified: modified}, IsLatest: true},
+		{ObjectInfo: s3ops.ObjectInfo{Key: "logs/b.json", Size: s3ops.UnknownSize}, IsLatest: false},
+		{ObjectInfo: s3ops.ObjectInfo{Key: "logs/a.json", Size: 0, ETag: "def", LastModified: modified}, IsLatest: true},
+		{ObjectInfo: s3ops.ObjectInfo{Key: "other/c.json", Size: 1 << 40, LastModified: time.Unix(0, 0).UTC()}, IsLatest: true},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("read %d records, want %d", len(records), len(expected))
+	}
+	for i, record := range records {
+		want := expected[i]
+		if record.Bucket != "source-bucket" || record.Key != want.Key || record.Size != want.Size ||
+			record.ETag != want.ETag || !record.LastModified.Equal(want.LastModified) || record.IsLatest != want.IsLatest {
+			t.Errorf("record %d = %+v, want %+v", i, record, want)
+		}
+	}
+}
+
+func TestReadParquet(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec int32
+		v2    bool
+	}{
+		{name: "uncompressed", codec: 0},
+		{name: "snappy", codec: 1},
+		{name: "gzip data page v2", codec: 2, v2: true},
+		{name: "zstd data page v2", codec: 6, v2: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildParquet(t, tt.codec, tt.v2, parquetTestColumns())
+
+			var records []Record
+			err := ReadParquet(bytes.NewReader(data), int64(len(data)), func(record *Record) error {
+				records = append(records, *record)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ReadParquet() returned unexpected error: %v", err)
+			}
+			checkTestRecords(t, records)
+		})
+	}
+}
+
+func TestReadParquetErrors(t *testing.T) {
+	valid := buildParquet(t, 0, false, parquetTestColumns())
+	corrupt := bytes.Clone(valid)
+	copy(corrupt[len(corrupt)-40:], bytes.Repeat([]byte{0xff}, 32))
+
+	tests := map[string][]byte{
+		"not parquet":       []byte("Bucket,Key\nsource-bucket,a.json\n"),
+		"truncated":         valid[:len(valid)-9],
+		"corrupt metadata":  corrupt,
+		"unsupported codec": buildParquet(t, 3, false, parquetTestColumns()),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ReadParquet(bytes.NewReader(data), int64(len(data)), func(*Record) error { return nil })
+			if err == nil {
+				t.Error("ReadParquet() did not return an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package inventory
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Protocol buffer wire types, as used by ORC metadata
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protoReader decodes a protocol buffer message. Only the fields ORC readers need are decoded,
+// every other field is skipped.
+type protoReader struct {
+	buf []byte
+	pos int
+}
+
+// readMessage calls fn with the number and wire type of every field until the end of the message.
+// fn must consume the field's value, or skip it.
+func (p *protoReader) readMessage(fn func(num int, wire int) error) error {
+	for p.pos < len(p.buf) {
+		tag, err := p.uvarint()
+		if err != nil {
+			return err
+		}
+		if err := fn(int(tag>>3), int(tag&7)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uvarint reads a varint field
+func (p *protoReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(p.buf[p.pos:])
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	p.pos += n
+	return v, nil
+}
+
+// bytes reads a length-delimited field, like a string or an embedded message
+func (p *protoReader) bytes() ([]byte, error) {
+	n, err := p.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(p.buf)-p.pos) {
+		return nil, errTruncated
+	}
+	b := p.buf[p.pos : p.pos+int(n)]
+	p.pos += int(n)
+	return b, nil
+}
+
+// message reads an embedded message field
+func (p *protoReader) message() (*protoReader, error) {
+	b, err := p.bytes()
+	return &protoReader{buf: b}, err
+}
+
+// uvarints reads a repeated varint field, which is packed when its wire type is protoBytes
+func (p *protoReader) uvarints(wire int, values []uint64) ([]uint64, error) {
+	if wire == protoVarint {
+		v, err := p.uvarint()
+		return append(values, v), err
+	}
+	packed, err := p.message()
+	if err != nil {
+		return nil, err
+	}
+	for packed.pos < len(packed.buf) {
+		v, err := packed.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// skip skips a field value of the given wire type
+func (p *protoReader) skip(wire int) error {
+	n := 0
+	switch wire {
+	case protoVarint:
+		_, err := p.uvarint()
+		return err
+	case protoBytes:
+		_, err := p.bytes()
+		return err
+	case protoFixed64:
+		n = 8
+	case protoFixed32:
+		n = 4
+	default:
+		return fmt.Errorf("unsupported protobuf wire type %d", wire)
+	}
+	if n > len(p.buf)-p.pos {
+		return errTruncated
+	}
+	p.pos += n
+	return nil
+}
@@ -0,0 +1,82 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestReadReports reads the ORC and Parquet data files of real inventory reports in testdata and compares
+// their records with the CSV report of the same objects, see testdata/README.md. The encoders of the other
+// tests only cover what this package writes itself, these files check the readers against what S3 writes.
+func TestReadReports(t *testing.T) {
+	orc, _ := filepath.Glob(filepath.Join("testdata", "*.orc"))
+	parquet, _ := filepath.Glob(filepath.Join("testdata", "*.parquet"))
+	reports := append(orc, parquet...)
+	if len(reports) == 0 {
+		t.Skip("no inventory reports in testdata, see testdata/README.md")
+	}
+
+	for _, path := range reports {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", path, err)
+			}
+			read := ReadParquet
+			if filepath.Ext(path) == ".orc" {
+				read = ReadORC
+			}
+			var records []Record
+			err = read(bytes.NewReader(data), int64(len(data)), func(record *Record) error {
+				records = append(records, *record)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("reading %s returned unexpected error: %v", path, err)
+			}
+
+			expected := readExpectedRecords(t, strings.TrimSuffix(path, filepath.Ext(path))+".csv")
+			if len(records) != len(expected) {
+				t.Fatalf("read %d records, want %d", len(records), len(expected))
+			}
+			for i, record := range records {
+				want := expected[i]
+				if record.Bucket != want.Bucket || record.Key != want.Key || record.VersionID != want.VersionID ||
+					record.IsLatest != want.IsLatest || record.IsDeleteMarker != want.IsDeleteMarker ||
+					record.Size != want.Size || record.ETag != want.ETag || !record.LastModified.Equal(want.LastModified) ||
+					record.StorageClass != want.StorageClass || !slices.Equal(record.ChecksumAlgorithms, want.ChecksumAlgorithms) {
+					t.Errorf("record %d = %+v, want %+v", i, record, want)
+				}
+			}
+		})
+	}
+}
+
+// readExpectedRecords reads a CSV report whose first line is its fileSchema
+func readExpectedRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the expected records: %v", err)
+	}
+	reader := bufio.NewReader(bytes.NewReader(data))
+	schema, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read the schema of %s: %v", path, err)
+	}
+
+	var records []Record
+	err = ReadCSV(reader, strings.TrimSpace(schema), func(record *Record) error {
+		records = append(records, *record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadCSV(%s) returned unexpected error: %v", path, err)
+	}
+	return records
+}
@@ -0,0 +1,362 @@
+package inventory
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ORC integer run-length encoding v2 sub-encodings, in the top two bits of a run's first byte
+const (
+	rleShortRepeat = 0
+	rleDirect      = 1
+	rlePatchedBase = 2
+	rleDelta       = 3
+)
+
+// decodeByteRLE decodes count bytes of ORC's byte run-length encoding.
+// A control byte below 0x80 starts a run of the next byte repeated control+3 times,
+// otherwise 256-control literal bytes follow.
+func decodeByteRLE(data []byte, count int) ([]byte, error) {
+	values := make([]byte, 0, count)
+	for pos := 0; len(values) < count; {
+		if pos >= len(data) {
+			return nil, errTruncated
+		}
+		control := int(data[pos])
+		pos++
+
+		if control < 0x80 {
+			if pos >= len(data) {
+				return nil, errTruncated
+			}
+			for run := control + 3; run > 0 && len(values) < count; run-- {
+				values = append(values, data[pos])
+			}
+			pos++
+			continue
+		}
+
+		literals := 0x100 - control
+		if literals > len(data)-pos {
+			return nil, errTruncated
+		}
+		values = append(values, data[pos:pos+literals]...)
+		pos += literals
+	}
+	return values[:count], nil
+}
+
+// decodeBooleanRLE decodes count booleans, stored most significant bit first in byte run-length encoded bytes
+func decodeBooleanRLE(data []byte, count int) ([]bool, error) {
+	bytes, err := decodeByteRLE(data, (count+7)/8)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]bool, count)
+	for i := range values {
+		values[i] = bytes[i/8]&(0x80>>(i%8)) != 0
+	}
+	return values, nil
+}
+
+// decodeIntRLE decodes count integers of ORC's integer run-length encoding version 1 or 2.
+// Signed integers are zigzag encoded.
+func decodeIntRLE(data []byte, v2, signed bool, count int) ([]int64, error) {
+	d := &intRLEDecoder{data: data, signed: signed, values: make([]int64, 0, count)}
+	for len(d.values) < count {
+		var err error
+		if v2 {
+			err = d.runV2()
+		} else {
+			err = d.runV1()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return d.values[:count], nil
+}
+
+// intRLEDecoder decodes the runs of an integer stream
+type intRLEDecoder struct {
+	data   []byte
+	pos    int
+	signed bool
+	values []int64
+}
+
+// runV1 decodes a run of version 1: a control byte below 0x80 starts a run of control+3 values
+// from a varint base incremented by a signed delta byte, otherwise 256-control literal varints follow.
+func (d *intRLEDecoder) runV1() error {
+	control, err := d.byte()
+	if err != nil {
+		return err
+	}
+
+	if control < 0x80 {
+		delta, err := d.byte()
+		if err != nil {
+			return err
+		}
+		base, err := d.varint(d.signed)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < int(control)+3; i++ {
+			d.values = append(d.values, base+int64(i)*int64(int8(delta)))
+		}
+		return nil
+	}
+
+	for i := 0; i < 0x100-int(control); i++ {
+		v, err := d.varint(d.signed)
+		if err != nil {
+			return err
+		}
+		d.values = append(d.values, v)
+	}
+	return nil
+}
+
+// runV2 decodes a run of version 2, using the sub-encoding in the top bits of its first byte
+func (d *intRLEDecoder) runV2() error {
+	first, err := d.byte()
+	if err != nil {
+		return err
+	}
+
+	if first>>6 == rleShortRepeat {
+		// A value of 1 to 8 big-endian bytes, repeated 3 to 10 times
+		width := int(first>>3&7) + 1
+		v, err := d.bigEndian(width)
+		if err != nil {
+			return err
+		}
+		value := int64(v)
+		if d.signed {
+			value = unzigzag(v)
+		}
+		for i := 0; i < int(first&7)+3; i++ {
+			d.values = append(d.values, value)
+		}
+		return nil
+	}
+
+	// The other sub-encodings have a 5-bit width code and a 9-bit length
+	second, err := d.byte()
+	if err != nil {
+		return err
+	}
+	widthCode := int(first >> 1 & 0x1f)
+	length := int(first&1)<<8 | int(second) + 1
+
+	switch first >> 6 {
+	case rleDirect:
+		unpacked, err := d.bits(length, decodeBitWidth(widthCode))
+		if err != nil {
+			return err
+		}
+		for _, v := range unpacked {
+			if d.signed {
+				d.values = append(d.values, unzigzag(v))
+			} else {
+				d.values = append(d.values, int64(v))
+			}
+		}
+		return nil
+	case rlePatchedBase:
+		return d.patchedBase(length, decodeBitWidth(widthCode))
+	default:
+		return d.delta(length, widthCode)
+	}
+}
+
+// patchedBase decodes values stored as offsets from a base, with the high bits of outliers patched in
+// from a list of gaps and patches following the offsets
+func (d *intRLEDecoder) patchedBase(length, width int) error {
+	third, err := d.byte()
+	if err != nil {
+		return err
+	}
+	fourth, err := d.byte()
+	if err != nil {
+		return err
+	}
+	baseWidth := int(third>>5) + 1
+	patchWidth := decodeBitWidth(int(third & 0x1f))
+	gapWidth := int(fourth>>5) + 1
+	patches := int(fourth & 0x1f)
+
+	// The base is stored in sign-magnitude form
+	v, err := d.bigEndian(baseWidth)
+	if err != nil {
+		return err
+	}
+	sign := uint64(1) << (baseWidth*8 - 1)
+	base := int64(v &^ sign)
+	if v&sign != 0 {
+		base = -base
+	}
+
+	offsets, err := d.bits(length, width)
+	if err != nil {
+		return err
+	}
+	list, err := d.bits(patches, closestFixedBits(patchWidth+gapWidth))
+	if err != nil {
+		return err
+	}
+
+	// Each patch entry holds the distance from the previous patch and the high bits to patch in.
+	// Distances beyond 255 are written as extra entries with a gap of 255 and an empty patch.
+	patchMask := uint64(1)<<patchWidth - 1
+	next := 0
+	index := 0
+	nextPatch := func() (uint64, bool) {
+		gap := 0
+		for next < len(list) {
+			entry := list[next]
+			next++
+			g, patch := int(entry>>patchWidth), entry&patchMask
+			gap += g
+			if g != 255 || patch != 0 {
+				index += gap
+				return patch, true
+			}
+		}
+		return 0, false
+	}
+
+	patch, ok := nextPatch()
+	for i, offset := range offsets {
+		if ok && i == index {
+			offset |= patch << width
+			patch, ok = nextPatch()
+		}
+		d.values = append(d.values, base+int64(offset))
+	}
+	return nil
+}
+
+// delta decodes a base value and a delta base as varints, followed by the absolute values
+// of the remaining deltas, which share the sign of the delta base.
+// A width code of 0 means that all deltas equal the delta base.
+func (d *intRLEDecoder) delta(length, widthCode int) error {
+	value, err := d.varint(d.signed)
+	if err != nil {
+		return err
+	}
+	deltaBase, err := d.varint(true)
+	if err != nil {
+		return err
+	}
+	d.values = append(d.values, value)
+
+	if widthCode == 0 {
+		for i := 1; i < length; i++ {
+			value += deltaBase
+			d.values = append(d.values, value)
+		}
+		return nil
+	}
+
+	if length < 2 {
+		return fmt.Errorf("delta run of %d values", length)
+	}
+	value += deltaBase
+	d.values = append(d.values, value)
+	deltas, err := d.bits(length-2, decodeBitWidth(widthCode))
+	if err != nil {
+		return err
+	}
+	for _, delta := range deltas {
+		if deltaBase < 0 {
+			value -= int64(delta)
+		} else {
+			value += int64(delta)
+		}
+		d.values = append(d.values, value)
+	}
+	return nil
+}
+
+func (d *intRLEDecoder) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errTruncated
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+// varint reads a base 128 varint, zigzag decoding it when signed
+func (d *intRLEDecoder) varint(signed bool) (int64, error) {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	d.pos += n
+	if signed {
+		return unzigzag(v), nil
+	}
+	return int64(v), nil
+}
+
+// bigEndian reads an unsigned integer of width bytes
+func (d *intRLEDecoder) bigEndian(width int) (uint64, error) {
+	if width > len(d.data)-d.pos {
+		return 0, errTruncated
+	}
+	var v uint64
+	for _, b := range d.data[d.pos : d.pos+width] {
+		v = v<<8 | uint64(b)
+	}
+	d.pos += width
+	return v, nil
+}
+
+// bits reads count values of width bits, packed most significant bit first.
+// The values end on a byte boundary.
+func (d *intRLEDecoder) bits(count, width int) ([]uint64, error) {
+	total := count * width
+	if (total+7)/8 > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+
+	values := make([]uint64, count)
+	bit := d.pos * 8
+	for i := range values {
+		var v uint64
+		for j := 0; j < width; j++ {
+			v = v<<1 | uint64(d.data[bit/8]>>(7-bit%8)&1)
+			bit++
+		}
+		values[i] = v
+	}
+	d.pos += (total + 7) / 8
+	return values, nil
+}
+
+// decodeBitWidth converts the 5-bit width code of version 2 runs into a number of bits
+func decodeBitWidth(code int) int {
+	if code < 24 {
+		return code + 1
+	}
+	return [...]int{26, 28, 30, 32, 40, 48, 56, 64}[code-24]
+}
+
+// closestFixedBits rounds a number of bits up to a width that decodeBitWidth can represent
+func closestFixedBits(n int) int {
+	switch {
+	case n == 0:
+		return 1
+	case n <= 24:
+		return n
+	}
+	for _, width := range [...]int{26, 28, 30, 32, 40, 48, 56} {
+		if n <= width {
+			return width
+		}
+	}
+	return 64
+}
@@ -0,0 +1,118 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The examples from the ORC specification
+func TestDecodeIntRLEv2(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		signed   bool
+		expected []int64
+	}{
+		{
+			name:     "short repeat",
+			data:     []byte{0x0a, 0x27, 0x10},
+			expected: []int64{10000, 10000, 10000, 10000, 10000},
+		},
+		{
+			name:     "direct",
+			data:     []byte{0x5e, 0x03, 0x5c, 0xa1, 0xab, 0x1e, 0xde, 0xad, 0xbe, 0xef},
+			expected: []int64{23713, 43806, 57005, 48879},
+		},
+		{
+			name: "patched base",
+			data: []byte{0x8e, 0x13, 0x2b, 0x21, 0x07, 0xd0, 0x1e, 0x00, 0x14, 0x70, 0x28, 0x32, 0x3c, 0x46, 0x50,
+				0x5a, 0x64, 0x6e, 0x78, 0x82, 0x8c, 0x96, 0xa0, 0xaa, 0xb4, 0xbe, 0xfc, 0xe8},
+			expected: []int64{2030, 2000, 2020, 1000000, 2040, 2050, 2060, 2070, 2080, 2090,
+				2100, 2110, 2120, 2130, 2140, 2150, 2160, 2170, 2180, 2190},
+		},
+		{
+			name:     "delta",
+			data:     []byte{0xc6, 0x09, 0x02, 0x02, 0x22, 0x42, 0x42, 0x46},
+			expected: []int64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29},
+		},
+		{
+			name:     "fixed delta",
+			data:     []byte{0xc0, 0x04, 0x0a, 0x03},
+			signed:   true,
+			expected: []int64{5, 3, 1, -1, -3},
+		},
+		{
+			name:     "signed direct",
+			data:     []byte{0x46, 0x02, 0x34, 0x50},
+			signed:   true,
+			expected: []int64{-2, 2, -3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := decodeIntRLE(tt.data, true, tt.signed, len(tt.expected))
+			if err != nil {
+				t.Fatalf("decodeIntRLE() returned unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("decodeIntRLE() = %v, want %v", values, tt.expected)
+			}
+		})
+	}
+
+	if _, err := decodeIntRLE([]byte{0x5e, 0x03, 0x5c}, true, false, 4); err == nil {
+		t.Error("decodeIntRLE() with truncated data did not fail")
+	}
+}
+
+func TestDecodeIntRLEv1(t *testing.T) {
+	// A run of 100 sevens, then literals 2, 3, 6, 7, 11
+	data := []byte{0x61, 0x00, 0x07, 0xfb, 0x02, 0x03, 0x06, 0x07, 0x0b}
+	values, err := decodeIntRLE(data, false, false, 105)
+	if err != nil {
+		t.Fatalf("decodeIntRLE() returned unexpected error: %v", err)
+	}
+	if values[0] != 7 || values[99] != 7 || !reflect.DeepEqual(values[100:], []int64{2, 3, 6, 7, 11}) {
+		t.Errorf("decodeIntRLE() = %v", values)
+	}
+
+	// A signed run counting down from 1 by 2
+	values, err = decodeIntRLE([]byte{0x00, 0xfe, 0x02}, false, true, 3)
+	if err != nil || !reflect.DeepEqual(values, []int64{1, -1, -3}) {
+		t.Errorf("decodeIntRLE() = %v, %v, want [1 -1 -3]", values, err)
+	}
+}
+
+func TestDecodeByteRLE(t *testing.T) {
+	// 100 zeros, then literals 0x44 and 0x45
+	values, err := decodeByteRLE([]byte{0x61, 0x00, 0xfe, 0x44, 0x45}, 102)
+	if err != nil {
+		t.Fatalf("decodeByteRLE() returned unexpected error: %v", err)
+	}
+	if values[99] != 0 || values[100] != 0x44 || values[101] != 0x45 {
+		t.Errorf("decodeByteRLE() = %v", values)
+	}
+
+	bools, err := decodeBooleanRLE([]byte{0xff, 0xa0}, 3)
+	if err != nil || !reflect.DeepEqual(bools, []bool{true, false, true}) {
+		t.Errorf("decodeBooleanRLE() = %v, %v, want [true false true]", bools, err)
+	}
+
+	if _, err := decodeByteRLE([]byte{0xfe, 0x44}, 2); err == nil {
+		t.Error("decodeByteRLE() with truncated data did not fail")
+	}
+}
+
+func TestBitWidths(t *testing.T) {
+	for code, width := range map[int]int{0: 1, 23: 24, 24: 26, 27: 32, 31: 64} {
+		if got := decodeBitWidth(code); got != width {
+			t.Errorf("decodeBitWidth(%d) = %d, want %d", code, got, width)
+		}
+	}
+	for n, width := range map[int]int{0: 1, 14: 14, 25: 26, 33: 40, 57: 64} {
+		if got := closestFixedBits(n); got != width {
+			t.Errorf("closestFixedBits(%d) = %d, want %d", n, got, width)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package inventory
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errTruncated is returned when a file ends in the middle of a structure
+var errTruncated = errors.New("truncated data")
+
+// Thrift compact protocol types, as used by Parquet metadata
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+const (
+	// thriftMaxNesting guards against corrupt files that nest structs without end
+	thriftMaxNesting = 64
+	// thriftLongList in a list header means the size follows as a varint
+	thriftLongList = 15
+)
+
+// thriftReader decodes the Thrift compact protocol. Only the fields Parquet readers need are decoded,
+// every other field is skipped.
+type thriftReader struct {
+	buf   []byte
+	pos   int
+	depth int
+}
+
+// readStruct calls fn with the id and type of every field in a struct until its end.
+// fn must consume the field's value, or skip it.
+func (r *thriftReader) readStruct(fn func(id int16, typ byte) error) error {
+	if r.depth++; r.depth > thriftMaxNesting {
+		return fmt.Errorf("structs nested too deeply")
+	}
+	defer func() { r.depth-- }()
+
+	var last int16
+	for {
+		header, err := r.byte()
+		if err != nil {
+			return err
+		}
+		typ := header & 0x0f
+		if typ == thriftStop {
+			return nil
+		}
+
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			v, err := r.varint()
+			if err != nil {
+				return err
+			}
+			id = int16(unzigzag(v))
+		}
+		last = id
+
+		if err := fn(id, typ); err != nil {
+			return err
+		}
+	}
+}
+
+// readList calls fn for every element of a list
+func (r *thriftReader) readList(fn func(typ byte) error) error {
+	header, err := r.byte()
+	if err != nil {
+		return err
+	}
+	size := uint64(header >> 4)
+	if size == thriftLongList {
+		if size, err = r.varint(); err != nil {
+			return err
+		}
+	}
+	if size > uint64(len(r.buf)-r.pos) {
+		return errTruncated
+	}
+
+	typ := header & 0x0f
+	for i := uint64(0); i < size; i++ {
+		if err := fn(typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip skips a field value of the given type
+func (r *thriftReader) skip(typ byte) error {
+	switch typ {
+	case thriftTrue, thriftFalse:
+		return nil
+	case thriftByte:
+		_, err := r.byte()
+		return err
+	case thriftI16, thriftI32, thriftI64:
+		_, err := r.varint()
+		return err
+	case thriftDouble:
+		return r.advance(8)
+	case thriftBinary:
+		_, err := r.binary()
+		return err
+	case thriftList, thriftSet:
+		return r.readList(r.skipElement)
+	case thriftMap:
+		size, err := r.varint()
+		if err != nil || size == 0 {
+			return err
+		}
+		types, err := r.byte()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < size; i++ {
+			if err := r.skipElement(types >> 4); err != nil {
+				return err
+			}
+			if err := r.skipElement(types & 0x0f); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftStruct:
+		return r.readStruct(func(_ int16, typ byte) error { return r.skip(typ) })
+	default:
+		return fmt.Errorf("unknown thrift type %d", typ)
+	}
+}
+
+// skipElement skips a list, set or map element. Unlike fields, boolean elements take a byte.
+func (r *thriftReader) skipElement(typ byte) error {
+	if typ == thriftTrue || typ == thriftFalse {
+		_, err := r.byte()
+		return err
+	}
+	return r.skip(typ)
+}
+
+// bool returns the value of a boolean field, which is stored in its type
+func (r *thriftReader) bool(typ byte) bool {
+	return typ == thriftTrue
+}
+
+// i32 reads an i32 field
+func (r *thriftReader) i32() (int32, error) {
+	v, err := r.varint()
+	return int32(unzigzag(v)), err
+}
+
+// i64 reads an i64 field
+func (r *thriftReader) i64() (int64, error) {
+	v, err := r.varint()
+	return unzigzag(v), err
+}
+
+// binary reads a binary or string field
+func (r *thriftReader) binary() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.buf)-r.pos) {
+		return nil, errTruncated
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errTruncated
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *thriftReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *thriftReader) advance(n int) error {
+	if n > len(r.buf)-r.pos {
+		return errTruncated
+	}
+	r.pos += n
+	return nil
+}
+
+// unzigzag decodes a zigzag encoded signed integer
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
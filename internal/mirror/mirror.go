@@ -0,0 +1,148 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/user/s3cpbp/internal/filter"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/source"
+)
+
+// Listed records the local paths of the objects the sources listed, relative to the destination with "/" separators
+type Listed struct {
+	mu    sync.Mutex
+	paths map[string]struct{}
+}
+
+// Add records the local path of a listed object
+func (l *Listed) Add(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.paths == nil {
+		l.paths = make(map[string]struct{})
+	}
+	l.paths[path] = struct{}{}
+}
+
+// Contains reports whether an object was listed for the local path
+func (l *Listed) Contains(path string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.paths[path]
+	return ok
+}
+
+// Track wraps the include function of a source downloading into subdir, recording every object it lists.
+// Objects that include drops are recorded too, their files mirror objects that still exist.
+func (l *Listed) Track(subdir string, include func(s3ops.ObjectInfo) bool) func(s3ops.ObjectInfo) bool {
+	return func(obj s3ops.ObjectInfo) bool {
+		l.Add(filepath.ToSlash(filepath.Join(subdir, obj.Key)))
+		return include == nil || include(obj)
+	}
+}
+
+// Scope is the part of the destination that mirrors one source
+type Scope struct {
+	Subdir string                // Relative to the destination, empty for the destination itself
+	Prefix string                // Prefix the source lists
+	Match  func(key string) bool // Keys the source would copy, nil for all
+}
+
+// contains reports whether the file at a path relative to the destination would hold an object of the source
+func (s Scope) contains(path string) bool {
+	key := path
+	if s.Subdir != "" {
+		var ok bool
+		if key, ok = strings.CutPrefix(path, filepath.ToSlash(s.Subdir)+"/"); !ok {
+			return false
+		}
+	}
+	return strings.HasPrefix(key, s.Prefix) && (s.Match == nil || s.Match(key))
+}
+
+// Mirror finds and deletes the files under a destination whose objects no longer exist.
+// Only files the sources could have downloaded are considered, files outside their prefixes,
+// excluded by their filters or matching Protect are kept.
+type Mirror struct {
+	Destination string
+	Scopes      []Scope
+	Listed      *Listed
+	Protect     filter.Patterns // Matched against the path relative to the destination
+	MaxDelete   int             // Delete nothing when more files are extraneous, 0 for no limit
+	Concurrency int             // Directories read at once
+}
+
+// Extraneous walks the destination and returns the files that no listing contained, sorted by path.
+// The walk skips partial and state files of downloads.
+func (m *Mirror) Extraneous(ctx context.Context) ([]s3ops.ObjectInfo, error) {
+	filesChan := make(chan s3ops.ObjectInfo, 1000)
+	var total atomic.Int64
+	errChan := make(chan error, 1)
+	go func() {
+		dir := &source.Directory{Path: m.Destination, Concurrency: m.Concurrency}
+		errChan <- dir.Objects(ctx, m.extraneous, filesChan, &total)
+	}()
+
+	var files []s3ops.ObjectInfo
+	for file := range filesChan {
+		files = append(files, file)
+	}
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+	slices.SortFunc(files, func(a, b s3ops.ObjectInfo) int { return strings.Compare(a.Key, b.Key) })
+	return files, nil
+}
+
+// extraneous reports whether a local file is to be deleted
+func (m *Mirror) extraneous(file s3ops.ObjectInfo) bool {
+	if m.Listed.Contains(file.Key) || m.Protect.Match(file.Key) {
+		return false
+	}
+	for _, scope := range m.Scopes {
+		if scope.contains(file.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes the files returned by Extraneous, and the directories that become empty, up to the destination.
+// Failures don't stop the other deletions, they are returned together with the number of files deleted.
+func (m *Mirror) Delete(files []s3ops.ObjectInfo) (int, error) {
+	if m.MaxDelete > 0 && len(files) > m.MaxDelete {
+		return 0, fmt.Errorf("%d files to delete exceed the limit of %d, nothing was deleted", len(files), m.MaxDelete)
+	}
+
+	var (
+		deleted int
+		errs    []error
+	)
+	root := filepath.Clean(m.Destination)
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file.Key))
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		deleted++
+		log.Printf("Deleted %s, its object no longer exists", path)
+
+		// Removing a directory fails while it still has entries, which ends the climb
+		for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
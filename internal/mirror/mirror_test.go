@@ -0,0 +1,131 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/user/s3cpbp/internal/download"
+	"github.com/user/s3cpbp/internal/filter"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// writeFiles creates the files under root, given by slash-separated relative paths
+func writeFiles(t *testing.T, root string, paths ...string) {
+	t.Helper()
+	for _, name := range paths {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+}
+
+func TestListedTrack(t *testing.T) {
+	var listed Listed
+	include := listed.Track("exports", func(obj s3ops.ObjectInfo) bool { return obj.Size < 10 })
+
+	// Objects dropped by the filters are recorded all the same
+	if !include(s3ops.ObjectInfo{Key: "data/a.json", Size: 1}) || include(s3ops.ObjectInfo{Key: "data/big.json", Size: 100}) {
+		t.Error("Track() changed what include returns")
+	}
+	for _, path := range []string{"exports/data/a.json", "exports/data/big.json"} {
+		if !listed.Contains(path) {
+			t.Errorf("Contains(%q) = false after listing it", path)
+		}
+	}
+	if listed.Contains("data/a.json") {
+		t.Error("Contains() = true for a path outside the subdirectory")
+	}
+}
+
+func TestMirror(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root,
+		"logs/2024/a.json",          // listed
+		"logs/2024/gone.json",       // deleted from S3
+		"logs/2024/old/stale.json",  // deleted from S3, its directory becomes empty
+		"logs/2024/skip.tmp",        // excluded by the filters
+		"logs/2024/notes/local.txt", // protected
+		"other/outside.json",        // outside the prefix
+		"sub/b.json",                // listed by the second source
+		"sub/removed.json",          // deleted from S3
+		"logs/2024/.c.json"+download.PartialSuffix,
+	)
+
+	var listed Listed
+	listed.Add("logs/2024/a.json")
+	listed.Add("sub/b.json")
+
+	var filters filter.Filter
+	if err := filters.Exclude("*.tmp"); err != nil {
+		t.Fatalf("Exclude() returned unexpected error: %v", err)
+	}
+	var protect filter.Patterns
+	if err := protect.Add("notes/"); err != nil {
+		t.Fatalf("Add() returned unexpected error: %v", err)
+	}
+
+	m := &Mirror{
+		Destination: root,
+		Scopes: []Scope{
+			{Prefix: "logs/2024/", Match: filters.MatchKey},
+			{Subdir: "sub", Prefix: ""},
+		},
+		Listed:      &listed,
+		Protect:     protect,
+		Concurrency: 2,
+	}
+
+	files, err := m.Extraneous(context.Background())
+	if err != nil {
+		t.Fatalf("Extraneous() returned unexpected error: %v", err)
+	}
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Key)
+	}
+	expected := []string{"logs/2024/gone.json", "logs/2024/old/stale.json", "sub/removed.json"}
+	if !slices.Equal(paths, expected) {
+		t.Fatalf("Extraneous() = %q, want %q", paths, expected)
+	}
+
+	// Above the limit nothing is deleted
+	m.MaxDelete = 2
+	if n, err := m.Delete(files); err == nil || n != 0 || !strings.Contains(err.Error(), "exceed the limit") {
+		t.Errorf("Delete() above the limit = %d, %v", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "logs", "2024", "gone.json")); err != nil {
+		t.Errorf("file deleted despite the limit: %v", err)
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	m.MaxDelete = 3
+	n, err := m.Delete(files)
+	if err != nil || n != 3 {
+		t.Fatalf("Delete() = %d, %v, want 3 files deleted", n, err)
+	}
+	for _, path := range expected {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(path))); !os.IsNotExist(err) {
+			t.Errorf("%s still exists: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "logs", "2024", "old")); !os.IsNotExist(err) {
+		t.Errorf("emptied directory still exists: %v", err)
+	}
+	for _, path := range []string{"logs/2024/a.json", "logs/2024/skip.tmp", "logs/2024/notes/local.txt", "other/outside.json", "sub/b.json"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(path))); err != nil {
+			t.Errorf("%s was deleted: %v", path, err)
+		}
+	}
+}
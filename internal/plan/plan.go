@@ -0,0 +1,217 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Format selects how a plan is written
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses a plan format name, the empty name selects text
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unknown plan format %q, expected text or json", name)
+}
+
+// Pricing holds the prices of the cost estimate, in US dollars
+type Pricing struct {
+	ListPer1000   float64 // LIST requests
+	GetPer1000    float64 // GET and HEAD requests
+	TransferPerGB float64 // Data transfer out of the bucket's region
+}
+
+// DefaultPricing are the S3 Standard prices in us-east-1, with data transfer out to the internet
+var DefaultPricing = Pricing{ListPer1000: 0.005, GetPer1000: 0.0004, TransferPerGB: 0.09}
+
+// Item is an object of the plan with the local file it maps to
+type Item struct {
+	Source string `json:"source,omitempty"` // s3:// URI of the object, empty for deletions
+	Path   string `json:"path"`
+	Size   int64  `json:"size"` // -1 when unknown, e.g. for keys read from a file
+}
+
+// Requests counts the S3 requests a run makes
+type Requests struct {
+	List int64 `json:"list"`
+	Get  int64 `json:"get"`
+	Head int64 `json:"head"`
+}
+
+// Cost is the estimated cost of a run, in US dollars
+type Cost struct {
+	Requests float64 `json:"requests"`
+	Transfer float64 `json:"transfer"`
+	Total    float64 `json:"total"`
+}
+
+// Summary totals the items of a plan
+type Summary struct {
+	DownloadFiles   int      `json:"download_files"`
+	DownloadBytes   int64    `json:"download_bytes"`
+	DownloadUnknown int      `json:"download_unknown_size"` // Files left out of DownloadBytes and the transfer cost
+	SkipFiles       int      `json:"skip_files"`
+	SkipBytes       int64    `json:"skip_bytes"`
+	SkipUnknown     int      `json:"skip_unknown_size"`
+	DeleteFiles     int      `json:"delete_files"`
+	DeleteBytes     int64    `json:"delete_bytes"`
+	Listed          int64    `json:"listed"` // Objects found, including those the filters dropped
+	Requests        Requests `json:"requests"`
+	Cost            Cost     `json:"estimated_cost_usd"`
+}
+
+// Plan describes what a run would download, skip and delete. Items are added concurrently,
+// Finish sorts them and computes the summary.
+type Plan struct {
+	Sources     []string `json:"sources"`
+	Destination string   `json:"destination"`
+	Download    []Item   `json:"download"`
+	Skip        []Item   `json:"skip"`
+	Delete      []Item   `json:"delete"`
+	Summary     Summary  `json:"summary"`
+
+	mu sync.Mutex
+}
+
+// AddDownload adds an object to download with the GET and HEAD requests that takes
+func (p *Plan) AddDownload(item Item, gets, heads int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Download = append(p.Download, item)
+	p.Summary.Requests.Get += gets
+	p.Summary.Requests.Head += heads
+}
+
+// AddSkip adds an object whose local file is unchanged
+func (p *Plan) AddSkip(item Item) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Skip = append(p.Skip, item)
+}
+
+// AddDelete adds a local file to delete
+func (p *Plan) AddDelete(item Item) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Delete = append(p.Delete, item)
+}
+
+// AddListing adds the objects found by a listing and the LIST requests it took
+func (p *Plan) AddListing(objects, requests int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Summary.Listed += objects
+	p.Summary.Requests.List += requests
+}
+
+// Finish sorts the items by path and totals them, estimating the cost with the pricing.
+// Items of unknown size are counted apart from the bytes.
+func (p *Plan) Finish(pricing Pricing) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	byPath := func(a, b Item) int { return strings.Compare(a.Path, b.Path) }
+	total := func(items []Item) (bytes int64, unknown int) {
+		for _, item := range items {
+			if item.Size < 0 {
+				unknown++
+				continue
+			}
+			bytes += item.Size
+		}
+		return bytes, unknown
+	}
+	for _, items := range []*[]Item{&p.Download, &p.Skip, &p.Delete} {
+		if *items == nil {
+			*items = []Item{}
+		}
+		slices.SortFunc(*items, byPath)
+	}
+
+	s := &p.Summary
+	s.DownloadFiles = len(p.Download)
+	s.DownloadBytes, s.DownloadUnknown = total(p.Download)
+	s.SkipFiles = len(p.Skip)
+	s.SkipBytes, s.SkipUnknown = total(p.Skip)
+	s.DeleteFiles = len(p.Delete)
+	s.DeleteBytes, _ = total(p.Delete)
+
+	s.Cost.Requests = float64(s.Requests.List)/1000*pricing.ListPer1000 +
+		float64(s.Requests.Get+s.Requests.Head)/1000*pricing.GetPer1000
+	s.Cost.Transfer = float64(s.DownloadBytes) / (1 << 30) * pricing.TransferPerGB
+	s.Cost.Total = s.Cost.Requests + s.Cost.Transfer
+}
+
+// Write writes the plan in the format. Text lists the files to download and delete, JSON every item.
+func (p *Plan) Write(w io.Writer, format Format) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if format == FormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(p)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plan for %s to %s\n", strings.Join(p.Sources, ", "), p.Destination)
+	for _, item := range p.Download {
+		fmt.Fprintf(&b, "  download %s (%s)\n", item.Path, FormatSize(item.Size))
+	}
+	for _, item := range p.Delete {
+		fmt.Fprintf(&b, "  delete   %s (%s)\n", item.Path, FormatSize(item.Size))
+	}
+
+	s := p.Summary
+	fmt.Fprintf(&b, "\nObjects listed: %d\n", s.Listed)
+	fmt.Fprintf(&b, "Download:       %d files, %s%s\n", s.DownloadFiles, FormatSize(s.DownloadBytes), unknown(s.DownloadUnknown))
+	fmt.Fprintf(&b, "Skip:           %d unchanged files, %s%s\n", s.SkipFiles, FormatSize(s.SkipBytes), unknown(s.SkipUnknown))
+	fmt.Fprintf(&b, "Delete:         %d files, %s\n", s.DeleteFiles, FormatSize(s.DeleteBytes))
+	fmt.Fprintf(&b, "Requests:       %d LIST, %d GET, %d HEAD\n", s.Requests.List, s.Requests.Get, s.Requests.Head)
+	fmt.Fprintf(&b, "Estimated cost: $%.4f ($%.4f requests, $%.4f data transfer)\n", s.Cost.Total, s.Cost.Requests, s.Cost.Transfer)
+	if s.DownloadUnknown > 0 {
+		fmt.Fprintf(&b, "                The data transfer of %d files of unknown size is not included\n", s.DownloadUnknown)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// unknown describes the files of unknown size a total leaves out, if any
+func unknown(files int) string {
+	if files == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" and %d files of unknown size", files)
+}
+
+// FormatSize formats a number of bytes with a binary unit, e.g. 1.5 GiB. Negative sizes are unknown.
+func FormatSize(bytes int64) string {
+	if bytes < 0 {
+		return "unknown size"
+	}
+	if bytes < 1024 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	size := float64(bytes)
+	for _, unit := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		size /= 1024
+		if size < 1024 || unit == "TiB" {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for name, expected := range map[string]Format{"": FormatText, "text": FormatText, "json": FormatJSON} {
+		if format, err := ParseFormat(name); err != nil || format != expected {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", name, format, err, expected)
+		}
+	}
+	if _, err := ParseFormat("yaml"); err == nil {
+		t.Error("ParseFormat(yaml) did not fail")
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		-1:            "unknown size",
+		0:             "0 B",
+		1023:          "1023 B",
+		1536:          "1.5 KiB",
+		5 * (1 << 30): "5.0 GiB",
+		3 << 50:       "3072.0 TiB",
+	}
+	for size, expected := range tests {
+		if got := FormatSize(size); got != expected {
+			t.Errorf("FormatSize(%d) = %q, want %q", size, got, expected)
+		}
+	}
+}
+
+// newTestPlan returns a finished plan of two downloads of 1 GiB in total, a skip and a deletion
+func newTestPlan() *Plan {
+	p := &Plan{Sources: []string{"s3://test-bucket/logs/"}, Destination: "/data"}
+	p.AddDownload(Item{Source: "s3://test-bucket/logs/b.json", Path: "/data/logs/b.json", Size: 1<<30 - 1024}, 205, 1)
+	p.AddDownload(Item{Source: "s3://test-bucket/logs/a.json", Path: "/data/logs/a.json", Size: 1024}, 1, 1)
+	p.AddSkip(Item{Source: "s3://test-bucket/logs/c.json", Path: "/data/logs/c.json", Size: 10})
+	p.AddDelete(Item{Path: "/data/logs/gone.json", Size: 5})
+	p.AddListing(2500, 3)
+	p.Finish(Pricing{ListPer1000: 5, GetPer1000: 0.4, TransferPerGB: 0.09})
+	return p
+}
+
+func TestPlanFinish(t *testing.T) {
+	p := newTestPlan()
+	s := p.Summary
+	if s.DownloadFiles != 2 || s.DownloadBytes != 1<<30 || s.SkipFiles != 1 || s.SkipBytes != 10 || s.DeleteFiles != 1 || s.DeleteBytes != 5 {
+		t.Errorf("Finish() summary = %+v", s)
+	}
+	if s.Listed != 2500 || s.Requests != (Requests{List: 3, Get: 206, Head: 2}) {
+		t.Errorf("Finish() listed %d with requests %+v", s.Listed, s.Requests)
+	}
+	if p.Download[0].Path != "/data/logs/a.json" {
+		t.Errorf("Finish() did not sort the downloads: %v", p.Download)
+	}
+
+	// 3 LIST at $5 and 208 GET and HEAD at $0.4 per 1,000, 1 GiB at $0.09
+	cost := Cost{Requests: 0.015 + 0.0832, Transfer: 0.09}
+	cost.Total = cost.Requests + cost.Transfer
+	for _, pair := range [][2]float64{{s.Cost.Requests, cost.Requests}, {s.Cost.Transfer, cost.Transfer}, {s.Cost.Total, cost.Total}} {
+		if math.Abs(pair[0]-pair[1]) > 1e-9 {
+			t.Errorf("Finish() cost = %+v, want %+v", s.Cost, cost)
+			break
+		}
+	}
+}
+
+func TestPlanWrite(t *testing.T) {
+	p := newTestPlan()
+
+	var text bytes.Buffer
+	if err := p.Write(&text, FormatText); err != nil {
+		t.Fatalf("Write() returned unexpected error: %v", err)
+	}
+	for _, line := range []string{
+		"Plan for s3://test-bucket/logs/ to /data",
+		"  download /data/logs/a.json (1.0 KiB)",
+		"  delete   /data/logs/gone.json (5 B)",
+		"Download:       2 files, 1.0 GiB",
+		"Requests:       3 LIST, 206 GET, 2 HEAD",
+	} {
+		if !strings.Contains(text.String(), line+"\n") {
+			t.Errorf("Write() text is missing %q:\n%s", line, text.String())
+		}
+	}
+	// Skipped files are only counted in text, they would drown the changes
+	if strings.Contains(text.String(), "c.json") {
+		t.Errorf("Write() text lists the skipped file:\n%s", text.String())
+	}
+
+	var out bytes.Buffer
+	if err := p.Write(&out, FormatJSON); err != nil {
+		t.Fatalf("Write() returned unexpected error: %v", err)
+	}
+	var decoded struct {
+		Skip    []Item `json:"skip"`
+		Summary struct {
+			DownloadBytes int64 `json:"download_bytes"`
+			Cost          struct {
+				Total float64 `json:"total"`
+			} `json:"estimated_cost_usd"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Write() JSON doesn't decode: %v", err)
+	}
+	if len(decoded.Skip) != 1 || decoded.Summary.DownloadBytes != 1<<30 || decoded.Summary.Cost.Total == 0 {
+		t.Errorf("Write() JSON = %s", out.String())
+	}
+}
+
+func TestPlan_UnknownSize(t *testing.T) {
+	// Keys read from a file have no size
+	p := &Plan{Sources: []string{"s3://test-bucket/"}, Destination: "/data"}
+	p.AddDownload(Item{Source: "s3://test-bucket/a.json", Path: "/data/a.json", Size: -1}, 1, 1)
+	p.AddDownload(Item{Source: "s3://test-bucket/b.json", Path: "/data/b.json", Size: -1}, 1, 1)
+	p.AddDownload(Item{Source: "s3://test-bucket/c.json", Path: "/data/c.json", Size: 1 << 30}, 1, 1)
+	p.Finish(Pricing{TransferPerGB: 0.09})
+
+	s := p.Summary
+	if s.DownloadFiles != 3 || s.DownloadBytes != 1<<30 || s.DownloadUnknown != 2 {
+		t.Errorf("Finish() summary = %+v, want 3 files, 1 GiB and 2 of unknown size", s)
+	}
+	if math.Abs(s.Cost.Transfer-0.09) > 1e-9 {
+		t.Errorf("Finish() transfer cost = %v, want 0.09", s.Cost.Transfer)
+	}
+
+	var text bytes.Buffer
+	if err := p.Write(&text, FormatText); err != nil {
+		t.Fatalf("Write() returned unexpected error: %v", err)
+	}
+	for _, line := range []string{
+		"  download /data/a.json (unknown size)",
+		"Download:       3 files, 1.0 GiB and 2 files of unknown size",
+		"The data transfer of 2 files of unknown size is not included",
+	} {
+		if !strings.Contains(text.String(), line+"\n") {
+			t.Errorf("Write() text is missing %q:\n%s", line, text.String())
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+)
+
+// defaultMaxAttempts is used when a Policy doesn't set MaxAttempts
+const defaultMaxAttempts = 3
+
+// Policy describes how often and how fast failed S3 requests are retried.
+// The zero value makes 3 attempts without any delay between them.
+type Policy struct {
+	MaxAttempts int           // Attempts including the first one
+	BaseDelay   time.Duration // Delay before the first retry, doubled on every attempt
+	MaxDelay    time.Duration // Upper bound for the delay between attempts, 0 means no bound
+	Jitter      float64       // Fraction of the delay that is randomized, between 0 and 1
+	Retries     *atomic.Int64 // Counts the retries made with this policy, optional
+}
+
+// Attempts returns the number of attempts to make, including the first one
+func (p Policy) Attempts() int {
+	if p.MaxAttempts < 1 {
+		return defaultMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+// Delay returns how long to wait after the given failed attempt, starting at 1
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay <= math.MaxInt64/2; i++ {
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxDelay > 0 {
+		delay = min(delay, p.MaxDelay)
+	}
+
+	// Spread out retries of requests that failed at the same time, e.g. when throttled
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 && delay > 0 {
+		randomized := time.Duration(jitter * float64(delay))
+		delay = delay - randomized + rand.N(randomized+1)
+	}
+	return delay
+}
+
+// Retried records a retry in the policy's counter, if there is one
+func (p Policy) Retried() {
+	if p.Retries != nil {
+		p.Retries.Add(1)
+	}
+}
+
+// sleep waits between attempts, it is a variable so tests can skip the backoff
+var sleep = Sleep
+
+// Do calls fn with the number of the attempt, starting at 1, until it succeeds or the policy's attempts run out,
+// backing off between attempts. Failures that aren't Retryable end the attempts at once. failed is called with
+// every failure but those of a cancelled context, e.g. to log it, and may be nil.
+// Do returns the last failure, or the context's error once it is cancelled.
+func (p Policy) Do(ctx context.Context, fn func(attempt int) error, failed func(attempt int, err error)) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			return nil
+		}
+
+		// Don't retry when the run is cancelled
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if failed != nil {
+			failed(attempt, err)
+		}
+		if attempt >= p.Attempts() || !Retryable(err) {
+			return err
+		}
+
+		// Back off before trying again
+		if err := sleep(ctx, p.Delay(attempt)); err != nil {
+			return err
+		}
+		p.Retried()
+	}
+}
+
+// permanentError wraps a failure that trying again won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a failure as not Retryable, e.g. one to prepare a local file for the next attempt
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// permanentCodes are S3 error codes that won't go away by trying again
+var permanentCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AllAccessDisabled":     true,
+	"InvalidAccessKeyId":    true,
+	"SignatureDoesNotMatch": true,
+	"NoSuchBucket":          true,
+	"NoSuchKey":             true,
+	"InvalidObjectState":    true,
+	"PreconditionFailed":    true,
+	"InvalidRange":          true,
+}
+
+// Retryable reports whether a failed request is worth trying again.
+// Permission, not-found and other client errors fail fast, while throttling,
+// server errors and network failures are retried.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) && permanentCodes[apiErr.ErrorCode()] {
+		return false
+	}
+
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		status := respErr.HTTPStatusCode()
+		// Throttling and request timeouts are client errors that do go away
+		if status >= 400 && status < 500 && status != http.StatusTooManyRequests && status != http.StatusRequestTimeout {
+			return false
+		}
+	}
+
+	return true
+}
+
+// throttleCodes are S3 error codes telling the client to slow down
+var throttleCodes = map[string]bool{
+	"SlowDown":                 true,
+	"Throttling":               true,
+	"ThrottlingException":      true,
+	"RequestLimitExceeded":     true,
+	"TooManyRequestsException": true,
+	"RequestTimeout":           true,
+}
+
+// Throttled reports whether a request failed because S3 is overloaded, either by
+// telling the client to slow down or by timing out
+func Throttled(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) && throttleCodes[apiErr.ErrorCode()] {
+		return true
+	}
+
+	// A retryer whose retry tokens ran out after sustained throttling returns this instead of the last error
+	var quotaErr ratelimit.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		return true
+	}
+
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		status := respErr.HTTPStatusCode()
+		if status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests {
+			return true
+		}
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Sleep waits for the given duration unless the context is cancelled first
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
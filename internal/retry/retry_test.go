@@ -0,0 +1,234 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestPolicyAttempts(t *testing.T) {
+	if attempts := (Policy{}).Attempts(); attempts != 3 {
+		t.Errorf("Attempts() of the zero Policy = %d, want 3", attempts)
+	}
+	if attempts := (Policy{MaxAttempts: 7}).Attempts(); attempts != 7 {
+		t.Errorf("Attempts() = %d, want 7", attempts)
+	}
+}
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, want := range expected {
+		if got := policy.Delay(i + 1); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, want)
+		}
+	}
+
+	if delay := (Policy{}).Delay(5); delay != 0 {
+		t.Errorf("Delay() of the zero Policy = %v, want 0", delay)
+	}
+
+	// Unbounded delays must not overflow
+	if delay := (Policy{BaseDelay: time.Second}).Delay(100); delay <= 0 {
+		t.Errorf("Delay(100) without MaxDelay = %v, want a positive delay", delay)
+	}
+
+	// Jitter keeps the delay between (1-Jitter) and the full delay
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := policy.Delay(3); delay < 200*time.Millisecond || delay > 400*time.Millisecond {
+			t.Fatalf("Delay(3) with jitter = %v, want between 200ms and 400ms", delay)
+		}
+	}
+}
+
+func TestPolicyRetried(t *testing.T) {
+	// Without a counter this must be a no-op
+	Policy{}.Retried()
+
+	var retries atomic.Int64
+	policy := Policy{Retries: &retries}
+	policy.Retried()
+	policy.Retried()
+	if retries.Load() != 2 {
+		t.Errorf("Retries = %d, want 2", retries.Load())
+	}
+}
+
+// responseError builds an SDK error carrying an HTTP status, like the ones returned by S3 operations
+func responseError(status int) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      errors.New(http.StatusText(status)),
+		},
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"network error", errors.New("connection reset by peer"), true},
+		{"no such key", &types.NoSuchKey{}, false},
+		{"wrapped no such bucket", fmt.Errorf("listing: %w", &types.NoSuchBucket{}), false},
+		{"access denied", responseError(http.StatusForbidden), false},
+		{"not found", responseError(http.StatusNotFound), false},
+		{"throttled", responseError(http.StatusTooManyRequests), true},
+		{"slow down", responseError(http.StatusServiceUnavailable), true},
+		{"internal error", responseError(http.StatusInternalServerError), true},
+		{"cancelled", context.Canceled, false},
+		{"permanent", Permanent(errors.New("seek: bad file descriptor")), false},
+		{"no error", nil, false},
+	}
+
+	for _, tt := range tests {
+		if retryable := Retryable(tt.err); retryable != tt.retryable {
+			t.Errorf("Retryable(%s) = %v, want %v", tt.name, retryable, tt.retryable)
+		}
+	}
+}
+
+func TestThrottled(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		throttled bool
+	}{
+		{"slow down", &smithy.GenericAPIError{Code: "SlowDown"}, true},
+		{"service unavailable", responseError(http.StatusServiceUnavailable), true},
+		{"too many requests", responseError(http.StatusTooManyRequests), true},
+		{"deadline exceeded", fmt.Errorf("download: %w", context.DeadlineExceeded), true},
+		{"retry quota exceeded", fmt.Errorf("failed to get rate limit token, %w", ratelimit.QuotaExceededError{Available: 0, Requested: 5}), true},
+		{"internal error", responseError(http.StatusInternalServerError), false},
+		{"access denied", &smithy.GenericAPIError{Code: "AccessDenied"}, false},
+		{"cancelled", context.Canceled, false},
+		{"no error", nil, false},
+	}
+
+	for _, tt := range tests {
+		if throttled := Throttled(tt.err); throttled != tt.throttled {
+			t.Errorf("Throttled(%s) = %v, want %v", tt.name, throttled, tt.throttled)
+		}
+	}
+}
+
+func TestSleep(t *testing.T) {
+	if err := Sleep(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("Sleep() returned unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("Sleep() with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+// TestPolicyDo tests that failures are retried with growing delays and that permanent errors fail fast
+func TestPolicyDo(t *testing.T) {
+	origSleep := sleep
+	var delays []time.Duration
+	sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	defer func() { sleep = origSleep }()
+
+	transient := errors.New("connection reset by peer")
+	tests := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{"success", nil, 1, nil},
+		{"transient errors are retried", []error{transient, transient}, 3, nil},
+		{"attempts run out", []error{transient, transient, transient, transient, transient}, 4, transient},
+		{"missing object fails fast", []error{&types.NoSuchKey{}}, 1, &types.NoSuchKey{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delays = nil
+			var retries atomic.Int64
+			policy := Policy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: 3 * time.Second, Retries: &retries}
+
+			attempts := 0
+			var failures []int
+			err := policy.Do(context.Background(), func(attempt int) error {
+				attempts++
+				if attempt != attempts {
+					t.Errorf("fn() called with attempt %d, want %d", attempt, attempts)
+				}
+				if attempt <= len(tt.errs) {
+					return tt.errs[attempt-1]
+				}
+				return nil
+			}, func(attempt int, err error) {
+				failures = append(failures, attempt)
+			})
+
+			if tt.expectedErr == nil && err != nil {
+				t.Errorf("Do() returned unexpected error: %v", err)
+			}
+			if tt.expectedErr != nil && (err == nil || err.Error() != tt.expectedErr.Error()) {
+				t.Errorf("Do() error = %v, want %v", err, tt.expectedErr)
+			}
+			if attempts != tt.expectedAttempts {
+				t.Errorf("Do() made %d attempts, want %d", attempts, tt.expectedAttempts)
+			}
+			if failed := min(len(tt.errs), tt.expectedAttempts); len(failures) != failed {
+				t.Errorf("failed() called for attempts %v, want %d calls", failures, failed)
+			}
+
+			// Backoff grows between attempts, bounded by the maximum delay
+			if int64(len(delays)) != retries.Load() {
+				t.Errorf("backed off %d times, but counted %d retries", len(delays), retries.Load())
+			}
+			for i, delay := range delays {
+				if expected := min(time.Second<<i, 3*time.Second); delay != expected {
+					t.Errorf("delay %d = %v, want %v", i+1, delay, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyDo_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := Policy{MaxAttempts: 5}.Do(ctx, func(attempt int) error {
+		attempts++
+		cancel()
+		return errors.New("connection reset by peer")
+	}, func(attempt int, err error) {
+		t.Errorf("failed() called with %v after cancellation", err)
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want %v", err, context.Canceled)
+	}
+	if attempts != 1 {
+		t.Errorf("Do() made %d attempts after cancellation, want 1", attempts)
+	}
+}
@@ -0,0 +1,155 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultRegion signs requests when no region is configured or detected
+const defaultRegion = "us-east-1"
+
+// ClientOptions configure how clients connect to AWS S3 or an S3-compatible store such as MinIO, Ceph or R2
+type ClientOptions struct {
+	EndpointURL string // Replaces the AWS endpoints, e.g. https://minio.example.com:9000
+	PathStyle   bool   // Address buckets as endpoint/bucket instead of bucket.endpoint
+	Region      string // Skips detecting the bucket's region
+	NoVerifySSL bool   // Accept any TLS certificate
+	CABundle    string // PEM file with additional certificate authorities to trust
+
+	Profile              string // Shared config profile, instead of AWS_PROFILE or the default profile
+	RoleARN              string // Role to assume with the profile's credentials or a web identity token
+	ExternalID           string // Required by the role's trust policy, typically for third-party accounts
+	SessionName          string // Names the role session in CloudTrail, defaults to s3cpbp-<unix time>
+	MFASerial            string // MFA device whose code the role requires, asked for on standard input
+	WebIdentityTokenFile string // OIDC token to assume the role with instead of AWS credentials
+	NoSignRequest        bool   // Send anonymous requests, for public buckets
+}
+
+// NewClient creates an S3 client for a bucket. Unless a region is given, the bucket's region is detected with the
+// same credentials, falling back to the configured region for stores that don't implement GetBucketLocation.
+func NewClient(ctx context.Context, opts ClientOptions, bucket string) (*s3.Client, error) {
+	awsCfg, err := awsConfigs.load(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	region := opts.Region
+	if IsAccessPoint(bucket) {
+		// Access points carry their region, Multi-Region Access Points are signed for all regions
+		accessPoint, err := ParseAccessPoint(bucket)
+		if err != nil {
+			return nil, err
+		}
+		if region == "" {
+			region = accessPoint.Region
+		}
+		if region == "" {
+			region = awsCfg.Region
+		}
+		if region == "" {
+			region = defaultRegion
+		}
+	} else if region == "" {
+		if region, err = detectRegion(ctx, awsCfg, opts, bucket); err != nil {
+			return nil, err
+		}
+	}
+
+	awsCfg.Region = region
+	return s3.NewFromConfig(awsCfg, opts.apply, withoutRetries), nil
+}
+
+// withoutRetries leaves retrying to the retry policy of the run. The SDK would otherwise retry every request
+// underneath the policy, multiplying its attempts, ignoring its delays and hiding throttling from the
+// concurrency controller once its retry tokens run out.
+func withoutRetries(options *s3.Options) {
+	options.Retryer = aws.NopRetryer{}
+}
+
+// WithSDKRetries restores the SDK's standard retries for a request that is not made under the retry policy,
+// such as reading an inventory report
+func WithSDKRetries(options *s3.Options) {
+	options.Retryer = retry.NewStandard()
+}
+
+// detectRegion asks for the bucket's region with a temporary client, the result is cached for the run
+func detectRegion(ctx context.Context, awsCfg aws.Config, opts ClientOptions, bucket string) (string, error) {
+	fallback := awsCfg.Region
+	if fallback == "" {
+		fallback = defaultRegion
+	}
+
+	// HeadBucket and GetBucketLocation are answered in any region, the SDK retries them as they
+	// are made once per bucket outside of the retry policy
+	tempCfg := awsCfg.Copy()
+	tempCfg.Region = fallback
+	region, err := bucketRegions.Region(ctx, s3.NewFromConfig(tempCfg, opts.apply), bucket)
+	if err != nil {
+		// S3-compatible stores may not implement it, or not the way AWS does
+		if opts.EndpointURL == "" && !isNotImplemented(err) {
+			return "", err
+		}
+		log.Printf("Could not detect the region of bucket '%s', using '%s': %v", bucket, fallback, err)
+		return fallback, nil
+	}
+
+	log.Printf("Bucket '%s' is in region '%s'", bucket, region)
+	return region, nil
+}
+
+// apply sets the endpoint and addressing options of S3 clients
+func (o ClientOptions) apply(options *s3.Options) {
+	// Requests to an access point go to its region, whatever the client's region
+	options.UseARNRegion = true
+	options.UsePathStyle = options.UsePathStyle || o.PathStyle
+
+	if o.EndpointURL == "" {
+		return
+	}
+	options.BaseEndpoint = aws.String(o.EndpointURL)
+
+	// Many S3-compatible stores reject the checksum headers the SDK adds by default
+	options.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+	options.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+}
+
+// httpClient returns an HTTP client with the TLS options, or nil to use the SDK's default client
+func (o ClientOptions) httpClient() (*awshttp.BuildableClient, error) {
+	if !o.NoVerifySSL && o.CABundle == "" {
+		return nil, nil
+	}
+
+	var roots *x509.CertPool
+	if o.CABundle != "" {
+		pem, err := os.ReadFile(o.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		if roots, err = x509.SystemCertPool(); err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", o.CABundle)
+		}
+	}
+
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		tr.TLSClientConfig.InsecureSkipVerify = o.NoVerifySSL
+		if roots != nil {
+			tr.TLSClientConfig.RootCAs = roots
+		}
+	}), nil
+}
@@ -0,0 +1,230 @@
+package s3
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// isolateAWSConfig keeps the developer's AWS configuration out of a test
+func isolateAWSConfig(t *testing.T, region string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+	t.Setenv("AWS_REGION", region)
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ENDPOINT_URL_STS", "")
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	// Configurations are cached for the run, a test's environment must not leak into the next one
+	awsConfigs = &configCache{configs: map[ClientOptions]aws.Config{}}
+}
+
+// fakeStore is an S3-compatible store that doesn't implement GetBucketLocation
+type fakeStore struct {
+	mu          sync.Mutex
+	paths       []string
+	credentials []string // Access key of each request, empty if unsigned
+}
+
+func (f *fakeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, credential, _ := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+	accessKey, _, _ := strings.Cut(credential, "/")
+	f.mu.Lock()
+	f.paths = append(f.paths, r.URL.Path)
+	f.credentials = append(f.credentials, accessKey)
+	f.mu.Unlock()
+
+	if _, ok := r.URL.Query()["location"]; ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NotImplemented</Code><Message>Not implemented</Message></Error>`))
+		return
+	}
+	w.Header().Set("Content-Length", "5")
+	w.Header().Set("ETag", `"abc"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestNewClient_Endpoint(t *testing.T) {
+	store := &fakeStore{}
+	server := httptest.NewTLSServer(store)
+	defer server.Close()
+
+	// Trust the server's self-signed certificate through a CA bundle
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, certPEM, 0644); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		opts           ClientOptions
+		expectedRegion string
+		expectError    bool
+	}{
+		{
+			name:           "detection not implemented falls back to the configured region",
+			opts:           ClientOptions{EndpointURL: server.URL, PathStyle: true, CABundle: bundle},
+			expectedRegion: "eu-central-1",
+		},
+		{
+			name:           "given region skips detection",
+			opts:           ClientOptions{EndpointURL: server.URL, PathStyle: true, Region: "minio-local", NoVerifySSL: true},
+			expectedRegion: "minio-local",
+		},
+		{
+			name:        "untrusted certificate",
+			opts:        ClientOptions{EndpointURL: server.URL, PathStyle: true, Region: "us-east-1"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateAWSConfig(t, "eu-central-1")
+			store.paths = nil
+
+			client, err := NewClient(context.Background(), tt.opts, "test-bucket")
+			if err != nil {
+				t.Fatalf("NewClient() returned unexpected error: %v", err)
+			}
+			if region := client.Options().Region; !tt.expectError && region != tt.expectedRegion {
+				t.Errorf("NewClient() region = %q, want %q", region, tt.expectedRegion)
+			}
+
+			_, err = client.HeadObject(context.Background(), &s3.HeadObjectInput{
+				Bucket: aws.String("test-bucket"),
+				Key:    aws.String("a.json"),
+			}, func(o *s3.Options) { o.RetryMaxAttempts = 1 })
+			if tt.expectError {
+				if err == nil {
+					t.Error("HeadObject() succeeded with an untrusted certificate")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HeadObject() returned unexpected error: %v", err)
+			}
+
+			// Path-style requests name the bucket in the path
+			last := store.paths[len(store.paths)-1]
+			if last != "/test-bucket/a.json" {
+				t.Errorf("HeadObject() requested %q, want %q", last, "/test-bucket/a.json")
+			}
+		})
+	}
+}
+
+func TestClientOptionsApply_PathStyle(t *testing.T) {
+	// Path-style addressing also applies to AWS itself, e.g. for bucket names with dots
+	var options s3.Options
+	ClientOptions{PathStyle: true}.apply(&options)
+	if !options.UsePathStyle {
+		t.Error("apply() UsePathStyle = false without an endpoint URL, want true")
+	}
+	if options.BaseEndpoint != nil {
+		t.Errorf("apply() BaseEndpoint = %q, want unset", aws.ToString(options.BaseEndpoint))
+	}
+}
+
+func TestNewClient_InvalidCABundle(t *testing.T) {
+	isolateAWSConfig(t, "us-east-1")
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+
+	for _, path := range []string{bundle, filepath.Join(t.TempDir(), "missing.pem")} {
+		opts := ClientOptions{EndpointURL: "https://localhost:9000", CABundle: path, Region: "us-east-1"}
+		if _, err := NewClient(context.Background(), opts, "test-bucket"); err == nil {
+			t.Errorf("NewClient() with CA bundle %s did not fail", path)
+		}
+	}
+}
+
+func TestNewClient_AccessPoint(t *testing.T) {
+	tests := []struct {
+		name           string
+		bucket         string
+		opts           ClientOptions
+		expectedRegion string
+	}{
+		{
+			name:           "access point region",
+			bucket:         "arn:aws:s3:ap-southeast-2:123456789012:accesspoint/my-ap",
+			expectedRegion: "ap-southeast-2",
+		},
+		{
+			name:           "multi-region access point uses the configured region",
+			bucket:         "arn:aws:s3::123456789012:accesspoint/mfzwi23gnjvgw.mrap",
+			expectedRegion: "eu-central-1",
+		},
+		{
+			name:           "given region",
+			bucket:         "arn:aws:s3::123456789012:accesspoint/mfzwi23gnjvgw.mrap",
+			opts:           ClientOptions{Region: "us-west-2"},
+			expectedRegion: "us-west-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateAWSConfig(t, "eu-central-1")
+			client, err := NewClient(context.Background(), tt.opts, tt.bucket)
+			if err != nil {
+				t.Fatalf("NewClient() returned unexpected error: %v", err)
+			}
+			if region := client.Options().Region; region != tt.expectedRegion {
+				t.Errorf("NewClient() region = %q, want %q", region, tt.expectedRegion)
+			}
+			if !client.Options().UseARNRegion {
+				t.Error("NewClient() does not use the access point's region")
+			}
+		})
+	}
+}
+
+func TestNewClient_NoSDKRetries(t *testing.T) {
+	isolateAWSConfig(t, "us-east-1")
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(context.Background(), ClientOptions{EndpointURL: server.URL, PathStyle: true, Region: "us-east-1"}, "test-bucket")
+	if err != nil {
+		t.Fatalf("NewClient() returned unexpected error: %v", err)
+	}
+
+	// The retry policy owns retries, a throttled request must come back after a single attempt
+	_, err = client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("a.json"),
+	})
+	if err == nil {
+		t.Fatal("HeadObject() succeeded against a throttling store")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("HeadObject() made %d requests, want 1", n)
+	}
+}
@@ -0,0 +1,114 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// mfaTokenProvider asks for the MFA code when assuming a role that requires one
+var mfaTokenProvider = stscreds.StdinTokenProvider
+
+// mfaPrompt serializes MFA prompts, a role assumed through a profile and --role-arn may both ask for a code
+var mfaPrompt sync.Mutex
+
+func promptMFA() (string, error) {
+	mfaPrompt.Lock()
+	defer mfaPrompt.Unlock()
+	return mfaTokenProvider()
+}
+
+// configCache holds the AWS configuration loaded for each set of options, so that the clients of all buckets
+// share one credentials cache: roles are assumed and MFA codes asked for once per run, not once per client
+type configCache struct {
+	mu      sync.Mutex
+	configs map[ClientOptions]aws.Config
+}
+
+// awsConfigs is shared by all clients of a run
+var awsConfigs = &configCache{configs: map[ClientOptions]aws.Config{}}
+
+// load returns the configuration for the options, loading it on first use. Only successes are cached.
+func (c *configCache) load(ctx context.Context, opts ClientOptions) (aws.Config, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if awsCfg, ok := c.configs[opts]; ok {
+		return awsCfg, nil
+	}
+
+	awsCfg, err := loadConfig(ctx, opts)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	c.configs[opts] = awsCfg
+	return awsCfg, nil
+}
+
+// loadConfig loads the AWS configuration with the profile, role and TLS options
+func loadConfig(ctx context.Context, opts ClientOptions) (aws.Config, error) {
+	// Profiles that assume a role with an mfa_serial prompt for the code as well
+	loadOptions := []func(*config.LoadOptions) error{
+		config.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) { o.TokenProvider = promptMFA }),
+	}
+	httpClient, err := opts.httpClient()
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if httpClient != nil {
+		loadOptions = append(loadOptions, config.WithHTTPClient(httpClient))
+	}
+	if opts.Profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(opts.Profile))
+	}
+	if opts.NoSignRequest {
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(aws.AnonymousCredentials{}))
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if opts.RoleARN != "" {
+		awsCfg.Credentials = opts.roleCredentials(awsCfg)
+	}
+	return awsCfg, nil
+}
+
+// roleCredentials assumes the role with the configuration's credentials, or with a web identity token
+func (o ClientOptions) roleCredentials(awsCfg aws.Config) aws.CredentialsProvider {
+	stsCfg := awsCfg.Copy()
+	if stsCfg.Region == "" {
+		stsCfg.Region = defaultRegion
+	}
+	client := sts.NewFromConfig(stsCfg)
+
+	sessionName := o.SessionName
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("s3cpbp-%d", time.Now().Unix())
+	}
+
+	if o.WebIdentityTokenFile != "" {
+		return aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(client, o.RoleARN,
+			stscreds.IdentityTokenFile(o.WebIdentityTokenFile), func(wo *stscreds.WebIdentityRoleOptions) {
+				wo.RoleSessionName = sessionName
+			}))
+	}
+	return aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(client, o.RoleARN, func(ao *stscreds.AssumeRoleOptions) {
+		ao.RoleSessionName = sessionName
+		// The longest session every role allows, so that long runs ask for fewer MFA codes
+		ao.Duration = time.Hour
+		if o.ExternalID != "" {
+			ao.ExternalID = aws.String(o.ExternalID)
+		}
+		if o.MFASerial != "" {
+			ao.SerialNumber = aws.String(o.MFASerial)
+			ao.TokenProvider = promptMFA
+		}
+	}))
+}
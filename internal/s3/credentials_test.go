@@ -0,0 +1,184 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeSTS answers AssumeRole and AssumeRoleWithWebIdentity with fixed credentials
+type fakeSTS struct {
+	mu       sync.Mutex
+	requests []map[string]string // Form values of each request
+}
+
+func (f *fakeSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	params := map[string]string{}
+	for key := range r.PostForm {
+		params[key] = r.PostForm.Get(key)
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, params)
+	f.mu.Unlock()
+
+	action := params["Action"]
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><%[1]sResult>
+<Credentials><AccessKeyId>ASIAROLE</AccessKeyId><SecretAccessKey>role-secret</SecretAccessKey><SessionToken>role-token</SessionToken><Expiration>2099-01-01T00:00:00Z</Expiration></Credentials>
+<AssumedRoleUser><Arn>arn:aws:sts::123456789012:assumed-role/reader/s</Arn><AssumedRoleId>AROAEXAMPLE:s</AssumedRoleId></AssumedRoleUser>
+</%[1]sResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></%[1]sResponse>`, action)
+}
+
+func TestNewClient_Credentials(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("oidc-token"), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	tests := []struct {
+		name               string
+		opts               ClientOptions
+		expectedAccessKey  string
+		expectedSTS        map[string]string // Expected form values of the single STS request, nil for none
+		expectedMFAPrompts int
+	}{
+		{
+			name:              "default credentials",
+			expectedAccessKey: "test-key",
+		},
+		{
+			name:              "anonymous",
+			opts:              ClientOptions{NoSignRequest: true},
+			expectedAccessKey: "",
+		},
+		{
+			name:              "assume role with external ID and MFA",
+			opts:              ClientOptions{RoleARN: "arn:aws:iam::123456789012:role/reader", ExternalID: "ext-1", SessionName: "nightly", MFASerial: "arn:aws:iam::111111111111:mfa/me"},
+			expectedAccessKey: "ASIAROLE",
+			expectedSTS: map[string]string{
+				"Action": "AssumeRole", "RoleArn": "arn:aws:iam::123456789012:role/reader", "ExternalId": "ext-1",
+				"RoleSessionName": "nightly", "SerialNumber": "arn:aws:iam::111111111111:mfa/me", "TokenCode": "123456",
+				"DurationSeconds": "3600",
+			},
+			expectedMFAPrompts: 1,
+		},
+		{
+			name:              "web identity",
+			opts:              ClientOptions{RoleARN: "arn:aws:iam::123456789012:role/reader", SessionName: "ci", WebIdentityTokenFile: tokenFile},
+			expectedAccessKey: "ASIAROLE",
+			expectedSTS: map[string]string{
+				"Action": "AssumeRoleWithWebIdentity", "RoleArn": "arn:aws:iam::123456789012:role/reader",
+				"RoleSessionName": "ci", "WebIdentityToken": "oidc-token",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateAWSConfig(t, "eu-central-1")
+			sts := &fakeSTS{}
+			stsServer := httptest.NewServer(sts)
+			defer stsServer.Close()
+			t.Setenv("AWS_ENDPOINT_URL_STS", stsServer.URL)
+			store := &fakeStore{}
+			server := httptest.NewServer(store)
+			defer server.Close()
+
+			prompts := 0
+			origProvider := mfaTokenProvider
+			defer func() { mfaTokenProvider = origProvider }()
+			mfaTokenProvider = func() (string, error) {
+				prompts++
+				return "123456", nil
+			}
+
+			// Clients of two buckets detect their regions and send a request each, all with the same credentials
+			tt.opts.EndpointURL = server.URL
+			tt.opts.PathStyle = true
+			for _, bucket := range []string{"bucket-a", "bucket-b"} {
+				client, err := NewClient(context.Background(), tt.opts, bucket)
+				if err != nil {
+					t.Fatalf("NewClient() returned unexpected error: %v", err)
+				}
+				if _, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{
+					Bucket: aws.String(bucket),
+					Key:    aws.String("a.json"),
+				}); err != nil {
+					t.Fatalf("HeadObject() returned unexpected error: %v", err)
+				}
+			}
+
+			// HeadBucket and GetBucketLocation to detect the region, then HeadObject, for each client
+			if len(store.credentials) != 6 {
+				t.Fatalf("store received %d requests, want 6", len(store.credentials))
+			}
+			for i, accessKey := range store.credentials {
+				if accessKey != tt.expectedAccessKey {
+					t.Errorf("request %d to %s signed with %q, want %q", i, store.paths[i], accessKey, tt.expectedAccessKey)
+				}
+			}
+
+			if tt.expectedSTS == nil {
+				if len(sts.requests) != 0 {
+					t.Errorf("STS received %d requests, want none", len(sts.requests))
+				}
+			} else {
+				if len(sts.requests) != 1 {
+					t.Fatalf("STS received %d requests, want the role assumed once", len(sts.requests))
+				}
+				for key, expected := range tt.expectedSTS {
+					if got := sts.requests[0][key]; got != expected {
+						t.Errorf("STS %s = %q, want %q", key, got, expected)
+					}
+				}
+			}
+			if prompts != tt.expectedMFAPrompts {
+				t.Errorf("MFA code asked for %d times, want %d", prompts, tt.expectedMFAPrompts)
+			}
+		})
+	}
+}
+
+func TestNewClient_Profile(t *testing.T) {
+	isolateAWSConfig(t, "")
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	credentialsFile := filepath.Join(dir, "credentials")
+	os.WriteFile(configFile, []byte("[profile pull]\nregion = ap-northeast-1\n"), 0600)
+	os.WriteFile(credentialsFile, []byte("[pull]\naws_access_key_id = AKIAPULL\naws_secret_access_key = pull-secret\n"), 0600)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	client, err := NewClient(context.Background(), ClientOptions{Profile: "pull", Region: "us-west-2"}, "test-bucket")
+	if err != nil {
+		t.Fatalf("NewClient() returned unexpected error: %v", err)
+	}
+	credentials, err := client.Options().Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() returned unexpected error: %v", err)
+	}
+	if credentials.AccessKeyID != "AKIAPULL" {
+		t.Errorf("credentials of profile = %q, want AKIAPULL", credentials.AccessKeyID)
+	}
+
+	if _, err := NewClient(context.Background(), ClientOptions{Profile: "missing", Region: "us-west-2"}, "test-bucket"); err == nil {
+		t.Error("NewClient() with a missing profile did not fail")
+	}
+	if len(awsConfigs.configs) != 1 {
+		t.Errorf("cached %d configurations, want only the successful one", len(awsConfigs.configs))
+	}
+}
@@ -2,11 +2,13 @@ package s3
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/user/s3cpbp/internal/retry"
 )
 
 // S3ListObjectsAPI defines the interface for the ListObjectsV2 operation
@@ -15,25 +17,70 @@ type S3ListObjectsAPI interface {
 }
 
 // ListFiles lists files from S3 bucket with the given prefix
-// and sends them to the provided channel
-func ListFiles(client S3ListObjectsAPI, bucket, prefix string, foundFilesChan chan<- string, totalFiles *atomic.Int64) {
+// and sends their metadata to the provided channel.
+// Objects for which include returns false are dropped before they are sent or counted,
+// a nil include keeps every object.
+// Failed pages are retried according to the policy, resuming from the last continuation token.
+// An error is returned if a page cannot be listed or the context is cancelled,
+// in which case the object set is incomplete.
+func ListFiles(ctx context.Context, client S3ListObjectsAPI, bucket, prefix string, policy retry.Policy, include func(ObjectInfo) bool, foundFilesChan chan<- ObjectInfo, totalFiles *atomic.Int64) error {
 	defer close(foundFilesChan)
 
-	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(bucket),
 		Prefix: aws.String(prefix),
-	})
+	}
+	return listPages(ctx, client, input, policy, include, foundFilesChan, totalFiles, nil)
+}
 
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(context.TODO())
+// listPages lists every page of the input, sending the included objects to the channel.
+// When the input has a delimiter, commonPrefix is called for each common prefix found.
+func listPages(ctx context.Context, client S3ListObjectsAPI, input *s3.ListObjectsV2Input, policy retry.Policy, include func(ObjectInfo) bool, foundFilesChan chan<- ObjectInfo, totalFiles *atomic.Int64, commonPrefix func(string)) error {
+	for {
+		page, err := listPage(ctx, client, input, policy)
 		if err != nil {
-			log.Printf("Error listing objects: %v", err)
-			return
+			return fmt.Errorf("listing s3://%s/%s: %w", aws.ToString(input.Bucket), aws.ToString(input.Prefix), err)
 		}
 
 		for _, obj := range page.Contents {
-			totalFiles.Add(1)
-			foundFilesChan <- *obj.Key
+			info := NewObjectInfo(obj)
+			if include != nil && !include(info) {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case foundFilesChan <- info:
+				totalFiles.Add(1)
+			}
+		}
+
+		if commonPrefix != nil {
+			for _, p := range page.CommonPrefixes {
+				commonPrefix(aws.ToString(p.Prefix))
+			}
 		}
+
+		if !aws.ToBool(page.IsTruncated) || aws.ToString(page.NextContinuationToken) == "" {
+			return nil
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+}
+
+// listPage fetches a single page of results, retrying transient failures
+func listPage(ctx context.Context, client S3ListObjectsAPI, input *s3.ListObjectsV2Input, policy retry.Policy) (*s3.ListObjectsV2Output, error) {
+	var page *s3.ListObjectsV2Output
+	err := policy.Do(ctx, func(attempt int) error {
+		var err error
+		page, err = client.ListObjectsV2(ctx, input)
+		return err
+	}, func(attempt int, err error) {
+		log.Printf("Attempt %d: Failed to list objects (continuation token %q): %v", attempt, aws.ToString(input.ContinuationToken), err)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return page, nil
 }
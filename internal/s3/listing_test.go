@@ -2,25 +2,49 @@ package s3
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/user/s3cpbp/internal/retry"
 )
 
+// testPolicy retries like a typical configuration without the delays, backing off is tested with retry.Policy.Do
+var testPolicy = retry.Policy{MaxAttempts: 5}
+
 // mockS3Client implements S3ListObjectsAPI interface for testing
 type mockS3Client struct {
 	// Pages to return, in order
 	pages []*s3.ListObjectsV2Output
 	// Current page index
 	currentPage int
+	// Errors to return, keyed by call number (starting at 0)
+	errs map[int]error
+	// Number of ListObjectsV2 calls made
+	calls int
+	// Continuation tokens received, in call order
+	tokens []string
 }
 
 // ListObjectsV2 implements the S3ListObjectsAPI interface
 func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	call := m.calls
+	m.calls++
+	m.tokens = append(m.tokens, aws.ToString(params.ContinuationToken))
+
+	if err, ok := m.errs[call]; ok {
+		return nil, err
+	}
+
 	if m.currentPage >= len(m.pages) {
 		return &s3.ListObjectsV2Output{Contents: []types.Object{}}, nil
 	}
@@ -49,18 +73,6 @@ func (m *mockPaginator) NextPage(ctx context.Context, optFns ...func(*s3.Options
 	return response, nil
 }
 
-// mockListFilesImpl is a function that replaces the standard ListFiles implementation for testing
-func mockListFilesImpl(pages []*s3.ListObjectsV2Output, foundFilesChan chan<- string, totalFiles *atomic.Int64) {
-	defer close(foundFilesChan)
-
-	for _, page := range pages {
-		for _, obj := range page.Contents {
-			totalFiles.Add(1)
-			foundFilesChan <- *obj.Key
-		}
-	}
-}
-
 // TestListFiles tests the ListFiles function
 func TestListFiles(t *testing.T) {
 	tests := []struct {
@@ -139,7 +151,7 @@ func TestListFiles(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create a channel to receive files
-			filesChan := make(chan string, len(tt.expectedFiles)+1)
+			filesChan := make(chan ObjectInfo, len(tt.expectedFiles)+1)
 
 			// Create a counter for total files
 			var totalFiles atomic.Int64
@@ -150,12 +162,15 @@ func TestListFiles(t *testing.T) {
 			}
 
 			// Call the actual ListFiles function with our mock client
-			go ListFiles(mockClient, tt.bucket, tt.prefix, filesChan, &totalFiles)
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- ListFiles(context.Background(), mockClient, tt.bucket, tt.prefix, testPolicy, nil, filesChan, &totalFiles)
+			}()
 
 			// Collect all files from the channel
 			var files []string
-			for file := range filesChan {
-				files = append(files, file)
+			for obj := range filesChan {
+				files = append(files, obj.Key)
 			}
 
 			// Verify the results
@@ -179,6 +194,218 @@ func TestListFiles(t *testing.T) {
 			if count := totalFiles.Load(); count != tt.expectedTotal {
 				t.Errorf("ListFiles() total count = %d, want %d", count, tt.expectedTotal)
 			}
+
+			if err := <-errChan; err != nil {
+				t.Errorf("ListFiles() returned unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestListFiles_PageErrors tests retrying and failing in the middle of pagination
+func TestListFiles_PageErrors(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	pages := []*s3.ListObjectsV2Output{
+		{
+			Contents: []types.Object{
+				{Key: aws.String("test-prefix/file1.txt")},
+				{Key: aws.String("test-prefix/file2.txt")},
+			},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("token-2"),
+		},
+		{
+			Contents: []types.Object{
+				{Key: aws.String("test-prefix/file3.txt")},
+			},
+			IsTruncated: aws.Bool(false),
+		},
+	}
+
+	transientErr := errors.New("connection reset by peer")
+	permanentErr := &types.NoSuchBucket{Message: aws.String("The specified bucket does not exist")}
+
+	tests := []struct {
+		name          string
+		errs          map[int]error
+		expectedTotal int64
+		expectedCalls int
+		expectError   bool
+		expectedErr   error
+	}{
+		{
+			name:          "transient error on second page is retried",
+			errs:          map[int]error{1: transientErr, 2: transientErr},
+			expectedTotal: 3,
+			expectedCalls: 4,
+			expectError:   false,
+		},
+		{
+			name:          "persistent error on second page fails the listing",
+			errs:          map[int]error{1: transientErr, 2: transientErr, 3: transientErr, 4: transientErr, 5: transientErr},
+			expectedTotal: 2,
+			expectedCalls: 1 + testPolicy.MaxAttempts,
+			expectError:   true,
+		},
+		{
+			name:          "permanent error on second page fails without retrying",
+			errs:          map[int]error{1: permanentErr},
+			expectedTotal: 2,
+			expectedCalls: 2,
+			expectError:   true,
+			expectedErr:   permanentErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filesChan := make(chan ObjectInfo, 10)
+			var totalFiles atomic.Int64
+
+			mockClient := &mockS3Client{
+				pages: pages,
+				errs:  tt.errs,
+			}
+
+			err := ListFiles(context.Background(), mockClient, "test-bucket", "test-prefix", testPolicy, nil, filesChan, &totalFiles)
+
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ListFiles() error = %v, expectError %v", err, tt.expectError)
+			}
+			expectedErr := tt.expectedErr
+			if expectedErr == nil {
+				expectedErr = transientErr
+			}
+			if tt.expectError && !errors.Is(err, expectedErr) {
+				t.Errorf("ListFiles() error = %v, want wrapped %v", err, expectedErr)
+			}
+
+			// The channel must be closed even when listing fails
+			var files []string
+			for obj := range filesChan {
+				files = append(files, obj.Key)
+			}
+			if int64(len(files)) != tt.expectedTotal || totalFiles.Load() != tt.expectedTotal {
+				t.Errorf("ListFiles() sent %d files (total %d), want %d", len(files), totalFiles.Load(), tt.expectedTotal)
+			}
+
+			if mockClient.calls != tt.expectedCalls {
+				t.Errorf("ListObjectsV2 called %d times, want %d", mockClient.calls, tt.expectedCalls)
+			}
+
+			// Every retry must resume from the continuation token of the failed page
+			for i, token := range mockClient.tokens[1:] {
+				if token != "token-2" {
+					t.Errorf("call %d used continuation token %q, want %q", i+1, token, "token-2")
+				}
+			}
 		})
 	}
 }
+
+// TestListFiles_Cancelled tests that listing stops when the context is cancelled
+func TestListFiles_Cancelled(t *testing.T) {
+	mockClient := &mockS3Client{
+		pages: []*s3.ListObjectsV2Output{
+			{
+				Contents: []types.Object{
+					{Key: aws.String("test-prefix/file1.txt")},
+					{Key: aws.String("test-prefix/file2.txt")},
+				},
+				IsTruncated: aws.Bool(false),
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Unbuffered and never read, so listing can only return through cancellation
+	filesChan := make(chan ObjectInfo)
+	var totalFiles atomic.Int64
+
+	err := ListFiles(ctx, mockClient, "test-bucket", "test-prefix", testPolicy, nil, filesChan, &totalFiles)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ListFiles() error = %v, want %v", err, context.Canceled)
+	}
+	if _, ok := <-filesChan; ok {
+		t.Error("ListFiles() did not close the channel")
+	}
+	if totalFiles.Load() != 0 {
+		t.Errorf("ListFiles() total count = %d, want 0", totalFiles.Load())
+	}
+}
+
+// TestListFiles_Metadata tests that object metadata from the listing reaches the channel
+func TestListFiles_Metadata(t *testing.T) {
+	modified := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	mockClient := &mockS3Client{
+		pages: []*s3.ListObjectsV2Output{
+			{
+				Contents: []types.Object{
+					{
+						Key:               aws.String("test-prefix/file1.txt"),
+						Size:              aws.Int64(42),
+						ETag:              aws.String(`"etag"`),
+						LastModified:      aws.Time(modified),
+						StorageClass:      types.ObjectStorageClassGlacierIr,
+						ChecksumAlgorithm: []types.ChecksumAlgorithm{types.ChecksumAlgorithmSha256},
+					},
+				},
+				IsTruncated: aws.Bool(false),
+			},
+		},
+	}
+
+	filesChan := make(chan ObjectInfo, 1)
+	var totalFiles atomic.Int64
+	if err := ListFiles(context.Background(), mockClient, "test-bucket", "test-prefix", testPolicy, nil, filesChan, &totalFiles); err != nil {
+		t.Fatalf("ListFiles() returned unexpected error: %v", err)
+	}
+
+	obj := <-filesChan
+	if obj.Key != "test-prefix/file1.txt" || obj.Size != 42 || obj.ETag != "etag" ||
+		!obj.LastModified.Equal(modified) || obj.StorageClass != types.ObjectStorageClassGlacierIr ||
+		len(obj.ChecksumAlgorithms) != 1 {
+		t.Errorf("ListFiles() sent %+v, metadata was not carried over", obj)
+	}
+}
+
+// TestListFiles_Filter tests that excluded objects are neither sent nor counted
+func TestListFiles_Filter(t *testing.T) {
+	mockClient := &mockS3Client{
+		pages: []*s3.ListObjectsV2Output{
+			{
+				Contents: []types.Object{
+					{Key: aws.String("test-prefix/part-0.parquet")},
+					{Key: aws.String("test-prefix/part-0.parquet.crc")},
+					{Key: aws.String("test-prefix/part-1.parquet")},
+				},
+				IsTruncated: aws.Bool(false),
+			},
+		},
+	}
+
+	include := func(obj ObjectInfo) bool {
+		return !strings.HasSuffix(obj.Key, ".crc")
+	}
+
+	filesChan := make(chan ObjectInfo, 3)
+	var totalFiles atomic.Int64
+	if err := ListFiles(context.Background(), mockClient, "test-bucket", "test-prefix", testPolicy, include, filesChan, &totalFiles); err != nil {
+		t.Fatalf("ListFiles() returned unexpected error: %v", err)
+	}
+
+	var files []string
+	for obj := range filesChan {
+		files = append(files, obj.Key)
+	}
+	if len(files) != 2 || files[0] != "test-prefix/part-0.parquet" || files[1] != "test-prefix/part-1.parquet" {
+		t.Errorf("ListFiles() sent %v, want only the parquet files", files)
+	}
+	if totalFiles.Load() != 2 {
+		t.Errorf("ListFiles() total count = %d, want 2", totalFiles.Load())
+	}
+}
@@ -0,0 +1,40 @@
+package s3
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// UnknownSize is the Size of objects whose size the source doesn't know, like keys read from a manifest
+const UnknownSize = -1
+
+// ObjectInfo describes an S3 object as returned by listing,
+// so workers know what they are about to download without extra HEAD requests
+type ObjectInfo struct {
+	Key                string
+	Size               int64  // UnknownSize if not known
+	ETag               string // Without the surrounding quotes
+	LastModified       time.Time
+	StorageClass       types.ObjectStorageClass
+	ChecksumAlgorithms []types.ChecksumAlgorithm
+}
+
+// NewObjectInfo converts an object from a ListObjectsV2 response into an ObjectInfo
+func NewObjectInfo(obj types.Object) ObjectInfo {
+	return ObjectInfo{
+		Key:                aws.ToString(obj.Key),
+		Size:               aws.ToInt64(obj.Size),
+		ETag:               strings.Trim(aws.ToString(obj.ETag), `"`),
+		LastModified:       aws.ToTime(obj.LastModified),
+		StorageClass:       obj.StorageClass,
+		ChecksumAlgorithms: obj.ChecksumAlgorithm,
+	}
+}
+
+// IsMultipart reports whether the object was uploaded in parts, judging by its ETag
+func (o ObjectInfo) IsMultipart() bool {
+	return strings.Contains(o.ETag, "-")
+}
@@ -0,0 +1,50 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestNewObjectInfo(t *testing.T) {
+	modified := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	info := NewObjectInfo(types.Object{
+		Key:               aws.String("prefix/file.bin"),
+		Size:              aws.Int64(1024),
+		ETag:              aws.String(`"d41d8cd98f00b204e9800998ecf8427e-3"`),
+		LastModified:      aws.Time(modified),
+		StorageClass:      types.ObjectStorageClassStandardIa,
+		ChecksumAlgorithm: []types.ChecksumAlgorithm{types.ChecksumAlgorithmCrc32c},
+	})
+
+	if info.Key != "prefix/file.bin" {
+		t.Errorf("Key = %q, want %q", info.Key, "prefix/file.bin")
+	}
+	if info.Size != 1024 {
+		t.Errorf("Size = %d, want 1024", info.Size)
+	}
+	if info.ETag != "d41d8cd98f00b204e9800998ecf8427e-3" {
+		t.Errorf("ETag = %q, want it without quotes", info.ETag)
+	}
+	if !info.LastModified.Equal(modified) {
+		t.Errorf("LastModified = %v, want %v", info.LastModified, modified)
+	}
+	if info.StorageClass != types.ObjectStorageClassStandardIa {
+		t.Errorf("StorageClass = %q, want %q", info.StorageClass, types.ObjectStorageClassStandardIa)
+	}
+	if len(info.ChecksumAlgorithms) != 1 || info.ChecksumAlgorithms[0] != types.ChecksumAlgorithmCrc32c {
+		t.Errorf("ChecksumAlgorithms = %v, want [CRC32C]", info.ChecksumAlgorithms)
+	}
+	if !info.IsMultipart() {
+		t.Error("IsMultipart() = false for a multipart ETag")
+	}
+
+	// Missing optional fields must not panic
+	empty := NewObjectInfo(types.Object{Key: aws.String("key")})
+	if empty.Size != 0 || empty.ETag != "" || !empty.LastModified.IsZero() || empty.IsMultipart() {
+		t.Errorf("NewObjectInfo() with only a key = %+v, want zero values", empty)
+	}
+}
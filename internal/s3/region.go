@@ -2,23 +2,105 @@ package s3
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
+// bucketRegionHeader is returned by S3 with the bucket's region, also on redirects and access denied responses
+const bucketRegionHeader = "X-Amz-Bucket-Region"
+
 // S3GetBucketLocationAPI defines the interface for the GetBucketLocation operation
 type S3GetBucketLocationAPI interface {
 	GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error)
 }
 
-// GetBucketRegion determines the region where the bucket is located
-func GetBucketRegion(client S3GetBucketLocationAPI, bucket string) (string, error) {
+// S3HeadBucketAPI defines the interface for the HeadBucket operation
+type S3HeadBucketAPI interface {
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+}
+
+// S3BucketRegionAPI defines the operations used to discover a bucket's region
+type S3BucketRegionAPI interface {
+	S3HeadBucketAPI
+	S3GetBucketLocationAPI
+}
+
+// RegionCache remembers the regions of buckets, so each bucket is looked up once per run
+type RegionCache struct {
+	mu      sync.Mutex
+	regions map[string]string
+}
+
+// bucketRegions is shared by all clients of a run
+var bucketRegions RegionCache
+
+// Region returns the cached region of a bucket, discovering it on first use
+func (c *RegionCache) Region(ctx context.Context, client S3BucketRegionAPI, bucket string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if region, ok := c.regions[bucket]; ok {
+		return region, nil
+	}
+
+	region, err := DiscoverBucketRegion(ctx, client, bucket)
+	if err != nil {
+		return "", err
+	}
+	if c.regions == nil {
+		c.regions = make(map[string]string)
+	}
+	c.regions[bucket] = region
+	return region, nil
+}
+
+// DiscoverBucketRegion determines the region of a bucket. HeadBucket comes first, its x-amz-bucket-region header
+// is set even when the request is redirected or denied, so it works with only s3:ListBucket permission, or none,
+// and with access points. GetBucketLocation is the fallback for stores that don't send the header.
+func DiscoverBucketRegion(ctx context.Context, client S3BucketRegionAPI, bucket string) (string, error) {
+	output, headErr := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if headErr == nil && aws.ToString(output.BucketRegion) != "" {
+		return aws.ToString(output.BucketRegion), nil
+	}
+	if region := regionHeader(headErr); region != "" {
+		return region, nil
+	}
+
+	region, err := GetBucketRegion(ctx, client, bucket)
+	if err != nil {
+		if headErr != nil {
+			err = errors.Join(headErr, err)
+		}
+		return "", fmt.Errorf("discovering region of bucket %s: %w", bucket, err)
+	}
+	if headErr != nil {
+		log.Printf("HeadBucket on '%s' failed, used GetBucketLocation: %v", bucket, headErr)
+	}
+	return region, nil
+}
+
+// regionHeader returns the bucket region header of an error response, or ""
+func regionHeader(err error) string {
+	var respErr *smithyhttp.ResponseError
+	if !errors.As(err, &respErr) || respErr.Response == nil || respErr.Response.Response == nil {
+		return ""
+	}
+	return respErr.Response.Header.Get(bucketRegionHeader)
+}
+
+// GetBucketRegion determines the region where the bucket is located with GetBucketLocation
+func GetBucketRegion(ctx context.Context, client S3GetBucketLocationAPI, bucket string) (string, error) {
 	input := &s3.GetBucketLocationInput{
 		Bucket: aws.String(bucket),
 	}
 
-	result, err := client.GetBucketLocation(context.TODO(), input)
+	result, err := client.GetBucketLocation(ctx, input)
 	if err != nil {
 		return "", err
 	}
@@ -34,3 +116,14 @@ func GetBucketRegion(client S3GetBucketLocationAPI, bucket string) (string, erro
 
 	return region, nil
 }
+
+// isNotImplemented reports whether an S3-compatible store does not support an operation
+func isNotImplemented(err error) bool {
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NotImplemented" || apiErr.ErrorCode() == "MethodNotAllowed") {
+		return true
+	}
+	var respErr interface{ HTTPStatusCode() int }
+	return errors.As(err, &respErr) &&
+		(respErr.HTTPStatusCode() == http.StatusNotImplemented || respErr.HTTPStatusCode() == http.StatusMethodNotAllowed)
+}
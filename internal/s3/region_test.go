@@ -3,10 +3,16 @@ package s3
 import (
 	"context"
 	"errors"
+	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 // MockS3GetBucketLocationClient is a mock implementation of S3GetBucketLocationAPI
@@ -68,7 +74,7 @@ func TestGetBucketRegion(t *testing.T) {
 				},
 			}
 
-			region, err := GetBucketRegion(mockClient, tt.bucket)
+			region, err := GetBucketRegion(context.Background(), mockClient, tt.bucket)
 
 			// Check error
 			if (err != nil) != tt.expectError {
@@ -83,3 +89,183 @@ func TestGetBucketRegion(t *testing.T) {
 		})
 	}
 }
+
+func TestIsNotImplemented(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "not implemented", err: &smithy.GenericAPIError{Code: "NotImplemented"}, expected: true},
+		{name: "method not allowed", err: &smithy.GenericAPIError{Code: "MethodNotAllowed"}, expected: true},
+		{name: "access denied", err: &smithy.GenericAPIError{Code: "AccessDenied"}, expected: false},
+		{name: "other error", err: errors.New("connection refused"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNotImplemented(tt.err); got != tt.expected {
+				t.Errorf("isNotImplemented() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// MockS3BucketRegionClient is a mock implementation of S3BucketRegionAPI
+type MockS3BucketRegionClient struct {
+	HeadBucketFunc         func(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	GetBucketLocationFunc  func(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error)
+	HeadBucketCalls        int
+	GetBucketLocationCalls int
+}
+
+func (m *MockS3BucketRegionClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	m.HeadBucketCalls++
+	return m.HeadBucketFunc(ctx, params, optFns...)
+}
+
+func (m *MockS3BucketRegionClient) GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	m.GetBucketLocationCalls++
+	return m.GetBucketLocationFunc(ctx, params, optFns...)
+}
+
+// responseError builds the error the SDK returns for an HTTP error response, with an optional region header
+func responseError(operation string, status int, code, region string) error {
+	header := http.Header{}
+	if region != "" {
+		header.Set("x-amz-bucket-region", region)
+	}
+	return &smithy.OperationError{
+		ServiceID:     "S3",
+		OperationName: operation,
+		Err: &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status, Header: header}},
+				Err:      &smithy.GenericAPIError{Code: code},
+			},
+		},
+	}
+}
+
+func TestDiscoverBucketRegion(t *testing.T) {
+	tests := []struct {
+		name             string
+		headOutput       *s3.HeadBucketOutput
+		headError        error
+		locationOutput   *s3.GetBucketLocationOutput
+		locationError    error
+		expectedRegion   string
+		expectLocation   bool
+		expectErrorParts []string
+	}{
+		{
+			name:           "HeadBucket",
+			headOutput:     &s3.HeadBucketOutput{BucketRegion: aws.String("eu-west-1")},
+			expectedRegion: "eu-west-1",
+		},
+		{
+			name:           "HeadBucket redirected to the bucket's region",
+			headError:      responseError("HeadBucket", http.StatusMovedPermanently, "PermanentRedirect", "us-west-2"),
+			expectedRegion: "us-west-2",
+		},
+		{
+			name:           "HeadBucket denied",
+			headError:      responseError("HeadBucket", http.StatusForbidden, "Forbidden", "ap-south-1"),
+			expectedRegion: "ap-south-1",
+		},
+		{
+			name:           "HeadBucket without region falls back to GetBucketLocation",
+			headOutput:     &s3.HeadBucketOutput{},
+			locationOutput: &s3.GetBucketLocationOutput{LocationConstraint: types.BucketLocationConstraintEuCentral1},
+			expectedRegion: "eu-central-1",
+			expectLocation: true,
+		},
+		{
+			name:           "HeadBucket failed without header falls back to GetBucketLocation",
+			headError:      responseError("HeadBucket", http.StatusForbidden, "Forbidden", ""),
+			locationOutput: &s3.GetBucketLocationOutput{},
+			expectedRegion: "us-east-1",
+			expectLocation: true,
+		},
+		{
+			name:             "both fail",
+			headError:        responseError("HeadBucket", http.StatusNotFound, "NotFound", ""),
+			locationError:    responseError("GetBucketLocation", http.StatusNotFound, "NoSuchBucket", ""),
+			expectLocation:   true,
+			expectErrorParts: []string{"HeadBucket", "GetBucketLocation", "test-bucket"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockS3BucketRegionClient{
+				HeadBucketFunc: func(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+					return tt.headOutput, tt.headError
+				},
+				GetBucketLocationFunc: func(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+					return tt.locationOutput, tt.locationError
+				},
+			}
+
+			region, err := DiscoverBucketRegion(context.Background(), mockClient, "test-bucket")
+			if tt.expectErrorParts != nil {
+				if err == nil {
+					t.Fatal("DiscoverBucketRegion() did not return an error")
+				}
+				for _, part := range tt.expectErrorParts {
+					if !strings.Contains(err.Error(), part) {
+						t.Errorf("DiscoverBucketRegion() error = %v, want it to mention %q", err, part)
+					}
+				}
+			} else if err != nil {
+				t.Fatalf("DiscoverBucketRegion() returned unexpected error: %v", err)
+			}
+
+			if region != tt.expectedRegion {
+				t.Errorf("DiscoverBucketRegion() = %q, want %q", region, tt.expectedRegion)
+			}
+			if called := mockClient.GetBucketLocationCalls > 0; called != tt.expectLocation {
+				t.Errorf("GetBucketLocation called = %v, want %v", called, tt.expectLocation)
+			}
+		})
+	}
+}
+
+func TestRegionCache(t *testing.T) {
+	failing := true
+	mockClient := &MockS3BucketRegionClient{
+		HeadBucketFunc: func(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+			if failing {
+				return nil, errors.New("connection reset")
+			}
+			return &s3.HeadBucketOutput{BucketRegion: aws.String("eu-west-1")}, nil
+		},
+		GetBucketLocationFunc: func(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+			return nil, errors.New("connection reset")
+		},
+	}
+
+	var cache RegionCache
+	// Failures are not cached
+	if _, err := cache.Region(context.Background(), mockClient, "bucket-a"); err == nil {
+		t.Fatal("Region() did not return an error")
+	}
+
+	failing = false
+	for range 3 {
+		region, err := cache.Region(context.Background(), mockClient, "bucket-a")
+		if err != nil || region != "eu-west-1" {
+			t.Fatalf("Region() = %q, %v, want eu-west-1", region, err)
+		}
+	}
+	if mockClient.HeadBucketCalls != 2 {
+		t.Errorf("HeadBucket called %d times, want 2", mockClient.HeadBucketCalls)
+	}
+
+	if _, err := cache.Region(context.Background(), mockClient, "bucket-b"); err != nil {
+		t.Fatalf("Region() returned unexpected error: %v", err)
+	}
+	if mockClient.HeadBucketCalls != 3 {
+		t.Errorf("HeadBucket called %d times after a second bucket, want 3", mockClient.HeadBucketCalls)
+	}
+}
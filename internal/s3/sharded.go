@@ -0,0 +1,49 @@
+package s3
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/user/s3cpbp/internal/retry"
+	"github.com/user/s3cpbp/internal/workqueue"
+)
+
+const (
+	// shardDelimiter splits the keyspace into sub-prefixes that are listed in parallel
+	shardDelimiter = "/"
+	// maxShardDepth is how many levels below the prefix are split, deeper prefixes are listed in one go
+	maxShardDepth = 4
+)
+
+// shard is a part of the keyspace listed by a single lister
+type shard struct {
+	prefix string
+	depth  int
+}
+
+// ListFilesParallel lists files like ListFiles, using up to concurrency ListObjectsV2 requests at once.
+// Sub-prefixes are discovered with a "/" delimiter and listed in parallel while there are idle listers,
+// so keyspaces organized in directories, like date partitions, list many times faster.
+// Objects are sent in no particular order. A concurrency of 1 or less lists sequentially.
+func ListFilesParallel(ctx context.Context, client S3ListObjectsAPI, bucket, prefix string, policy retry.Policy, include func(ObjectInfo) bool, concurrency int, foundFilesChan chan<- ObjectInfo, totalFiles *atomic.Int64) error {
+	if concurrency <= 1 {
+		return ListFiles(ctx, client, bucket, prefix, policy, include, foundFilesChan, totalFiles)
+	}
+	defer close(foundFilesChan)
+
+	return workqueue.Run(ctx, concurrency, shard{prefix: prefix}, func(ctx context.Context, q *workqueue.Queue[shard], sh shard) error {
+		// Only split further while there are listers waiting for work
+		input := &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(sh.prefix),
+		}
+		var found func(string)
+		if sh.depth < maxShardDepth && q.Idle() {
+			input.Delimiter = aws.String(shardDelimiter)
+			found = func(p string) { q.Push(shard{prefix: p, depth: sh.depth + 1}) }
+		}
+		return listPages(ctx, client, input, policy, include, foundFilesChan, totalFiles, found)
+	})
+}
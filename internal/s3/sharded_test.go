@@ -0,0 +1,207 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// fakeBucket serves ListObjectsV2 from a sorted set of keys, honouring prefixes, delimiters and pagination
+type fakeBucket struct {
+	keys     []string
+	pageSize int
+	// failPrefix makes listings of this prefix fail
+	failPrefix string
+
+	mu          sync.Mutex
+	delimited   int // Calls with a delimiter
+	inFlight    int
+	maxInFlight int
+}
+
+func newFakeBucket(pageSize int, keys ...string) *fakeBucket {
+	sort.Strings(keys)
+	return &fakeBucket{keys: keys, pageSize: pageSize}
+}
+
+// ListObjectsV2 implements the S3ListObjectsAPI interface
+func (b *fakeBucket) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	b.mu.Lock()
+	b.inFlight++
+	b.maxInFlight = max(b.maxInFlight, b.inFlight)
+	if params.Delimiter != nil {
+		b.delimited++
+	}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.inFlight--
+		b.mu.Unlock()
+	}()
+
+	prefix, delimiter := aws.ToString(params.Prefix), aws.ToString(params.Delimiter)
+	if b.failPrefix != "" && prefix == b.failPrefix {
+		return nil, &types.NoSuchBucket{}
+	}
+
+	start := 0
+	if token := aws.ToString(params.ContinuationToken); token != "" {
+		start, _ = strconv.Atoi(token)
+	}
+
+	output := &s3.ListObjectsV2Output{}
+	seen := make(map[string]bool)
+	i := start
+	for ; i < len(b.keys) && len(output.Contents)+len(output.CommonPrefixes) < b.pageSize; i++ {
+		key := b.keys[i]
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if end := strings.Index(key[len(prefix):], delimiter); end >= 0 {
+				common := key[:len(prefix)+end+len(delimiter)]
+				if !seen[common] {
+					seen[common] = true
+					output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(common)})
+				}
+				// Skip the rest of the common prefix, like S3 does
+				for i+1 < len(b.keys) && strings.HasPrefix(b.keys[i+1], common) {
+					i++
+				}
+				continue
+			}
+		}
+		output.Contents = append(output.Contents, types.Object{Key: aws.String(key), Size: aws.Int64(int64(len(key)))})
+	}
+
+	for ; i < len(b.keys); i++ {
+		if strings.HasPrefix(b.keys[i], prefix) {
+			output.IsTruncated = aws.Bool(true)
+			output.NextContinuationToken = aws.String(strconv.Itoa(i))
+			break
+		}
+	}
+	return output, nil
+}
+
+func TestListFilesParallel(t *testing.T) {
+	var keys []string
+	for day := 1; day <= 10; day++ {
+		for hour := 0; hour < 5; hour++ {
+			for part := 0; part < 3; part++ {
+				keys = append(keys, fmt.Sprintf("logs/2024-10-%02d/%02d/part-%d.json", day, hour, part))
+			}
+		}
+	}
+	keys = append(keys, "logs/_SUCCESS", "logs/manifest.json", "other/file.json")
+
+	tests := []struct {
+		name        string
+		concurrency int
+		include     func(ObjectInfo) bool
+		expected    int
+	}{
+		{"sequential", 1, nil, 152},
+		{"parallel", 8, nil, 152},
+		{"parallel with filter", 4, func(obj ObjectInfo) bool { return strings.HasSuffix(obj.Key, "part-0.json") }, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := newFakeBucket(7, keys...)
+			filesChan := make(chan ObjectInfo, 1000)
+			var totalFiles atomic.Int64
+
+			err := ListFilesParallel(context.Background(), bucket, "test-bucket", "logs/", testPolicy, tt.include, tt.concurrency, filesChan, &totalFiles)
+			if err != nil {
+				t.Fatalf("ListFilesParallel() returned unexpected error: %v", err)
+			}
+
+			seen := make(map[string]bool)
+			for obj := range filesChan {
+				if seen[obj.Key] {
+					t.Errorf("ListFilesParallel() sent %q more than once", obj.Key)
+				}
+				seen[obj.Key] = true
+				if !strings.HasPrefix(obj.Key, "logs/") {
+					t.Errorf("ListFilesParallel() sent %q outside of the prefix", obj.Key)
+				}
+			}
+			if len(seen) != tt.expected || totalFiles.Load() != int64(tt.expected) {
+				t.Errorf("ListFilesParallel() sent %d files and counted %d, want %d", len(seen), totalFiles.Load(), tt.expected)
+			}
+
+			if bucket.maxInFlight > tt.concurrency {
+				t.Errorf("ListFilesParallel() made %d calls at once, want at most %d", bucket.maxInFlight, tt.concurrency)
+			}
+			if tt.concurrency == 1 && bucket.delimited > 0 {
+				t.Errorf("Sequential listing made %d delimited calls, want 0", bucket.delimited)
+			}
+			if tt.concurrency > 1 && bucket.delimited == 0 {
+				t.Error("Parallel listing did not split the keyspace")
+			}
+		})
+	}
+}
+
+func TestListFilesParallel_Error(t *testing.T) {
+	var keys []string
+	for day := 1; day <= 5; day++ {
+		for part := 0; part < 20; part++ {
+			keys = append(keys, fmt.Sprintf("logs/2024-10-%02d/part-%02d.json", day, part))
+		}
+	}
+	bucket := newFakeBucket(5, keys...)
+	bucket.failPrefix = "logs/2024-10-03/"
+
+	filesChan := make(chan ObjectInfo, 1000)
+	var totalFiles atomic.Int64
+	err := ListFilesParallel(context.Background(), bucket, "test-bucket", "logs/", testPolicy, nil, 4, filesChan, &totalFiles)
+
+	var noSuchBucket *types.NoSuchBucket
+	if !errors.As(err, &noSuchBucket) {
+		t.Fatalf("ListFilesParallel() error = %v, want NoSuchBucket", err)
+	}
+	if !strings.Contains(err.Error(), "logs/2024-10-03/") {
+		t.Errorf("ListFilesParallel() error %q doesn't name the failed prefix", err)
+	}
+
+	// The channel must be closed even when listing fails
+	for range filesChan {
+	}
+}
+
+func TestListFilesParallel_Cancelled(t *testing.T) {
+	var keys []string
+	for i := 0; i < 100; i++ {
+		keys = append(keys, fmt.Sprintf("logs/%02d/file.json", i))
+	}
+	bucket := newFakeBucket(10, keys...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	filesChan := make(chan ObjectInfo)
+	var totalFiles atomic.Int64
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- ListFilesParallel(ctx, bucket, "test-bucket", "logs/", testPolicy, nil, 4, filesChan, &totalFiles)
+	}()
+
+	// Take a single file, then stop the run while the listers are blocked on the channel
+	<-filesChan
+	cancel()
+
+	if err := <-errChan; !errors.Is(err, context.Canceled) {
+		t.Errorf("ListFilesParallel() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,107 @@
+package s3
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// URIScheme starts S3 locations given as URIs
+const URIScheme = "s3://"
+
+// accessPointResource starts the resource of access point ARNs, followed by the access point's name
+const accessPointResource = "accesspoint/"
+
+// IsURI reports whether a location is an s3:// URI rather than a local path
+func IsURI(location string) bool {
+	return strings.HasPrefix(location, URIScheme)
+}
+
+// ParseURI splits an s3://bucket/prefix URI into its bucket and prefix. The bucket may be an access point
+// or Multi-Region Access Point ARN, as in s3://arn:aws:s3:us-west-2:123456789012:accesspoint/my-ap/prefix.
+func ParseURI(uri string) (bucket, prefix string, err error) {
+	rest, ok := strings.CutPrefix(uri, URIScheme)
+	if !ok {
+		return "", "", fmt.Errorf("%q is not an %s URI", uri, URIScheme)
+	}
+
+	// The ARN's resource contains a slash itself, the prefix starts after the access point's name
+	if arn.IsARN(rest) {
+		head, tail, _ := strings.Cut(rest, "/")
+		name, prefix, _ := strings.Cut(tail, "/")
+		bucket = head + "/" + name
+		if _, err := ParseAccessPoint(bucket); err != nil {
+			return "", "", fmt.Errorf("%q: %w", uri, err)
+		}
+		return bucket, prefix, nil
+	}
+
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("%q has no bucket", uri)
+	}
+	if err := ValidateBucket(bucket); err != nil {
+		return "", "", fmt.Errorf("%q: %w", uri, err)
+	}
+	return bucket, prefix, nil
+}
+
+// AccessPoint is an access point ARN given in place of a bucket name
+type AccessPoint struct {
+	arn.ARN
+	Name string
+}
+
+// MultiRegion reports whether this is a Multi-Region Access Point, which has no region of its own
+func (a AccessPoint) MultiRegion() bool {
+	return a.Region == ""
+}
+
+// ParseAccessPoint parses an access point or Multi-Region Access Point ARN
+func ParseAccessPoint(value string) (AccessPoint, error) {
+	parsed, err := arn.Parse(value)
+	if err != nil {
+		return AccessPoint{}, fmt.Errorf("invalid ARN %q: %w", value, err)
+	}
+	name, ok := strings.CutPrefix(parsed.Resource, accessPointResource)
+	if parsed.Service != "s3" || !ok {
+		return AccessPoint{}, fmt.Errorf("ARN %q is not an S3 access point, only access point and Multi-Region Access Point ARNs can be used as buckets", value)
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return AccessPoint{}, fmt.Errorf("ARN %q must name a single access point", value)
+	}
+	if len(parsed.AccountID) != 12 || strings.Trim(parsed.AccountID, "0123456789") != "" {
+		return AccessPoint{}, fmt.Errorf("ARN %q must contain a 12-digit account ID", value)
+	}
+	if parsed.Region == "" && !strings.HasSuffix(name, ".mrap") {
+		return AccessPoint{}, fmt.Errorf("ARN %q has no region, only Multi-Region Access Points (alias ending in .mrap) are global", value)
+	}
+	return AccessPoint{ARN: parsed, Name: name}, nil
+}
+
+// IsAccessPoint reports whether a bucket is given as an access point ARN
+func IsAccessPoint(bucket string) bool {
+	return arn.IsARN(bucket)
+}
+
+// ValidateBucket checks a bucket name or access point ARN. Names follow the legacy rules, which S3-compatible
+// stores and old us-east-1 buckets still allow, so they are not held to the stricter DNS-compatible rules.
+func ValidateBucket(bucket string) error {
+	if IsAccessPoint(bucket) {
+		_, err := ParseAccessPoint(bucket)
+		return err
+	}
+	if IsURI(bucket) {
+		return fmt.Errorf("bucket %q must be a name, not an %s URI", bucket, URIScheme)
+	}
+	if len(bucket) < 3 || len(bucket) > 255 {
+		return fmt.Errorf("bucket name %q must be 3 to 255 characters long", bucket)
+	}
+	for _, r := range bucket {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return fmt.Errorf("bucket name %q may only contain letters, digits, '.', '-' and '_'", bucket)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package s3
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseURI(t *testing.T) {
+	tests := []struct {
+		uri            string
+		expectedBucket string
+		expectedPrefix string
+		wantErr        bool
+	}{
+		{uri: "s3://bucket", expectedBucket: "bucket"},
+		{uri: "s3://bucket/", expectedBucket: "bucket"},
+		{uri: "s3://bucket/logs/2024/", expectedBucket: "bucket", expectedPrefix: "logs/2024/"},
+		{uri: "s3://bucket/a.json", expectedBucket: "bucket", expectedPrefix: "a.json"},
+		{uri: "s3:///logs/", wantErr: true},
+		{uri: "bucket/logs/", wantErr: true},
+		{uri: "https://bucket.s3.amazonaws.com/logs/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			bucket, prefix, err := ParseURI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseURI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if bucket != tt.expectedBucket || prefix != tt.expectedPrefix {
+				t.Errorf("ParseURI() = %q, %q, want %q, %q", bucket, prefix, tt.expectedBucket, tt.expectedPrefix)
+			}
+		})
+	}
+}
+
+func TestIsURI(t *testing.T) {
+	for location, expected := range map[string]bool{
+		"s3://bucket/manifest.json": true,
+		"./manifest.json":           false,
+		"/tmp/s3://manifest.json":   false,
+		"S3://bucket/":              false,
+	} {
+		if got := IsURI(location); got != expected {
+			t.Errorf("IsURI(%q) = %v, want %v", location, got, expected)
+		}
+	}
+}
+
+func TestParseURI_AccessPoint(t *testing.T) {
+	tests := []struct {
+		uri            string
+		expectedBucket string
+		expectedPrefix string
+		wantErr        bool
+	}{
+		{
+			uri:            "s3://arn:aws:s3:us-west-2:123456789012:accesspoint/my-ap/logs/2024/",
+			expectedBucket: "arn:aws:s3:us-west-2:123456789012:accesspoint/my-ap",
+			expectedPrefix: "logs/2024/",
+		},
+		{
+			uri:            "s3://arn:aws:s3:us-west-2:123456789012:accesspoint/my-ap",
+			expectedBucket: "arn:aws:s3:us-west-2:123456789012:accesspoint/my-ap",
+		},
+		{
+			uri:            "s3://arn:aws:s3::123456789012:accesspoint/mfzwi23gnjvgw.mrap/logs/",
+			expectedBucket: "arn:aws:s3::123456789012:accesspoint/mfzwi23gnjvgw.mrap",
+			expectedPrefix: "logs/",
+		},
+		{uri: "s3://arn:aws:s3:::my-bucket/logs/", wantErr: true},
+		{uri: "s3://arn:aws:s3-object-lambda:us-west-2:123456789012:accesspoint/my-olap/", wantErr: true},
+		{uri: "s3://arn:aws:s3:us-west-2:123456789012:accesspoint", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			bucket, prefix, err := ParseURI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseURI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if bucket != tt.expectedBucket || prefix != tt.expectedPrefix {
+				t.Errorf("ParseURI() = %q, %q, want %q, %q", bucket, prefix, tt.expectedBucket, tt.expectedPrefix)
+			}
+		})
+	}
+}
+
+func TestParseAccessPoint(t *testing.T) {
+	tests := []struct {
+		arn            string
+		expectedName   string
+		expectedRegion string
+		wantErr        string
+	}{
+		{arn: "arn:aws:s3:eu-west-1:123456789012:accesspoint/my-ap", expectedName: "my-ap", expectedRegion: "eu-west-1"},
+		{arn: "arn:aws-cn:s3:cn-north-1:123456789012:accesspoint/my-ap", expectedName: "my-ap", expectedRegion: "cn-north-1"},
+		{arn: "arn:aws:s3::123456789012:accesspoint/mfzwi23gnjvgw.mrap", expectedName: "mfzwi23gnjvgw.mrap"},
+		{arn: "arn:aws:s3::123456789012:accesspoint/my-ap", wantErr: "has no region"},
+		{arn: "arn:aws:s3:eu-west-1:1234:accesspoint/my-ap", wantErr: "12-digit account ID"},
+		{arn: "arn:aws:s3:eu-west-1:123456789012:accesspoint/my-ap/object/key", wantErr: "single access point"},
+		{arn: "arn:aws:s3:::my-bucket", wantErr: "not an S3 access point"},
+		{arn: "arn:aws:s3-outposts:eu-west-1:123456789012:outpost/op-01/accesspoint/my-ap", wantErr: "not an S3 access point"},
+		{arn: "arn:aws:s3", wantErr: "invalid ARN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arn, func(t *testing.T) {
+			accessPoint, err := ParseAccessPoint(tt.arn)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseAccessPoint() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAccessPoint() returned unexpected error: %v", err)
+			}
+			if accessPoint.Name != tt.expectedName || accessPoint.Region != tt.expectedRegion {
+				t.Errorf("ParseAccessPoint() = %q in %q, want %q in %q", accessPoint.Name, accessPoint.Region, tt.expectedName, tt.expectedRegion)
+			}
+			if accessPoint.MultiRegion() != (tt.expectedRegion == "") {
+				t.Errorf("MultiRegion() = %v, want %v", accessPoint.MultiRegion(), tt.expectedRegion == "")
+			}
+		})
+	}
+}
+
+func TestValidateBucket(t *testing.T) {
+	tests := []struct {
+		bucket  string
+		wantErr bool
+	}{
+		{bucket: "my-bucket.logs"},
+		{bucket: "Legacy_Bucket"},
+		{bucket: "arn:aws:s3:eu-west-1:123456789012:accesspoint/my-ap"},
+		{bucket: "ab", wantErr: true},
+		{bucket: "my bucket", wantErr: true},
+		{bucket: "my-bucket/logs", wantErr: true},
+		{bucket: "s3://my-bucket", wantErr: true},
+		{bucket: "arn:aws:s3:::my-bucket", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bucket, func(t *testing.T) {
+			if err := ValidateBucket(tt.bucket); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateBucket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
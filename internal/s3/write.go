@@ -0,0 +1,94 @@
+package s3
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// maxTags is the most tags S3 allows on an object
+const maxTags = 10
+
+// WriteOptions are the attributes given to the objects written to S3
+type WriteOptions struct {
+	StorageClass types.StorageClass         // Empty for the bucket's default
+	SSE          types.ServerSideEncryption // Empty for the bucket's default encryption
+	SSEKMSKeyID  string                     // Only with aws:kms or aws:kms:dsse, empty for the AWS managed key
+	Tags         map[string]string
+	Metadata     map[string]string // User metadata, sent as x-amz-meta-* headers
+}
+
+// Tagging encodes the tags as the query string S3 expects in the x-amz-tagging header, nil without tags
+func (o WriteOptions) Tagging() *string {
+	if len(o.Tags) == 0 {
+		return nil
+	}
+	values := url.Values{}
+	for key, value := range o.Tags {
+		values.Set(key, value)
+	}
+	return aws.String(values.Encode())
+}
+
+// ParseStorageClass validates a storage class to write objects in, case-insensitive, e.g. "standard_ia"
+func ParseStorageClass(name string) (types.StorageClass, error) {
+	class := types.StorageClass(strings.ToUpper(strings.TrimSpace(name)))
+	for _, v := range class.Values() {
+		if v == class {
+			return class, nil
+		}
+	}
+	return "", fmt.Errorf("unknown storage class %q", name)
+}
+
+// ParseServerSideEncryption validates a server-side encryption algorithm: AES256, aws:kms or aws:kms:dsse
+func ParseServerSideEncryption(name string) (types.ServerSideEncryption, error) {
+	sse := types.ServerSideEncryption(name)
+	for _, v := range sse.Values() {
+		if v == sse {
+			return sse, nil
+		}
+	}
+	return "", fmt.Errorf("unknown server-side encryption %q, expected one of %q", name, sse.Values())
+}
+
+// AddTag adds a tag given as key=value
+func (o *WriteOptions) AddTag(value string) error {
+	key, tag, err := parseKeyValue(value)
+	if err != nil {
+		return err
+	}
+	if _, ok := o.Tags[key]; !ok && len(o.Tags) == maxTags {
+		return fmt.Errorf("objects can have at most %d tags", maxTags)
+	}
+	if o.Tags == nil {
+		o.Tags = map[string]string{}
+	}
+	o.Tags[key] = tag
+	return nil
+}
+
+// AddMetadata adds a user metadata entry given as key=value. Keys are case-insensitive, S3 stores them lowercase.
+func (o *WriteOptions) AddMetadata(value string) error {
+	key, entry, err := parseKeyValue(value)
+	if err != nil {
+		return err
+	}
+	if o.Metadata == nil {
+		o.Metadata = map[string]string{}
+	}
+	o.Metadata[strings.ToLower(key)] = entry
+	return nil
+}
+
+// parseKeyValue splits "key=value" at the first equals sign, the value may be empty but the key may not
+func parseKeyValue(value string) (string, string, error) {
+	key, rest, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("expected key=value, got %q", value)
+	}
+	return key, rest, nil
+}
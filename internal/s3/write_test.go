@@ -0,0 +1,74 @@
+package s3
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestWriteOptions(t *testing.T) {
+	var opts WriteOptions
+	if opts.Tagging() != nil {
+		t.Errorf("Tagging() = %q, want nil without tags", aws.ToString(opts.Tagging()))
+	}
+
+	for _, value := range []string{"team=data", "cost center=a&b", "empty="} {
+		if err := opts.AddTag(value); err != nil {
+			t.Fatalf("AddTag(%q) returned unexpected error: %v", value, err)
+		}
+	}
+	if got, want := aws.ToString(opts.Tagging()), "cost+center=a%26b&empty=&team=data"; got != want {
+		t.Errorf("Tagging() = %q, want %q", got, want)
+	}
+
+	if err := opts.AddMetadata("Source-System=etl=v2"); err != nil {
+		t.Fatalf("AddMetadata() returned unexpected error: %v", err)
+	}
+	if opts.Metadata["source-system"] != "etl=v2" {
+		t.Errorf("Metadata = %v, want source-system: etl=v2", opts.Metadata)
+	}
+
+	for _, invalid := range []string{"novalue", "=value"} {
+		if err := opts.AddTag(invalid); err == nil {
+			t.Errorf("AddTag(%q) did not fail", invalid)
+		}
+		if err := opts.AddMetadata(invalid); err == nil {
+			t.Errorf("AddMetadata(%q) did not fail", invalid)
+		}
+	}
+
+	// Replacing a tag doesn't count against the limit, an eleventh tag does
+	for i := len(opts.Tags); i < maxTags; i++ {
+		if err := opts.AddTag(fmt.Sprintf("tag%d=x", i)); err != nil {
+			t.Fatalf("AddTag() returned unexpected error: %v", err)
+		}
+	}
+	if err := opts.AddTag("team=ops"); err != nil {
+		t.Errorf("AddTag() replacing a tag returned unexpected error: %v", err)
+	}
+	if err := opts.AddTag("one=too-many"); err == nil {
+		t.Error("AddTag() did not fail beyond the tag limit")
+	}
+}
+
+func TestParseStorageClass(t *testing.T) {
+	if class, err := ParseStorageClass("standard_ia"); err != nil || class != types.StorageClassStandardIa {
+		t.Errorf("ParseStorageClass(standard_ia) = %q, %v, want STANDARD_IA", class, err)
+	}
+	if _, err := ParseStorageClass("COLD"); err == nil {
+		t.Error("ParseStorageClass(COLD) did not fail")
+	}
+}
+
+func TestParseServerSideEncryption(t *testing.T) {
+	for _, name := range []string{"AES256", "aws:kms", "aws:kms:dsse"} {
+		if sse, err := ParseServerSideEncryption(name); err != nil || string(sse) != name {
+			t.Errorf("ParseServerSideEncryption(%q) = %q, %v", name, sse, err)
+		}
+	}
+	if _, err := ParseServerSideEncryption("kms"); err == nil {
+		t.Error("ParseServerSideEncryption(kms) did not fail")
+	}
+}
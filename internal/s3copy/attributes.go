@@ -0,0 +1,96 @@
+package s3copy
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// attributes are the properties of an object that a copy carries over, after the overrides of the write options
+type attributes struct {
+	contentType        *string
+	cacheControl       *string
+	contentDisposition *string
+	contentEncoding    *string
+	contentLanguage    *string
+	metadata           map[string]string
+	storageClass       types.StorageClass
+	sse                types.ServerSideEncryption
+	sseKMSKeyID        *string
+	tagging            *string
+}
+
+// resolve applies the write options to the source's attributes. The source's KMS key is not kept, keys belong
+// to an account and region, so without --sse-kms-key-id copies use the target account's AWS managed key.
+func (a attributes) resolve(opts s3ops.WriteOptions) attributes {
+	if opts.StorageClass != "" {
+		a.storageClass = opts.StorageClass
+	}
+	if len(opts.Metadata) > 0 {
+		a.metadata = opts.Metadata
+	}
+	if len(opts.Tags) > 0 {
+		a.tagging = opts.Tagging()
+	}
+	if opts.SSE != "" {
+		a.sse = opts.SSE
+	}
+	// SSE-C keys are never sent to us, those objects can't be copied with their encryption
+	if a.sse != types.ServerSideEncryptionAes256 && a.sse != types.ServerSideEncryptionAwsKms && a.sse != types.ServerSideEncryptionAwsKmsDsse {
+		a.sse = ""
+	}
+	if opts.SSEKMSKeyID != "" {
+		a.sseKMSKeyID = aws.String(opts.SSEKMSKeyID)
+	}
+	return a
+}
+
+// headAttributes returns the attributes of a HeadObject response
+func headAttributes(head *s3.HeadObjectOutput) attributes {
+	return attributes{
+		contentType:        head.ContentType,
+		cacheControl:       head.CacheControl,
+		contentDisposition: head.ContentDisposition,
+		contentEncoding:    head.ContentEncoding,
+		contentLanguage:    head.ContentLanguage,
+		metadata:           head.Metadata,
+		storageClass:       head.StorageClass,
+		sse:                head.ServerSideEncryption,
+	}
+}
+
+// getAttributes returns the attributes of a GetObject response
+func getAttributes(get *s3.GetObjectOutput) attributes {
+	return attributes{
+		contentType:        get.ContentType,
+		cacheControl:       get.CacheControl,
+		contentDisposition: get.ContentDisposition,
+		contentEncoding:    get.ContentEncoding,
+		contentLanguage:    get.ContentLanguage,
+		metadata:           get.Metadata,
+		storageClass:       get.StorageClass,
+		sse:                get.ServerSideEncryption,
+	}
+}
+
+// sourceTagging reads the tags of the source object, unless the write options replace them
+func (w *Worker) sourceTagging(ctx context.Context, key string) (*string, error) {
+	if len(w.Options.Tags) > 0 {
+		return nil, nil
+	}
+	out, err := w.Source.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(w.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	tags := s3ops.WriteOptions{Tags: map[string]string{}}
+	for _, tag := range out.TagSet {
+		tags.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags.Tagging(), nil
+}
@@ -0,0 +1,227 @@
+package s3copy
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+const (
+	// MaxCopySize is the largest object CopyObject copies in one request, larger ones are copied in parts
+	MaxCopySize = 5 * 1024 * 1024 * 1024
+	// maxParts is the most parts S3 allows in a multipart upload
+	maxParts = 10000
+	// partConcurrency is the number of parts of an object copied at once
+	partConcurrency = 3
+)
+
+// serverCopy copies an object within S3, with CopyObject or, above MaxCopySize, with UploadPartCopy.
+// The copy is conditional on the ETag read first, so an object replaced meanwhile is not copied half old, half new.
+// With Verify the copy is then compared with the source. It returns the number of bytes copied.
+func (w *Worker) serverCopy(ctx context.Context, obj s3ops.ObjectInfo, key string) (int64, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(w.Bucket),
+		Key:    aws.String(obj.Key),
+	}
+	if w.Verify {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+	head, err := w.Source.HeadObject(ctx, input)
+	if err != nil {
+		return 0, err
+	}
+	size := aws.ToInt64(head.ContentLength)
+	attrs := headAttributes(head).resolve(w.Options)
+
+	if size > MaxCopySize {
+		err = w.multipartCopy(ctx, obj.Key, key, head, attrs)
+	} else {
+		err = w.singleCopy(ctx, obj.Key, key, head, attrs)
+	}
+	if err == nil && w.Verify {
+		err = w.verifyCopy(ctx, key, headFingerprint(head))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// singleCopy copies an object of up to MaxCopySize with CopyObject
+func (w *Worker) singleCopy(ctx context.Context, sourceKey, key string, head *s3.HeadObjectOutput, attrs attributes) error {
+
+	input := &s3.CopyObjectInput{
+		Bucket:               aws.String(w.TargetBucket),
+		Key:                  aws.String(key),
+		CopySource:           aws.String(copySource(w.Bucket, sourceKey)),
+		CopySourceIfMatch:    head.ETag,
+		StorageClass:         attrs.storageClass,
+		ServerSideEncryption: attrs.sse,
+		SSEKMSKeyId:          attrs.sseKMSKeyID,
+	}
+	// CopyObject keeps the source's metadata and tags unless told to replace them
+	if len(w.Options.Metadata) > 0 {
+		input.MetadataDirective = types.MetadataDirectiveReplace
+		input.Metadata = attrs.metadata
+		input.ContentType = attrs.contentType
+		input.CacheControl = attrs.cacheControl
+		input.ContentDisposition = attrs.contentDisposition
+		input.ContentEncoding = attrs.contentEncoding
+		input.ContentLanguage = attrs.contentLanguage
+	}
+	if len(w.Options.Tags) > 0 {
+		input.TaggingDirective = types.TaggingDirectiveReplace
+		input.Tagging = attrs.tagging
+	}
+	if w.Verify {
+		input.ChecksumAlgorithm = headFingerprint(head).algorithm()
+	}
+	_, err := w.Destination.CopyObject(ctx, input)
+	return err
+}
+
+// multipartCopy copies a large object in parts with UploadPartCopy, aborting the upload if any part fails
+func (w *Worker) multipartCopy(ctx context.Context, sourceKey, key string, head *s3.HeadObjectOutput, attrs attributes) error {
+	// UploadPartCopy copies data only, the metadata and tags are given when the upload is created
+	if attrs.tagging == nil {
+		var err error
+		if attrs.tagging, err = w.sourceTagging(ctx, sourceKey); err != nil {
+			return fmt.Errorf("reading tags: %w", err)
+		}
+	}
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(w.TargetBucket),
+		Key:                  aws.String(key),
+		ContentType:          attrs.contentType,
+		CacheControl:         attrs.cacheControl,
+		ContentDisposition:   attrs.contentDisposition,
+		ContentEncoding:      attrs.contentEncoding,
+		ContentLanguage:      attrs.contentLanguage,
+		Metadata:             attrs.metadata,
+		StorageClass:         attrs.storageClass,
+		ServerSideEncryption: attrs.sse,
+		SSEKMSKeyId:          attrs.sseKMSKeyID,
+		Tagging:              attrs.tagging,
+	}
+	if w.Verify {
+		// CRCs of the parts combine into a checksum of the whole copy, comparable with the source's
+		create.ChecksumAlgorithm = headFingerprint(head).algorithm()
+		if create.ChecksumAlgorithm != types.ChecksumAlgorithmSha1 && create.ChecksumAlgorithm != types.ChecksumAlgorithmSha256 {
+			create.ChecksumType = types.ChecksumTypeFullObject
+		}
+	}
+	created, err := w.Destination.CreateMultipartUpload(ctx, create)
+	if err != nil {
+		return err
+	}
+	uploadID := created.UploadId
+
+	size := aws.ToInt64(head.ContentLength)
+	partSize := max(w.PartSize, (size+maxParts-1)/maxParts)
+	parts := make([]types.CompletedPart, (size+partSize-1)/partSize)
+	source := aws.String(copySource(w.Bucket, sourceKey))
+
+	// The first failed part stops the others
+	partCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	next := make(chan int)
+	for i := 0; i < partConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range next {
+				start := int64(part) * partSize
+				end := min(start+partSize, size) - 1
+				out, err := w.Destination.UploadPartCopy(partCtx, &s3.UploadPartCopyInput{
+					Bucket:            aws.String(w.TargetBucket),
+					Key:               aws.String(key),
+					UploadId:          uploadID,
+					PartNumber:        aws.Int32(int32(part + 1)),
+					CopySource:        source,
+					CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+					CopySourceIfMatch: head.ETag,
+				})
+				if err == nil && out.CopyPartResult == nil {
+					err = fmt.Errorf("part %d: missing copy result", part+1)
+				}
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				result := out.CopyPartResult
+				parts[part] = types.CompletedPart{
+					PartNumber:        aws.Int32(int32(part + 1)),
+					ETag:              result.ETag,
+					ChecksumCRC32:     result.ChecksumCRC32,
+					ChecksumCRC32C:    result.ChecksumCRC32C,
+					ChecksumCRC64NVME: result.ChecksumCRC64NVME,
+					ChecksumSHA1:      result.ChecksumSHA1,
+					ChecksumSHA256:    result.ChecksumSHA256,
+				}
+			}
+		}()
+	}
+feed:
+	for part := range parts {
+		select {
+		case next <- part:
+		case <-partCtx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	err = firstErr
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		_, err = w.Destination.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(w.TargetBucket),
+			Key:             aws.String(key),
+			UploadId:        uploadID,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if err != nil {
+		// Parts of an unfinished upload are billed until it is aborted, also when the run is cancelled
+		w.Destination.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(w.TargetBucket),
+			Key:      aws.String(key),
+			UploadId: uploadID,
+		})
+		return err
+	}
+	return nil
+}
+
+// copySource formats the x-amz-copy-source of an object: the bucket and URL-encoded key,
+// or for access points the ARN followed by /object/ and the key
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(segment), "+", "%20")
+	}
+	if s3ops.IsAccessPoint(bucket) {
+		return bucket + "/object/" + strings.Join(segments, "/")
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
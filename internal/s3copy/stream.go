@@ -0,0 +1,64 @@
+package s3copy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// streamCopy downloads an object and uploads it to the target as it arrives, without touching the disk.
+// The uploader holds a part of each object in memory. It returns the number of bytes copied.
+func (w *Worker) streamCopy(ctx context.Context, obj s3ops.ObjectInfo, key string) (int64, error) {
+	// With checksum mode on the SDK also checks the body against the source's full-object checksum
+	getInput := &s3.GetObjectInput{
+		Bucket: aws.String(w.Bucket),
+		Key:    aws.String(obj.Key),
+	}
+	if w.Verify {
+		getInput.ChecksumMode = types.ChecksumModeEnabled
+	}
+	get, err := w.Source.GetObject(ctx, getInput)
+	if err != nil {
+		return 0, err
+	}
+	defer get.Body.Close()
+
+	attrs := getAttributes(get).resolve(w.Options)
+	if attrs.tagging == nil && aws.ToInt32(get.TagCount) > 0 {
+		if attrs.tagging, err = w.sourceTagging(ctx, obj.Key); err != nil {
+			return 0, fmt.Errorf("reading tags: %w", err)
+		}
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:               aws.String(w.TargetBucket),
+		Key:                  aws.String(key),
+		Body:                 get.Body,
+		ContentType:          attrs.contentType,
+		CacheControl:         attrs.cacheControl,
+		ContentDisposition:   attrs.contentDisposition,
+		ContentEncoding:      attrs.contentEncoding,
+		ContentLanguage:      attrs.contentLanguage,
+		Metadata:             attrs.metadata,
+		StorageClass:         attrs.storageClass,
+		ServerSideEncryption: attrs.sse,
+		SSEKMSKeyId:          attrs.sseKMSKeyID,
+		Tagging:              attrs.tagging,
+	}
+	if w.Verify {
+		input.ChecksumAlgorithm = getFingerprint(get).algorithm()
+	}
+	if _, err := w.Uploader.Upload(ctx, input); err != nil {
+		return 0, err
+	}
+	if w.Verify {
+		if err := w.verifyCopy(ctx, key, getFingerprint(get)); err != nil {
+			return 0, err
+		}
+	}
+	return aws.ToInt64(get.ContentLength), nil
+}
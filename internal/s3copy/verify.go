@@ -0,0 +1,123 @@
+package s3copy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// checksumAlgorithms are the additional checksums a copy is compared by, in the order a copy's algorithm is picked
+var checksumAlgorithms = []types.ChecksumAlgorithm{
+	types.ChecksumAlgorithmCrc64nvme,
+	types.ChecksumAlgorithmCrc32c,
+	types.ChecksumAlgorithmCrc32,
+	types.ChecksumAlgorithmSha256,
+	types.ChecksumAlgorithmSha1,
+}
+
+// fingerprint holds what a copy and its source are compared by
+type fingerprint struct {
+	size      int64
+	md5       string                             // The ETag when it is an MD5 of the data, not for multipart, SSE-KMS or SSE-C objects
+	checksums map[types.ChecksumAlgorithm]string // Full-object checksums, composite checksums of multipart uploads are left out
+}
+
+func newFingerprint(size int64, etag *string, sse types.ServerSideEncryption, sseCustomer *string, checksums map[types.ChecksumAlgorithm]*string) fingerprint {
+	f := fingerprint{size: size, checksums: make(map[types.ChecksumAlgorithm]string)}
+	md5 := strings.Trim(aws.ToString(etag), `"`)
+	if !strings.Contains(md5, "-") && sse != types.ServerSideEncryptionAwsKms && sse != types.ServerSideEncryptionAwsKmsDsse && sseCustomer == nil {
+		f.md5 = md5
+	}
+	for algorithm, value := range checksums {
+		if value != nil && !strings.Contains(*value, "-") {
+			f.checksums[algorithm] = *value
+		}
+	}
+	return f
+}
+
+func headFingerprint(head *s3.HeadObjectOutput) fingerprint {
+	return newFingerprint(aws.ToInt64(head.ContentLength), head.ETag, head.ServerSideEncryption, head.SSECustomerAlgorithm, map[types.ChecksumAlgorithm]*string{
+		types.ChecksumAlgorithmCrc32:     head.ChecksumCRC32,
+		types.ChecksumAlgorithmCrc32c:    head.ChecksumCRC32C,
+		types.ChecksumAlgorithmSha1:      head.ChecksumSHA1,
+		types.ChecksumAlgorithmSha256:    head.ChecksumSHA256,
+		types.ChecksumAlgorithmCrc64nvme: head.ChecksumCRC64NVME,
+	})
+}
+
+func getFingerprint(get *s3.GetObjectOutput) fingerprint {
+	return newFingerprint(aws.ToInt64(get.ContentLength), get.ETag, get.ServerSideEncryption, get.SSECustomerAlgorithm, map[types.ChecksumAlgorithm]*string{
+		types.ChecksumAlgorithmCrc32:     get.ChecksumCRC32,
+		types.ChecksumAlgorithmCrc32c:    get.ChecksumCRC32C,
+		types.ChecksumAlgorithmSha1:      get.ChecksumSHA1,
+		types.ChecksumAlgorithmSha256:    get.ChecksumSHA256,
+		types.ChecksumAlgorithmCrc64nvme: get.ChecksumCRC64NVME,
+	})
+}
+
+// algorithm returns the checksum the copy of the object is made with: one the object has,
+// so S3 computes the same checksum of the copy, or CRC32 for objects without any
+func (f fingerprint) algorithm() types.ChecksumAlgorithm {
+	for _, algorithm := range checksumAlgorithms {
+		if _, ok := f.checksums[algorithm]; ok {
+			return algorithm
+		}
+	}
+	return types.ChecksumAlgorithmCrc32
+}
+
+// compare checks a copy against its source, returning an error wrapping ErrIntegrity on a mismatch.
+// It returns false when there was nothing to compare but the size.
+func (f fingerprint) compare(copied fingerprint) (bool, error) {
+	if copied.size != f.size {
+		return false, fmt.Errorf("%w: size is %d, expected %d", transfer.ErrIntegrity, copied.size, f.size)
+	}
+
+	verified := false
+	for _, algorithm := range checksumAlgorithms {
+		expected, ok := f.checksums[algorithm]
+		actual, copiedOK := copied.checksums[algorithm]
+		if !ok || !copiedOK {
+			continue
+		}
+		if actual != expected {
+			return false, fmt.Errorf("%w: %s is %s, expected %s", transfer.ErrIntegrity, algorithm, actual, expected)
+		}
+		verified = true
+	}
+	if f.md5 != "" && copied.md5 != "" {
+		if copied.md5 != f.md5 {
+			return false, fmt.Errorf("%w: ETag is %s, expected %s", transfer.ErrIntegrity, copied.md5, f.md5)
+		}
+		verified = true
+	}
+	return verified, nil
+}
+
+// verifyCopy compares the copy at key with its source. Copies without a checksum or MD5 ETag in common
+// with the source, such as multipart copies of objects without additional checksums, are logged and accepted.
+func (w *Worker) verifyCopy(ctx context.Context, key string, source fingerprint) error {
+	head, err := w.Destination.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(w.TargetBucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("head copy: %w", err)
+	}
+	verified, err := source.compare(headFingerprint(head))
+	if err != nil {
+		return err
+	}
+	if !verified {
+		log.Printf("Worker %d: No checksum available to verify %s, only its size was compared", w.ID, key)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package s3copy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+func TestFingerprintCompare(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       *s3.HeadObjectOutput
+		copied       *s3.HeadObjectOutput
+		wantVerified bool
+		wantErr      bool
+	}{
+		{
+			name:         "matching MD5 ETags",
+			source:       &s3.HeadObjectOutput{ContentLength: aws.Int64(3), ETag: aws.String(`"abc"`)},
+			copied:       &s3.HeadObjectOutput{ContentLength: aws.Int64(3), ETag: aws.String(`"abc"`)},
+			wantVerified: true,
+		},
+		{
+			name:    "different MD5 ETags",
+			source:  &s3.HeadObjectOutput{ContentLength: aws.Int64(3), ETag: aws.String(`"abc"`)},
+			copied:  &s3.HeadObjectOutput{ContentLength: aws.Int64(3), ETag: aws.String(`"abd"`)},
+			wantErr: true,
+		},
+		{
+			name:    "different sizes",
+			source:  &s3.HeadObjectOutput{ContentLength: aws.Int64(3)},
+			copied:  &s3.HeadObjectOutput{ContentLength: aws.Int64(2)},
+			wantErr: true,
+		},
+		{
+			name:         "matching checksums of a KMS encrypted copy",
+			source:       &s3.HeadObjectOutput{ContentLength: aws.Int64(3), ETag: aws.String(`"abc"`), ChecksumCRC64NVME: aws.String("crc")},
+			copied:       &s3.HeadObjectOutput{ContentLength: aws.Int64(3), ETag: aws.String(`"kms"`), ServerSideEncryption: types.ServerSideEncryptionAwsKms, ChecksumCRC64NVME: aws.String("crc")},
+			wantVerified: true,
+		},
+		{
+			name:    "different checksums",
+			source:  &s3.HeadObjectOutput{ContentLength: aws.Int64(3), ChecksumCRC32: aws.String("one")},
+			copied:  &s3.HeadObjectOutput{ContentLength: aws.Int64(3), ChecksumCRC32: aws.String("two")},
+			wantErr: true,
+		},
+		{
+			// A multipart source copied in one piece gets another ETag, composite checksums only cover parts
+			name:   "multipart source without full-object checksums",
+			source: &s3.HeadObjectOutput{ContentLength: aws.Int64(3), ETag: aws.String(`"abc-2"`), ChecksumCRC32: aws.String("crc-2")},
+			copied: &s3.HeadObjectOutput{ContentLength: aws.Int64(3), ETag: aws.String(`"def"`), ChecksumCRC32: aws.String("crc")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, err := headFingerprint(tt.source).compare(headFingerprint(tt.copied))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compare() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, transfer.ErrIntegrity) {
+				t.Errorf("compare() error = %v, want wrapped %v", err, transfer.ErrIntegrity)
+			}
+			if verified != tt.wantVerified {
+				t.Errorf("compare() verified = %v, want %v", verified, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestFingerprintAlgorithm(t *testing.T) {
+	tests := []struct {
+		head     *s3.HeadObjectOutput
+		expected types.ChecksumAlgorithm
+	}{
+		{&s3.HeadObjectOutput{}, types.ChecksumAlgorithmCrc32},
+		{&s3.HeadObjectOutput{ChecksumCRC64NVME: aws.String("crc")}, types.ChecksumAlgorithmCrc64nvme},
+		{&s3.HeadObjectOutput{ChecksumSHA256: aws.String("sha"), ChecksumCRC32C: aws.String("crc")}, types.ChecksumAlgorithmCrc32c},
+		{&s3.HeadObjectOutput{ChecksumSHA1: aws.String("sha-3")}, types.ChecksumAlgorithmCrc32},
+	}
+	for _, tt := range tests {
+		if got := headFingerprint(tt.head).algorithm(); got != tt.expected {
+			t.Errorf("algorithm() for %+v = %q, want %q", tt.head, got, tt.expected)
+		}
+	}
+}
+
+// TestCopyObject_VerifyFailure tests that a copy differing from its source is retried, then reported as a verify failure
+func TestCopyObject_VerifyFailure(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var (
+		copies        int
+		copied        *s3.CopyObjectInput
+		headMode      types.ChecksumMode
+		finishedFiles atomic.Int64
+		retries       atomic.Int64
+	)
+	worker := Worker{
+		Source: &mockSource{
+			headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+				headMode = params.ChecksumMode
+				return &s3.HeadObjectOutput{ContentLength: aws.Int64(1), ETag: aws.String(`"etag"`), ChecksumCRC64NVME: aws.String("source")}, nil
+			},
+		},
+		Bucket: "src",
+		Destination: &mockDestination{
+			copyObjectFunc: func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+				copies++
+				copied = params
+				return &s3.CopyObjectOutput{}, nil
+			},
+			headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+				return &s3.HeadObjectOutput{ContentLength: aws.Int64(1), ETag: aws.String(`"etag"`), ChecksumCRC64NVME: aws.String("corrupt")}, nil
+			},
+		},
+		TargetBucket:  "dst",
+		FinishedFiles: &finishedFiles,
+		Verify:        true,
+		Retry:         retry.Policy{MaxAttempts: 2, Retries: &retries},
+	}
+
+	err := worker.copyObject(context.Background(), s3ops.ObjectInfo{Key: "a.json", Size: 1}, "a.json")
+	var fileErr *transfer.FileError
+	if !errors.As(err, &fileErr) || fileErr.Op != "verify" || !errors.Is(err, transfer.ErrIntegrity) {
+		t.Fatalf("copyObject() error = %v, want a verify FileError wrapping %v", err, transfer.ErrIntegrity)
+	}
+	if copies != 2 || finishedFiles.Load() != 0 {
+		t.Errorf("copied %d times, finished %d, want 2 attempts and none finished", copies, finishedFiles.Load())
+	}
+	// The copy is checksummed with the source's algorithm, so S3 computes a comparable checksum
+	if headMode != types.ChecksumModeEnabled || copied.ChecksumAlgorithm != types.ChecksumAlgorithmCrc64nvme {
+		t.Errorf("source HEAD checksum mode = %q, copy checksum algorithm = %q, want ENABLED and CRC64NVME", headMode, copied.ChecksumAlgorithm)
+	}
+}
+
+// TestStreamCopy_Verify tests that streamed copies read the source with checksum mode and are compared with it
+func TestStreamCopy_Verify(t *testing.T) {
+	var getMode types.ChecksumMode
+	var uploaded *s3.PutObjectInput
+	worker := Worker{
+		Source: &mockSource{
+			getObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+				getMode = params.ChecksumMode
+				return &s3.GetObjectOutput{
+					Body:          io.NopCloser(strings.NewReader("content")),
+					ContentLength: aws.Int64(7),
+					ETag:          aws.String(`"multipart-3"`),
+					ChecksumCRC32: aws.String("crc"),
+				}, nil
+			},
+		},
+		Bucket: "src",
+		Destination: &mockDestination{
+			headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+				return &s3.HeadObjectOutput{ContentLength: aws.Int64(7), ChecksumCRC32: aws.String("crc")}, nil
+			},
+		},
+		Uploader: &mockUploader{
+			uploadFunc: func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+				uploaded = input
+				_, err := io.Copy(io.Discard, input.Body)
+				return &manager.UploadOutput{}, err
+			},
+		},
+		Stream:       true,
+		TargetBucket: "dst",
+		Verify:       true,
+	}
+
+	if _, err := worker.streamCopy(context.Background(), s3ops.ObjectInfo{Key: "a.txt", Size: 7}, "a.txt"); err != nil {
+		t.Fatalf("streamCopy() returned unexpected error: %v", err)
+	}
+	if getMode != types.ChecksumModeEnabled || uploaded.ChecksumAlgorithm != types.ChecksumAlgorithmCrc32 {
+		t.Errorf("GET checksum mode = %q, upload checksum algorithm = %q, want ENABLED and CRC32", getMode, uploaded.ChecksumAlgorithm)
+	}
+}
@@ -0,0 +1,119 @@
+package s3copy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+	"github.com/user/s3cpbp/internal/upload"
+)
+
+// SourceAPI defines the operations that read the objects to copy
+type SourceAPI interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+}
+
+// DestinationAPI defines the operations that copy objects server-side and check the copies
+type DestinationAPI interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// Worker represents a copy worker. Objects are copied server-side, without passing through this machine,
+// unless Stream is set, in which case they are downloaded from the source and uploaded to the target.
+// Metadata, tags, storage class and the encryption algorithm of the source are kept unless Options override them.
+type Worker struct {
+	ID            int
+	Source        SourceAPI
+	Bucket        string         // Source bucket
+	Destination   DestinationAPI // Required for server-side copies and Verify
+	Uploader      upload.Uploader
+	Stream        bool // Copy with GET and PUT, for copies between credentials or partitions; requires Uploader
+	TargetBucket  string
+	TargetPrefix  string // Joined with the key of each object to form its key in the target, see upload.Key
+	PartSize      int64  // Part size of multipart copies, grown to stay within S3's 10,000 parts
+	FilesChan     <-chan s3ops.ObjectInfo
+	WaitGroup     *sync.WaitGroup
+	TotalFiles    *atomic.Int64
+	FinishedFiles *atomic.Int64
+	SkippedFiles  *atomic.Int64 // Required when Sync is set
+	Sync          transfer.SyncStrategy
+	Remote        map[string]s3ops.ObjectInfo // Objects under the target prefix by key, required when Sync is set
+	Verify        bool                        // Compare each copy with its source, see verifyCopy
+	Options       s3ops.WriteOptions
+	Retry         retry.Policy
+	Concurrency   *transfer.Concurrency // Limits the copies in flight across workers, optional
+	Results       *transfer.Results
+}
+
+// Start starts the copy worker.
+// It stops taking new objects as soon as the context is cancelled.
+func (w *Worker) Start(ctx context.Context) {
+	defer w.WaitGroup.Done()
+
+	loop := transfer.Loop{
+		ID:    w.ID,
+		Files: w.FilesChan,
+		Skip:  w.skip,
+		Transfer: func(ctx context.Context, obj s3ops.ObjectInfo) error {
+			return w.copyObject(ctx, obj, upload.Key(w.TargetPrefix, obj.Key))
+		},
+		Concurrency: w.Concurrency,
+		Results:     w.Results,
+	}
+	loop.Run(ctx)
+}
+
+// skip reports whether the copy of an object is already up to date, counting and logging it as skipped
+func (w *Worker) skip(obj s3ops.ObjectInfo) bool {
+	key := upload.Key(w.TargetPrefix, obj.Key)
+	if target, ok := w.Remote[key]; !ok || !w.Sync.Copied(obj, target) {
+		return false
+	}
+	w.SkippedFiles.Add(1)
+	log.Printf("Worker %d %s, skipped unchanged %s", w.ID, w.progress(), key)
+	return true
+}
+
+// copyObject copies a single object to key in the target bucket, retrying transient failures.
+// Any failure is returned as a *transfer.FileError so the run can carry on with other objects.
+func (w *Worker) copyObject(ctx context.Context, obj s3ops.ObjectInfo, key string) error {
+	target := s3ops.URIScheme + w.TargetBucket + "/" + key
+	err := transfer.Attempt(ctx, w.Retry, w.Concurrency, func(attempt int) (int64, error) {
+		if w.Stream {
+			return w.streamCopy(ctx, obj, key)
+		}
+		return w.serverCopy(ctx, obj, key)
+	}, func(attempt int, err error) {
+		log.Printf("Worker %d: Attempt %d: Failed to copy %s: %v", w.ID, attempt, obj.Key, err)
+	})
+	if errors.Is(err, transfer.ErrIntegrity) {
+		return &transfer.FileError{Key: obj.Key, Op: "verify", Path: target, Err: err}
+	}
+	if err != nil {
+		return &transfer.FileError{Key: obj.Key, Op: "copy", Path: target, Err: err}
+	}
+
+	// Increment counter and log progress only on success
+	w.FinishedFiles.Add(1)
+
+	log.Printf("Worker %d %s, copied %s to %s", w.ID, w.progress(), obj.Key, target)
+	return nil
+}
+
+// progress formats the progress of the run for the worker's log lines
+func (w *Worker) progress() string {
+	return transfer.Progress(w.TotalFiles, w.FinishedFiles, w.SkippedFiles, w.Concurrency)
+}
@@ -0,0 +1,449 @@
+package s3copy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// mockSource implements the SourceAPI interface for testing
+type mockSource struct {
+	headObjectFunc       func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	getObjectFunc        func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	getObjectTaggingFunc func(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+}
+
+func (m *mockSource) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return m.headObjectFunc(ctx, params, optFns...)
+}
+
+func (m *mockSource) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return m.getObjectFunc(ctx, params, optFns...)
+}
+
+func (m *mockSource) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	return m.getObjectTaggingFunc(ctx, params, optFns...)
+}
+
+// mockDestination implements the DestinationAPI interface for testing
+type mockDestination struct {
+	headObjectFunc              func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	copyObjectFunc              func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	createMultipartUploadFunc   func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	uploadPartCopyFunc          func(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+	completeMultipartUploadFunc func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	abortMultipartUploadFunc    func(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+func (m *mockDestination) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return m.headObjectFunc(ctx, params, optFns...)
+}
+
+func (m *mockDestination) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	return m.copyObjectFunc(ctx, params, optFns...)
+}
+
+func (m *mockDestination) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return m.createMultipartUploadFunc(ctx, params, optFns...)
+}
+
+func (m *mockDestination) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	return m.uploadPartCopyFunc(ctx, params, optFns...)
+}
+
+func (m *mockDestination) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return m.completeMultipartUploadFunc(ctx, params, optFns...)
+}
+
+func (m *mockDestination) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return m.abortMultipartUploadFunc(ctx, params, optFns...)
+}
+
+// mockUploader implements the upload.Uploader interface for testing
+type mockUploader struct {
+	uploadFunc func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+}
+
+func (m *mockUploader) Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	return m.uploadFunc(ctx, input, opts...)
+}
+
+func TestCopySource(t *testing.T) {
+	tests := []struct {
+		bucket, key, expected string
+	}{
+		{"src", "logs/a.json", "src/logs/a.json"},
+		{"src", "logs/a b+c&d.json", "src/logs/a%20b%2Bc%26d.json"},
+		{"src", "ümlaut/ä.txt", "src/%C3%BCmlaut/%C3%A4.txt"},
+		{"arn:aws:s3:us-west-2:123456789012:accesspoint/ap", "a.json", "arn:aws:s3:us-west-2:123456789012:accesspoint/ap/object/a.json"},
+	}
+	for _, tt := range tests {
+		if got := copySource(tt.bucket, tt.key); got != tt.expected {
+			t.Errorf("copySource(%q, %q) = %q, want %q", tt.bucket, tt.key, got, tt.expected)
+		}
+	}
+}
+
+func TestAttributesResolve(t *testing.T) {
+	source := attributes{
+		metadata:     map[string]string{"origin": "etl"},
+		storageClass: types.StorageClassGlacierIr,
+		sse:          types.ServerSideEncryptionAwsKms,
+	}
+	if got := source.resolve(s3ops.WriteOptions{}); got.storageClass != types.StorageClassGlacierIr || got.sse != types.ServerSideEncryptionAwsKms || got.metadata["origin"] != "etl" {
+		t.Errorf("resolve() without options = %+v, want the source's attributes", got)
+	}
+
+	got := source.resolve(s3ops.WriteOptions{
+		StorageClass: types.StorageClassStandard,
+		SSE:          types.ServerSideEncryptionAes256,
+		Tags:         map[string]string{"team": "data"},
+		Metadata:     map[string]string{"owner": "ops"},
+	})
+	if got.storageClass != types.StorageClassStandard || got.sse != types.ServerSideEncryptionAes256 || aws.ToString(got.tagging) != "team=data" || got.metadata["owner"] != "ops" || got.metadata["origin"] != "" {
+		t.Errorf("resolve() with options = %+v, want the options' attributes", got)
+	}
+
+	// Customer-provided keys never reach us, such objects are copied with the bucket's encryption
+	if got := (attributes{sse: "SSE-C"}).resolve(s3ops.WriteOptions{}); got.sse != "" {
+		t.Errorf("resolve() kept encryption %q", got.sse)
+	}
+}
+
+// TestWorkerStart tests that objects are copied server-side under the target prefix, skipping unchanged ones
+func TestWorkerStart(t *testing.T) {
+	modified := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	objects := []s3ops.ObjectInfo{
+		{Key: "logs/a.json", Size: 3, LastModified: modified, ETag: "etag-a"},
+		{Key: "logs/b c.json", Size: 2, LastModified: modified, ETag: "etag-b"},
+		{Key: "logs/unchanged.json", Size: 9, LastModified: modified, ETag: "etag-u"},
+	}
+	filesChan := make(chan s3ops.ObjectInfo, len(objects))
+	for _, obj := range objects {
+		filesChan <- obj
+	}
+	close(filesChan)
+
+	// unchanged.json was copied after its last change
+	remote := map[string]s3ops.ObjectInfo{
+		"backup/logs/unchanged.json": {Key: "backup/logs/unchanged.json", Size: 9, LastModified: modified.Add(time.Hour)},
+	}
+
+	var (
+		wg            sync.WaitGroup
+		mu            sync.Mutex
+		totalFiles    atomic.Int64
+		finishedFiles atomic.Int64
+		skippedFiles  atomic.Int64
+		copied        = map[string]*s3.CopyObjectInput{}
+	)
+	totalFiles.Store(int64(len(objects)))
+	wg.Add(1)
+
+	worker := Worker{
+		ID: 1,
+		Source: &mockSource{
+			headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+				return &s3.HeadObjectOutput{
+					ContentLength:        aws.Int64(3),
+					ETag:                 aws.String(`"` + aws.ToString(params.Key) + `"`),
+					ContentType:          aws.String("application/json"),
+					StorageClass:         types.StorageClassStandardIa,
+					ServerSideEncryption: types.ServerSideEncryptionAes256,
+				}, nil
+			},
+		},
+		Bucket: "src",
+		Destination: &mockDestination{
+			copyObjectFunc: func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				copied[aws.ToString(params.Key)] = params
+				return &s3.CopyObjectOutput{}, nil
+			},
+			// Copies of objects without additional checksums keep the source's MD5 ETag
+			headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+				return &s3.HeadObjectOutput{
+					ContentLength: aws.Int64(3),
+					ETag:          aws.String(`"` + strings.TrimPrefix(aws.ToString(params.Key), "backup/") + `"`),
+				}, nil
+			},
+		},
+		TargetBucket:  "dst",
+		TargetPrefix:  "backup",
+		PartSize:      8 * 1024 * 1024,
+		FilesChan:     filesChan,
+		WaitGroup:     &wg,
+		TotalFiles:    &totalFiles,
+		FinishedFiles: &finishedFiles,
+		SkippedFiles:  &skippedFiles,
+		Sync:          transfer.SyncSizeMtime,
+		Remote:        remote,
+		Verify:        true,
+		Options:       s3ops.WriteOptions{Metadata: map[string]string{"copied-by": "test"}},
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	worker.Start(context.Background())
+	wg.Wait()
+
+	if len(copied) != 2 || finishedFiles.Load() != 2 || skippedFiles.Load() != 1 {
+		t.Fatalf("copied %d objects, finished %d, skipped %d, want 2, 2 and 1", len(copied), finishedFiles.Load(), skippedFiles.Load())
+	}
+
+	input := copied["backup/logs/b c.json"]
+	if input == nil {
+		t.Fatalf("CopyObject() not called for backup/logs/b c.json, copied %v", copied)
+	}
+	if aws.ToString(input.Bucket) != "dst" || aws.ToString(input.CopySource) != "src/logs/b%20c.json" || aws.ToString(input.CopySourceIfMatch) != `"logs/b c.json"` {
+		t.Errorf("CopyObject() bucket = %q, copy source = %q, if-match = %q", aws.ToString(input.Bucket), aws.ToString(input.CopySource), aws.ToString(input.CopySourceIfMatch))
+	}
+	// The source's storage class and encryption are kept, its metadata replaced along with the content headers
+	if input.StorageClass != types.StorageClassStandardIa || input.ServerSideEncryption != types.ServerSideEncryptionAes256 {
+		t.Errorf("CopyObject() storage class = %q, SSE = %q, want the source's", input.StorageClass, input.ServerSideEncryption)
+	}
+	if input.MetadataDirective != types.MetadataDirectiveReplace || input.Metadata["copied-by"] != "test" || aws.ToString(input.ContentType) != "application/json" {
+		t.Errorf("CopyObject() metadata directive = %q, metadata = %v, content type = %q", input.MetadataDirective, input.Metadata, aws.ToString(input.ContentType))
+	}
+	if input.TaggingDirective != "" || input.ChecksumAlgorithm != types.ChecksumAlgorithmCrc32 {
+		t.Errorf("CopyObject() tagging directive = %q, checksum algorithm = %q, want the tags copied and CRC32", input.TaggingDirective, input.ChecksumAlgorithm)
+	}
+}
+
+// TestServerCopy_Multipart tests that objects over MaxCopySize are copied in ranged parts with their tags,
+// and that the upload is aborted when a part fails
+func TestServerCopy_Multipart(t *testing.T) {
+	const (
+		size     = MaxCopySize + 1
+		partSize = 2 * 1024 * 1024 * 1024
+	)
+
+	tests := []struct {
+		name      string
+		failPart  int32
+		wantErr   bool
+		wantAbort bool
+	}{
+		{"all parts copied", 0, false, false},
+		{"failed part aborts the upload", 2, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				ranges   = map[int32]string{}
+				created  *s3.CreateMultipartUploadInput
+				complete *s3.CompleteMultipartUploadInput
+				aborted  bool
+			)
+			worker := Worker{
+				Source: &mockSource{
+					headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+						return &s3.HeadObjectOutput{
+							ContentLength: aws.Int64(size),
+							ETag:          aws.String(`"big-2"`),
+							Metadata:      map[string]string{"origin": "etl"},
+						}, nil
+					},
+					getObjectTaggingFunc: func(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+						return &s3.GetObjectTaggingOutput{TagSet: []types.Tag{{Key: aws.String("team"), Value: aws.String("data")}}}, nil
+					},
+				},
+				Bucket: "src",
+				Destination: &mockDestination{
+					createMultipartUploadFunc: func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+						created = params
+						return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+					},
+					uploadPartCopyFunc: func(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+						part := aws.ToInt32(params.PartNumber)
+						if part == tt.failPart {
+							return nil, &smithy.GenericAPIError{Code: "AccessDenied"}
+						}
+						mu.Lock()
+						ranges[part] = aws.ToString(params.CopySourceRange)
+						mu.Unlock()
+						return &s3.UploadPartCopyOutput{CopyPartResult: &types.CopyPartResult{ETag: aws.String(strings.Repeat("e", int(part)))}}, nil
+					},
+					completeMultipartUploadFunc: func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+						complete = params
+						return &s3.CompleteMultipartUploadOutput{}, nil
+					},
+					abortMultipartUploadFunc: func(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+						aborted = aws.ToString(params.UploadId) == "upload-1"
+						return &s3.AbortMultipartUploadOutput{}, nil
+					},
+				},
+				TargetBucket: "dst",
+				PartSize:     partSize,
+			}
+
+			n, err := worker.serverCopy(context.Background(), s3ops.ObjectInfo{Key: "big.bin", Size: size}, "big.bin")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serverCopy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if aborted != tt.wantAbort {
+				t.Errorf("upload aborted = %v, want %v", aborted, tt.wantAbort)
+			}
+			if created == nil || aws.ToString(created.Tagging) != "team=data" || created.Metadata["origin"] != "etl" {
+				t.Fatalf("CreateMultipartUpload() = %+v, want the source's tags and metadata", created)
+			}
+			if tt.wantErr {
+				if complete != nil {
+					t.Error("CompleteMultipartUpload() called after a failed part")
+				}
+				return
+			}
+
+			if n != size {
+				t.Errorf("serverCopy() = %d bytes, want %d", n, size)
+			}
+			expected := map[int32]string{
+				1: "bytes=0-2147483647",
+				2: "bytes=2147483648-4294967295",
+				3: "bytes=4294967296-5368709120",
+			}
+			for part, want := range expected {
+				if ranges[part] != want {
+					t.Errorf("part %d range = %q, want %q", part, ranges[part], want)
+				}
+			}
+			if complete == nil || len(complete.MultipartUpload.Parts) != 3 {
+				t.Fatalf("CompleteMultipartUpload() = %+v, want 3 parts", complete)
+			}
+			for i, part := range complete.MultipartUpload.Parts {
+				if aws.ToInt32(part.PartNumber) != int32(i+1) || len(aws.ToString(part.ETag)) != i+1 {
+					t.Errorf("completed part %d = %d with ETag %q", i, aws.ToInt32(part.PartNumber), aws.ToString(part.ETag))
+				}
+			}
+		})
+	}
+}
+
+// TestStreamCopy tests that streamed copies upload the source's body with its attributes and tags
+func TestStreamCopy(t *testing.T) {
+	var uploaded *s3.PutObjectInput
+	var body string
+	worker := Worker{
+		Source: &mockSource{
+			getObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+				return &s3.GetObjectOutput{
+					Body:          io.NopCloser(strings.NewReader("content")),
+					ContentLength: aws.Int64(7),
+					ContentType:   aws.String("text/plain"),
+					Metadata:      map[string]string{"origin": "etl"},
+					StorageClass:  types.StorageClassStandardIa,
+					TagCount:      aws.Int32(1),
+				}, nil
+			},
+			getObjectTaggingFunc: func(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+				return &s3.GetObjectTaggingOutput{TagSet: []types.Tag{{Key: aws.String("team"), Value: aws.String("data")}}}, nil
+			},
+		},
+		Bucket: "src",
+		Uploader: &mockUploader{
+			uploadFunc: func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+				uploaded = input
+				data, err := io.ReadAll(input.Body)
+				body = string(data)
+				return &manager.UploadOutput{}, err
+			},
+		},
+		Stream:       true,
+		TargetBucket: "dst",
+		Options:      s3ops.WriteOptions{StorageClass: types.StorageClassGlacierIr},
+	}
+
+	n, err := worker.streamCopy(context.Background(), s3ops.ObjectInfo{Key: "a.txt", Size: 7}, "copy/a.txt")
+	if err != nil || n != 7 {
+		t.Fatalf("streamCopy() = %d, %v, want 7 bytes", n, err)
+	}
+	if body != "content" || aws.ToString(uploaded.Bucket) != "dst" || aws.ToString(uploaded.Key) != "copy/a.txt" {
+		t.Errorf("Upload() sent %q to %s/%s", body, aws.ToString(uploaded.Bucket), aws.ToString(uploaded.Key))
+	}
+	if aws.ToString(uploaded.ContentType) != "text/plain" || uploaded.Metadata["origin"] != "etl" || aws.ToString(uploaded.Tagging) != "team=data" {
+		t.Errorf("Upload() content type = %q, metadata = %v, tagging = %q", aws.ToString(uploaded.ContentType), uploaded.Metadata, aws.ToString(uploaded.Tagging))
+	}
+	if uploaded.StorageClass != types.StorageClassGlacierIr {
+		t.Errorf("Upload() storage class = %q, want the override GLACIER_IR", uploaded.StorageClass)
+	}
+}
+
+// TestCopyObject_Retry tests that failed copies are retried and that permanent errors fail fast
+func TestCopyObject_Retry(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		wantErr          bool
+	}{
+		{"transient errors are retried", []error{errors.New("connection reset by peer"), &smithy.GenericAPIError{Code: "SlowDown"}}, 3, false},
+		{"changed source fails fast", []error{&smithy.GenericAPIError{Code: "PreconditionFailed"}}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				attempts      int
+				finishedFiles atomic.Int64
+				totalFiles    atomic.Int64
+				retries       atomic.Int64
+			)
+			worker := Worker{
+				Source: &mockSource{
+					headObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+						return &s3.HeadObjectOutput{ContentLength: aws.Int64(1)}, nil
+					},
+				},
+				Bucket: "src",
+				Destination: &mockDestination{
+					copyObjectFunc: func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+						attempts++
+						if attempts <= len(tt.errs) {
+							return nil, tt.errs[attempts-1]
+						}
+						return &s3.CopyObjectOutput{}, nil
+					},
+				},
+				TargetBucket:  "dst",
+				TotalFiles:    &totalFiles,
+				FinishedFiles: &finishedFiles,
+				Retry:         retry.Policy{MaxAttempts: 5, Retries: &retries},
+			}
+
+			err := worker.copyObject(context.Background(), s3ops.ObjectInfo{Key: "a.json", Size: 1}, "a.json")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("copyObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var fileErr *transfer.FileError
+			if err != nil && (!errors.As(err, &fileErr) || fileErr.Op != "copy" || fileErr.Path != "s3://dst/a.json") {
+				t.Errorf("copyObject() error = %v, want a copy FileError for s3://dst/a.json", err)
+			}
+			if attempts != tt.expectedAttempts {
+				t.Errorf("CopyObject attempts = %d, want %d", attempts, tt.expectedAttempts)
+			}
+		})
+	}
+}
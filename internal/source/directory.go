@@ -0,0 +1,84 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/user/s3cpbp/internal/download"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/workqueue"
+)
+
+// Directory walks a local directory tree, as the source of uploads. Files are sent with their path relative to
+// the directory, with forward slashes, as the Key and their modification time as LastModified.
+// Symbolic links to files are followed, those to directories are not, so the walk cannot loop.
+// Temporary files of downloads in progress are left out.
+type Directory struct {
+	Path        string
+	Concurrency int // Directories read at once
+}
+
+// Objects implements Source
+func (d *Directory) Objects(ctx context.Context, include func(s3ops.ObjectInfo) bool, foundFilesChan chan<- s3ops.ObjectInfo, totalFiles *atomic.Int64) error {
+	defer close(foundFilesChan)
+
+	// Directories are relative to the root, "" for the root itself
+	return workqueue.Run(ctx, d.Concurrency, "", func(ctx context.Context, q *workqueue.Queue[string], dir string) error {
+		return d.readDir(ctx, q, dir, include, foundFilesChan, totalFiles)
+	})
+}
+
+// readDir sends the files of a directory and queues its subdirectories
+func (d *Directory) readDir(ctx context.Context, q *workqueue.Queue[string], dir string, include func(s3ops.ObjectInfo) bool, foundFilesChan chan<- s3ops.ObjectInfo, totalFiles *atomic.Int64) error {
+	entries, err := os.ReadDir(filepath.Join(d.Path, filepath.FromSlash(dir)))
+	if err != nil {
+		return fmt.Errorf("walking %s: %w", d.Path, err)
+	}
+
+	for _, entry := range entries {
+		key := path.Join(dir, entry.Name())
+		if entry.IsDir() {
+			q.Push(key)
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), download.PartialSuffix) || strings.HasSuffix(entry.Name(), download.StateSuffix) {
+			continue
+		}
+
+		// Stat rather than the entry's Info, to follow symbolic links
+		info, err := os.Stat(filepath.Join(d.Path, filepath.FromSlash(key)))
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed since the directory was read, or a dangling link
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("walking %s: %w", d.Path, err)
+		}
+		if !info.Mode().IsRegular() {
+			if !info.IsDir() {
+				log.Printf("Skipping %s, not a regular file", key)
+			}
+			continue
+		}
+
+		obj := s3ops.ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()}
+		if include != nil && !include(obj) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case foundFilesChan <- obj:
+			totalFiles.Add(1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/s3cpbp/internal/download"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+func TestDirectory(t *testing.T) {
+	root := t.TempDir()
+	modified := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	files := map[string]string{
+		"a.json":                                "a",
+		"logs/2024/b.json":                      "bb",
+		"logs/2024/c.crc":                       "c",
+		"logs/2025/01/d.json":                   "dddd",
+		"logs/.e.json" + download.PartialSuffix: "partial",
+		"logs/.e.json" + download.StateSuffix:   "{}",
+		"empty/nested/f.json":                   "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatalf("Failed to set mtime: %v", err)
+		}
+	}
+	// Links to files are followed, links to directories are not
+	if err := os.Symlink(filepath.Join(root, "a.json"), filepath.Join(root, "link.json")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "logs"), filepath.Join(root, "logs-link")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		d := &Directory{Path: root, Concurrency: concurrency}
+		include := func(obj s3ops.ObjectInfo) bool { return !strings.HasSuffix(obj.Key, ".crc") }
+		objects, total, err := collect(t, d, include)
+		if err != nil {
+			t.Fatalf("Objects() returned unexpected error: %v", err)
+		}
+
+		var keys []string
+		for _, obj := range objects {
+			keys = append(keys, obj.Key)
+			if obj.Key == "logs/2025/01/d.json" && (obj.Size != 4 || !obj.LastModified.Equal(modified)) {
+				t.Errorf("Objects() sent %+v, want size 4 modified at %v", obj, modified)
+			}
+		}
+		slices.Sort(keys)
+		expected := []string{"a.json", "empty/nested/f.json", "link.json", "logs/2024/b.json", "logs/2025/01/d.json"}
+		if !slices.Equal(keys, expected) {
+			t.Errorf("Objects() with concurrency %d sent %q, want %q", concurrency, keys, expected)
+		}
+		if total != int64(len(expected)) {
+			t.Errorf("Objects() total count = %d, want %d", total, len(expected))
+		}
+	}
+}
+
+func TestDirectory_Missing(t *testing.T) {
+	d := &Directory{Path: filepath.Join(t.TempDir(), "missing"), Concurrency: 2}
+	if _, _, err := collect(t, d, nil); err == nil {
+		t.Error("Objects() did not fail for a missing directory")
+	}
+}
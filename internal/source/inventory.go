@@ -0,0 +1,192 @@
+package source
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/user/s3cpbp/internal/inventory"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// GetObjectAPI defines the interface for the GetObject operation used to read inventory reports stored in S3
+type GetObjectAPI interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Inventory reads the objects to copy from an S3 Inventory report instead of listing the bucket.
+// Only current versions are copied, delete markers and noncurrent versions in the report are skipped.
+type Inventory struct {
+	Manifest string       // Local path or s3:// URI of the report's manifest.json
+	Client   GetObjectAPI // Reads reports stored in S3, required for s3:// manifests
+	Bucket   string       // Must be the bucket the report was made for
+	Prefix   string       // Only keys under the prefix are copied
+}
+
+// Objects implements Source
+func (inv *Inventory) Objects(ctx context.Context, include func(s3ops.ObjectInfo) bool, foundFilesChan chan<- s3ops.ObjectInfo, totalFiles *atomic.Int64) error {
+	defer close(foundFilesChan)
+
+	err := inv.objects(ctx, func(record *inventory.Record) error {
+		if !record.Current() || !strings.HasPrefix(record.Key, inv.Prefix) {
+			return nil
+		}
+		if record.Bucket != "" && record.Bucket != inv.Bucket {
+			return fmt.Errorf("object %s in bucket %q, copying from %q", record.Key, record.Bucket, inv.Bucket)
+		}
+		if include != nil && !include(record.ObjectInfo) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case foundFilesChan <- record.ObjectInfo:
+			totalFiles.Add(1)
+			return nil
+		}
+	})
+	if err != nil && !errors.Is(err, ctx.Err()) {
+		return fmt.Errorf("reading inventory %s: %w", inv.Manifest, err)
+	}
+	return err
+}
+
+// objects reads the manifest and calls fn for every record of its data files
+func (inv *Inventory) objects(ctx context.Context, fn func(*inventory.Record) error) error {
+	manifestFile, err := inv.open(ctx, inv.Manifest)
+	if err != nil {
+		return err
+	}
+	manifest, err := inventory.ParseManifest(manifestFile)
+	manifestFile.Close()
+	if err != nil {
+		return err
+	}
+	if manifest.SourceBucket != inv.Bucket {
+		return fmt.Errorf("report is for bucket %q, copying from %q", manifest.SourceBucket, inv.Bucket)
+	}
+
+	for _, file := range manifest.Files {
+		location, err := inv.dataFile(manifest, file)
+		if err != nil {
+			return err
+		}
+		if err := inv.readDataFile(ctx, manifest, file, location, fn); err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+	}
+	return nil
+}
+
+// dataFile returns where a data file of the report is found. Data files of a report in S3 are in the
+// report's destination bucket. For a local report, the file's key is looked up relative to the manifest's
+// directory and its parent, dropping leading path segments of the key until a file exists,
+// so both a copy of the whole destination bucket and of the report's own directory work.
+func (inv *Inventory) dataFile(manifest *inventory.Manifest, file inventory.File) (string, error) {
+	if s3ops.IsURI(inv.Manifest) {
+		return s3ops.URIScheme + manifest.Bucket() + "/" + file.Key, nil
+	}
+
+	dir := filepath.Dir(inv.Manifest)
+	segments := strings.Split(file.Key, "/")
+	for i := range segments {
+		suffix := filepath.Join(segments[i:]...)
+		for _, base := range []string{filepath.Dir(dir), dir} {
+			path := filepath.Join(base, suffix)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("data file %s not found next to %s", file.Key, inv.Manifest)
+}
+
+// readDataFile checks a data file against the manifest and decodes its records
+func (inv *Inventory) readDataFile(ctx context.Context, manifest *inventory.Manifest, file inventory.File, location string, fn func(*inventory.Record) error) error {
+	data, err := inv.open(ctx, location)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	// No record is used before the whole file is checked, files in S3 are downloaded to a temporary file first
+	local, ok := data.(*os.File)
+	if !ok {
+		if local, err = os.CreateTemp("", "s3cpbp-inventory-*"); err != nil {
+			return err
+		}
+		defer os.Remove(local.Name())
+		defer local.Close()
+		if _, err := io.Copy(local, data); err != nil {
+			return err
+		}
+	}
+	if err := verifyDataFile(local, file); err != nil {
+		return err
+	}
+	if _, err := local.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return inventory.ReadCSV(local, manifest.FileSchema, fn)
+}
+
+// verifyDataFile compares the MD5 of a data file with the checksum the manifest lists for it, if any
+func verifyDataFile(local *os.File, file inventory.File) error {
+	if file.MD5Checksum == "" {
+		return nil
+	}
+	if _, err := local.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, local); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, file.MD5Checksum) {
+		return fmt.Errorf("%w: MD5 is %s, the manifest lists %s", transfer.ErrIntegrity, sum, file.MD5Checksum)
+	}
+	return nil
+}
+
+// open opens a local file or an S3 object
+func (inv *Inventory) open(ctx context.Context, location string) (io.ReadCloser, error) {
+	if !s3ops.IsURI(location) {
+		return os.Open(location)
+	}
+	if inv.Client == nil {
+		return nil, fmt.Errorf("no S3 client to read %s", location)
+	}
+
+	bucket, key, err := s3ops.ParseURI(location)
+	if err != nil {
+		return nil, err
+	}
+	output, err := inv.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3ops.WithSDKRetries)
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+// InventoryBucket returns the bucket holding a manifest given as an s3:// URI, or "" for local manifests
+func InventoryBucket(manifest string) string {
+	bucket, _, err := s3ops.ParseURI(manifest)
+	if err != nil {
+		return ""
+	}
+	return bucket
+}
@@ -0,0 +1,220 @@
+package source
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// mockGetObjectClient serves objects from memory, by bucket and key
+type mockGetObjectClient struct {
+	objects map[string][]byte
+}
+
+func (m *mockGetObjectClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, ok := m.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	if !ok {
+		return nil, fmt.Errorf("NoSuchKey: %s", aws.ToString(params.Key))
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+const inventoryManifest = `{
+	"sourceBucket": "test-bucket",
+	"destinationBucket": "arn:aws:s3:::inventory-bucket",
+	"fileFormat": "CSV",
+	"fileSchema": "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, ETag",
+	"files": [{"key": "test-bucket/daily/data/part-0.csv.gz"}]
+}`
+
+// inventoryData is a gzipped CSV data file with a noncurrent version and a delete marker
+func inventoryData(t *testing.T, bucket string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	fmt.Fprintf(gz, "%s,logs/a.json,v2,true,false,12,abc\n", bucket)
+	fmt.Fprintf(gz, "%s,logs/a.json,v1,false,false,10,old\n", bucket)
+	fmt.Fprintf(gz, "%s,logs/b%%20c.json,v1,true,false,7,def\n", bucket)
+	fmt.Fprintf(gz, "%s,logs/d.crc,v1,true,false,1,ghi\n", bucket)
+	fmt.Fprintf(gz, "%s,logs/deleted.json,v3,true,true,,\n", bucket)
+	fmt.Fprintf(gz, "%s,other/e.json,v1,true,false,5,jkl\n", bucket)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// manifestWithChecksum returns the manifest listing the data file with the given MD5 checksum
+func manifestWithChecksum(checksum string) []byte {
+	return []byte(strings.Replace(inventoryManifest, `part-0.csv.gz"}`, `part-0.csv.gz", "MD5checksum": "`+checksum+`"}`, 1))
+}
+
+// checkInventoryObjects checks the objects sent for the prefix logs/, excluding .crc files
+func checkInventoryObjects(t *testing.T, objects []s3ops.ObjectInfo, total int64) {
+	t.Helper()
+	if len(objects) != 2 || objects[0].Key != "logs/a.json" || objects[1].Key != "logs/b c.json" {
+		t.Fatalf("Objects() sent %v, want logs/a.json and logs/b c.json", objects)
+	}
+	if objects[0].Size != 12 || objects[0].ETag != "abc" {
+		t.Errorf("Objects()[0] = %+v, want the current version", objects[0])
+	}
+	if total != 2 {
+		t.Errorf("Objects() total count = %d, want 2", total)
+	}
+}
+
+func TestInventory_Local(t *testing.T) {
+	include := func(obj s3ops.ObjectInfo) bool { return !strings.HasSuffix(obj.Key, ".crc") }
+
+	tests := []struct {
+		name     string
+		manifest string // Relative to the report directory
+		data     string
+	}{
+		{
+			name:     "copy of the destination bucket",
+			manifest: "test-bucket/daily/2024-10-01T01-00Z/manifest.json",
+			data:     "test-bucket/daily/data/part-0.csv.gz",
+		},
+		{
+			name:     "files next to the manifest",
+			manifest: "manifest.json",
+			data:     "part-0.csv.gz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "inventory_test")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			files := map[string][]byte{
+				tt.manifest: []byte(inventoryManifest),
+				tt.data:     inventoryData(t, "test-bucket"),
+			}
+			for name, content := range files {
+				path := filepath.Join(tempDir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+				if err := os.WriteFile(path, content, 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", name, err)
+				}
+			}
+
+			inv := &Inventory{Manifest: filepath.Join(tempDir, tt.manifest), Bucket: "test-bucket", Prefix: "logs/"}
+			objects, total, err := collect(t, inv, include)
+			if err != nil {
+				t.Fatalf("Objects() returned unexpected error: %v", err)
+			}
+			checkInventoryObjects(t, objects, total)
+		})
+	}
+}
+
+func TestInventory_S3(t *testing.T) {
+	data := inventoryData(t, "test-bucket")
+	sum := md5.Sum(data)
+	client := &mockGetObjectClient{objects: map[string][]byte{
+		"inventory-bucket/test-bucket/daily/2024-10-01T01-00Z/manifest.json": manifestWithChecksum(hex.EncodeToString(sum[:])),
+		"inventory-bucket/test-bucket/daily/data/part-0.csv.gz":              data,
+	}}
+	manifest := "s3://inventory-bucket/test-bucket/daily/2024-10-01T01-00Z/manifest.json"
+
+	include := func(obj s3ops.ObjectInfo) bool { return !strings.HasSuffix(obj.Key, ".crc") }
+	objects, total, err := collect(t, &Inventory{Manifest: manifest, Client: client, Bucket: "test-bucket", Prefix: "logs/"}, include)
+	if err != nil {
+		t.Fatalf("Objects() returned unexpected error: %v", err)
+	}
+	checkInventoryObjects(t, objects, total)
+
+	if got := InventoryBucket(manifest); got != "inventory-bucket" {
+		t.Errorf("InventoryBucket() = %q, want %q", got, "inventory-bucket")
+	}
+	if got := InventoryBucket("manifest.json"); got != "" {
+		t.Errorf("InventoryBucket() of a local manifest = %q, want empty", got)
+	}
+}
+
+func TestInventory_Errors(t *testing.T) {
+	manifest := "s3://inventory-bucket/test-bucket/daily/manifest.json"
+	tests := []struct {
+		name    string
+		bucket  string
+		objects map[string][]byte
+		wantErr string
+	}{
+		{
+			name:    "report for another bucket",
+			bucket:  "other-bucket",
+			objects: map[string][]byte{"inventory-bucket/test-bucket/daily/manifest.json": []byte(inventoryManifest)},
+			wantErr: `report is for bucket "test-bucket"`,
+		},
+		{
+			name:   "record of another bucket",
+			bucket: "test-bucket",
+			objects: map[string][]byte{
+				"inventory-bucket/test-bucket/daily/manifest.json":      []byte(inventoryManifest),
+				"inventory-bucket/test-bucket/daily/data/part-0.csv.gz": inventoryData(t, "other-bucket"),
+			},
+			wantErr: `in bucket "other-bucket"`,
+		},
+		{
+			name:   "data file not matching its checksum",
+			bucket: "test-bucket",
+			objects: map[string][]byte{
+				"inventory-bucket/test-bucket/daily/manifest.json":      manifestWithChecksum("f11166069f1990abeb9c97ace9cdfabc"),
+				"inventory-bucket/test-bucket/daily/data/part-0.csv.gz": inventoryData(t, "test-bucket"),
+			},
+			wantErr: "integrity check failed",
+		},
+		{
+			name:   "orc report",
+			bucket: "test-bucket",
+			objects: map[string][]byte{
+				"inventory-bucket/test-bucket/daily/manifest.json": []byte(strings.Replace(inventoryManifest, `"CSV"`, `"ORC"`, 1)),
+			},
+			wantErr: "not supported yet",
+		},
+		{
+			name:    "missing data file",
+			bucket:  "test-bucket",
+			objects: map[string][]byte{"inventory-bucket/test-bucket/daily/manifest.json": []byte(inventoryManifest)},
+			wantErr: "NoSuchKey",
+		},
+		{
+			name:    "missing manifest",
+			bucket:  "test-bucket",
+			wantErr: "NoSuchKey",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := &Inventory{Manifest: manifest, Client: &mockGetObjectClient{objects: tt.objects}, Bucket: tt.bucket}
+			_, _, err := collect(t, inv, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Objects() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, _, err := collect(t, &Inventory{Manifest: manifest, Bucket: "test-bucket"}, nil); err == nil {
+		t.Error("Objects() of an s3:// manifest without a client did not fail")
+	}
+}
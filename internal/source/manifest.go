@@ -0,0 +1,157 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// Stdin is the manifest path that reads from standard input
+const Stdin = "-"
+
+// ManifestFormat is the layout of a manifest file
+type ManifestFormat string
+
+const (
+	// FormatAuto picks FormatCSV for files ending in .csv and FormatKeys otherwise
+	FormatAuto ManifestFormat = ""
+	// FormatKeys has one key per line
+	FormatKeys ManifestFormat = "keys"
+	// FormatCSV has bucket,key[,size[,etag]] records, with an optional header
+	FormatCSV ManifestFormat = "csv"
+)
+
+// ParseManifestFormat validates a manifest format name
+func ParseManifestFormat(name string) (ManifestFormat, error) {
+	switch f := ManifestFormat(name); f {
+	case FormatAuto, FormatKeys, FormatCSV:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown manifest format %q, expected %s or %s", name, FormatKeys, FormatCSV)
+	}
+}
+
+// Manifest reads the objects to copy from a file or standard input instead of listing the bucket.
+// Objects without a size in the manifest have s3ops.UnknownSize, they are always downloaded by --sync.
+type Manifest struct {
+	Path   string // Stdin reads from Input
+	Format ManifestFormat
+	Bucket string    // Records for other buckets are rejected
+	Prefix string    // Only keys under the prefix are copied
+	Input  io.Reader // Standard input, replaced by tests
+}
+
+// Objects implements Source
+func (m *Manifest) Objects(ctx context.Context, include func(s3ops.ObjectInfo) bool, foundFilesChan chan<- s3ops.ObjectInfo, totalFiles *atomic.Int64) error {
+	defer close(foundFilesChan)
+
+	input := m.Input
+	if m.Path != Stdin {
+		file, err := os.Open(m.Path)
+		if err != nil {
+			return fmt.Errorf("reading manifest: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	format := m.Format
+	if format == FormatAuto {
+		format = FormatKeys
+		if strings.HasSuffix(strings.ToLower(m.Path), ".csv") {
+			format = FormatCSV
+		}
+	}
+
+	send := func(obj s3ops.ObjectInfo) error {
+		if !strings.HasPrefix(obj.Key, m.Prefix) || (include != nil && !include(obj)) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case foundFilesChan <- obj:
+			totalFiles.Add(1)
+			return nil
+		}
+	}
+
+	var err error
+	if format == FormatCSV {
+		err = m.readCSV(input, send)
+	} else {
+		err = readKeys(input, send)
+	}
+	if err != nil && !errors.Is(err, ctx.Err()) {
+		return fmt.Errorf("reading manifest %s: %w", m.Path, err)
+	}
+	return err
+}
+
+// readKeys reads one key per line. Keys are taken verbatim, only empty lines are skipped.
+func readKeys(input io.Reader, send func(s3ops.ObjectInfo) error) error {
+	scanner := bufio.NewScanner(input)
+	// Keys are up to 1024 bytes, but allow for long lines in badly formatted files
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key := strings.TrimSuffix(scanner.Text(), "\r")
+		if key == "" {
+			continue
+		}
+		if err := send(s3ops.ObjectInfo{Key: key, Size: s3ops.UnknownSize}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readCSV reads bucket,key[,size[,etag]] records, skipping a header row starting with "bucket,key"
+func (m *Manifest) readCSV(input io.Reader, send func(s3ops.ObjectInfo) error) error {
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if first && len(record) >= 2 && strings.EqualFold(record[0], "bucket") && strings.EqualFold(record[1], "key") {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 2 || record[1] == "" {
+			return fmt.Errorf("line %d: expected bucket,key[,size[,etag]]", line)
+		}
+		if record[0] != "" && record[0] != m.Bucket {
+			return fmt.Errorf("line %d: object in bucket %q, copying from %q", line, record[0], m.Bucket)
+		}
+
+		obj := s3ops.ObjectInfo{Key: record[1], Size: s3ops.UnknownSize}
+		if len(record) > 2 && record[2] != "" {
+			if obj.Size, err = strconv.ParseInt(record[2], 10, 64); err != nil || obj.Size < 0 {
+				return fmt.Errorf("line %d: invalid size %q", line, record[2])
+			}
+		}
+		if len(record) > 3 {
+			obj.ETag = strings.Trim(record[3], `"`)
+		}
+
+		if err := send(obj); err != nil {
+			return err
+		}
+	}
+}
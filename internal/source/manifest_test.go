@@ -0,0 +1,152 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// collect runs the source and returns everything it sent
+func collect(t *testing.T, src Source, include func(s3ops.ObjectInfo) bool) ([]s3ops.ObjectInfo, int64, error) {
+	t.Helper()
+	filesChan := make(chan s3ops.ObjectInfo, 100)
+	var totalFiles atomic.Int64
+	err := src.Objects(context.Background(), include, filesChan, &totalFiles)
+
+	var objects []s3ops.ObjectInfo
+	for obj := range filesChan {
+		objects = append(objects, obj)
+	}
+	return objects, totalFiles.Load(), err
+}
+
+func TestManifest_Keys(t *testing.T) {
+	input := "logs/a.json\r\n\nlogs/b c.json\nother/d.json\nlogs/e.crc\n"
+	m := &Manifest{Path: Stdin, Bucket: "test-bucket", Prefix: "logs/", Input: strings.NewReader(input)}
+
+	include := func(obj s3ops.ObjectInfo) bool { return !strings.HasSuffix(obj.Key, ".crc") }
+	objects, total, err := collect(t, m, include)
+	if err != nil {
+		t.Fatalf("Objects() returned unexpected error: %v", err)
+	}
+
+	if len(objects) != 2 || objects[0].Key != "logs/a.json" || objects[1].Key != "logs/b c.json" {
+		t.Fatalf("Objects() sent %v, want logs/a.json and logs/b c.json", objects)
+	}
+	if objects[0].Size != s3ops.UnknownSize {
+		t.Errorf("Objects() Size = %d, want UnknownSize", objects[0].Size)
+	}
+	if total != 2 {
+		t.Errorf("Objects() total count = %d, want 2", total)
+	}
+}
+
+func TestManifest_CSV(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "manifest_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tests := []struct {
+		name     string
+		content  string
+		expected []s3ops.ObjectInfo
+		wantErr  string
+	}{
+		{
+			name:    "with header",
+			content: "bucket,key,size,etag\ntest-bucket,a.json,12,\"\"\"abc\"\"\"\ntest-bucket,\"b,c.json\",7,def-2\n",
+			expected: []s3ops.ObjectInfo{
+				{Key: "a.json", Size: 12, ETag: "abc"},
+				{Key: "b,c.json", Size: 7, ETag: "def-2"},
+			},
+		},
+		{
+			name:    "bucket and key only",
+			content: "test-bucket,a.json\n,b.json\n",
+			expected: []s3ops.ObjectInfo{
+				{Key: "a.json", Size: s3ops.UnknownSize},
+				{Key: "b.json", Size: s3ops.UnknownSize},
+			},
+		},
+		{
+			name:    "other bucket",
+			content: "test-bucket,a.json\nother-bucket,b.json\n",
+			wantErr: "line 2",
+		},
+		{
+			name:    "invalid size",
+			content: "test-bucket,a.json,big\n",
+			wantErr: "invalid size",
+		},
+		{
+			name:    "missing key",
+			content: "test-bucket\n",
+			wantErr: "expected bucket,key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, "manifest.csv")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write manifest: %v", err)
+			}
+
+			objects, _, err := collect(t, &Manifest{Path: path, Bucket: "test-bucket"}, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Objects() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Objects() returned unexpected error: %v", err)
+			}
+
+			if len(objects) != len(tt.expected) {
+				t.Fatalf("Objects() sent %v, want %v", objects, tt.expected)
+			}
+			for i, obj := range objects {
+				want := tt.expected[i]
+				if obj.Key != want.Key || obj.Size != want.Size || obj.ETag != want.ETag {
+					t.Errorf("Objects()[%d] = %+v, want %+v", i, obj, want)
+				}
+			}
+		})
+	}
+}
+
+func TestManifest_Errors(t *testing.T) {
+	if _, _, err := collect(t, &Manifest{Path: filepath.Join(os.TempDir(), "missing-manifest.txt")}, nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Objects() with a missing file error = %v, want %v", err, os.ErrNotExist)
+	}
+
+	// A cancelled run stops reading
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m := &Manifest{Path: Stdin, Format: FormatKeys, Input: strings.NewReader("a\nb\n")}
+	filesChan := make(chan s3ops.ObjectInfo)
+	var totalFiles atomic.Int64
+	if err := m.Objects(ctx, nil, filesChan, &totalFiles); !errors.Is(err, context.Canceled) {
+		t.Errorf("Objects() with a cancelled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestParseManifestFormat(t *testing.T) {
+	for _, name := range []string{"", "keys", "csv"} {
+		if _, err := ParseManifestFormat(name); err != nil {
+			t.Errorf("ParseManifestFormat(%q) returned unexpected error: %v", name, err)
+		}
+	}
+	if _, err := ParseManifestFormat("parquet"); err == nil {
+		t.Error("ParseManifestFormat() with an unknown format did not fail")
+	}
+}
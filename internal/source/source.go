@@ -0,0 +1,31 @@
+package source
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// Source produces the objects to copy
+type Source interface {
+	// Objects sends the objects for which include returns true to the channel, counting them in totalFiles,
+	// and closes the channel when done. A nil include keeps every object.
+	// An error means the set of objects sent is incomplete.
+	Objects(ctx context.Context, include func(s3ops.ObjectInfo) bool, foundFilesChan chan<- s3ops.ObjectInfo, totalFiles *atomic.Int64) error
+}
+
+// Listing lists the objects under a prefix with ListObjectsV2
+type Listing struct {
+	Client      s3ops.S3ListObjectsAPI
+	Bucket      string
+	Prefix      string
+	Retry       retry.Policy
+	Concurrency int // Listing requests in flight
+}
+
+// Objects implements Source
+func (l *Listing) Objects(ctx context.Context, include func(s3ops.ObjectInfo) bool, foundFilesChan chan<- s3ops.ObjectInfo, totalFiles *atomic.Int64) error {
+	return s3ops.ListFilesParallel(ctx, l.Client, l.Bucket, l.Prefix, l.Retry, include, l.Concurrency, foundFilesChan, totalFiles)
+}
@@ -0,0 +1,20 @@
+package transfer
+
+import (
+	"context"
+
+	"github.com/user/s3cpbp/internal/retry"
+)
+
+// Attempt makes the attempts at a single transfer the policy allows, see retry.Policy.Do. fn returns the bytes an
+// attempt transferred, which the concurrency controller, if there is one, records with the attempt's outcome so
+// it can react to throughput and throttling. On attempts after the first, fn starts over from a clean state.
+func Attempt(ctx context.Context, policy retry.Policy, concurrency *Concurrency, fn func(attempt int) (int64, error), failed func(attempt int, err error)) error {
+	return policy.Do(ctx, func(attempt int) error {
+		n, err := fn(attempt)
+		if concurrency != nil && ctx.Err() == nil {
+			concurrency.Record(n, err)
+		}
+		return err
+	}, failed)
+}
@@ -0,0 +1,56 @@
+package transfer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/user/s3cpbp/internal/retry"
+)
+
+func TestAttempt(t *testing.T) {
+	c := NewConcurrency(16, 2, 32)
+	now := fakeClock(c)
+	*now = now.Add(concurrencyWindow)
+
+	// A throttled attempt is recorded before the retry succeeds
+	slowDown := &smithy.GenericAPIError{Code: "SlowDown", Message: "Please reduce your request rate."}
+	var attempts []int
+	err := Attempt(context.Background(), retry.Policy{MaxAttempts: 3}, c, func(attempt int) (int64, error) {
+		attempts = append(attempts, attempt)
+		if attempt == 1 {
+			return 0, slowDown
+		}
+		return 1024, nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("Attempt() returned unexpected error: %v", err)
+	}
+	if len(attempts) != 2 {
+		t.Errorf("Attempt() made attempts %v, want 2", attempts)
+	}
+	if limit := c.Limit(); limit != 8 {
+		t.Errorf("Limit() after a throttled attempt = %d, want 8", limit)
+	}
+	if c.successes != 1 || c.bytes != 1024 {
+		t.Errorf("recorded %d successes and %d bytes, want 1 and 1024", c.successes, c.bytes)
+	}
+}
+
+func TestAttempt_Cancelled(t *testing.T) {
+	c := NewConcurrency(16, 2, 32)
+	fakeClock(c)
+
+	// Attempts failing because the run is cancelled say nothing about S3
+	ctx, cancel := context.WithCancel(context.Background())
+	err := Attempt(ctx, retry.Policy{MaxAttempts: 3}, c, func(attempt int) (int64, error) {
+		cancel()
+		return 0, ctx.Err()
+	}, nil)
+	if err != context.Canceled {
+		t.Errorf("Attempt() error = %v, want %v", err, context.Canceled)
+	}
+	if c.failures != 0 {
+		t.Errorf("recorded %d failures after cancellation, want 0", c.failures)
+	}
+}
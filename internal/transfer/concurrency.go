@@ -0,0 +1,152 @@
+package transfer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/user/s3cpbp/internal/retry"
+)
+
+const (
+	// concurrencyWindow is how often throughput is compared to decide whether to add a transfer
+	concurrencyWindow = 2 * time.Second
+	// maxErrorRate is the share of failed attempts in a window above which concurrency stops growing
+	maxErrorRate = 0.05
+)
+
+// Concurrency is an AIMD controller for the number of transfers in flight.
+// It adds a transfer every window while throughput keeps up and errors stay low,
+// and halves the limit when S3 throttles requests or they time out.
+type Concurrency struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	min    int
+	max    int
+	active int
+
+	now          func() time.Time // Replaced by tests
+	windowStart  time.Time
+	lastDecrease time.Time
+	bytes        int64   // Transferred in the current window
+	successes    int     // Attempts that succeeded in the current window
+	failures     int     // Attempts that failed in the current window
+	throttled    bool    // Whether the current window saw throttling
+	lastRate     float64 // Bytes per second of the previous window
+	lastFiles    float64 // Files per second of the previous window
+}
+
+// NewConcurrency creates a controller that starts at initial transfers and stays within min and max
+func NewConcurrency(initial, min, max int) *Concurrency {
+	c := &Concurrency{
+		limit: initial,
+		min:   min,
+		max:   max,
+		now:   time.Now,
+	}
+	c.limit = c.clamp(initial)
+	c.cond = sync.NewCond(&c.mu)
+	c.windowStart = c.now()
+	return c
+}
+
+// clamp keeps a limit within the configured bounds
+func (c *Concurrency) clamp(limit int) int {
+	return min(max(limit, c.min, 1), max(c.max, c.min, 1))
+}
+
+// Acquire waits until another transfer may start.
+// It returns the context's error if the context is cancelled first.
+func (c *Concurrency) Acquire(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.cond.Broadcast()
+	})
+	defer stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.active >= c.limit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.active++
+	return nil
+}
+
+// Release marks a transfer as finished, letting a waiting one start
+func (c *Concurrency) Release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active--
+	c.cond.Signal()
+}
+
+// Limit returns the current number of transfers allowed in flight
+func (c *Concurrency) Limit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limit
+}
+
+// Record reports the outcome of a single transfer attempt and the bytes it transferred
+func (c *Concurrency) Record(bytes int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	switch {
+	case err == nil:
+		c.successes++
+		c.bytes += bytes
+	case retry.Throttled(err):
+		c.failures++
+		c.throttled = true
+		// Every request in flight may be throttled at once, only back off once per window
+		if now.Sub(c.lastDecrease) >= concurrencyWindow {
+			c.lastDecrease = now
+			c.setLimit(c.limit / 2)
+		}
+	default:
+		c.failures++
+	}
+
+	if elapsed := now.Sub(c.windowStart); elapsed >= concurrencyWindow {
+		c.endWindow(elapsed)
+		c.windowStart = now
+	}
+}
+
+// endWindow grows the limit if throughput didn't drop and errors stayed low, then starts a new window
+func (c *Concurrency) endWindow(elapsed time.Duration) {
+	rate := float64(c.bytes) / elapsed.Seconds()
+	files := float64(c.successes) / elapsed.Seconds()
+	attempts := c.successes + c.failures
+
+	// Only grow when all allowed transfers are actually used, otherwise more won't help
+	saturated := c.active >= c.limit
+	lowErrors := attempts > 0 && float64(c.failures)/float64(attempts) <= maxErrorRate
+	rising := rate >= c.lastRate || files >= c.lastFiles
+	if !c.throttled && saturated && lowErrors && rising {
+		c.setLimit(c.limit + 1)
+	}
+
+	c.lastRate, c.lastFiles = rate, files
+	c.bytes, c.successes, c.failures, c.throttled = 0, 0, 0, false
+}
+
+// setLimit changes the limit within the bounds, waking up waiting transfers if it grew
+func (c *Concurrency) setLimit(limit int) {
+	limit = c.clamp(limit)
+	if limit > c.limit {
+		c.cond.Broadcast()
+	}
+	c.limit = limit
+}
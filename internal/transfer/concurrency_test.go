@@ -0,0 +1,168 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/smithy-go"
+)
+
+// fakeClock returns a controllable time source for the concurrency controller
+func fakeClock(c *Concurrency) *time.Time {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	c.windowStart = now
+	return &now
+}
+
+func TestNewConcurrency_Bounds(t *testing.T) {
+	tests := []struct {
+		initial, min, max int
+		expected          int
+	}{
+		{10, 1, 20, 10},
+		{50, 1, 20, 20},
+		{0, 5, 20, 5},
+		{0, 0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		if limit := NewConcurrency(tt.initial, tt.min, tt.max).Limit(); limit != tt.expected {
+			t.Errorf("NewConcurrency(%d, %d, %d).Limit() = %d, want %d", tt.initial, tt.min, tt.max, limit, tt.expected)
+		}
+	}
+}
+
+func TestConcurrency_BacksOffOnThrottling(t *testing.T) {
+	c := NewConcurrency(16, 2, 32)
+	now := fakeClock(c)
+	slowDown := &smithy.GenericAPIError{Code: "SlowDown", Message: "Please reduce your request rate."}
+
+	// A burst of throttled requests only halves the limit once
+	*now = now.Add(concurrencyWindow)
+	for i := 0; i < 10; i++ {
+		c.Record(0, slowDown)
+	}
+	if limit := c.Limit(); limit != 8 {
+		t.Errorf("Limit() after a burst of SlowDown = %d, want 8", limit)
+	}
+
+	// Throttling in later windows keeps halving, down to the minimum
+	for i := 0; i < 5; i++ {
+		*now = now.Add(concurrencyWindow)
+		c.Record(0, slowDown)
+	}
+	if limit := c.Limit(); limit != 2 {
+		t.Errorf("Limit() after repeated SlowDown = %d, want 2", limit)
+	}
+
+	// Other errors don't count as throttling
+	*now = now.Add(concurrencyWindow)
+	c.Record(0, errors.New("access denied"))
+	if limit := c.Limit(); limit != 2 {
+		t.Errorf("Limit() after a non-throttling error = %d, want 2", limit)
+	}
+}
+
+func TestConcurrency_BacksOffOnRetryQuotaExceeded(t *testing.T) {
+	c := NewConcurrency(16, 2, 32)
+	now := fakeClock(c)
+
+	// Once the SDK's retry tokens run out under sustained SlowDown, the 503 is no longer in the error
+	quotaExceeded := &smithy.OperationError{
+		ServiceID:     "S3",
+		OperationName: "GetObject",
+		Err:           fmt.Errorf("failed to get rate limit token, %w", ratelimit.QuotaExceededError{Available: 0, Requested: 5}),
+	}
+	*now = now.Add(concurrencyWindow)
+	c.Record(0, quotaExceeded)
+	if limit := c.Limit(); limit != 8 {
+		t.Errorf("Limit() after QuotaExceededError = %d, want 8", limit)
+	}
+}
+
+func TestConcurrency_GrowsWhileThroughputRises(t *testing.T) {
+	c := NewConcurrency(2, 1, 4)
+	now := fakeClock(c)
+	ctx := context.Background()
+
+	// Keep every allowed transfer busy
+	for i := 0; i < c.Limit(); i++ {
+		if err := c.Acquire(ctx); err != nil {
+			t.Fatalf("Acquire() returned unexpected error: %v", err)
+		}
+	}
+
+	// Steady throughput without errors adds a transfer per window, up to the maximum
+	for i := 0; i < 5; i++ {
+		*now = now.Add(concurrencyWindow)
+		c.Record(1024, nil)
+		for c.active < c.Limit() {
+			if err := c.Acquire(ctx); err != nil {
+				t.Fatalf("Acquire() returned unexpected error: %v", err)
+			}
+		}
+	}
+	if limit := c.Limit(); limit != 4 {
+		t.Errorf("Limit() after steady throughput = %d, want 4", limit)
+	}
+
+	// Dropping throughput holds the limit
+	for i := 0; i < 3; i++ {
+		c.Record(1024, nil)
+	}
+	*now = now.Add(concurrencyWindow)
+	c.Record(1024, nil)
+	c.Release()
+	c.setLimit(3)
+	*now = now.Add(concurrencyWindow)
+	c.Record(1, nil)
+	if limit := c.Limit(); limit != 3 {
+		t.Errorf("Limit() after throughput dropped = %d, want 3", limit)
+	}
+}
+
+func TestConcurrency_AcquireWaitsForLimit(t *testing.T) {
+	c := NewConcurrency(1, 1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := c.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() returned unexpected error: %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- c.Acquire(ctx) }()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("Acquire() returned %v while the limit was reached", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("Acquire() returned unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire() did not return after Release()")
+	}
+
+	// A cancelled run must not wait for a free slot
+	go func() { acquired <- c.Acquire(ctx) }()
+	cancel()
+	select {
+	case err := <-acquired:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Acquire() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire() did not return after cancellation")
+	}
+}
@@ -0,0 +1,97 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// Loop is the loop of a download, upload or copy worker. It takes objects from Files until the channel
+// is closed or the context is cancelled, passes over those Skip reports as unchanged, and transfers
+// the others within the concurrency limit, recording their failures.
+type Loop struct {
+	ID          int
+	Files       <-chan s3ops.ObjectInfo
+	Skip        func(obj s3ops.ObjectInfo) bool                       // Counts and logs unchanged objects, nil to transfer all
+	Transfer    func(ctx context.Context, obj s3ops.ObjectInfo) error // Returns failures as a *FileError
+	Concurrency *Concurrency                                          // Limits the transfers in flight across workers, optional
+	Results     *Results
+}
+
+// Run runs the loop. It stops taking new objects as soon as the context is cancelled.
+func (l *Loop) Run(ctx context.Context) {
+	for {
+		var obj s3ops.ObjectInfo
+		select {
+		case <-ctx.Done():
+			return
+		case o, ok := <-l.Files:
+			if !ok {
+				return
+			}
+			obj = o
+		}
+
+		// Both cases can be ready at once, don't start a new object after cancellation
+		if ctx.Err() != nil {
+			return
+		}
+		if l.Skip != nil && l.Skip(obj) {
+			continue
+		}
+
+		// Wait for the adaptive limit to allow another transfer
+		if l.Concurrency != nil {
+			if err := l.Concurrency.Acquire(ctx); err != nil {
+				return
+			}
+		}
+		err := l.Transfer(ctx, obj)
+		if l.Concurrency != nil {
+			l.Concurrency.Release()
+		}
+
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			// Cancelled mid-transfer, the worker has cleaned up or kept what it needs to resume
+			if l.Results != nil {
+				l.Results.AddInterrupted(failedKey(obj, err))
+			}
+		default:
+			log.Printf("Worker %d: %v", l.ID, err)
+			if l.Results != nil {
+				l.Results.Add(err)
+			}
+		}
+	}
+}
+
+// failedKey returns the key a failure is reported under, which for uploads is the key of the object written
+func failedKey(obj s3ops.ObjectInfo, err error) string {
+	var fileErr *FileError
+	if errors.As(err, &fileErr) {
+		return fileErr.Key
+	}
+	return obj.Key
+}
+
+// Progress formats the number of processed objects out of the total found so far, with the number
+// of skipped objects and the current concurrency when those are in use
+func Progress(total, finished, skipped *atomic.Int64, concurrency *Concurrency) string {
+	done := finished.Load()
+	var details string
+	if skipped != nil {
+		n := skipped.Load()
+		done += n
+		details += fmt.Sprintf(", %d skipped", n)
+	}
+	if concurrency != nil {
+		details += fmt.Sprintf(", concurrency %d", concurrency.Limit())
+	}
+	return fmt.Sprintf("(%d/%d%s)", done, total.Load(), details)
+}
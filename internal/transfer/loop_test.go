@@ -0,0 +1,104 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+func TestLoopRun(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	files := make(chan s3ops.ObjectInfo, 3)
+	for _, key := range []string{"same.txt", "bad.txt", "good.txt"} {
+		files <- s3ops.ObjectInfo{Key: key}
+	}
+	close(files)
+
+	var results Results
+	var transferred []string
+	loop := Loop{
+		ID:    1,
+		Files: files,
+		Skip:  func(obj s3ops.ObjectInfo) bool { return obj.Key == "same.txt" },
+		Transfer: func(ctx context.Context, obj s3ops.ObjectInfo) error {
+			transferred = append(transferred, obj.Key)
+			if obj.Key == "bad.txt" {
+				return &FileError{Key: obj.Key, Op: "upload", Path: "/tmp/bad.txt", Err: errors.New("access denied")}
+			}
+			return nil
+		},
+		Concurrency: NewConcurrency(1, 1, 1),
+		Results:     &results,
+	}
+	loop.Run(context.Background())
+
+	if expected := []string{"bad.txt", "good.txt"}; !slices.Equal(transferred, expected) {
+		t.Errorf("transferred %q, want %q", transferred, expected)
+	}
+	failures := results.Failures()
+	var fileErr *FileError
+	if len(failures) != 1 || !errors.As(failures[0], &fileErr) || fileErr.Key != "bad.txt" {
+		t.Errorf("Failures() = %v, want the failure of bad.txt", failures)
+	}
+	if interrupted := results.Interrupted(); len(interrupted) != 0 {
+		t.Errorf("Interrupted() = %q, want none", interrupted)
+	}
+}
+
+func TestLoopRun_Interrupted(t *testing.T) {
+	files := make(chan s3ops.ObjectInfo, 2)
+	files <- s3ops.ObjectInfo{Key: "a.txt"}
+	files <- s3ops.ObjectInfo{Key: "b.txt"}
+	close(files)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var results Results
+	calls := 0
+	loop := Loop{
+		Files: files,
+		Transfer: func(ctx context.Context, obj s3ops.ObjectInfo) error {
+			calls++
+			cancel()
+			// Failures are recorded under the key of the FileError, e.g. the key an upload writes
+			return &FileError{Key: "prefix/" + obj.Key, Op: "upload", Err: ctx.Err()}
+		},
+		Results: &results,
+	}
+	loop.Run(ctx)
+
+	if calls != 1 {
+		t.Errorf("Transfer called %d times, want 1 as the loop stops after cancellation", calls)
+	}
+	if interrupted := results.Interrupted(); !slices.Equal(interrupted, []string{"prefix/a.txt"}) {
+		t.Errorf("Interrupted() = %q, want [prefix/a.txt]", interrupted)
+	}
+	if failures := results.Failures(); len(failures) != 0 {
+		t.Errorf("Failures() = %v, want none", failures)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var total, finished, skipped atomic.Int64
+	total.Store(10)
+	finished.Store(3)
+	skipped.Store(2)
+
+	if got := Progress(&total, &finished, nil, nil); got != "(3/10)" {
+		t.Errorf("Progress() = %q, want %q", got, "(3/10)")
+	}
+	expected := "(5/10, 2 skipped, concurrency 4)"
+	if got := Progress(&total, &finished, &skipped, NewConcurrency(4, 1, 8)); got != expected {
+		t.Errorf("Progress() = %q, want %q", got, expected)
+	}
+}
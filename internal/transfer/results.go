@@ -0,0 +1,61 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrIntegrity is returned when a downloaded file or a copy doesn't match the object it was made from
+var ErrIntegrity = errors.New("integrity check failed")
+
+// FileError describes a failure to transfer a single object or file
+type FileError struct {
+	Key  string // S3 object key
+	Op   string // Operation that failed, e.g. "mkdir", "download", "upload" or "copy"
+	Path string // Local path or s3:// URI involved in the failure
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s %s (%s): %v", e.Op, e.Key, e.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Results collects per-object failures reported by workers
+type Results struct {
+	mu          sync.Mutex
+	failures    []error
+	interrupted []string
+}
+
+// Add records a failed object
+func (r *Results) Add(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, err)
+}
+
+// Failures returns a copy of all recorded failures
+func (r *Results) Failures() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.failures...)
+}
+
+// AddInterrupted records an object whose transfer was abandoned because the run was cancelled
+func (r *Results) AddInterrupted(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interrupted = append(r.interrupted, key)
+}
+
+// Interrupted returns a copy of the keys whose transfers were abandoned
+func (r *Results) Interrupted() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.interrupted...)
+}
@@ -0,0 +1,130 @@
+package transfer
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+// SyncStrategy decides how an existing local file is compared with its S3 object
+// to find out whether it has to be downloaded again
+type SyncStrategy string
+
+const (
+	// SyncNone always downloads, overwriting existing files
+	SyncNone SyncStrategy = ""
+	// SyncSizeOnly skips files whose size matches the object
+	SyncSizeOnly SyncStrategy = "size-only"
+	// SyncSizeMtime skips files whose size matches and which are not older than the object
+	SyncSizeMtime SyncStrategy = "size-mtime"
+	// SyncChecksum skips files whose size and MD5 match the object's ETag.
+	// Multipart ETags are not a plain MD5, those objects are compared like SyncSizeMtime.
+	SyncChecksum SyncStrategy = "checksum"
+)
+
+// ParseSyncStrategy validates a sync strategy name
+func ParseSyncStrategy(name string) (SyncStrategy, error) {
+	switch strategy := SyncStrategy(name); strategy {
+	case SyncNone, SyncSizeOnly, SyncSizeMtime, SyncChecksum:
+		return strategy, nil
+	default:
+		return SyncNone, fmt.Errorf("unknown sync strategy %q, expected one of %s, %s or %s",
+			name, SyncSizeOnly, SyncSizeMtime, SyncChecksum)
+	}
+}
+
+// Unchanged reports whether the local file at path already matches the object.
+// A missing local file is never unchanged.
+func (s SyncStrategy) Unchanged(path string, obj s3ops.ObjectInfo) (bool, error) {
+	if s == SyncNone {
+		return false, nil
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() || info.Size() != obj.Size {
+		return false, nil
+	}
+
+	switch {
+	case s == SyncSizeOnly:
+		return true, nil
+	case s == SyncChecksum && obj.ETag != "" && !obj.IsMultipart():
+		sum, err := FileMD5(path)
+		if err != nil {
+			return false, err
+		}
+		return sum == obj.ETag, nil
+	default:
+		// Downloaded files get the object's LastModified as their mtime,
+		// so a newer object means it changed since the last download
+		return !obj.LastModified.After(info.ModTime()), nil
+	}
+}
+
+// Uploaded reports whether the object already holds the local file at path, described by file with its size
+// and modification time, so that uploading it again can be skipped
+func (s SyncStrategy) Uploaded(path string, file, obj s3ops.ObjectInfo) (bool, error) {
+	if s == SyncNone || file.Size != obj.Size {
+		return false, nil
+	}
+
+	switch {
+	case s == SyncSizeOnly:
+		return true, nil
+	case s == SyncChecksum && obj.ETag != "" && !obj.IsMultipart():
+		sum, err := FileMD5(path)
+		if err != nil {
+			return false, err
+		}
+		return sum == obj.ETag, nil
+	default:
+		// Objects get their LastModified when they are uploaded,
+		// so a file modified later changed since the last upload
+		return !file.LastModified.After(obj.LastModified), nil
+	}
+}
+
+// Copied reports whether the target object already holds a copy of the source object,
+// so that copying it again can be skipped
+func (s SyncStrategy) Copied(src, dst s3ops.ObjectInfo) bool {
+	if s == SyncNone || src.Size != dst.Size {
+		return false
+	}
+
+	switch {
+	case s == SyncSizeOnly:
+		return true
+	case s == SyncChecksum && src.ETag != "" && !src.IsMultipart() && !dst.IsMultipart():
+		// Single-part copies keep the ETag, unless the target is encrypted with KMS
+		return src.ETag == dst.ETag
+	default:
+		// Copies get their LastModified when they are made,
+		// so a source modified later changed since the last copy
+		return !src.LastModified.After(dst.LastModified)
+	}
+}
+
+// FileMD5 returns the hex encoded MD5 digest of a file
+func FileMD5(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
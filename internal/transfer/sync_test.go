@@ -0,0 +1,178 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	s3ops "github.com/user/s3cpbp/internal/s3"
+)
+
+func TestParseSyncStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected SyncStrategy
+		wantErr  bool
+	}{
+		{"", SyncNone, false},
+		{"size-only", SyncSizeOnly, false},
+		{"size-mtime", SyncSizeMtime, false},
+		{"checksum", SyncChecksum, false},
+		{"etag", SyncNone, true},
+	}
+
+	for _, tt := range tests {
+		strategy, err := ParseSyncStrategy(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSyncStrategy(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if strategy != tt.expected {
+			t.Errorf("ParseSyncStrategy(%q) = %q, want %q", tt.name, strategy, tt.expected)
+		}
+	}
+}
+
+func TestSyncStrategyUnchanged(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sync_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Local file as left behind by an earlier download
+	content := []byte("hello world")
+	contentMD5 := "5eb63bbbe01eeed093cb22bb8f5acdc3"
+	mtime := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	localPath := filepath.Join(tempDir, "file.txt")
+	if err := os.WriteFile(localPath, content, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chtimes(localPath, mtime, mtime); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+
+	object := func(size int64, modified time.Time, etag string) s3ops.ObjectInfo {
+		return s3ops.ObjectInfo{
+			Key:          "file.txt",
+			Size:         size,
+			LastModified: modified,
+			ETag:         etag,
+		}
+	}
+	size := int64(len(content))
+
+	tests := []struct {
+		name      string
+		strategy  SyncStrategy
+		path      string
+		object    s3ops.ObjectInfo
+		unchanged bool
+	}{
+		{"sync disabled", SyncNone, localPath, object(size, mtime, contentMD5), false},
+		{"missing local file", SyncSizeOnly, filepath.Join(tempDir, "missing.txt"), object(size, mtime, contentMD5), false},
+		{"size-only same size", SyncSizeOnly, localPath, object(size, mtime.Add(time.Hour), "other"), true},
+		{"size-only different size", SyncSizeOnly, localPath, object(size+1, mtime, contentMD5), false},
+		{"size-mtime unchanged", SyncSizeMtime, localPath, object(size, mtime, contentMD5), true},
+		{"size-mtime older object", SyncSizeMtime, localPath, object(size, mtime.Add(-time.Hour), contentMD5), true},
+		{"size-mtime newer object", SyncSizeMtime, localPath, object(size, mtime.Add(time.Hour), contentMD5), false},
+		{"checksum matching MD5", SyncChecksum, localPath, object(size, mtime.Add(time.Hour), contentMD5), true},
+		{"checksum different MD5", SyncChecksum, localPath, object(size, mtime, "00000000000000000000000000000000"), false},
+		{"checksum multipart falls back to mtime", SyncChecksum, localPath, object(size, mtime, "abc-2"), true},
+		{"checksum multipart newer object", SyncChecksum, localPath, object(size, mtime.Add(time.Hour), "abc-2"), false},
+		{"directory in place of file", SyncSizeOnly, tempDir, object(size, mtime, contentMD5), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unchanged, err := tt.strategy.Unchanged(tt.path, tt.object)
+			if err != nil {
+				t.Fatalf("Unchanged() returned unexpected error: %v", err)
+			}
+			if unchanged != tt.unchanged {
+				t.Errorf("Unchanged() = %v, want %v", unchanged, tt.unchanged)
+			}
+		})
+	}
+}
+
+func TestSyncStrategyUploaded(t *testing.T) {
+	content := []byte("hello world")
+	contentMD5 := "5eb63bbbe01eeed093cb22bb8f5acdc3"
+	localPath := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(localPath, content, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	uploaded := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	size := int64(len(content))
+	file := func(size int64, modified time.Time) s3ops.ObjectInfo {
+		return s3ops.ObjectInfo{Key: "file.txt", Size: size, LastModified: modified}
+	}
+	object := s3ops.ObjectInfo{Key: "file.txt", Size: size, LastModified: uploaded, ETag: contentMD5}
+
+	tests := []struct {
+		name      string
+		strategy  SyncStrategy
+		file      s3ops.ObjectInfo
+		object    s3ops.ObjectInfo
+		unchanged bool
+	}{
+		{"sync disabled", SyncNone, file(size, uploaded), object, false},
+		{"size-only same size", SyncSizeOnly, file(size, uploaded.Add(time.Hour)), object, true},
+		{"size-only different size", SyncSizeOnly, file(size+1, uploaded), object, false},
+		{"size-mtime file older than the object", SyncSizeMtime, file(size, uploaded.Add(-time.Hour)), object, true},
+		{"size-mtime file modified after the upload", SyncSizeMtime, file(size, uploaded.Add(time.Hour)), object, false},
+		{"checksum matching MD5", SyncChecksum, file(size, uploaded.Add(time.Hour)), object, true},
+		{"checksum different MD5", SyncChecksum, file(size, uploaded), s3ops.ObjectInfo{Size: size, LastModified: uploaded, ETag: "00000000000000000000000000000000"}, false},
+		{"checksum multipart falls back to mtime", SyncChecksum, file(size, uploaded), s3ops.ObjectInfo{Size: size, LastModified: uploaded, ETag: "abc-2"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unchanged, err := tt.strategy.Uploaded(localPath, tt.file, tt.object)
+			if err != nil {
+				t.Fatalf("Uploaded() returned unexpected error: %v", err)
+			}
+			if unchanged != tt.unchanged {
+				t.Errorf("Uploaded() = %v, want %v", unchanged, tt.unchanged)
+			}
+		})
+	}
+}
+
+func TestSyncStrategyCopied(t *testing.T) {
+	copied := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	src := s3ops.ObjectInfo{Key: "a.json", Size: 11, LastModified: copied.Add(-time.Hour), ETag: "5eb63bbbe01eeed093cb22bb8f5acdc3"}
+	dst := s3ops.ObjectInfo{Key: "copy/a.json", Size: 11, LastModified: copied, ETag: "5eb63bbbe01eeed093cb22bb8f5acdc3"}
+	modified := src
+	modified.LastModified = copied.Add(time.Hour)
+	resized := src
+	resized.Size = 12
+	multipart := dst
+	multipart.ETag = "abc-2"
+
+	tests := []struct {
+		name      string
+		strategy  SyncStrategy
+		src, dst  s3ops.ObjectInfo
+		unchanged bool
+	}{
+		{"sync disabled", SyncNone, src, dst, false},
+		{"size-only same size", SyncSizeOnly, modified, dst, true},
+		{"size-only different size", SyncSizeOnly, resized, dst, false},
+		{"size-mtime source older than the copy", SyncSizeMtime, src, dst, true},
+		{"size-mtime source modified after the copy", SyncSizeMtime, modified, dst, false},
+		{"checksum matching ETag", SyncChecksum, modified, dst, true},
+		{"checksum different ETag", SyncChecksum, src, s3ops.ObjectInfo{Size: 11, LastModified: copied, ETag: "00000000000000000000000000000000"}, false},
+		{"checksum multipart copy falls back to mtime", SyncChecksum, modified, multipart, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.strategy.Copied(tt.src, tt.dst); got != tt.unchanged {
+				t.Errorf("Copied() = %v, want %v", got, tt.unchanged)
+			}
+		})
+	}
+}
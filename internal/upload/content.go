@@ -0,0 +1,45 @@
+package upload
+
+import (
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// contentTypes covers data formats the system's MIME tables often lack, they take precedence over those tables
+var contentTypes = map[string]string{
+	".avro":    "application/avro",
+	".csv":     "text/csv",
+	".gz":      "application/gzip",
+	".jsonl":   "application/x-ndjson",
+	".log":     "text/plain",
+	".md":      "text/markdown",
+	".ndjson":  "application/x-ndjson",
+	".orc":     "application/x-orc",
+	".parquet": "application/vnd.apache.parquet",
+	".tar":     "application/x-tar",
+	".tsv":     "text/tab-separated-values",
+	".txt":     "text/plain",
+	".yaml":    "application/yaml",
+	".yml":     "application/yaml",
+	".zip":     "application/zip",
+	".zst":     "application/zstd",
+}
+
+// ContentType guesses the Content-Type of a key from its extension, case-insensitive.
+// It returns nil for unknown extensions, which S3 stores as binary/octet-stream.
+func ContentType(key string) *string {
+	ext := strings.ToLower(path.Ext(key))
+	if ext == "" {
+		return nil
+	}
+	if contentType, ok := contentTypes[ext]; ok {
+		return aws.String(contentType)
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return aws.String(contentType)
+	}
+	return nil
+}
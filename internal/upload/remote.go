@@ -0,0 +1,29 @@
+package upload
+
+import (
+	"context"
+	"sync/atomic"
+
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/source"
+)
+
+// RemoteObjects collects the objects a source lists by key, for the workers to compare the files with.
+// An error means the listing is incomplete, and files missing from it would be uploaded again.
+func RemoteObjects(ctx context.Context, objects source.Source) (map[string]s3ops.ObjectInfo, error) {
+	foundFilesChan := make(chan s3ops.ObjectInfo, 1000)
+	var total atomic.Int64
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- objects.Objects(ctx, nil, foundFilesChan, &total)
+	}()
+
+	remote := make(map[string]s3ops.ObjectInfo)
+	for obj := range foundFilesChan {
+		remote[obj.Key] = obj
+	}
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+	return remote, nil
+}
@@ -0,0 +1,174 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+const (
+	// MinPartSize is the smallest part S3 accepts in multipart uploads, but for the last one
+	MinPartSize = manager.MinUploadPartSize
+	// MaxPartSize is the largest part S3 accepts in multipart uploads
+	MaxPartSize = 5 * 1024 * 1024 * 1024
+)
+
+// Uploader defines an interface for the S3 upload functionality
+type Uploader interface {
+	Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+}
+
+// Worker represents an upload worker
+type Worker struct {
+	ID            int
+	Uploader      Uploader
+	Bucket        string
+	Prefix        string // Joined with the relative path of each file to form its key, see Key
+	Root          string // Local directory the files are relative to
+	FilesChan     <-chan s3ops.ObjectInfo
+	WaitGroup     *sync.WaitGroup
+	TotalFiles    *atomic.Int64
+	FinishedFiles *atomic.Int64
+	SkippedFiles  *atomic.Int64 // Required when Sync is set
+	Sync          transfer.SyncStrategy
+	Remote        map[string]s3ops.ObjectInfo // Objects under the prefix by key, required when Sync is set
+	Verify        bool                        // Have S3 check a CRC32 checksum of the uploaded data
+	Options       s3ops.WriteOptions
+	Retry         retry.Policy
+	Concurrency   *transfer.Concurrency // Limits the uploads in flight across workers, optional
+	Results       *transfer.Results
+}
+
+// Key returns the key a file is uploaded to: its relative path under the prefix, which is treated as a directory
+// like aws s3 cp --recursive does, so "logs" and "logs/" both upload "a.json" to "logs/a.json"
+func Key(prefix, relative string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix + relative
+}
+
+// Start starts the upload worker.
+// It stops taking new files as soon as the context is cancelled.
+func (w *Worker) Start(ctx context.Context) {
+	defer w.WaitGroup.Done()
+
+	loop := transfer.Loop{
+		ID:    w.ID,
+		Files: w.FilesChan,
+		Skip:  w.skip,
+		Transfer: func(ctx context.Context, file s3ops.ObjectInfo) error {
+			return w.uploadFile(ctx, w.localPath(file), Key(w.Prefix, file.Key))
+		},
+		Concurrency: w.Concurrency,
+		Results:     w.Results,
+	}
+	loop.Run(ctx)
+}
+
+// localPath returns the path of a file found under the root
+func (w *Worker) localPath(file s3ops.ObjectInfo) string {
+	return filepath.Join(w.Root, filepath.FromSlash(file.Key))
+}
+
+// skip reports whether the object of a file is already up to date, counting and logging it as skipped
+func (w *Worker) skip(file s3ops.ObjectInfo) bool {
+	key := Key(w.Prefix, file.Key)
+	obj, ok := w.Remote[key]
+	if !ok {
+		return false
+	}
+	localPath := w.localPath(file)
+	unchanged, err := w.Sync.Uploaded(localPath, file, obj)
+	if err != nil {
+		log.Printf("Worker %d: Failed to compare %s with the object, uploading it: %v", w.ID, localPath, err)
+	}
+	if unchanged {
+		w.SkippedFiles.Add(1)
+		log.Printf("Worker %d %s, skipped unchanged %s", w.ID, w.progress(), key)
+	}
+	return unchanged
+}
+
+// uploadFile uploads a single file to S3, in parts if it is larger than the uploader's part size.
+// Any failure is returned as a *transfer.FileError so the run can carry on with other files.
+func (w *Worker) uploadFile(ctx context.Context, localPath, key string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return &transfer.FileError{Key: key, Op: "open", Path: localPath, Err: err}
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return &transfer.FileError{Key: key, Op: "stat", Path: localPath, Err: err}
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:               aws.String(w.Bucket),
+		Key:                  aws.String(key),
+		Body:                 file,
+		ContentType:          ContentType(key),
+		StorageClass:         w.Options.StorageClass,
+		ServerSideEncryption: w.Options.SSE,
+		Tagging:              w.Options.Tagging(),
+		Metadata:             w.Options.Metadata,
+	}
+	if w.Options.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(w.Options.SSEKMSKeyID)
+	}
+	if w.Verify {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+	}
+
+	err = transfer.Attempt(ctx, w.Retry, w.Concurrency, func(attempt int) (int64, error) {
+		// Send the file from its start again
+		if attempt > 1 {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return 0, retry.Permanent(err)
+			}
+		}
+		if _, err := w.Uploader.Upload(ctx, input); err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}, func(attempt int, err error) {
+		log.Printf("Worker %d: Attempt %d: Failed to upload %s: %v", w.ID, attempt, key, err)
+	})
+	if err != nil {
+		return &transfer.FileError{Key: key, Op: "upload", Path: localPath, Err: err}
+	}
+
+	// Increment counter and log progress only on success
+	w.FinishedFiles.Add(1)
+
+	log.Printf("Worker %d %s, uploaded %s", w.ID, w.progress(), key)
+	return nil
+}
+
+// progress formats the progress of the run for the worker's log lines
+func (w *Worker) progress() string {
+	return transfer.Progress(w.TotalFiles, w.FinishedFiles, w.SkippedFiles, w.Concurrency)
+}
+
+// CreateUploader creates a new S3 uploader that sends files larger than partSize in parts of that size.
+// The uploader grows the parts of files too large for S3's limit of 10,000 parts.
+func CreateUploader(client *s3.Client, partSize int64) *manager.Uploader {
+	return manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = 3 // 3 go routines per file upload
+	})
+}
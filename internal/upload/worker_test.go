@@ -0,0 +1,248 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/user/s3cpbp/internal/retry"
+	s3ops "github.com/user/s3cpbp/internal/s3"
+	"github.com/user/s3cpbp/internal/transfer"
+)
+
+// mockUploader implements the Uploader interface for testing
+type mockUploader struct {
+	uploadFunc func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+}
+
+func (m *mockUploader) Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	return m.uploadFunc(ctx, input, opts...)
+}
+
+func TestCreateUploader(t *testing.T) {
+	uploader := CreateUploader(s3.NewFromConfig(aws.Config{}), 16*1024*1024)
+	if uploader == nil || uploader.PartSize != 16*1024*1024 {
+		t.Errorf("CreateUploader() = %+v, want a part size of 16 MiB", uploader)
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		prefix, relative, expected string
+	}{
+		{"", "a.json", "a.json"},
+		{"logs/", "a.json", "logs/a.json"},
+		{"logs", "2024/a.json", "logs/2024/a.json"},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.prefix, tt.relative); got != tt.expected {
+			t.Errorf("Key(%q, %q) = %q, want %q", tt.prefix, tt.relative, got, tt.expected)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := map[string]string{
+		"logs/a.json":       "application/json",
+		"data/b.PARQUET":    "application/vnd.apache.parquet",
+		"data/c.csv":        "text/csv",
+		"index.html":        "text/html; charset=utf-8",
+		"archive.tar.gz":    "application/gzip",
+		"no-extension":      "",
+		"data/d.unknownext": "",
+	}
+	for key, expected := range tests {
+		if got := aws.ToString(ContentType(key)); got != expected {
+			t.Errorf("ContentType(%q) = %q, want %q", key, got, expected)
+		}
+	}
+}
+
+// TestWorkerStart tests that files are uploaded under the prefix with the write options, skipping unchanged ones
+func TestWorkerStart(t *testing.T) {
+	root := t.TempDir()
+	modified := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	files := map[string]string{"a.json": "aaa", "sub/b.csv": "bb", "sub/c.txt": "unchanged"}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	filesChan := make(chan s3ops.ObjectInfo, len(files))
+	for name, content := range files {
+		filesChan <- s3ops.ObjectInfo{Key: name, Size: int64(len(content)), LastModified: modified}
+	}
+	close(filesChan)
+
+	// c.txt was uploaded after its last change, a.json has changed size since
+	remote := map[string]s3ops.ObjectInfo{
+		"out/a.json":    {Key: "out/a.json", Size: 1, LastModified: modified.Add(time.Hour)},
+		"out/sub/c.txt": {Key: "out/sub/c.txt", Size: 9, LastModified: modified.Add(time.Hour)},
+	}
+
+	var (
+		wg            sync.WaitGroup
+		mu            sync.Mutex
+		totalFiles    atomic.Int64
+		finishedFiles atomic.Int64
+		skippedFiles  atomic.Int64
+		uploaded      = map[string]*s3.PutObjectInput{}
+	)
+	totalFiles.Store(int64(len(files)))
+	wg.Add(1)
+
+	options := s3ops.WriteOptions{
+		StorageClass: types.StorageClassStandardIa,
+		SSE:          types.ServerSideEncryptionAwsKms,
+		SSEKMSKeyID:  "alias/uploads",
+		Tags:         map[string]string{"team": "data", "env": "prod"},
+		Metadata:     map[string]string{"source": "test"},
+	}
+	worker := Worker{
+		ID: 1,
+		Uploader: &mockUploader{
+			uploadFunc: func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+				if _, err := io.ReadAll(input.Body); err != nil {
+					return nil, err
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				uploaded[aws.ToString(input.Key)] = input
+				return &manager.UploadOutput{}, nil
+			},
+		},
+		Bucket:        "test-bucket",
+		Prefix:        "out",
+		Root:          root,
+		FilesChan:     filesChan,
+		WaitGroup:     &wg,
+		TotalFiles:    &totalFiles,
+		FinishedFiles: &finishedFiles,
+		SkippedFiles:  &skippedFiles,
+		Sync:          transfer.SyncSizeMtime,
+		Remote:        remote,
+		Verify:        true,
+		Options:       options,
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	worker.Start(context.Background())
+	wg.Wait()
+
+	var keys []string
+	for key := range uploaded {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"out/a.json", "out/sub/b.csv"}) {
+		t.Fatalf("uploaded %q, want out/a.json and out/sub/b.csv", keys)
+	}
+	if finishedFiles.Load() != 2 || skippedFiles.Load() != 1 {
+		t.Errorf("finished %d, skipped %d, want 2 and 1", finishedFiles.Load(), skippedFiles.Load())
+	}
+
+	input := uploaded["out/sub/b.csv"]
+	if aws.ToString(input.Bucket) != "test-bucket" || aws.ToString(input.ContentType) != "text/csv" {
+		t.Errorf("Upload() bucket = %q, content type = %q, want test-bucket and text/csv", aws.ToString(input.Bucket), aws.ToString(input.ContentType))
+	}
+	if input.StorageClass != options.StorageClass || input.ServerSideEncryption != options.SSE || aws.ToString(input.SSEKMSKeyId) != "alias/uploads" {
+		t.Errorf("Upload() storage class = %q, SSE = %q with key %q", input.StorageClass, input.ServerSideEncryption, aws.ToString(input.SSEKMSKeyId))
+	}
+	if aws.ToString(input.Tagging) != "env=prod&team=data" || input.Metadata["source"] != "test" {
+		t.Errorf("Upload() tagging = %q, metadata = %v", aws.ToString(input.Tagging), input.Metadata)
+	}
+	if input.ChecksumAlgorithm != types.ChecksumAlgorithmCrc32 {
+		t.Errorf("Upload() checksum algorithm = %q, want CRC32", input.ChecksumAlgorithm)
+	}
+}
+
+// TestUploadFile_Retry tests that failed uploads are retried from the start of the file
+// and that permanent errors fail fast
+func TestUploadFile_Retry(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		wantErr          bool
+	}{
+		{"transient errors are retried", []error{errors.New("connection reset by peer"), errors.New("connection reset by peer")}, 3, false},
+		{"denied upload fails fast", []error{&smithy.GenericAPIError{Code: "AccessDenied"}}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				attempts      int
+				finishedFiles atomic.Int64
+				totalFiles    atomic.Int64
+				retries       atomic.Int64
+				results       transfer.Results
+			)
+			worker := Worker{
+				ID: 2,
+				Uploader: &mockUploader{
+					uploadFunc: func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+						attempts++
+						// Every attempt must send the whole file
+						body, err := io.ReadAll(input.Body)
+						if err != nil || string(body) != "content" {
+							t.Errorf("attempt %d sent %q, %v, want the whole file", attempts, body, err)
+						}
+						if attempts <= len(tt.errs) {
+							return nil, tt.errs[attempts-1]
+						}
+						return &manager.UploadOutput{}, nil
+					},
+				},
+				Bucket:        "test-bucket",
+				TotalFiles:    &totalFiles,
+				FinishedFiles: &finishedFiles,
+				Retry:         retry.Policy{MaxAttempts: 5, Retries: &retries},
+				Results:       &results,
+			}
+
+			err := worker.uploadFile(context.Background(), path, "file.txt")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("uploadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var fileErr *transfer.FileError
+			if err != nil && (!errors.As(err, &fileErr) || fileErr.Op != "upload" || fileErr.Key != "file.txt") {
+				t.Errorf("uploadFile() error = %v, want an upload FileError for file.txt", err)
+			}
+			if attempts != tt.expectedAttempts {
+				t.Errorf("Upload attempts = %d, want %d", attempts, tt.expectedAttempts)
+			}
+			if retries.Load() != int64(tt.expectedAttempts-1) {
+				t.Errorf("Retries = %d, want %d", retries.Load(), tt.expectedAttempts-1)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Queue hands out work items, such as directories to walk or prefixes to list, to a fixed number of workers.
+// Processing an item may queue more items, the work is done once every queued item is processed.
+type Queue[T any] struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   []T
+	pending int // Items queued or being processed
+	workers int
+	err     error
+}
+
+// Run processes the first item and every item queued while processing, with up to workers items at once.
+// The first failure stops the other workers and is returned, unless the context was cancelled first.
+func Run[T any](ctx context.Context, workers int, first T, process func(ctx context.Context, q *Queue[T], item T) error) error {
+	// The first failure stops the other workers
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	q := &Queue[T]{items: []T{first}, pending: 1, workers: max(workers, 1)}
+	q.cond = sync.NewCond(&q.mu)
+	stop := context.AfterFunc(workCtx, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.cond.Broadcast()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				item, ok := q.next(workCtx)
+				if !ok {
+					return
+				}
+				err := process(workCtx, q, item)
+				if err != nil {
+					cancel()
+				}
+				q.done(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if q.err != nil && !errors.Is(q.err, context.Canceled) {
+		return q.err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return q.err
+}
+
+// next waits for an item to process. It returns false once every item is processed or the work was stopped.
+func (q *Queue[T]) next(ctx context.Context) (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && q.pending > 0 && ctx.Err() == nil {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 || ctx.Err() != nil {
+		var none T
+		return none, false
+	}
+
+	item := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return item, true
+}
+
+// Push queues a newly found item
+func (q *Queue[T]) Push(item T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, item)
+	q.pending++
+	q.cond.Signal()
+}
+
+// Idle reports whether fewer items are pending than there are workers, so that splitting up work would help
+func (q *Queue[T]) Idle() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending < q.workers
+}
+
+// done marks an item as processed, recording the first error
+func (q *Queue[T]) done(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending--
+	if err != nil && (q.err == nil || errors.Is(q.err, context.Canceled)) {
+		q.err = err
+	}
+	if q.pending == 0 || err != nil {
+		q.cond.Broadcast()
+	}
+}
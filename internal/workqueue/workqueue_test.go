@@ -0,0 +1,90 @@
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	// Every item below 40 queues its two children, like a directory with two subdirectories
+	var mu sync.Mutex
+	var processed []int
+	err := Run(context.Background(), 4, 1, func(ctx context.Context, q *Queue[int], item int) error {
+		mu.Lock()
+		processed = append(processed, item)
+		mu.Unlock()
+		if item < 40 {
+			q.Push(2 * item)
+			q.Push(2*item + 1)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run() returned unexpected error: %v", err)
+	}
+
+	slices.Sort(processed)
+	for i, item := range processed {
+		if item != i+1 {
+			t.Fatalf("Run() processed %v, want every item from 1 to 79 once", processed)
+		}
+	}
+	if len(processed) != 79 {
+		t.Errorf("Run() processed %d items, want 79", len(processed))
+	}
+}
+
+func TestRun_FirstErrorStops(t *testing.T) {
+	failure := errors.New("permission denied")
+	err := Run(context.Background(), 4, 1, func(ctx context.Context, q *Queue[int], item int) error {
+		if item == 3 {
+			return failure
+		}
+		// Keep queueing until the failure stops the workers
+		q.Push(2 * item)
+		q.Push(2*item + 1)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Run() error = %v, want %v", err, failure)
+	}
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := Run(ctx, 2, 1, func(ctx context.Context, q *Queue[int], item int) error {
+		cancel()
+		q.Push(item + 1)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestQueue_Idle(t *testing.T) {
+	checked := make(chan struct{})
+	err := Run(context.Background(), 2, 0, func(ctx context.Context, q *Queue[int], item int) error {
+		if item > 0 {
+			// Stay pending until the check is done
+			<-checked
+			return nil
+		}
+		if !q.Idle() {
+			t.Error("Idle() = false with one item pending and two workers")
+		}
+		q.Push(1)
+		if q.Idle() {
+			t.Error("Idle() = true with two items pending and two workers")
+		}
+		close(checked)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run() returned unexpected error: %v", err)
+	}
+}